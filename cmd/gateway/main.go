@@ -2,30 +2,62 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
 	"fmt"
+	"io"
+	"io/fs"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/tanmay/gateway/internal/analytics"
+	"github.com/tanmay/gateway/internal/apierror"
 	"github.com/tanmay/gateway/internal/config"
 	"github.com/tanmay/gateway/internal/dashboard"
+	"github.com/tanmay/gateway/internal/geoip"
 	"github.com/tanmay/gateway/internal/health"
 	"github.com/tanmay/gateway/internal/middleware"
+	"github.com/tanmay/gateway/internal/openapi"
 	"github.com/tanmay/gateway/internal/proxy"
+	"github.com/tanmay/gateway/internal/state"
+	"github.com/tanmay/gateway/web"
 )
 
 func main() {
+	dashboardDir := flag.String("dashboard-dir", "", "serve the dashboard frontend from this directory instead of the embedded build (for development)")
+	flag.Parse()
+
 	// Load configuration
 	cfg, err := config.LoadConfig("config.yml")
 	if err != nil {
 		log.Fatalf("failed to load config: %v", err)
 	}
 
+	if cfg.Server.ErrorDocsURL != "" {
+		apierror.SetDocsURL(cfg.Server.ErrorDocsURL)
+	}
+
+	// Open the store that carries runtime state across restarts
+	var stateStore state.Store
+	if cfg.State.Enabled {
+		fs, err := state.NewFileStore(cfg.State.Dir)
+		if err != nil {
+			log.Fatalf("failed to open state store: %v", err)
+		}
+		stateStore = fs
+	}
+
 	// Collect all backend URLs for health checking
 	var backendURLs []string
 	for _, route := range cfg.Routes {
@@ -34,33 +66,324 @@ func main() {
 
 	// Initialize health checker and start background checks
 	healthChecker := health.NewHealthChecker(backendURLs)
+	healthChecker.SetThresholds(cfg.HealthCheck.UnhealthyThreshold, cfg.HealthCheck.HealthyThreshold)
+	healthChecker.SetMaxBackoff(time.Duration(cfg.HealthCheck.MaxBackoff) * time.Second)
+	healthChecker.SetConcurrency(cfg.HealthCheck.Concurrency, time.Duration(cfg.HealthCheck.CycleTimeout)*time.Second)
+	healthChecker.SetMinHealthy(cfg.HealthCheck.MinHealthy)
+	if cfg.HealthCheck.FlapThreshold > 0 {
+		healthChecker.SetFlapDetection(cfg.HealthCheck.FlapThreshold, time.Duration(cfg.HealthCheck.FlapWindow)*time.Minute)
+	}
+	for _, b := range cfg.Backends {
+		hcCfg := b.HealthCheck
+		healthChecker.SetProbe(b.URL, health.Probe{
+			Type:           hcCfg.Type,
+			Path:           hcCfg.Path,
+			Method:         hcCfg.Method,
+			ExpectedStatus: hcCfg.ExpectedStatus,
+			ExpectBody:     hcCfg.ExpectBody,
+			Headers:        hcCfg.Headers,
+		})
+	}
+	healthChecker.SetTimeline(stateStore, time.Duration(cfg.HealthCheck.TimelineRetention)*time.Hour)
 	healthChecker.StartBackground(time.Duration(cfg.HealthCheck.Interval) * time.Second)
 
+	// Background loops to stop on shutdown, in reverse start order
+	stoppers := []func(){healthChecker.Stop}
+
 	// Create the reverse proxy handler (now with load balancing + health awareness)
 	proxyHandler := proxy.NewProxy(cfg, healthChecker)
 
 	// Initialize middleware
-	rateLimiter := middleware.NewRateLimiter(cfg.RateLimit.MaxTokens, cfg.RateLimit.RefillRate)
 	auth := middleware.NewAuth(cfg.Auth.APIKeys, cfg.Auth.JWTSecret)
-	circuitBreaker := middleware.NewCircuitBreaker(cfg.CircuitBreaker.Threshold, time.Duration(cfg.CircuitBreaker.Timeout)*time.Second)
+	if jwtCfg := cfg.Auth.JWT; jwtCfg.JWKSURL != "" {
+		refresh, _ := time.ParseDuration(jwtCfg.JWKSRefresh)
+		jwks := middleware.NewJWKS(jwtCfg.JWKSURL, refresh)
+		if err := jwks.Refresh(); err != nil {
+			log.Printf("[init] JWKS not available yet, will retry on first token: %v", err)
+		}
+		auth.SetJWKS(jwks)
+		log.Printf("[init] Verifying asymmetric JWTs against %s", jwtCfg.JWKSURL)
+	}
+	leeway, _ := time.ParseDuration(cfg.Auth.JWT.Leeway)
+	if err := auth.SetJWTPolicy(middleware.JWTPolicy{
+		Issuer:     cfg.Auth.JWT.Issuer,
+		Audience:   cfg.Auth.JWT.Audience,
+		Leeway:     leeway,
+		Algorithms: cfg.Auth.JWT.Algorithms,
+		RequireExp: cfg.Auth.JWT.RequireExp,
+	}); err != nil {
+		log.Fatalf("auth: %v", err)
+	}
+	for _, route := range cfg.Routes {
+		if route.Trusted == nil {
+			continue
+		}
+		policy, err := middleware.NewTrustedPolicy(route.Trusted.CIDRs, route.Trusted.Identities)
+		if err != nil {
+			log.Fatalf("route %s: %v", route.Path, err)
+		}
+		auth.SetTrustedPolicy(route.Path, policy)
+		log.Printf("[init] Route %s restricted to trusted callers", route.Path)
+	}
+	for _, route := range cfg.Routes {
+		if route.ForwardAuth == nil {
+			continue
+		}
+		timeout, _ := time.ParseDuration(route.ForwardAuth.Timeout)
+		fa, err := middleware.NewForwardAuth(route.ForwardAuth.URL, route.ForwardAuth.ResponseHeaders, timeout)
+		if err != nil {
+			log.Fatalf("route %s: %v", route.Path, err)
+		}
+		auth.SetForwardAuth(route.Path, fa)
+		log.Printf("[init] Route %s authorized by %s", route.Path, route.ForwardAuth.URL)
+	}
+	for i, k := range cfg.Auth.Keys {
+		var expires time.Time
+		if k.Expires != "" {
+			if expires, err = time.Parse(time.RFC3339, k.Expires); err != nil {
+				log.Fatalf("auth.keys[%d]: expires: %v", i, err)
+			}
+		}
+		if _, ok := cfg.Tiers[k.Tier]; k.Tier != "" && !ok {
+			log.Fatalf("auth.keys[%d]: unknown tier %q", i, k.Tier)
+		}
+		grant := middleware.Grant{Scopes: k.Scopes, Roles: k.Roles, Tier: k.Tier}
+		if k.Hash != "" {
+			err = auth.AddHashedAPIKey(k.Prefix, k.Hash, grant, expires)
+		} else {
+			err = auth.AddAPIKey(k.Key, grant, expires)
+		}
+		if err != nil {
+			log.Fatalf("auth.keys[%d]: %v", i, err)
+		}
+		if !expires.IsZero() {
+			log.Printf("[init] API key %s... retires at %s", k.Prefix+middleware.KeyPrefix(k.Key), expires.Format(time.RFC3339))
+		}
+	}
+	for _, route := range cfg.Routes {
+		if err := auth.SetRouteAuth(route.Path, route.Auth); err != nil {
+			log.Fatalf("route %s: %v", route.Path, err)
+		}
+		if len(route.RequiredScopes) > 0 || len(route.RequiredRoles) > 0 {
+			auth.SetRequirement(route.Path, middleware.Requirement{Scopes: route.RequiredScopes, Roles: route.RequiredRoles})
+			log.Printf("[init] Route %s requires scopes %v, roles %v", route.Path, route.RequiredScopes, route.RequiredRoles)
+		}
+		if route.Auth == middleware.AuthNone {
+			log.Printf("[init] Route %s is public (no auth)", route.Path)
+		}
+	}
+	var oidc *middleware.OIDC
+	needOIDC := func(what string) *middleware.OIDC {
+		if oidc == nil {
+			sessionTTL, _ := time.ParseDuration(cfg.Auth.OIDC.SessionTTL)
+			oidc, err = middleware.NewOIDC(middleware.OIDCConfig{
+				Issuer:       cfg.Auth.OIDC.Issuer,
+				ClientID:     cfg.Auth.OIDC.ClientID,
+				ClientSecret: cfg.Auth.OIDC.ClientSecret,
+				RedirectURL:  cfg.Auth.OIDC.RedirectURL,
+				Scopes:       cfg.Auth.OIDC.Scopes,
+				CookieSecret: cfg.Auth.OIDC.CookieSecret,
+				SessionTTL:   sessionTTL,
+			})
+			if err != nil {
+				log.Fatalf("%s: %v", what, err)
+			}
+		}
+		return oidc
+	}
+	for _, route := range cfg.Routes {
+		if !route.OIDC {
+			continue
+		}
+		auth.SetOIDC(route.Path, needOIDC("route "+route.Path))
+		log.Printf("[init] Route %s requires OIDC login via %s", route.Path, cfg.Auth.OIDC.Issuer)
+	}
+	rateLimiter := newRateLimiter(cfg.RateLimit, auth)
+	routeLimiters := middleware.NewRouteRateLimiter(rateLimiter)
+	if al := cfg.RateLimit.Allowlist; len(al.CIDRs) > 0 || len(al.APIKeys) > 0 {
+		allowlist, err := middleware.NewAllowlist(al.CIDRs, al.APIKeys)
+		if err != nil {
+			log.Fatalf("ratelimit: %v", err)
+		}
+		routeLimiters.SetAllowlist(allowlist)
+		log.Printf("[init] Rate limit allowlist: %d networks, %d API keys", len(al.CIDRs), len(al.APIKeys))
+	}
+	routeLimiters.SetDefaultCost(middleware.RequestCost{Methods: upperKeys(cfg.RateLimit.MethodCosts)})
+	for name, tier := range cfg.Tiers {
+		if rl, ok := cfg.TierRateLimit(tier); ok {
+			routeLimiters.SetTier(name, newRateLimiter(rl, auth))
+			log.Printf("[init] Tier %s rate limit: burst %.0f, refill %.2f/s per key", name, rl.MaxTokens, rl.RefillRate)
+		}
+	}
+	routeLimiters.SetTierFunc(func(r *http.Request) string { return auth.KeyTier(r.Header.Get("X-API-Key")) })
+	var anonymousRoutes []string
+	for _, route := range cfg.Routes {
+		if route.Auth == middleware.AuthAnonymous {
+			anonymousRoutes = append(anonymousRoutes, route.Path)
+		}
+	}
+	if len(anonymousRoutes) > 0 {
+		rl := cfg.AnonymousRateLimit()
+		routeLimiters.SetAnonymous(newRateLimiter(rl, auth), anonymousRoutes)
+		log.Printf("[init] Anonymous access on %v: burst %.0f, refill %.2f/s per IP", anonymousRoutes, rl.MaxTokens, rl.RefillRate)
+	}
+	for _, route := range cfg.Routes {
+		rl, ok := cfg.RouteRateLimit(route)
+		if ok {
+			routeLimiters.SetRoute(route.Path, newRateLimiter(rl, auth))
+			log.Printf("[init] Route %s rate limit: burst %.0f, refill %.2f/s", route.Path, rl.MaxTokens, rl.RefillRate)
+		}
+		if route.Cost > 0 || len(route.MethodCosts) > 0 {
+			routeLimiters.SetCost(route.Path, middleware.RequestCost{Default: route.Cost, Methods: upperKeys(route.MethodCosts)})
+			maxCost := route.Cost
+			for _, c := range route.MethodCosts {
+				maxCost = max(maxCost, c)
+			}
+			if maxCost > rl.MaxTokens {
+				log.Printf("[init] warning: route %s cost %.0f exceeds its burst of %.0f; such requests are always rejected", route.Path, maxCost, rl.MaxTokens)
+			}
+		}
+	}
+	circuitBreaker := newCircuitBreaker(cfg.CircuitBreaker)
+	breakers := middleware.NewRouteCircuitBreaker(circuitBreaker)
+	for _, route := range cfg.Routes {
+		cb, own := cfg.RouteCircuitBreaker(route)
+		switch {
+		case !cb.IsEnabled():
+			breakers.Disable(route.Path)
+			log.Printf("[init] Route %s circuit breaker disabled", route.Path)
+		case own:
+			breakers.SetRoute(route.Path, newCircuitBreaker(cb))
+			log.Printf("[init] Route %s circuit breaker: threshold %d, timeout %ds", route.Path, cb.Threshold, cb.Timeout)
+		}
+	}
+
+	// Protection profiles tune breaker and limiter together per route
+	profiles := middleware.NewProfileManager(middleware.ProfileBalanced)
+	for _, route := range cfg.Routes {
+		if route.Profile == "" {
+			continue
+		}
+		if err := profiles.Set(route.Path, route.Profile); err != nil {
+			log.Fatalf("route %s: %v", route.Path, err)
+		}
+	}
+	breakers.SetProfiles(profiles)
+
+	// Retries share a per-route budget with the circuit breaker
+	retryWindow, _ := time.ParseDuration(cfg.RetryBudget.Window)
+	retryBudget := middleware.NewRetryBudget(retryWindow, cfg.RetryBudget.MinRetries)
+	retryBudget.SetProfiles(profiles)
+	breakers.SetRetryBudget(retryBudget)
+	proxyHandler.SetRetryBudget(retryBudget)
+
+	// Long-horizon quotas per API key, checked after auth
+	var quotas *middleware.QuotaManager
+	if cfg.Quotas.Enabled {
+		quotas = middleware.NewQuotaManager(middleware.QuotaLimits{Daily: cfg.Quotas.Daily, Monthly: cfg.Quotas.Monthly})
+		for key, l := range cfg.Quotas.Keys {
+			quotas.SetKeyLimits(key, middleware.QuotaLimits{Daily: l.Daily, Monthly: l.Monthly})
+		}
+		for name, tier := range cfg.Tiers {
+			if tier.Quota.Daily > 0 || tier.Quota.Monthly > 0 {
+				quotas.SetTier(name, middleware.QuotaLimits{Daily: tier.Quota.Daily, Monthly: tier.Quota.Monthly})
+			}
+		}
+		quotas.SetTierFunc(auth.KeyTier)
+		if stateStore == nil {
+			log.Println("[init] Quotas enabled without state persistence; usage resets on restart")
+		}
+	}
+
+	// Restore rate limiter and circuit breaker state from the previous run
+	if stateStore != nil {
+		restoreState(stateStore, rateLimiter, routeLimiters, circuitBreaker, breakers)
+		if quotas != nil {
+			restoreQuotas(stateStore, quotas)
+		}
+
+		syncInterval, _ := time.ParseDuration(cfg.State.SyncInterval)
+		if syncInterval <= 0 {
+			syncInterval = 30 * time.Second
+		}
+		ticker := time.NewTicker(syncInterval)
+		stopSync := make(chan struct{})
+		go func() {
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+				case <-stopSync:
+					return
+				}
+				saveState(stateStore, rateLimiter, routeLimiters, circuitBreaker, breakers)
+				if quotas != nil {
+					saveQuotas(stateStore, quotas)
+				}
+			}
+		}()
+		stoppers = append(stoppers, func() { close(stopSync) })
+		log.Printf("[init] State persistence enabled (dir: %s, sync every %s)", cfg.State.Dir, syncInterval)
+	}
 
 	// Initialize dashboard process manager, log store, and SSE broker early so middleware can use it
 	pm := dashboard.NewProcessManager()
-	logStore := dashboard.NewLogStore(1000)
-	broker := dashboard.NewBroker()
+	if err := pm.RegisterMetrics(prometheus.DefaultRegisterer); err != nil {
+		log.Printf("[init] failed to register process metrics: %v", err)
+	}
+	logStore := dashboard.NewLogStore(cfg.Dashboard.LogCapacity)
+	if lc := cfg.Dashboard.LogFile; lc != nil && lc.Path != "" {
+		logFile, err := dashboard.OpenLogFile(lc.Path, int64(lc.MaxSizeMB)<<20)
+		if err != nil {
+			log.Fatalf("dashboard: %v", err)
+		}
+		if err := logStore.SetLogFile(logFile); err != nil {
+			log.Printf("[init] failed to restore request logs: %v", err)
+		}
+		logFile.Start(time.Second)
+		stoppers = append(stoppers, logFile.Stop)
+		log.Printf("[init] Request logs persisted to %s", lc.Path)
+	}
+	broker := dashboard.NewBroker(cfg.Dashboard.SSEBuffer)
+	sseHeartbeat, _ := time.ParseDuration(cfg.Dashboard.SSEHeartbeat)
+	broker.SetHeartbeat(sseHeartbeat)
+
+	// GeoIP tagging of request logs and analytics
+	var geoDB *geoip.DB
+	if g := cfg.GeoIP; g.CountryDB != "" || g.ASNDB != "" {
+		geoDB, err = geoip.Open(g.CountryDB, g.ASNDB)
+		if err != nil {
+			log.Fatalf("geoip: %v", err)
+		}
+		logStore.SetGeoIP(func(ip string) (string, uint32) {
+			loc := geoDB.Lookup(ip)
+			return loc.Country, loc.ASN
+		})
+	}
 
 	// Hook ProcessManager events to the SSE broker
 	pm.OnStateChange = func(p dashboard.ManagedProcess) {
+		// Out of rotation until it passes its readiness check
+		if p.Status == dashboard.StatusStarting {
+			healthChecker.SetHealthy(fmt.Sprintf("http://localhost:%d", p.Port), false)
+		}
 		broker.Broadcast("process", p)
 	}
+	pm.OnReady = func(p dashboard.ManagedProcess) {
+		healthChecker.SetHealthy(fmt.Sprintf("http://localhost:%d", p.Port), true)
+	}
+	pm.OnRestart = func(e dashboard.RestartEvent) {
+		broker.Broadcast("process_restart", e)
+	}
 
 	// --- Phase 5: Adaptive Traffic Intelligence ---
 
-	// Collect route prefixes for traffic normalization
+	// Collect route prefixes for traffic normalization and per-route policies
 	var routePrefixes []string
 	for _, route := range cfg.Routes {
 		routePrefixes = append(routePrefixes, route.Path)
 	}
+	routeMatcher := middleware.NewRouteMatcher(routePrefixes)
 
 	// Initialize TrafficStore and TrafficRecorder
 	var trafficStore analytics.TrafficStore
@@ -73,52 +396,210 @@ func main() {
 		if retention <= 0 {
 			retention = 48 * time.Hour
 		}
-		trafficStore = analytics.NewMemoryTrafficStore(retention)
-		trafficStore.(*analytics.MemoryTrafficStore).StartCleanup()
+		bucketInterval, _ := time.ParseDuration(cfg.Analytics.BucketInterval)
+		instance := cfg.Analytics.Instance
+		if instance == "" {
+			instance, _ = os.Hostname()
+		}
+		var downsample []analytics.DownsampleTier
+		for _, tier := range cfg.Analytics.Downsample {
+			after, _ := time.ParseDuration(tier.After)
+			interval, _ := time.ParseDuration(tier.Interval)
+			downsample = append(downsample, analytics.DownsampleTier{After: after, Interval: interval})
+		}
+		trafficStore, err = analytics.OpenStore(cfg.Analytics.Store, cfg.Analytics.StoreDSN, analytics.StoreOptions{
+			Retention:  retention,
+			BucketSize: bucketInterval,
+			Instance:   instance,
+			Downsample: downsample,
+		})
+		if err != nil {
+			log.Fatalf("analytics store: %v", err)
+		}
+		logStore.SetSparklineBucket(trafficStore.BucketSize())
 
 		trafficRecorder = middleware.NewTrafficRecorder(trafficStore, routePrefixes)
+		maxRoutes := cfg.Analytics.MaxRoutes
+		if maxRoutes == 0 {
+			maxRoutes = 1000
+		}
+		trafficRecorder.SetRouteGrouping(cfg.Analytics.UnmatchedRoutes, maxRoutes)
+		if s := cfg.Analytics.Sampling; s != nil {
+			slow, _ := time.ParseDuration(s.SlowThreshold)
+			trafficRecorder.SetSampling(s.Rate, slow)
+			log.Printf("[init] Traffic sampling at %.3g (errors and requests over %s always kept)", s.Rate, slow)
+		}
 
 		// Initialize the Analyzer
 		analyzerInterval, _ := time.ParseDuration(cfg.Analytics.AnalyzerInterval)
+		analyzerWindow, _ := time.ParseDuration(cfg.Analytics.AnalyzerWindow)
+		thresholds := make(map[string]analytics.MetricThreshold, len(cfg.Analytics.Thresholds))
+		for metric, th := range cfg.Analytics.Thresholds {
+			thresholds[metric] = analytics.MetricThreshold{ZScore: th.ZScore, Direction: analytics.Direction(th.Direction)}
+		}
+		routeOverrides := make(map[string]analytics.RouteOverride)
+		for _, route := range cfg.Routes {
+			if ac := route.Anomaly; ac != nil {
+				window, _ := time.ParseDuration(ac.Window)
+				routeOverrides[route.Path] = analytics.RouteOverride{Window: window, ZScore: ac.ZScore, MinSamples: ac.MinSamples}
+			}
+		}
 		analyzer = analytics.NewAnalyzer(trafficStore, analytics.AnalyzerConfig{
 			Interval:        analyzerInterval,
-			Window:          1 * time.Hour,
+			Window:          analyzerWindow,
 			ZScoreThreshold: 3.0,
+			Seasonality:     analytics.Seasonality(cfg.Analytics.Seasonality),
+			SeasonalDays:    cfg.Analytics.SeasonalDays,
+			Thresholds:      thresholds,
+			Routes:          routeOverrides,
 		})
+		if cfg.Analytics.Seasonality != "" && retention < 48*time.Hour {
+			log.Printf("[analytics] seasonality needs at least 48h of retention to learn, have %s", retention)
+		}
+		if cs := cfg.Analytics.ColdStart; cs != nil {
+			analyzer.SetColdStart(analytics.ColdStartPolicy{
+				MinSamples:       cs.MinSamples,
+				RateLimit:        cs.RateLimit,
+				BreakerErrorRate: cs.BreakerErrorRate,
+			})
+		}
 		analyzer.Start()
+		stoppers = append(stoppers, analyzer.Stop)
 		log.Println("[init] Traffic analyzer started")
 
+		// The analyzer publishes anomalies on one channel; fan them out,
+		// starting with the dashboard stream
+		anomalySinks := []func(analytics.Anomaly){
+			func(anomaly analytics.Anomaly) { broker.Broadcast("anomaly", anomaly) },
+		}
+		var notifier *analytics.WebhookNotifier
+		if len(cfg.Analytics.Webhooks) > 0 {
+			hooks := make([]analytics.Webhook, len(cfg.Analytics.Webhooks))
+			for i, wh := range cfg.Analytics.Webhooks {
+				timeout, _ := time.ParseDuration(wh.Timeout)
+				hooks[i] = analytics.Webhook{
+					Name:     wh.Name,
+					URL:      wh.URL,
+					Template: wh.Template,
+					Secret:   wh.Secret,
+					Headers:  wh.Headers,
+					Retries:  wh.Retries,
+					Timeout:  timeout,
+				}
+			}
+			notifier, err = analytics.NewWebhookNotifier(hooks, instance)
+			if err != nil {
+				log.Fatalf("analytics webhooks: %v", err)
+			}
+			anomalySinks = append(anomalySinks, notifier.Notify)
+			log.Printf("[init] Anomaly webhooks enabled (%d)", len(hooks))
+		}
+		if oc := cfg.Analytics.OTLP; oc != nil {
+			interval, _ := time.ParseDuration(oc.Interval)
+			timeout, _ := time.ParseDuration(oc.Timeout)
+			otlpConfig := analytics.OTLPConfig{
+				Endpoint:    oc.Endpoint,
+				Headers:     oc.Headers,
+				Interval:    interval,
+				Timeout:     timeout,
+				ServiceName: oc.ServiceName,
+				Instance:    instance,
+			}
+			if oc.Prometheus {
+				otlpConfig.Gatherer = prometheus.DefaultGatherer
+			}
+			exporter, err := analytics.NewOTLPExporter(trafficStore, otlpConfig)
+			if err != nil {
+				log.Fatalf("analytics otlp: %v", err)
+			}
+			exporter.Start()
+			stoppers = append(stoppers, exporter.Stop)
+			anomalySinks = append(anomalySinks, exporter.NotifyAnomaly)
+			log.Printf("[init] OTLP export to %s enabled", oc.Endpoint)
+		}
+		go func() {
+			for anomaly := range analyzer.AnomalyChannel {
+				for _, sink := range anomalySinks {
+					sink(anomaly)
+				}
+			}
+		}()
+
 		// Wire analyzer into circuit breaker for dynamic thresholds
-		circuitBreaker.SetAnalyzer(analyzer)
+		breakers.SetAnalyzer(analyzer)
 
 		// Initialize analytics REST API
 		analyticsAPI = analytics.NewAnalyticsAPI(analyzer, trafficStore)
+		analyticsAPI.SetRecorderStats(trafficRecorder.Stats)
+		analyticsAPI.RegisterMetrics(prometheus.DefaultRegisterer)
+		analyticsAPI.SetBroadcast(broker.Broadcast)
+
+		if geoDB != nil {
+			geoStats := analytics.NewGeoStats(trafficStore.BucketSize(), min(retention, 24*time.Hour))
+			trafficRecorder.SetGeoIP(geoDB.Lookup, geoStats)
+			analyticsAPI.SetGeoStats(geoStats)
+		}
+
+		if len(cfg.Alerts.Rules) > 0 {
+			rules := make([]analytics.AlertRule, len(cfg.Alerts.Rules))
+			for i, rc := range cfg.Alerts.Rules {
+				holdFor, _ := time.ParseDuration(rc.For)
+				rules[i] = analytics.AlertRule{
+					Name:      rc.Name,
+					Route:     rc.Route,
+					Backend:   rc.Backend,
+					Condition: rc.Condition,
+					For:       holdFor,
+				}
+			}
+			alertInterval, _ := time.ParseDuration(cfg.Alerts.Interval)
+			alerts, err := analytics.NewAlertEngine(trafficStore, rules, alertInterval)
+			if err != nil {
+				log.Fatalf("alerts: %v", err)
+			}
+			if notifier != nil {
+				alerts.OnAlert(notifier.NotifyAlert)
+			}
+			alerts.Start()
+			stoppers = append(stoppers, alerts.Stop)
+			analyticsAPI.SetAlertStatus(alerts.Status)
+			log.Printf("[init] Alert rules enabled (%d)", len(rules))
+		}
 	}
 
 	// Build the rate limiting middleware (static or adaptive)
 	var rateLimitMiddleware middleware.Middleware
 	if cfg.AdaptiveRateLimit.Enabled && analyzer != nil {
 		learningPeriod, _ := time.ParseDuration(cfg.AdaptiveRateLimit.LearningPeriod)
-		adaptiveRL := middleware.NewAdaptiveRateLimiter(rateLimiter, analyzer, middleware.AdaptiveRateLimitConfig{
+		routeBaselines := make(map[string]string)
+		for _, route := range cfg.Routes {
+			if route.AdaptiveBaseline != "" {
+				routeBaselines[route.Path] = route.AdaptiveBaseline
+			}
+		}
+		adaptiveRL := middleware.NewAdaptiveRateLimiter(routeLimiters, analyzer, middleware.AdaptiveRateLimitConfig{
 			Enabled:        true,
 			Multiplier:     cfg.AdaptiveRateLimit.Multiplier,
 			MinLimit:       cfg.AdaptiveRateLimit.MinLimit,
 			MaxLimit:       cfg.AdaptiveRateLimit.MaxLimit,
 			LearningPeriod: learningPeriod,
+			Baseline:       cfg.AdaptiveRateLimit.Baseline,
+			RouteBaselines: routeBaselines,
+			HardMultiplier: cfg.AdaptiveRateLimit.HardMultiplier,
+			Shadow:         cfg.AdaptiveRateLimit.Shadow,
 		})
 
-		// Route resolver: maps a full path to its normalized route prefix
-		routeResolver := func(path string) string {
-			if trafficRecorder != nil {
-				return trafficRecorder.NormalizeRoute(path)
-			}
-			return path
+		adaptiveRL.SetProfiles(profiles)
+		rateLimitMiddleware = adaptiveRL.Middleware(routeMatcher.Resolve)
+		analyticsAPI.SetRateLimitStatus(adaptiveRL.Status)
+		if cfg.AdaptiveRateLimit.Shadow {
+			analyticsAPI.SetShadowRejections(adaptiveRL.ShadowRejections)
+			log.Println("[init] Adaptive rate limiter enabled in shadow mode (static limits enforced)")
+		} else {
+			log.Println("[init] Adaptive rate limiter enabled")
 		}
-
-		rateLimitMiddleware = adaptiveRL.Middleware(routeResolver)
-		log.Println("[init] Adaptive rate limiter enabled")
 	} else {
-		rateLimitMiddleware = rateLimiter.Middleware()
+		rateLimitMiddleware = routeLimiters.Middleware(routeMatcher.Resolve)
 	}
 
 	// Set up weighted load balancers if enabled
@@ -132,7 +613,14 @@ func main() {
 			}
 
 			wlb := proxy.NewWeightedLoadBalancer(backends, analyzer, healthChecker, rebalanceInterval)
+			hints := make(map[string]proxy.BackendHint, len(backends))
+			for _, b := range backends {
+				bc := cfg.Backend(b)
+				hints[b] = proxy.BackendHint{MaxRate: bc.MaxRate, Capacity: bc.Capacity}
+			}
+			wlb.SetBackendHints(hints)
 			wlb.StartRebalancing()
+			stoppers = append(stoppers, wlb.Stop)
 			proxyHandler.SetRouteSelector(route.Path, wlb)
 			weightedLBs = append(weightedLBs, wlb)
 			log.Printf("[init] Weighted LB enabled for %s", route.Path)
@@ -167,15 +655,64 @@ func main() {
 	middlewares = append(middlewares,
 		middleware.Logging(),
 		rateLimitMiddleware,
-		auth.Middleware(),
-		circuitBreaker.Middleware(),
+		auth.Middleware(routeMatcher.Resolve),
 	)
+	if quotas != nil {
+		middlewares = append(middlewares, quotas.Middleware(auth.ValidAPIKey))
+	}
+
+	// Duplicate/replay detection runs after auth so unauthenticated
+	// requests can't burn signatures
+	if cfg.Dedup.Enabled {
+		window, _ := time.ParseDuration(cfg.Dedup.Window)
+		keyFunc, _ := middleware.NewKeyFunc(cfg.RateLimit.Key, cfg.RateLimit.KeyHeader, auth)
+		dedup := middleware.NewDedupTracker(middleware.DedupConfig{
+			Window:           window,
+			SignatureHeaders: cfg.Dedup.SignatureHeaders,
+			FlagRate:         cfg.Dedup.FlagRate,
+		}, keyFunc)
+		for _, route := range cfg.Routes {
+			if route.ReplayProtection {
+				dedup.SetReplayProtection(route.Path)
+				log.Printf("[init] Route %s rejects replayed requests", route.Path)
+			}
+		}
+		if analyticsAPI != nil {
+			analyticsAPI.SetDuplicateStats(dedup.Stats)
+		}
+		middlewares = append(middlewares, dedup.Middleware(routeMatcher.Resolve))
+	}
+
+	// In-flight caps sit right in front of the breaker, so only requests
+	// about to reach a backend hold a slot
+	concurrency := middleware.NewConcurrencyLimiter()
+	capped := 0
+	for _, route := range cfg.Routes {
+		if route.MaxConcurrent > 0 {
+			concurrency.SetRoute(route.Path, route.MaxConcurrent)
+			log.Printf("[init] Route %s capped at %d concurrent requests", route.Path, route.MaxConcurrent)
+			capped++
+		}
+	}
+	if capped > 0 {
+		middlewares = append(middlewares, concurrency.Middleware(routeMatcher.Resolve))
+	}
+
+	middlewares = append(middlewares, breakers.Middleware(routeMatcher.Resolve))
 
 	handler := middleware.Chain(proxyHandler, middlewares...)
 
 	// Populate managed processes from config
 	for _, procCfg := range cfg.Processes {
-		if err := pm.Add(procCfg.ID, procCfg.Command, procCfg.Args, procCfg.Port); err != nil {
+		restart := dashboard.RestartPolicy{
+			Mode:        dashboard.RestartMode(procCfg.Restart),
+			MaxRestarts: procCfg.MaxRestarts,
+		}
+		restart.Backoff, _ = time.ParseDuration(procCfg.RestartBackoff)
+		restart.MaxBackoff, _ = time.ParseDuration(procCfg.RestartMaxBackoff)
+		opts := dashboard.ProcessOptions{Restart: restart, Env: procCfg.Env, Dir: procCfg.Dir, ReadyURL: procCfg.ReadyURL}
+		opts.ReadyTimeout, _ = time.ParseDuration(procCfg.ReadyTimeout)
+		if err := pm.Add(procCfg.ID, procCfg.Command, procCfg.Args, procCfg.Port, opts); err != nil {
 			log.Printf("Error adding process %s: %v", procCfg.ID, err)
 			continue
 		}
@@ -190,42 +727,142 @@ func main() {
 
 	// Hook HealthChecker events to the SSE broker
 	healthChecker.OnStateChange = func(url string, isHealthy bool) {
+		if isHealthy {
+			markProcessReady(pm, url)
+		}
 		broker.Broadcast("service", map[string]interface{}{
 			"url":     url,
 			"healthy": isHealthy,
+			"drained": healthChecker.IsDrained(url),
 		})
 	}
 
 	dashboardAPI := dashboard.NewAPI(pm, healthChecker, proxyHandler, logStore, broker)
-	dashboardAPI.StartMetricsBroadcast(5 * time.Second)
+	if trafficStore != nil {
+		dashboardAPI.SetTrafficStore(trafficStore)
+	}
+	dashboardAPI.SetProfileProvider(func() interface{} {
+		return map[string]interface{}{
+			"profiles": middleware.Profiles,
+			"routes":   profiles.Assignments(proxyHandler.RouteNames()),
+		}
+	}, profiles.Set)
+	dashboardAPI.SetRateLimitAdmin(routeLimiters.AdminHandler())
+	dashboardAPI.SetCircuitBreakerAdmin(breakers.AdminHandler())
+	breakers.SetOnStateChange(func(e middleware.BreakerEvent) {
+		broker.Broadcast("circuit_breaker", e)
+	})
+	metricsInterval, _ := time.ParseDuration(cfg.Dashboard.MetricsInterval)
+	dashboardAPI.SetMetricsDelta(cfg.Dashboard.MetricsDelta)
+	dashboardAPI.StartMetricsBroadcast(metricsInterval)
+	stoppers = append(stoppers, dashboardAPI.StopMetricsBroadcast)
 
 	// Register routes
 	mux := http.NewServeMux()
 	mux.Handle("/health", healthChecker.Handler()) // outside middleware chain — no auth/rate limit
-	mux.Handle("/metrics", promhttp.Handler())     // Prometheus metrics endpoint
-
-	// Analytics API (outside middleware chain)
-	if analyticsAPI != nil {
-		log.Println("[init] Analytics API enabled at /analytics/")
-		mux.Handle("/analytics/", http.StripPrefix("/analytics", analyticsAPI.Handler()))
+	mux.Handle("/livez", healthChecker.LivenessHandler())
+	mux.Handle("/readyz", healthChecker.ReadinessHandler())
+	mux.Handle("/metrics", promhttp.Handler()) // Prometheus metrics endpoint
+	mux.Handle("/openapi.json", openapi.Handler())
+	if quotas != nil {
+		mux.Handle("/quota", quotas.UsageHandler(auth.ValidAPIKey)) // consumers check their own usage
 	}
 
 	// Dashboard
+	var dashAuth *middleware.DashboardAuth
 	if cfg.Dashboard.Enabled {
 		log.Println("Dashboard enabled - UI hosted at /dashboard/")
-		mux.Handle("/dashboard/api/", http.StripPrefix("/dashboard/api", dashboardAPI.Handler()))
+		var dashboardHandler http.Handler = http.StripPrefix("/dashboard/api", dashboardAPI.Handler())
+		if ac := cfg.Dashboard.Auth; ac != nil {
+			var users []middleware.DashboardUser
+			for _, u := range ac.Users {
+				users = append(users, middleware.DashboardUser{Username: u.Username, PasswordHash: u.PasswordHash, Role: u.Role})
+			}
+			dashCfg := middleware.DashboardAuthConfig{
+				Users:        users,
+				Tokens:       ac.Tokens,
+				ViewerTokens: ac.ViewerTokens,
+				OIDCRole:     ac.OIDCRole,
+				CookieSecret: ac.CookieSecret,
+			}
+			dashCfg.SessionTTL, _ = time.ParseDuration(ac.SessionTTL)
+			if ac.OIDC {
+				dashCfg.OIDC = needOIDC("dashboard")
+			}
+			var err error
+			dashAuth, err = middleware.NewDashboardAuth(dashCfg)
+			if err != nil {
+				log.Fatalf("%v", err)
+			}
+			mux.Handle("/dashboard/api/login", dashAuth.LoginHandler())
+			mux.Handle("/dashboard/api/login/oidc", dashAuth.OIDCLoginHandler())
+			mux.Handle("/dashboard/api/logout", dashAuth.LogoutHandler())
+			mux.Handle("/dashboard/api/session", dashAuth.SessionHandler())
+			dashboardHandler = dashAuth.Middleware()(dashboardHandler)
+			log.Printf("[init] Dashboard API requires login (%d users, %d tokens, %d viewer tokens, oidc=%v)", len(ac.Users), len(ac.Tokens), len(ac.ViewerTokens), ac.OIDC)
+		}
+		mux.Handle("/dashboard/api/", dashboardHandler)
 		// Serve React frontend (ensure trailing slash matches React router/assets if applicable)
-		mux.Handle("/dashboard/", http.StripPrefix("/dashboard/", http.FileServer(http.Dir("web/dashboard/dist"))))
+		frontend := web.Dashboard()
+		if *dashboardDir != "" {
+			frontend = os.DirFS(*dashboardDir)
+			log.Printf("[init] Serving dashboard frontend from %s", *dashboardDir)
+		} else if _, err := fs.Stat(frontend, "index.html"); err != nil {
+			log.Println("[init] Dashboard frontend was not built into this binary (run npm run build in web/dashboard, then rebuild)")
+		}
+		mux.Handle("/dashboard/", http.StripPrefix("/dashboard/", http.FileServerFS(frontend)))
+	}
+
+	// Analytics API (outside middleware chain). Acknowledging and muting
+	// anomalies takes a dashboard admin login
+	if analyticsAPI != nil {
+		if dashAuth != nil {
+			analyticsAPI.SetMutationGuard(dashAuth.Middleware())
+		}
+		log.Println("[init] Analytics API enabled at /analytics/")
+		mux.Handle("/analytics/", http.StripPrefix("/analytics", analyticsAPI.Handler()))
+	}
+
+	if oidc != nil {
+		mux.Handle(oidc.CallbackPath(), oidc.CallbackHandler())
+		mux.Handle("/oauth2/logout", oidc.LogoutHandler())
 	}
 
 	mux.Handle("/", handler) // everything else goes through middleware
 
+	// Federation: aggregate peer gateways into this dashboard's API
+	if fedCfg := cfg.Dashboard.Federation; cfg.Dashboard.Enabled && len(fedCfg.Peers) > 0 {
+		peers := make([]dashboard.Peer, 0, len(fedCfg.Peers))
+		for _, p := range fedCfg.Peers {
+			peers = append(peers, dashboard.Peer{Name: p.Name, URL: p.URL, Token: p.Token})
+		}
+		timeout, _ := time.ParseDuration(fedCfg.Timeout)
+		federation := dashboard.NewFederation(fedCfg.Instance, peers, timeout)
+		federation.SetLocal(mux)
+		dashboardAPI.SetFederation(federation)
+		log.Printf("[init] Dashboard federation enabled with %d peers", len(peers))
+	}
+
 	// Setup graceful shutdown
 	serverCtx, stop := context.WithCancel(context.Background())
 	defer stop()
 
 	addr := fmt.Sprintf(":%d", cfg.Server.Port)
 	srv := &http.Server{Addr: addr, Handler: mux}
+	if cfg.Server.ClientCAFile != "" {
+		caPEM, err := os.ReadFile(cfg.Server.ClientCAFile)
+		if err != nil {
+			log.Fatalf("failed to read client CA: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			log.Fatalf("no certificates found in %s", cfg.Server.ClientCAFile)
+		}
+		srv.TLSConfig = &tls.Config{
+			ClientCAs:  pool,
+			ClientAuth: tls.VerifyClientCertIfGiven,
+		}
+	}
 
 	// Wait for interrupt signal to gracefully shutdown the server
 	go func() {
@@ -234,23 +871,193 @@ func main() {
 		<-sigChan
 
 		log.Println("Shutting down gateway and backend processes...")
-		pm.StopAll() // Kill all managed processes
+		healthChecker.SetReady(false) // fail /readyz first so traffic drains away
 
-		// Shutdown the HTTP server
+		// Drain in-flight requests first: they still count against quotas
+		// and limiters and record traffic, all persisted below
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 		if err := srv.Shutdown(ctx); err != nil {
 			log.Printf("HTTP server shutdown error: %v", err)
 		}
+		pm.StopAll() // Kill all managed processes
+
+		for i := len(stoppers) - 1; i >= 0; i-- {
+			stoppers[i]()
+		}
+		if trafficRecorder != nil && !trafficRecorder.Flush(5*time.Second) {
+			log.Printf("analytics: gave up waiting for queued traffic events")
+		}
+		if stateStore != nil {
+			saveState(stateStore, rateLimiter, routeLimiters, circuitBreaker, breakers)
+			if quotas != nil {
+				saveQuotas(stateStore, quotas)
+			}
+		}
+		if closer, ok := trafficStore.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				log.Printf("analytics store: %v", err)
+			}
+		}
 		stop()
 	}()
 
-	// Start the gateway server
+	// Start the gateway server. Bind first so /readyz only passes once the
+	// listener is actually accepting connections.
 	log.Printf("API Gateway starting on %s", addr)
-	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatalf("failed to listen on %s: %v", addr, err)
+	}
+	healthChecker.SetReady(true)
+	if cfg.Server.TLSCertFile != "" {
+		err = srv.ServeTLS(ln, cfg.Server.TLSCertFile, cfg.Server.TLSKeyFile)
+	} else {
+		err = srv.Serve(ln)
+	}
+	if err != http.ErrServerClosed {
 		log.Fatalf("HTTP server ListenAndServe: %v", err)
 	}
 
 	<-serverCtx.Done()
 	log.Println("Gateway shutdown complete")
 }
+
+// newRateLimiter builds a static limiter keyed as configured.
+func newRateLimiter(cfg config.RateLimitConfig, auth *middleware.Auth) *middleware.RateLimiter {
+	keyFunc, err := middleware.NewKeyFunc(cfg.Key, cfg.KeyHeader, auth)
+	if err != nil {
+		log.Fatalf("ratelimit: %v", err)
+	}
+	rl := middleware.NewRateLimiter(cfg.MaxTokens, cfg.RefillRate)
+	rl.SetKeyFunc(keyFunc)
+	if err := rl.SetAlgorithm(cfg.Algorithm); err != nil {
+		log.Fatalf("ratelimit: %v", err)
+	}
+	if err := rl.SetHeaders(cfg.Headers); err != nil {
+		log.Fatalf("ratelimit: %v", err)
+	}
+	idleTTL, _ := time.ParseDuration(cfg.IdleTTL)
+	rl.SetEviction(idleTTL, cfg.MaxBuckets)
+	return rl
+}
+
+// newCircuitBreaker builds a circuit breaker from its config block.
+func newCircuitBreaker(cfg config.CircuitBreakerConfig) *middleware.CircuitBreaker {
+	cb := middleware.NewCircuitBreaker(cfg.Threshold, time.Duration(cfg.Timeout)*time.Second)
+	cb.SetHalfOpen(cfg.SuccessThreshold, cfg.HalfOpenProbes)
+	window, _ := time.ParseDuration(cfg.Window)
+	cb.SetWindow(window)
+	return cb
+}
+
+// State snapshot keys used in the state store.
+const (
+	stateKeyRateLimit      = "ratelimit"
+	stateKeyRouteRateLimit = "ratelimit_routes"
+	stateKeyCircuitBreaker = "circuitbreaker"
+	stateKeyRouteBreakers  = "circuitbreaker_routes"
+	stateKeyQuotas         = "quotas"
+	stateKeyTierRateLimit  = "ratelimit_tiers"
+)
+
+// restoreState loads persisted limiter buckets and breaker states, if any.
+func restoreState(store state.Store, rl *middleware.RateLimiter, routes *middleware.RouteRateLimiter, cb *middleware.CircuitBreaker, breakers *middleware.RouteCircuitBreaker) {
+	var buckets map[string]middleware.BucketState
+	if ok, err := store.Load(stateKeyRateLimit, &buckets); err != nil {
+		log.Printf("[state] failed to restore rate limiter: %v", err)
+	} else if ok {
+		rl.Restore(buckets)
+		log.Printf("[state] restored %d rate limit buckets", len(buckets))
+	}
+
+	var routeBuckets map[string]map[string]middleware.BucketState
+	if ok, err := store.Load(stateKeyRouteRateLimit, &routeBuckets); err != nil {
+		log.Printf("[state] failed to restore route rate limiters: %v", err)
+	} else if ok {
+		routes.Restore(routeBuckets)
+		log.Printf("[state] restored rate limit buckets for %d routes", len(routeBuckets))
+	}
+
+	var tierBuckets map[string]map[string]middleware.BucketState
+	if ok, err := store.Load(stateKeyTierRateLimit, &tierBuckets); err != nil {
+		log.Printf("[state] failed to restore tier rate limiters: %v", err)
+	} else if ok {
+		routes.TierRestore(tierBuckets)
+		log.Printf("[state] restored rate limit buckets for %d tiers", len(tierBuckets))
+	}
+
+	var breaker middleware.BreakerState
+	if ok, err := store.Load(stateKeyCircuitBreaker, &breaker); err != nil {
+		log.Printf("[state] failed to restore circuit breaker: %v", err)
+	} else if ok {
+		cb.Restore(breaker)
+		log.Printf("[state] restored circuit breaker (state=%d)", breaker.State)
+	}
+
+	var routeBreakers map[string]middleware.BreakerState
+	if ok, err := store.Load(stateKeyRouteBreakers, &routeBreakers); err != nil {
+		log.Printf("[state] failed to restore route circuit breakers: %v", err)
+	} else if ok {
+		breakers.Restore(routeBreakers)
+		log.Printf("[state] restored circuit breakers for %d routes", len(routeBreakers))
+	}
+}
+
+// saveState writes limiter buckets and breaker state to the store.
+func saveState(store state.Store, rl *middleware.RateLimiter, routes *middleware.RouteRateLimiter, cb *middleware.CircuitBreaker, breakers *middleware.RouteCircuitBreaker) {
+	if err := store.Save(stateKeyRateLimit, rl.Snapshot()); err != nil {
+		log.Printf("[state] failed to save rate limiter: %v", err)
+	}
+	if err := store.Save(stateKeyRouteRateLimit, routes.Snapshot()); err != nil {
+		log.Printf("[state] failed to save route rate limiters: %v", err)
+	}
+	if err := store.Save(stateKeyTierRateLimit, routes.TierSnapshot()); err != nil {
+		log.Printf("[state] failed to save tier rate limiters: %v", err)
+	}
+	if err := store.Save(stateKeyCircuitBreaker, cb.Snapshot()); err != nil {
+		log.Printf("[state] failed to save circuit breaker: %v", err)
+	}
+	if err := store.Save(stateKeyRouteBreakers, breakers.Snapshot()); err != nil {
+		log.Printf("[state] failed to save route circuit breakers: %v", err)
+	}
+}
+
+// markProcessReady tells the process manager that the managed process behind
+// a backend URL passed a health check, for its readiness latency metric.
+func markProcessReady(pm *dashboard.ProcessManager, backendURL string) {
+	u, err := url.Parse(backendURL)
+	if err != nil {
+		return
+	}
+	if port, err := strconv.Atoi(u.Port()); err == nil {
+		pm.MarkReady(port)
+	}
+}
+
+// restoreQuotas loads persisted per-key quota usage, if any.
+func restoreQuotas(store state.Store, q *middleware.QuotaManager) {
+	var usage map[string]middleware.QuotaUsage
+	if ok, err := store.Load(stateKeyQuotas, &usage); err != nil {
+		log.Printf("[state] failed to restore quotas: %v", err)
+	} else if ok {
+		q.Restore(usage)
+		log.Printf("[state] restored quota usage for %d keys", len(usage))
+	}
+}
+
+// saveQuotas writes per-key quota usage to the store.
+func saveQuotas(store state.Store, q *middleware.QuotaManager) {
+	if err := store.Save(stateKeyQuotas, q.Snapshot()); err != nil {
+		log.Printf("[state] failed to save quotas: %v", err)
+	}
+}
+
+// upperKeys returns m with HTTP method keys upper-cased.
+func upperKeys(m map[string]float64) map[string]float64 {
+	out := make(map[string]float64, len(m))
+	for k, v := range m {
+		out[strings.ToUpper(k)] = v
+	}
+	return out
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/tanmay/gateway/internal/middleware"
+)
+
+// keygen issues a new API key, or hashes an existing one, and prints the
+// auth.keys entry to paste into config.yml. The key itself is shown once
+// and never needs to be stored by the gateway. With -password it prints a
+// dashboard user's password_hash instead.
+func main() {
+	prefix := flag.String("prefix", "gw_", "prefix for generated keys")
+	existing := flag.String("key", "", "hash this key instead of generating one")
+	password := flag.String("password", "", "print a bcrypt password_hash for a dashboard user")
+	flag.Parse()
+
+	if *password != "" {
+		hash, err := middleware.NewPasswordHash(*password)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("password_hash: %q\n", hash)
+		return
+	}
+
+	key := *existing
+	if key == "" {
+		b := make([]byte, 24)
+		if _, err := rand.Read(b); err != nil {
+			log.Fatal(err)
+		}
+		key = *prefix + base64.RawURLEncoding.EncodeToString(b)
+	}
+	hash, err := middleware.NewKeyHash(key)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("key: %s\n\n", key)
+	fmt.Println("auth:")
+	fmt.Println("  keys:")
+	fmt.Printf("    - prefix: %q\n", middleware.KeyPrefix(key))
+	fmt.Printf("      hash: %q\n", hash)
+}
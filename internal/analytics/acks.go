@@ -0,0 +1,203 @@
+package analytics
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Mute silences anomalies for a route and metric until Until: they are
+// still recorded, flagged muted, but not published, so a known issue
+// stops re-alerting while it's being worked on.
+type Mute struct {
+	Route  string    `json:"route"`
+	Metric string    `json:"metric,omitempty"` // empty mutes every metric of the route
+	Reason string    `json:"reason,omitempty"`
+	Until  time.Time `json:"until"`
+}
+
+// muteKey identifies a mute.
+type muteKey struct {
+	route, metric string
+}
+
+// Acknowledge marks an anomaly as seen by someone. Returns the updated
+// anomaly, or false if no recent anomaly has that ID.
+func (a *Analyzer) Acknowledge(id, by string) (Anomaly, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for i := range a.anomalies {
+		anom := &a.anomalies[i]
+		if anom.ID != id {
+			continue
+		}
+		now := time.Now()
+		anom.Acked = true
+		anom.AckedBy = by
+		anom.AckedAt = &now
+		return *anom, true
+	}
+	return Anomaly{}, false
+}
+
+// Mute silences anomalies for route and metric (every metric if empty)
+// for d, replacing any existing mute for the pair.
+func (a *Analyzer) Mute(route, metric, reason string, d time.Duration) Mute {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	m := Mute{Route: route, Metric: metric, Reason: reason, Until: time.Now().Add(d)}
+	a.mutes[muteKey{route, metric}] = m
+	return m
+}
+
+// Unmute lifts a mute early, reporting whether there was one.
+func (a *Analyzer) Unmute(route, metric string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, ok := a.mutes[muteKey{route, metric}]
+	delete(a.mutes, muteKey{route, metric})
+	return ok
+}
+
+// Mutes returns the active mutes, soonest to expire first.
+func (a *Analyzer) Mutes() []Mute {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now()
+	out := make([]Mute, 0, len(a.mutes))
+	for key, m := range a.mutes {
+		if !now.Before(m.Until) {
+			delete(a.mutes, key)
+			continue
+		}
+		out = append(out, m)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Until.Before(out[j].Until) })
+	return out
+}
+
+// isMuted reports whether anomalies for route and metric are muted at
+// now. Must hold a.mu.
+func (a *Analyzer) isMuted(route, metric string, now time.Time) bool {
+	for _, key := range []muteKey{{route, metric}, {route, ""}} {
+		if m, ok := a.mutes[key]; ok && now.Before(m.Until) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetBroadcast allows main.go to forward acknowledgments and mutes to the
+// dashboard's SSE stream, so every open dashboard reflects them.
+func (api *AnalyticsAPI) SetBroadcast(fn func(eventType string, payload interface{})) {
+	api.broadcast = fn
+}
+
+// SetMutationGuard puts acknowledgments and mutes behind guard, typically
+// the dashboard's auth middleware. Without one they are refused, since the
+// analytics API is mounted outside the middleware chain.
+func (api *AnalyticsAPI) SetMutationGuard(guard func(http.Handler) http.Handler) {
+	api.guard = guard
+}
+
+// mutating lets reads through and sends anything else through the guard.
+func (api *AnalyticsAPI) mutating(h http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet || r.Method == http.MethodHead:
+			h(w, r)
+		case api.guard == nil:
+			http.Error(w, "Acknowledging and muting anomalies requires dashboard.auth", http.StatusForbidden)
+		default:
+			api.guard(h).ServeHTTP(w, r)
+		}
+	})
+}
+
+// notify forwards an event to the dashboard stream, if wired.
+func (api *AnalyticsAPI) notify(eventType string, payload interface{}) {
+	if api.broadcast != nil {
+		api.broadcast(eventType, payload)
+	}
+}
+
+// handleAnomalyAck acknowledges an anomaly.
+// POST /analytics/anomalies/{id}/ack with an optional {"by": "alice"}
+func (api *AnalyticsAPI) handleAnomalyAck(w http.ResponseWriter, r *http.Request) {
+	id, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/anomalies/"), "/ack")
+	if !ok || id == "" {
+		http.Error(w, "Invalid path", http.StatusBadRequest)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		By string `json:"by"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	anomaly, ok := api.analyzer.Acknowledge(id, req.By)
+	if !ok {
+		http.Error(w, fmt.Sprintf("no recent anomaly %q", id), http.StatusNotFound)
+		return
+	}
+	api.notify("anomaly_ack", anomaly)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(anomaly)
+}
+
+// handleMutes lists, creates, and lifts mutes.
+//   - GET    /analytics/mutes
+//   - POST   /analytics/mutes  {"route", "metric", "duration": "1h", "reason"}
+//   - DELETE /analytics/mutes?route=/api/v1&metric=latency
+func (api *AnalyticsAPI) handleMutes(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var req struct {
+			Route    string `json:"route"`
+			Metric   string `json:"metric"`
+			Duration string `json:"duration"`
+			Reason   string `json:"reason"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		d, err := time.ParseDuration(req.Duration)
+		if req.Route == "" || err != nil || d <= 0 {
+			http.Error(w, `"route" and a positive "duration" (e.g. "1h") are required`, http.StatusBadRequest)
+			return
+		}
+		api.notify("anomaly_mute", api.analyzer.Mute(req.Route, req.Metric, req.Reason, d))
+	case http.MethodDelete:
+		q := r.URL.Query()
+		route, metric := q.Get("route"), q.Get("metric")
+		if !api.analyzer.Unmute(route, metric) {
+			http.Error(w, fmt.Sprintf("no mute for route %q metric %q", route, metric), http.StatusNotFound)
+			return
+		}
+		api.notify("anomaly_unmute", Mute{Route: route, Metric: metric})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"mutes": api.analyzer.Mutes(),
+	})
+}
@@ -0,0 +1,76 @@
+package analytics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// requireToken stands in for the dashboard's auth middleware.
+func requireToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer admin-token" {
+			http.Error(w, "Dashboard login required", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func TestAnomalyMutationsRequireAuth(t *testing.T) {
+	store := NewMemoryTrafficStore(time.Hour, time.Minute)
+	analyzer := NewAnalyzer(store, AnalyzerConfig{Window: time.Hour})
+	api := NewAnalyticsAPI(analyzer, store)
+
+	do := func(method, path, body, token string) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		api.Handler().ServeHTTP(rec, req)
+		return rec.Code
+	}
+	mute := `{"route": "/api", "duration": "1h"}`
+
+	// Without a guard, reads work and mutations are refused
+	if code := do(http.MethodGet, "/mutes", "", ""); code != http.StatusOK {
+		t.Errorf("Expected mutes readable, got %d", code)
+	}
+	if code := do(http.MethodPost, "/mutes", mute, ""); code != http.StatusForbidden {
+		t.Errorf("Expected a mute refused without a guard, got %d", code)
+	}
+	if code := do(http.MethodPost, "/anomalies/a-1/ack", "", ""); code != http.StatusForbidden {
+		t.Errorf("Expected an ack refused without a guard, got %d", code)
+	}
+
+	api.SetMutationGuard(requireToken)
+	tests := []struct {
+		method, path, body, token string
+		want                      int
+	}{
+		{http.MethodPost, "/mutes", mute, "", http.StatusUnauthorized},
+		{http.MethodPost, "/mutes", mute, "wrong", http.StatusUnauthorized},
+		{http.MethodPost, "/anomalies/a-1/ack", "", "", http.StatusUnauthorized},
+		{http.MethodGet, "/mutes", "", "", http.StatusOK},
+		{http.MethodPost, "/mutes", mute, "admin-token", http.StatusOK},
+		{http.MethodDelete, "/mutes?route=/api", "", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		if code := do(tt.method, tt.path, tt.body, tt.token); code != tt.want {
+			t.Errorf("%s %s with token %q: expected %d, got %d", tt.method, tt.path, tt.token, tt.want, code)
+		}
+	}
+	if mutes := analyzer.Mutes(); len(mutes) != 1 || mutes[0].Route != "/api" {
+		t.Errorf("Expected only the authenticated mute applied, got %+v", mutes)
+	}
+
+	if code := do(http.MethodDelete, "/mutes?route=/api", "", "admin-token"); code != http.StatusOK {
+		t.Errorf("Expected an authenticated unmute, got %d", code)
+	}
+	if mutes := analyzer.Mutes(); len(mutes) != 0 {
+		t.Errorf("Expected the mute lifted, got %+v", mutes)
+	}
+}
@@ -0,0 +1,352 @@
+package analytics
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AlertRule is an operator-defined condition on one route's or backend's
+// traffic, e.g. "error_rate > 5%" for 5m on /api/v1, or "requests == 0"
+// for 10m to catch a route that went silent. Unlike anomaly detection it
+// involves no statistics: the rule fires when the condition has held in
+// every bucket for the whole For duration, and resolves when it stops.
+type AlertRule struct {
+	Name    string
+	Route   string // the route to watch, or
+	Backend string // the backend to watch
+
+	// Condition is "<metric> <op> <value>". Metrics are requests (per
+	// bucket), request_rate (per minute), error_rate, latency (average),
+	// latency_p95, and latency_p99; ops are >, >=, <, <=, ==, and !=.
+	// Values may be written as percentages ("5%") or durations ("300ms").
+	Condition string
+	For       time.Duration // how long the condition must hold (default one bucket)
+}
+
+// Alert is a rule changing state, passed to OnAlert callbacks.
+type Alert struct {
+	Rule      string    `json:"rule"`
+	Route     string    `json:"route,omitempty"`
+	Backend   string    `json:"backend,omitempty"`
+	Condition string    `json:"condition"`
+	Metric    string    `json:"metric"`
+	Value     float64   `json:"value"` // metric in the most recent bucket
+	Threshold float64   `json:"threshold"`
+	State     string    `json:"state"` // "firing" or "resolved"
+	Since     time.Time `json:"since"` // when the rule entered this state
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// AlertStatus is a rule's current state, for GET /analytics/alerts.
+type AlertStatus struct {
+	Rule      string     `json:"rule"`
+	Route     string     `json:"route,omitempty"`
+	Backend   string     `json:"backend,omitempty"`
+	Condition string     `json:"condition"`
+	For       string     `json:"for"`
+	Firing    bool       `json:"firing"`
+	Since     *time.Time `json:"since,omitempty"` // when it started firing
+	Value     *float64   `json:"value,omitempty"` // metric in the most recent bucket, if it had data
+}
+
+// alertMetrics are the metrics a condition can test, reading one bucket.
+// ok is false when the bucket has no data for the metric, which never
+// satisfies a condition.
+var alertMetrics = map[string]func(b Bucket) (v float64, ok bool){
+	"requests": func(b Bucket) (float64, bool) {
+		return float64(b.RequestCount), true
+	},
+	"request_rate": func(b Bucket) (float64, bool) {
+		return b.RatePerMinute(), true
+	},
+	"error_rate": func(b Bucket) (float64, bool) {
+		return b.ErrorRate(), b.RequestCount > 0
+	},
+	"latency": func(b Bucket) (float64, bool) {
+		return float64(b.AvgLatency()) / float64(time.Millisecond), b.RequestCount > 0
+	},
+	"latency_p95": func(b Bucket) (float64, bool) {
+		return b.Latency.QuantileMs(0.95), b.Latency.Count() > 0
+	},
+	"latency_p99": func(b Bucket) (float64, bool) {
+		return b.Latency.QuantileMs(0.99), b.Latency.Count() > 0
+	},
+}
+
+// alertOps are the comparisons a condition can use.
+var alertOps = map[string]func(v, threshold float64) bool{
+	">":  func(v, t float64) bool { return v > t },
+	">=": func(v, t float64) bool { return v >= t },
+	"<":  func(v, t float64) bool { return v < t },
+	"<=": func(v, t float64) bool { return v <= t },
+	"==": func(v, t float64) bool { return v == t },
+	"!=": func(v, t float64) bool { return v != t },
+}
+
+// alertCondition is a parsed AlertRule.Condition.
+type alertCondition struct {
+	metric    string
+	op        string
+	threshold float64
+}
+
+// parseAlertCondition parses "<metric> <op> <value>". Percentages are
+// converted to fractions and durations to milliseconds, matching how the
+// metrics are reported.
+func parseAlertCondition(s string) (alertCondition, error) {
+	fields := strings.Fields(s)
+	if len(fields) != 3 {
+		return alertCondition{}, fmt.Errorf("condition %q is not \"<metric> <op> <value>\"", s)
+	}
+	c := alertCondition{metric: fields[0], op: fields[1]}
+	if _, ok := alertMetrics[c.metric]; !ok {
+		return c, fmt.Errorf("condition %q: unknown metric %q", s, c.metric)
+	}
+	if _, ok := alertOps[c.op]; !ok {
+		return c, fmt.Errorf("condition %q: unknown operator %q", s, c.op)
+	}
+
+	value := fields[2]
+	var err error
+	switch {
+	case strings.HasSuffix(value, "%"):
+		c.threshold, err = strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+		c.threshold /= 100
+	case strings.HasSuffix(value, "s"):
+		var d time.Duration
+		d, err = time.ParseDuration(value)
+		c.threshold = float64(d) / float64(time.Millisecond)
+	default:
+		c.threshold, err = strconv.ParseFloat(value, 64)
+	}
+	if err != nil {
+		return c, fmt.Errorf("condition %q: invalid value %q", s, value)
+	}
+	return c, nil
+}
+
+// alertState is a rule's evaluation state.
+type alertState struct {
+	firing bool
+	since  time.Time
+	value  *float64
+}
+
+// AlertEngine evaluates alert rules against the TrafficStore on a fixed
+// interval and reports rules that start or stop firing.
+type AlertEngine struct {
+	store      TrafficStore
+	rules      []AlertRule
+	conditions []alertCondition
+	interval   time.Duration
+	startTime  time.Time
+
+	mu      sync.RWMutex
+	states  []alertState // parallel to rules
+	onAlert []func(Alert)
+
+	stop chan struct{} // closed by Stop
+	done chan struct{} // closed when the evaluation loop exits
+}
+
+// NewAlertEngine validates rules and creates an engine that evaluates
+// them every interval (default 1m).
+func NewAlertEngine(store TrafficStore, rules []AlertRule, interval time.Duration) (*AlertEngine, error) {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	e := &AlertEngine{
+		store:      store,
+		rules:      rules,
+		conditions: make([]alertCondition, len(rules)),
+		interval:   interval,
+		startTime:  time.Now(),
+		states:     make([]alertState, len(rules)),
+	}
+	seen := make(map[string]bool)
+	for i := range e.rules {
+		rule := &e.rules[i]
+		if rule.Name == "" {
+			return nil, fmt.Errorf("alert rule %d has no name", i)
+		}
+		if seen[rule.Name] {
+			return nil, fmt.Errorf("duplicate alert rule %q", rule.Name)
+		}
+		seen[rule.Name] = true
+		if (rule.Route == "") == (rule.Backend == "") {
+			return nil, fmt.Errorf("alert rule %q needs exactly one of route or backend", rule.Name)
+		}
+		c, err := parseAlertCondition(rule.Condition)
+		if err != nil {
+			return nil, fmt.Errorf("alert rule %q: %w", rule.Name, err)
+		}
+		e.conditions[i] = c
+		if bucket := store.BucketSize(); rule.For < bucket {
+			rule.For = bucket
+		}
+	}
+	return e, nil
+}
+
+// OnAlert registers a callback for rules that start or stop firing. Must
+// be called before Start.
+func (e *AlertEngine) OnAlert(fn func(Alert)) {
+	e.onAlert = append(e.onAlert, fn)
+}
+
+// Start launches the background evaluation loop.
+func (e *AlertEngine) Start() {
+	e.stop = make(chan struct{})
+	e.done = make(chan struct{})
+	ticker := time.NewTicker(e.interval)
+	go func() {
+		defer close(e.done)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				e.evaluate(time.Now())
+			case <-e.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends the evaluation loop.
+func (e *AlertEngine) Stop() {
+	if e.stop != nil {
+		close(e.stop)
+		<-e.done
+		e.stop = nil
+	}
+}
+
+// evaluate checks every rule against the completed buckets before now.
+func (e *AlertEngine) evaluate(now time.Time) {
+	bucket := e.store.BucketSize()
+	end := now.Truncate(bucket) // the current bucket is still filling
+
+	var changed []Alert
+	e.mu.Lock()
+	for i, rule := range e.rules {
+		// Whole buckets only: a For that isn't a multiple of the bucket
+		// size is rounded up
+		from := end.Add(-rule.For).Truncate(bucket)
+		if from.Before(e.startTime) {
+			// Not watching long enough to tell, e.g. "requests == 0"
+			// right after a restart
+			continue
+		}
+		holds, value := e.check(i, from, end)
+
+		st := &e.states[i]
+		st.value = value
+		if holds == st.firing {
+			continue
+		}
+		st.firing = holds
+		st.since = now
+		alert := Alert{
+			Rule:      rule.Name,
+			Route:     rule.Route,
+			Backend:   rule.Backend,
+			Condition: rule.Condition,
+			Metric:    e.conditions[i].metric,
+			Threshold: e.conditions[i].threshold,
+			State:     "resolved",
+			Since:     now,
+			Timestamp: now,
+		}
+		if holds {
+			alert.State = "firing"
+		}
+		if value != nil {
+			alert.Value = *value
+		}
+		changed = append(changed, alert)
+	}
+	e.mu.Unlock()
+
+	for _, alert := range changed {
+		log.Printf("[alert] %s %s: %s (value=%.4g)", alert.Rule, alert.State, alert.Condition, alert.Value)
+		for _, fn := range e.onAlert {
+			fn(alert)
+		}
+	}
+}
+
+// check reports whether rule i's condition held in every bucket in
+// [from, end), and the metric's value in the last one. Missing buckets
+// had no traffic; downsampled ones count once for their whole width,
+// including one that began before from.
+func (e *AlertEngine) check(i int, from, end time.Time) (bool, *float64) {
+	rule, cond := e.rules[i], e.conditions[i]
+	lookback := from.Add(e.store.BucketSize() - widestBucket(e.store))
+	var buckets []Bucket
+	if rule.Route != "" {
+		buckets = e.store.GetBuckets(rule.Route, lookback, end)
+	} else {
+		buckets = e.store.GetBackendBuckets(lookback, end)[rule.Backend]
+	}
+	start := from
+	byStart := make(map[time.Time]Bucket, len(buckets))
+	for _, b := range buckets {
+		byStart[b.Timestamp] = b
+		if b.Timestamp.Before(from) && b.Timestamp.Add(b.Width).After(from) {
+			start = b.Timestamp
+		}
+	}
+
+	metric, op := alertMetrics[cond.metric], alertOps[cond.op]
+	holds := true
+	var value *float64
+	for t := start; t.Before(end); {
+		b, found := byStart[t]
+		if found {
+			t = t.Add(b.Width)
+		} else {
+			t = t.Add(e.store.BucketSize())
+		}
+		v, ok := metric(b)
+		value = nil
+		if ok {
+			value = &v
+		}
+		if !ok || !op(v, cond.threshold) {
+			holds = false
+		}
+	}
+	return holds, value
+}
+
+// Status returns every rule's current state, sorted by name.
+func (e *AlertEngine) Status() []AlertStatus {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	out := make([]AlertStatus, len(e.rules))
+	for i, rule := range e.rules {
+		st := e.states[i]
+		out[i] = AlertStatus{
+			Rule:      rule.Name,
+			Route:     rule.Route,
+			Backend:   rule.Backend,
+			Condition: rule.Condition,
+			For:       rule.For.String(),
+			Firing:    st.firing,
+			Value:     st.value,
+		}
+		if st.firing {
+			since := st.since
+			out[i].Since = &since
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Rule < out[j].Rule })
+	return out
+}
@@ -0,0 +1,75 @@
+package analytics
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// newTestAlertEngine returns an engine over store that has been watching
+// long enough to evaluate any rule.
+func newTestAlertEngine(t *testing.T, store TrafficStore, rules ...AlertRule) *AlertEngine {
+	t.Helper()
+	e, err := NewAlertEngine(store, rules, time.Minute)
+	if err != nil {
+		t.Fatalf("NewAlertEngine: %v", err)
+	}
+	e.startTime = time.Now().Add(-24 * time.Hour)
+	return e
+}
+
+// recordMinutes records n requests with status in each minute of [from, to).
+func recordMinutes(store TrafficStore, route string, from, to time.Time, n, status int) {
+	for t := from; t.Before(to); t = t.Add(time.Minute) {
+		for range n {
+			store.Record(TrafficEvent{Route: route, Status: status, Latency: time.Millisecond, Timestamp: t})
+		}
+	}
+}
+
+func TestAlertEngineForNotAMultipleOfBucketSize(t *testing.T) {
+	store := NewMemoryTrafficStore(24*time.Hour, time.Minute)
+	now := time.Now().Add(-time.Hour).Truncate(time.Minute).Add(30 * time.Second)
+	recordMinutes(store, "/api", now.Add(-10*time.Minute), now, 10, http.StatusInternalServerError)
+
+	e := newTestAlertEngine(t, store,
+		AlertRule{Name: "silent", Route: "/api", Condition: "requests == 0", For: 90 * time.Second},
+		AlertRule{Name: "errors", Route: "/api", Condition: "error_rate > 50%", For: 90 * time.Second},
+	)
+	e.evaluate(now)
+
+	firing := make(map[string]bool)
+	for _, st := range e.Status() {
+		firing[st.Rule] = st.Firing
+	}
+	if firing["silent"] {
+		t.Error("Expected requests == 0 not to fire on a busy route")
+	}
+	if !firing["errors"] {
+		t.Error("Expected error_rate > 50% to fire on a route failing every request")
+	}
+}
+
+func TestAlertEngineCountsDownsampledBucketBeforeWindow(t *testing.T) {
+	store := NewMemoryTrafficStore(24*time.Hour, time.Minute)
+	if err := store.SetDownsampling([]DownsampleTier{{After: 2 * time.Minute, Interval: 10 * time.Minute}}); err != nil {
+		t.Fatalf("SetDownsampling: %v", err)
+	}
+	// Everything before boundary is rolled up into [boundary-10m, boundary)
+	boundary := time.Now().Add(-time.Hour).Truncate(10 * time.Minute)
+	now := boundary.Add(5 * time.Minute)
+	recordMinutes(store, "/api", boundary.Add(-10*time.Minute), now, 10, http.StatusInternalServerError)
+	store.rollup(now)
+	if b := store.GetBuckets("/api", boundary.Add(-10*time.Minute), boundary); len(b) != 1 || b[0].Width != 10*time.Minute {
+		t.Fatalf("Expected one rolled-up bucket before the boundary, got %+v", b)
+	}
+
+	// The window [boundary-3m, boundary+5m) starts inside the rolled-up bucket
+	e := newTestAlertEngine(t, store,
+		AlertRule{Name: "errors", Route: "/api", Condition: "error_rate > 50%", For: 8 * time.Minute},
+	)
+	e.evaluate(now)
+	if st := e.Status()[0]; !st.Firing {
+		t.Error("Expected the rule to fire, counting the downsampled bucket that began before its window")
+	}
+}
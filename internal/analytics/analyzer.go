@@ -1,6 +1,7 @@
 package analytics
 
 import (
+	"fmt"
 	"log"
 	"math"
 	"sync"
@@ -9,31 +10,51 @@ import (
 
 // Anomaly represents a detected traffic anomaly.
 type Anomaly struct {
+	ID        string    `json:"id"`
 	Route     string    `json:"route"`
-	Metric    string    `json:"metric"`    // "request_rate", "error_rate", "latency"
+	Metric    string    `json:"metric"` // "request_rate", "error_rate", "latency"
 	Current   float64   `json:"current"`
 	Mean      float64   `json:"mean"`
 	StdDev    float64   `json:"std_dev"`
 	ZScore    float64   `json:"z_score"`
+	Direction Direction `json:"direction"`      // "above" or "below" the baseline
+	Slot      string    `json:"slot,omitempty"` // seasonal slot compared against; empty for the rolling window
 	Timestamp time.Time `json:"timestamp"`
+
+	// Acknowledgment and muting, see Acknowledge and Mute. A muted anomaly
+	// is recorded but not published to AnomalyChannel.
+	Acked   bool       `json:"acked"`
+	AckedBy string     `json:"acked_by,omitempty"`
+	AckedAt *time.Time `json:"acked_at,omitempty"`
+	Muted   bool       `json:"muted"`
 }
 
 // RouteBaseline holds the computed baseline statistics for a single route.
 type RouteBaseline struct {
 	Route         string  `json:"route"`
-	MeanRate      float64 `json:"mean_rate"`       // avg requests per minute
+	MeanRate      float64 `json:"mean_rate"` // avg requests per minute, normalized from the bucket size
 	StdDevRate    float64 `json:"std_dev_rate"`
+	P95Rate       float64 `json:"p95_rate"`  // 95th percentile of per-bucket request rates
+	PeakRate      float64 `json:"peak_rate"` // busiest bucket in the window
 	MeanErrorRate float64 `json:"mean_error_rate"`
 	StdDevError   float64 `json:"std_dev_error"`
 	MeanLatencyMs float64 `json:"mean_latency_ms"` // avg latency in milliseconds
 	StdDevLatency float64 `json:"std_dev_latency"`
+	P50LatencyMs  float64 `json:"p50_latency_ms"` // percentiles over every request in the window
+	P95LatencyMs  float64 `json:"p95_latency_ms"`
 	P99LatencyMs  float64 `json:"p99_latency_ms"`
 	SampleSize    int     `json:"sample_size"` // number of buckets used
+
+	// Seasonal is the baseline for the current hour-of-day slot, used for
+	// anomaly detection instead of the rolling window once it has history.
+	Seasonal *SeasonalBaseline `json:"seasonal,omitempty"`
 }
 
 // BackendBaseline holds computed baseline statistics for a single backend.
 type BackendBaseline struct {
 	Backend       string  `json:"backend"`
+	MeanRate      float64 `json:"mean_rate"`    // avg requests per minute
+	CurrentRate   float64 `json:"current_rate"` // rate (per minute) of the most recent bucket
 	MeanLatencyMs float64 `json:"mean_latency_ms"`
 	MeanErrorRate float64 `json:"mean_error_rate"`
 	StdDevError   float64 `json:"std_dev_error"`
@@ -42,9 +63,52 @@ type BackendBaseline struct {
 
 // AnalyzerConfig configures the traffic analyzer.
 type AnalyzerConfig struct {
-	Interval       time.Duration // how often to recompute baselines (default 5m)
-	Window         time.Duration // how far back to look for baselines (default 1h)
-	ZScoreThreshold float64      // z-score threshold for anomaly detection (default 3.0)
+	Interval        time.Duration // how often to recompute baselines (default 5m)
+	Window          time.Duration // how far back to look for baselines (default 1h, rounded up to whole buckets)
+	ZScoreThreshold float64       // z-score threshold for anomaly detection (default 3.0)
+	Seasonality     Seasonality   // compare against the same hour of previous days (default off)
+	SeasonalDays    int           // days of history for seasonal baselines (default 7, bounded by retention)
+
+	// Thresholds overrides detection per metric ("request_rate",
+	// "error_rate", "latency"). Unset fields fall back to ZScoreThreshold
+	// and the metric's default direction.
+	Thresholds map[string]MetricThreshold
+
+	// Routes overrides analysis per route, keyed by route prefix.
+	Routes map[string]RouteOverride
+}
+
+// RouteOverride tunes analysis for one route, since a quiet admin route
+// needs different sensitivity than a busy public API. Zero fields keep
+// the global settings.
+type RouteOverride struct {
+	Window     time.Duration // baseline lookback (rounded up to whole buckets)
+	ZScore     float64       // threshold for every metric of the route
+	MinSamples int           // buckets of history needed before anomalies are flagged
+}
+
+// Direction is which side of the baseline counts as anomalous.
+type Direction string
+
+const (
+	DirectionAbove Direction = "above" // spikes only
+	DirectionBelow Direction = "below" // drops only
+	DirectionBoth  Direction = "both"
+)
+
+// MetricThreshold configures anomaly detection for one metric.
+type MetricThreshold struct {
+	ZScore    float64
+	Direction Direction
+}
+
+// defaultDirections are the directions checked unless configured: a
+// traffic drop or a latency collapse can mean an outage or a bad deploy
+// (requests failing fast), but fewer errors is only good news.
+var defaultDirections = map[string]Direction{
+	"request_rate": DirectionBoth,
+	"error_rate":   DirectionAbove,
+	"latency":      DirectionBoth,
 }
 
 // Analyzer computes traffic baselines and detects anomalies.
@@ -55,13 +119,37 @@ type Analyzer struct {
 	config    AnalyzerConfig
 	startTime time.Time
 
-	mu              sync.RWMutex
-	routeBaselines  map[string]*RouteBaseline
+	mu               sync.RWMutex
+	routeBaselines   map[string]*RouteBaseline
 	backendBaselines map[string]*BackendBaseline
-	anomalies       []Anomaly // recent anomalies (last 24h)
+	anomalies        []Anomaly // recent anomalies (last 24h)
+	anomalySeq       uint64    // numbers anomaly IDs
+	mutes            map[muteKey]Mute
+	weights          map[string][]WeightSample // load balancer weights per backend, see RecordWeights
+
+	coldStart *ColdStartPolicy     // optional, see SetColdStart
+	warmedAt  map[string]time.Time // when each route left cold start
+
+	// Self-observability of the analysis loop (guarded by mu)
+	lastAnalyzeAt       time.Time
+	lastAnalyzeDuration time.Duration
+	analyzeRuns         uint64
+	analyzeErrors       uint64
 
 	// AnomalyChannel publishes detected anomalies for other components to react.
 	AnomalyChannel chan Anomaly
+
+	stop chan struct{} // closed by Stop
+	done chan struct{} // closed when the analysis loop exits
+}
+
+// AnalyzerStats describes the analyzer's own health.
+type AnalyzerStats struct {
+	LastAnalyzeAt       time.Time
+	LastAnalyzeDuration time.Duration
+	AnalyzeRuns         uint64
+	AnalyzeErrors       uint64
+	Interval            time.Duration
 }
 
 // NewAnalyzer creates a new traffic analyzer with the given store and config.
@@ -75,6 +163,22 @@ func NewAnalyzer(store TrafficStore, cfg AnalyzerConfig) *Analyzer {
 	if cfg.ZScoreThreshold <= 0 {
 		cfg.ZScoreThreshold = 3.0
 	}
+	if cfg.SeasonalDays <= 0 {
+		cfg.SeasonalDays = DefaultSeasonalDays
+	}
+	if bucket := store.BucketSize(); ValidateWindow(cfg.Window, bucket) != nil {
+		rounded := (cfg.Window/bucket + 1) * bucket
+		log.Printf("[analyzer] window %s is not a multiple of bucket size %s, using %s", cfg.Window, bucket, rounded)
+		cfg.Window = rounded
+	}
+	for route, ov := range cfg.Routes {
+		if bucket := store.BucketSize(); ov.Window > 0 && ValidateWindow(ov.Window, bucket) != nil {
+			rounded := (ov.Window/bucket + 1) * bucket
+			log.Printf("[analyzer] window %s for %s is not a multiple of bucket size %s, using %s", ov.Window, route, bucket, rounded)
+			ov.Window = rounded
+			cfg.Routes[route] = ov
+		}
+	}
 
 	return &Analyzer{
 		store:            store,
@@ -82,6 +186,9 @@ func NewAnalyzer(store TrafficStore, cfg AnalyzerConfig) *Analyzer {
 		startTime:        time.Now(),
 		routeBaselines:   make(map[string]*RouteBaseline),
 		backendBaselines: make(map[string]*BackendBaseline),
+		warmedAt:         make(map[string]time.Time),
+		mutes:            make(map[muteKey]Mute),
+		weights:          make(map[string][]WeightSample),
 		AnomalyChannel:   make(chan Anomaly, 64),
 	}
 }
@@ -91,14 +198,32 @@ func (a *Analyzer) Start() {
 	// Run an initial analysis immediately
 	a.analyze()
 
+	a.stop = make(chan struct{})
+	a.done = make(chan struct{})
 	ticker := time.NewTicker(a.config.Interval)
 	go func() {
-		for range ticker.C {
-			a.analyze()
+		defer close(a.done)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				a.analyze()
+			case <-a.stop:
+				return
+			}
 		}
 	}()
 }
 
+// Stop ends the analysis loop and waits for a running pass to finish.
+func (a *Analyzer) Stop() {
+	if a.stop != nil {
+		close(a.stop)
+		<-a.done
+		a.stop = nil
+	}
+}
+
 // HasSufficientData returns true if the analyzer has been running long enough
 // to have meaningful baselines (at least one full analysis window).
 func (a *Analyzer) HasSufficientData() bool {
@@ -158,24 +283,77 @@ func (a *Analyzer) GetRecentAnomalies() []Anomaly {
 	a.mu.RLock()
 	defer a.mu.RUnlock()
 
+	now := time.Now()
 	result := make([]Anomaly, len(a.anomalies))
 	copy(result, a.anomalies)
+	for i := range result {
+		// Reflect mutes added after detection too
+		result[i].Muted = result[i].Muted || a.isMuted(result[i].Route, result[i].Metric, now)
+	}
 	return result
 }
 
 // analyze recomputes all baselines and checks for anomalies.
+// A panic in one pass is recovered and counted so a bad bucket can't
+// silently kill the background loop.
 func (a *Analyzer) analyze() {
 	now := time.Now()
-	from := now.Add(-a.config.Window)
+	// Only completed buckets: the current one is still filling, and its
+	// low rate would read as a drop
+	to := now.Truncate(a.store.BucketSize())
+	from := to.Add(-a.config.Window)
+
+	defer func() {
+		failed := false
+		if r := recover(); r != nil {
+			failed = true
+			log.Printf("[analyzer] analysis pass failed: %v", r)
+		}
+		a.mu.Lock()
+		a.lastAnalyzeAt = now
+		a.lastAnalyzeDuration = time.Since(now)
+		a.analyzeRuns++
+		if failed {
+			a.analyzeErrors++
+		}
+		a.mu.Unlock()
+	}()
 
-	a.analyzeRoutes(from, now)
-	a.analyzeBackends(from, now)
+	a.analyzeRoutes(from, to)
+	a.analyzeBackends(from, to)
 	a.pruneAnomalies()
 }
 
+// Stats returns counters describing the analysis loop itself.
+func (a *Analyzer) Stats() AnalyzerStats {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return AnalyzerStats{
+		LastAnalyzeAt:       a.lastAnalyzeAt,
+		LastAnalyzeDuration: a.lastAnalyzeDuration,
+		AnalyzeRuns:         a.analyzeRuns,
+		AnalyzeErrors:       a.analyzeErrors,
+		Interval:            a.config.Interval,
+	}
+}
+
 // analyzeRoutes computes baselines for all routes and detects anomalies.
 func (a *Analyzer) analyzeRoutes(from, to time.Time) {
 	allBuckets := a.store.GetAllBuckets(from, to)
+	for route, ov := range a.config.Routes {
+		if ov.Window <= 0 {
+			continue
+		}
+		if buckets := a.store.GetBuckets(route, to.Add(-ov.Window), to); len(buckets) > 0 {
+			allBuckets[route] = buckets
+		} else {
+			delete(allBuckets, route)
+		}
+	}
+	var history map[string][]Bucket
+	if a.config.Seasonality != SeasonalityNone {
+		history = a.store.GetAllBuckets(to.Add(-time.Duration(a.config.SeasonalDays)*24*time.Hour), to)
+	}
 
 	a.mu.Lock()
 	defer a.mu.Unlock()
@@ -189,36 +367,66 @@ func (a *Analyzer) analyzeRoutes(from, to time.Time) {
 		rates := make([]float64, len(buckets))
 		errorRates := make([]float64, len(buckets))
 		latencies := make([]float64, len(buckets))
+		var hist LatencyHistogram
 
 		for i, b := range buckets {
-			rates[i] = float64(b.RequestCount)
+			rates[i] = b.RatePerMinute()
 			errorRates[i] = b.ErrorRate()
 			latencies[i] = float64(b.AvgLatency()) / float64(time.Millisecond)
+			hist.Merge(b.Latency)
 		}
 
 		baseline := &RouteBaseline{
 			Route:         route,
 			MeanRate:      mean(rates),
 			StdDevRate:    stddev(rates),
+			P95Rate:       percentile(rates, 0.95),
+			PeakRate:      percentile(rates, 1.0),
 			MeanErrorRate: mean(errorRates),
 			StdDevError:   stddev(errorRates),
 			MeanLatencyMs: mean(latencies),
 			StdDevLatency: stddev(latencies),
-			P99LatencyMs:  percentile(latencies, 0.99),
+			P50LatencyMs:  hist.QuantileMs(0.50),
+			P95LatencyMs:  hist.QuantileMs(0.95),
+			P99LatencyMs:  hist.QuantileMs(0.99),
 			SampleSize:    len(buckets),
 		}
 
 		a.routeBaselines[route] = baseline
+		a.markWarmed(route, baseline.SampleSize, to)
+		if baseline.SampleSize < a.config.Routes[route].MinSamples {
+			continue // too little history to judge this route yet
+		}
 
-		// Check current bucket (most recent) for anomalies
+		// Check the last completed bucket for anomalies. A route that
+		// went idle records no bucket at all, which is a drop to zero.
 		current := buckets[len(buckets)-1]
-		currentRate := float64(current.RequestCount)
+		if bucket := a.store.BucketSize(); current.Timestamp.Add(current.Width).Before(to) {
+			current = Bucket{Route: route, Timestamp: to.Add(-bucket), Width: bucket}
+		}
+		currentRate := current.RatePerMinute()
 		currentErrorRate := current.ErrorRate()
 		currentLatency := float64(current.AvgLatency()) / float64(time.Millisecond)
 
-		a.checkAnomaly(route, "request_rate", currentRate, baseline.MeanRate, baseline.StdDevRate)
-		a.checkAnomaly(route, "error_rate", currentErrorRate, baseline.MeanErrorRate, baseline.StdDevError)
-		a.checkAnomaly(route, "latency", currentLatency, baseline.MeanLatencyMs, baseline.StdDevLatency)
+		// An idle bucket has no errors or latency to judge
+		active := current.RequestCount > 0
+
+		if s := a.seasonalBaseline(history[route], current); s != nil {
+			// Compare with the same slot on previous days, so a daily
+			// ramp-up isn't flagged against the quieter hour before it
+			baseline.Seasonal = s
+			a.checkAnomaly(route, "request_rate", s.Slot, currentRate, s.MeanRate, s.StdDevRate)
+			if active {
+				a.checkAnomaly(route, "error_rate", s.Slot, currentErrorRate, s.MeanErrorRate, s.StdDevError)
+				a.checkAnomaly(route, "latency", s.Slot, currentLatency, s.MeanLatencyMs, s.StdDevLatency)
+			}
+			continue
+		}
+		a.checkAnomaly(route, "request_rate", "", currentRate, baseline.MeanRate, baseline.StdDevRate)
+		if active {
+			a.checkAnomaly(route, "error_rate", "", currentErrorRate, baseline.MeanErrorRate, baseline.StdDevError)
+			a.checkAnomaly(route, "latency", "", currentLatency, baseline.MeanLatencyMs, baseline.StdDevLatency)
+		}
 	}
 }
 
@@ -234,16 +442,20 @@ func (a *Analyzer) analyzeBackends(from, to time.Time) {
 			continue
 		}
 
+		rates := make([]float64, len(buckets))
 		errorRates := make([]float64, len(buckets))
 		latencies := make([]float64, len(buckets))
 
 		for i, b := range buckets {
+			rates[i] = b.RatePerMinute()
 			errorRates[i] = b.ErrorRate()
 			latencies[i] = float64(b.AvgLatency()) / float64(time.Millisecond)
 		}
 
 		a.backendBaselines[backend] = &BackendBaseline{
 			Backend:       backend,
+			MeanRate:      mean(rates),
+			CurrentRate:   rates[len(rates)-1],
 			MeanLatencyMs: mean(latencies),
 			MeanErrorRate: mean(errorRates),
 			StdDevError:   stddev(errorRates),
@@ -254,27 +466,45 @@ func (a *Analyzer) analyzeBackends(from, to time.Time) {
 
 // checkAnomaly tests if a current value is anomalous and records it.
 // Must be called with the write lock held.
-func (a *Analyzer) checkAnomaly(route, metric string, current, mean, stddev float64) {
+func (a *Analyzer) checkAnomaly(route, metric, slot string, current, mean, stddev float64) {
 	if stddev == 0 || mean == 0 {
 		return
 	}
 
+	th := a.threshold(route, metric)
 	zScore := (current - mean) / stddev
-	if zScore > a.config.ZScoreThreshold {
+	direction := DirectionAbove
+	if zScore < 0 {
+		direction = DirectionBelow
+	}
+	if th.Direction != DirectionBoth && th.Direction != direction {
+		return
+	}
+	if math.Abs(zScore) > th.ZScore {
+		now := time.Now()
+		a.anomalySeq++
 		anomaly := Anomaly{
+			// Unique across restarts, since anomalies aren't persisted
+			ID:        fmt.Sprintf("%x-%d", a.startTime.Unix(), a.anomalySeq),
 			Route:     route,
 			Metric:    metric,
 			Current:   current,
 			Mean:      mean,
 			StdDev:    stddev,
 			ZScore:    zScore,
-			Timestamp: time.Now(),
+			Direction: direction,
+			Slot:      slot,
+			Timestamp: now,
+			Muted:     a.isMuted(route, metric, now),
 		}
 
 		a.anomalies = append(a.anomalies, anomaly)
 
-		log.Printf("[anomaly] route=%s metric=%s current=%.2f mean=%.2f z_score=%.2f",
-			route, metric, current, mean, zScore)
+		log.Printf("[anomaly] route=%s metric=%s current=%.2f mean=%.2f z_score=%.2f muted=%t",
+			route, metric, current, mean, zScore, anomaly.Muted)
+		if anomaly.Muted {
+			return
+		}
 
 		// Non-blocking publish to the anomaly channel
 		select {
@@ -284,6 +514,25 @@ func (a *Analyzer) checkAnomaly(route, metric string, current, mean, stddev floa
 	}
 }
 
+// threshold returns the detection settings for a route's metric. A route's
+// z-score override takes precedence over the metric's.
+func (a *Analyzer) threshold(route, metric string) MetricThreshold {
+	th := a.config.Thresholds[metric]
+	if z := a.config.Routes[route].ZScore; z > 0 {
+		th.ZScore = z
+	}
+	if th.ZScore <= 0 {
+		th.ZScore = a.config.ZScoreThreshold
+	}
+	if th.Direction == "" {
+		th.Direction = defaultDirections[metric]
+	}
+	if th.Direction == "" {
+		th.Direction = DirectionAbove
+	}
+	return th
+}
+
 // pruneAnomalies removes anomalies older than 24 hours.
 func (a *Analyzer) pruneAnomalies() {
 	cutoff := time.Now().Add(-24 * time.Hour)
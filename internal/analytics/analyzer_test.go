@@ -0,0 +1,37 @@
+package analytics
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestAnalyzerFlagsRouteGoingIdle(t *testing.T) {
+	store := NewMemoryTrafficStore(24*time.Hour, time.Minute)
+	a := NewAnalyzer(store, AnalyzerConfig{Window: time.Hour})
+
+	// Steady traffic until two minutes ago, then nothing. The bucket still
+	// filling is ignored; the last completed one is missing.
+	to := time.Now().Truncate(time.Minute)
+	for i := 2; i <= 30; i++ {
+		n := 10 + i%3
+		for range n {
+			store.Record(TrafficEvent{Route: "/api", Status: http.StatusOK, Latency: time.Millisecond, Timestamp: to.Add(-time.Duration(i) * time.Minute)})
+		}
+	}
+	a.analyze()
+
+	var found bool
+	for _, an := range a.GetRecentAnomalies() {
+		if an.Route != "/api" {
+			continue
+		}
+		if an.Metric != "request_rate" || an.Direction != DirectionBelow || an.Current != 0 {
+			t.Errorf("Unexpected anomaly %+v", an)
+		}
+		found = true
+	}
+	if !found {
+		t.Error("Expected a request_rate drop to zero to be flagged")
+	}
+}
@@ -2,7 +2,9 @@ package analytics
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 )
@@ -11,8 +13,22 @@ import (
 // These are registered outside the middleware chain so they aren't
 // rate-limited or counted as regular traffic.
 type AnalyticsAPI struct {
-	analyzer *Analyzer
-	store    TrafficStore
+	analyzer      *Analyzer
+	store         TrafficStore
+	recorderStats func() RecorderStats // optional, set via SetRecorderStats
+
+	duplicateStats func() []DuplicateStats // optional, set via SetDuplicateStats
+
+	shadowRejections func() map[string]int64 // optional, set via SetShadowRejections
+	rateLimitStatus  func() RateLimitStatus  // optional, set via SetRateLimitStatus
+
+	alertStatus func() []AlertStatus // optional, set via SetAlertStatus
+
+	geo *GeoStats // optional, set via SetGeoStats
+
+	broadcast func(eventType string, payload interface{}) // optional, set via SetBroadcast
+
+	guard func(http.Handler) http.Handler // optional, set via SetMutationGuard
 }
 
 // NewAnalyticsAPI creates a new analytics API handler.
@@ -30,7 +46,16 @@ func (api *AnalyticsAPI) Handler() http.Handler {
 	mux.HandleFunc("/routes", api.handleRoutes)
 	mux.HandleFunc("/routes/", api.handleRouteHistory) // /routes/{route}/history
 	mux.HandleFunc("/anomalies", api.handleAnomalies)
+	mux.Handle("/anomalies/", api.mutating(api.handleAnomalyAck)) // /anomalies/{id}/ack
+	mux.Handle("/mutes", api.mutating(api.handleMutes))
 	mux.HandleFunc("/backends", api.handleBackends)
+	mux.HandleFunc("/backends/", api.handleBackendHistory) // /backends/{backend}/history
+	mux.HandleFunc("/status", api.handleStatus)
+	mux.HandleFunc("/duplicates", api.handleDuplicates)
+	mux.HandleFunc("/ratelimits", api.handleRateLimits)
+	mux.HandleFunc("/export", api.handleExport)
+	mux.HandleFunc("/alerts", api.handleAlerts)
+	mux.HandleFunc("/countries", api.handleCountries)
 	return mux
 }
 
@@ -39,10 +64,28 @@ type routeSummary struct {
 	Route            string  `json:"route"`
 	AvgRate          float64 `json:"avg_rate"`
 	AvgLatencyMs     float64 `json:"avg_latency_ms"`
+	P50LatencyMs     float64 `json:"p50_latency_ms"`
+	P95LatencyMs     float64 `json:"p95_latency_ms"`
 	P99LatencyMs     float64 `json:"p99_latency_ms"`
 	ErrorRate        float64 `json:"error_rate"`
 	CurrentRateLimit float64 `json:"current_rate_limit"`
 	Anomalies24h     int     `json:"anomalies_24h"`
+
+	// Cold-start status (see ColdStartPolicy). WarmedAt is when the route
+	// gathered enough samples to switch to learned limits.
+	SampleSize int        `json:"sample_size"`
+	ColdStart  bool       `json:"cold_start"`
+	WarmedAt   *time.Time `json:"warmed_at,omitempty"`
+
+	// ShadowRejections counts requests the adaptive limiter would have
+	// rejected, when it runs in shadow mode.
+	ShadowRejections *int64 `json:"shadow_rejections,omitempty"`
+}
+
+// SetShadowRejections allows main.go to inject the adaptive rate limiter's
+// per-route would-be rejections, when it runs in shadow mode.
+func (api *AnalyticsAPI) SetShadowRejections(fn func() map[string]int64) {
+	api.shadowRejections = fn
 }
 
 // handleRoutes returns all known routes with current baselines.
@@ -62,37 +105,102 @@ func (api *AnalyticsAPI) handleRoutes(w http.ResponseWriter, r *http.Request) {
 		anomalyCounts[a.Route]++
 	}
 
+	coldStart := api.analyzer.ColdStart()
+	var shadow map[string]int64
+	if api.shadowRejections != nil {
+		shadow = api.shadowRejections()
+	}
+
 	var summaries []routeSummary
 	for route, b := range baselines {
-		summaries = append(summaries, routeSummary{
+		summary := routeSummary{
 			Route:            route,
 			AvgRate:          b.MeanRate,
 			AvgLatencyMs:     b.MeanLatencyMs,
+			P50LatencyMs:     b.P50LatencyMs,
+			P95LatencyMs:     b.P95LatencyMs,
 			P99LatencyMs:     b.P99LatencyMs,
 			ErrorRate:        b.MeanErrorRate,
 			CurrentRateLimit: b.MeanRate * 3.0, // default multiplier
 			Anomalies24h:     anomalyCounts[route],
-		})
+			SampleSize:       b.SampleSize,
+			ColdStart:        api.analyzer.RouteIsCold(route),
+		}
+		if summary.ColdStart {
+			summary.CurrentRateLimit = coldStart.RateLimit
+		}
+		if t, ok := api.analyzer.RouteWarmedAt(route); ok {
+			summary.WarmedAt = &t
+		}
+		if shadow != nil {
+			n := shadow[route]
+			summary.ShadowRejections = &n
+		}
+		summaries = append(summaries, summary)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"routes": summaries,
+		"routes":     summaries,
+		"cold_start": coldStart,
 	})
 }
 
 // historyPoint is a single data point in a route's time-series history.
 type historyPoint struct {
 	Timestamp    time.Time `json:"timestamp"`
+	Width        string    `json:"width,omitempty"` // set when downsampled wider than bucket_size
 	RequestCount int       `json:"request_count"`
 	ErrorRate    float64   `json:"error_rate"`
-	AvgLatencyMs float64  `json:"avg_latency_ms"`
+	AvgLatencyMs float64   `json:"avg_latency_ms"`
+	P50LatencyMs float64   `json:"p50_latency_ms"`
+	P95LatencyMs float64   `json:"p95_latency_ms"`
+	P99LatencyMs float64   `json:"p99_latency_ms"`
 	BytesIn      int64     `json:"bytes_in"`
 	BytesOut     int64     `json:"bytes_out"`
 }
 
+// newHistoryPoint converts a bucket into a history point.
+func newHistoryPoint(b Bucket, bucketSize time.Duration) historyPoint {
+	p := historyPoint{
+		Timestamp:    b.Timestamp,
+		RequestCount: b.RequestCount,
+		ErrorRate:    b.ErrorRate(),
+		AvgLatencyMs: float64(b.AvgLatency()) / float64(time.Millisecond),
+		P50LatencyMs: b.Latency.QuantileMs(0.50),
+		P95LatencyMs: b.Latency.QuantileMs(0.95),
+		P99LatencyMs: b.Latency.QuantileMs(0.99),
+		BytesIn:      b.BytesIn,
+		BytesOut:     b.BytesOut,
+	}
+	if b.Width > bucketSize {
+		p.Width = b.Width.String()
+	}
+	return p
+}
+
+// historyRange reads the ?window= of a history request (default 1h, a
+// multiple of bucketSize) and returns the range it covers, aligned to
+// bucket boundaries so the first and last points are whole buckets.
+func historyRange(r *http.Request, bucketSize time.Duration) (from, to time.Time, err error) {
+	window := 1 * time.Hour
+	if v := r.URL.Query().Get("window"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return from, to, fmt.Errorf("invalid window: %w", err)
+		}
+		window = d
+	}
+	if err := ValidateWindow(window, bucketSize); err != nil {
+		return from, to, err
+	}
+	to = time.Now().Truncate(bucketSize).Add(bucketSize)
+	return to.Add(-window), to, nil
+}
+
 // handleRouteHistory returns time-series data for a specific route.
-// GET /analytics/routes/{route}/history
+// GET /analytics/routes/{route}/history?window=1h
+// window defaults to 1h and must be a multiple of the store's bucket size.
 func (api *AnalyticsAPI) handleRouteHistory(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -115,30 +223,27 @@ func (api *AnalyticsAPI) handleRouteHistory(w http.ResponseWriter, r *http.Reque
 		route = "/" + route
 	}
 
-	// Default to last 1 hour of data
-	to := time.Now()
-	from := to.Add(-1 * time.Hour)
+	bucketSize := api.store.BucketSize()
+	from, to, err := historyRange(r, bucketSize)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	buckets := api.store.GetBuckets(route, from, to)
 
 	points := make([]historyPoint, len(buckets))
 	for i, b := range buckets {
-		points[i] = historyPoint{
-			Timestamp:    b.Timestamp,
-			RequestCount: b.RequestCount,
-			ErrorRate:    b.ErrorRate(),
-			AvgLatencyMs: float64(b.AvgLatency()) / float64(time.Millisecond),
-			BytesIn:      b.BytesIn,
-			BytesOut:     b.BytesOut,
-		}
+		points[i] = newHistoryPoint(b, bucketSize)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"route":   route,
-		"from":    from,
-		"to":      to,
-		"history": points,
+		"route":       route,
+		"from":        from,
+		"to":          to,
+		"bucket_size": bucketSize.String(),
+		"history":     points,
 	})
 }
 
@@ -159,6 +264,37 @@ func (api *AnalyticsAPI) handleAnomalies(w http.ResponseWriter, r *http.Request)
 	})
 }
 
+// SetAlertStatus allows main.go to inject the alert engine's rule states.
+func (api *AnalyticsAPI) SetAlertStatus(fn func() []AlertStatus) {
+	api.alertStatus = fn
+}
+
+// handleAlerts returns every alert rule and whether it is firing.
+// GET /analytics/alerts
+func (api *AnalyticsAPI) handleAlerts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	alerts := []AlertStatus{}
+	if api.alertStatus != nil {
+		alerts = api.alertStatus()
+	}
+	firing := 0
+	for _, a := range alerts {
+		if a.Firing {
+			firing++
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"alerts": alerts,
+		"firing": firing,
+	})
+}
+
 // backendSummary is the JSON response for a single backend in GET /analytics/backends.
 type backendSummary struct {
 	Backend      string  `json:"backend"`
@@ -215,3 +351,76 @@ func (api *AnalyticsAPI) handleBackends(w http.ResponseWriter, r *http.Request)
 		"backends": summaries,
 	})
 }
+
+// backendHistoryPoint is a history point with the load balancer weight
+// the backend had at the end of the bucket, if it's weighted.
+type backendHistoryPoint struct {
+	historyPoint
+	Weight *float64 `json:"weight,omitempty"`
+}
+
+// handleBackendHistory returns time-series data for a backend alongside
+// its load balancer weights, so weight changes can be lined up with
+// latency and error rate.
+// GET /analytics/backends/{backend}/history?window=1h
+// backend is the URL-escaped backend URL, or just its host:port.
+func (api *AnalyticsAPI) handleBackendHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Use the escaped path: a backend URL's "//" would be cleaned away
+	name, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.EscapedPath(), "/backends/"), "/history")
+	if !ok || name == "" {
+		http.Error(w, "backend parameter required", http.StatusBadRequest)
+		return
+	}
+	name, err := url.PathUnescape(name)
+	if err != nil {
+		http.Error(w, "invalid backend: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	bucketSize := api.store.BucketSize()
+	from, to, err := historyRange(r, bucketSize)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	all := api.store.GetBackendBuckets(from, to)
+	backend := name
+	if _, ok := all[backend]; !ok {
+		for b := range all {
+			if u, err := url.Parse(b); err == nil && u.Host == name {
+				backend = b
+				break
+			}
+		}
+	}
+	buckets := all[backend]
+	weights := api.analyzer.WeightHistory(backend, from, to)
+	if len(buckets) == 0 && len(weights) == 0 && api.analyzer.GetBackendBaseline(backend) == nil {
+		http.Error(w, fmt.Sprintf("unknown backend %q", name), http.StatusNotFound)
+		return
+	}
+
+	points := make([]backendHistoryPoint, len(buckets))
+	for i, b := range buckets {
+		points[i] = backendHistoryPoint{
+			historyPoint: newHistoryPoint(b, bucketSize),
+			Weight:       weightAt(weights, b.Timestamp.Add(b.Width)),
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"backend":     backend,
+		"from":        from,
+		"to":          to,
+		"bucket_size": bucketSize.String(),
+		"history":     points,
+		"weights":     weights,
+	})
+}
@@ -0,0 +1,89 @@
+package analytics
+
+import (
+	"log"
+	"time"
+)
+
+// ColdStartPolicy covers routes and backends that don't have enough history
+// for learned limits yet. Without it a brand-new route gets no adaptive
+// limit and its backends a generous 50% breaker threshold, which makes a
+// launch the riskiest moment. Applied until MinSamples buckets are seen.
+type ColdStartPolicy struct {
+	MinSamples       int     // buckets of history needed to leave cold start (default 10)
+	RateLimit        float64 // per-client requests per minute on a cold route (default 60)
+	BreakerErrorRate float64 // error rate that trips the breaker for a cold backend (default 0.2)
+}
+
+// SetColdStart enables the cold-start policy, filling in defaults for
+// zero fields. Must be called before Start.
+func (a *Analyzer) SetColdStart(p ColdStartPolicy) {
+	if p.MinSamples <= 0 {
+		p.MinSamples = 10
+	}
+	if p.RateLimit <= 0 {
+		p.RateLimit = 60
+	}
+	if p.BreakerErrorRate <= 0 {
+		p.BreakerErrorRate = 0.2
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.coldStart = &p
+}
+
+// ColdStart returns the cold-start policy, or nil if it's disabled.
+func (a *Analyzer) ColdStart() *ColdStartPolicy {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.coldStart == nil {
+		return nil
+	}
+	cp := *a.coldStart
+	return &cp
+}
+
+// RouteIsCold reports whether a route is still under the cold-start policy.
+// Always false when the policy is disabled.
+func (a *Analyzer) RouteIsCold(route string) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.coldStart == nil {
+		return false
+	}
+	b, ok := a.routeBaselines[route]
+	return !ok || b.SampleSize < a.coldStart.MinSamples
+}
+
+// BackendIsCold reports whether a backend is still under the cold-start
+// policy. Always false when the policy is disabled.
+func (a *Analyzer) BackendIsCold(backend string) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.coldStart == nil {
+		return false
+	}
+	b, ok := a.backendBaselines[backend]
+	return !ok || b.SampleSize < a.coldStart.MinSamples
+}
+
+// RouteWarmedAt returns when a route left cold start, if it has.
+func (a *Analyzer) RouteWarmedAt(route string) (time.Time, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	t, ok := a.warmedAt[route]
+	return t, ok
+}
+
+// markWarmed records a route leaving cold start. Must hold a.mu.
+func (a *Analyzer) markWarmed(route string, samples int, now time.Time) {
+	if a.coldStart == nil || samples < a.coldStart.MinSamples {
+		return
+	}
+	if _, done := a.warmedAt[route]; done {
+		return
+	}
+	a.warmedAt[route] = now
+	log.Printf("[analyzer] route %s left cold start after %d samples", route, samples)
+}
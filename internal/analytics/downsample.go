@@ -0,0 +1,117 @@
+package analytics
+
+import (
+	"fmt"
+	"time"
+)
+
+// DownsampleTier rolls buckets older than After up into Interval-wide
+// buckets. With tiers {6h, 5m} and {24h, 1h}, a 48h retention keeps
+// 1-minute buckets for the last 6 hours, 5-minute buckets to a day, and
+// hourly buckets beyond, about 600 buckets per series instead of 2880.
+type DownsampleTier struct {
+	After    time.Duration
+	Interval time.Duration
+}
+
+// cutoff returns the end of the oldest whole Interval periods that are
+// past After at now; buckets before it are rolled up.
+func (t DownsampleTier) cutoff(now time.Time) time.Time {
+	return now.Add(-t.After).Truncate(t.Interval)
+}
+
+// ValidateDownsampling checks that tiers are ordered by age with widening
+// intervals, each a multiple of the previous one (and of bucketSize).
+func ValidateDownsampling(tiers []DownsampleTier, bucketSize time.Duration) error {
+	prev := DownsampleTier{Interval: bucketSize}
+	for _, t := range tiers {
+		if t.After <= prev.After {
+			return fmt.Errorf("downsample tier after %s must be older than the previous tier (%s)", t.After, prev.After)
+		}
+		if t.Interval <= prev.Interval || t.Interval%prev.Interval != 0 {
+			return fmt.Errorf("downsample interval %s must be a multiple of %s", t.Interval, prev.Interval)
+		}
+		prev = t
+	}
+	return nil
+}
+
+// SetDownsampling rolls old buckets up into wider ones on each cleanup,
+// so long retention costs less memory and storage. Reads return a mix of
+// widths: consumers should use Bucket.Width and RatePerMinute rather than
+// assume the store's bucket size. Must be called before recording.
+func (s *MemoryTrafficStore) SetDownsampling(tiers []DownsampleTier) error {
+	if err := ValidateDownsampling(tiers, s.bucketSize); err != nil {
+		return err
+	}
+	s.downsample = tiers
+	return nil
+}
+
+// MaxBucketWidth returns the widest bucket the store may hold: the last
+// downsample tier's interval, or the bucket size without downsampling.
+func (s *MemoryTrafficStore) MaxBucketWidth() time.Duration {
+	if n := len(s.downsample); n > 0 {
+		return s.downsample[n-1].Interval
+	}
+	return s.bucketSize
+}
+
+// widestBucket returns the widest bucket store may hold, for readers
+// that need to find a downsampled bucket starting before their range.
+func widestBucket(store TrafficStore) time.Duration {
+	if s, ok := store.(interface{ MaxBucketWidth() time.Duration }); ok {
+		return s.MaxBucketWidth()
+	}
+	return store.BucketSize()
+}
+
+// rollup merges buckets narrower than each tier's interval into buckets
+// of that interval once they're past the tier's cutoff. Returns the keys
+// of the merged buckets.
+func (s *MemoryTrafficStore) rollup(now time.Time) map[bucketKey]struct{} {
+	changed := make(map[bucketKey]struct{})
+	for _, tier := range s.downsample {
+		cutoff := tier.cutoff(now)
+		for _, sh := range s.shards {
+			sh.mu.Lock()
+			for _, kind := range []string{"route", "backend"} {
+				for key, bucketMap := range sh.series(kind) {
+					for _, start := range rollupSeries(key, bucketMap, tier.Interval, cutoff) {
+						changed[bucketKey{kind, key, start}] = struct{}{}
+					}
+				}
+			}
+			sh.mu.Unlock()
+		}
+	}
+	return changed
+}
+
+// rollupSeries merges a series' buckets narrower than interval and before
+// cutoff into interval-wide buckets, returning their starts. Must hold the
+// series' shard lock.
+func rollupSeries(key string, bucketMap map[time.Time]*Bucket, interval time.Duration, cutoff time.Time) []time.Time {
+	// Take the narrow buckets out first: a rolled-up bucket can start at
+	// the same time as one of them
+	var narrow []*Bucket
+	for start, b := range bucketMap {
+		if b.Width < interval && start.Before(cutoff) {
+			narrow = append(narrow, b)
+			delete(bucketMap, start)
+		}
+	}
+
+	var starts []time.Time
+	for _, b := range narrow {
+		start := b.Timestamp.Truncate(interval)
+		dst, ok := bucketMap[start]
+		if !ok {
+			dst = &Bucket{Route: key, Timestamp: start, Width: interval}
+			bucketMap[start] = dst
+		}
+		dst.add(*b)
+		starts = append(starts, start)
+	}
+	return starts
+}
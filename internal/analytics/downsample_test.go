@@ -0,0 +1,96 @@
+package analytics
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// totals sums the buckets of a series.
+func totals(buckets []Bucket) (b Bucket) {
+	for _, other := range buckets {
+		b.add(other)
+	}
+	return b
+}
+
+func TestDownsamplingPreservesTotals(t *testing.T) {
+	store := NewMemoryTrafficStore(48*time.Hour, time.Minute)
+	err := store.SetDownsampling([]DownsampleTier{
+		{After: time.Hour, Interval: 5 * time.Minute},
+		{After: 6 * time.Hour, Interval: 30 * time.Minute},
+	})
+	if err != nil {
+		t.Fatalf("SetDownsampling: %v", err)
+	}
+
+	now := time.Now().Truncate(30 * time.Minute)
+	from, to := now.Add(-8*time.Hour), now
+	for ts := from; ts.Before(to); ts = ts.Add(time.Minute) {
+		status := http.StatusOK
+		if ts.Minute()%10 == 0 {
+			status = http.StatusBadGateway
+		}
+		store.Record(TrafficEvent{Route: "/api", Backend: "http://b1", Status: status,
+			Latency: time.Duration(1+ts.Minute()) * time.Millisecond, BytesIn: 10, BytesOut: 100, Timestamp: ts})
+	}
+	before := totals(store.GetBuckets("/api", from, to))
+	beforeBackend := totals(store.GetBackendBuckets(from, to)["http://b1"])
+
+	store.rollup(now)
+
+	buckets := store.GetBuckets("/api", from, to)
+	widths := make(map[time.Duration]int)
+	for _, b := range buckets {
+		widths[b.Width]++
+		if !b.Timestamp.Equal(b.Timestamp.Truncate(b.Width)) {
+			t.Errorf("Expected a %s bucket aligned to its width, got %s", b.Width, b.Timestamp)
+		}
+	}
+	// 8h: the last hour stays at 1m, 1h-6h becomes 5m, 6h-8h becomes 30m
+	want := map[time.Duration]int{time.Minute: 60, 5 * time.Minute: 60, 30 * time.Minute: 4}
+	for width, n := range want {
+		if widths[width] != n {
+			t.Errorf("Expected %d buckets of %s, got %v", n, width, widths)
+		}
+	}
+
+	for name, pair := range map[string][2]Bucket{
+		"route":   {before, totals(buckets)},
+		"backend": {beforeBackend, totals(store.GetBackendBuckets(from, to)["http://b1"])},
+	} {
+		b, a := pair[0], pair[1]
+		if a.RequestCount != b.RequestCount || a.ErrorCount != b.ErrorCount || a.TotalLatency != b.TotalLatency ||
+			a.MaxLatency != b.MaxLatency || a.BytesIn != b.BytesIn || a.BytesOut != b.BytesOut {
+			t.Errorf("%s: expected totals preserved, got %+v, want %+v", name, a, b)
+		}
+		if a.Latency.String() != b.Latency.String() {
+			t.Errorf("%s: expected the latency histogram preserved, got %s, want %s", name, a.Latency, b.Latency)
+		}
+	}
+
+	// Rolling up again changes nothing
+	store.rollup(now)
+	if again := store.GetBuckets("/api", from, to); len(again) != len(buckets) || totals(again).RequestCount != before.RequestCount {
+		t.Errorf("Expected a second rollup to be a no-op, got %d buckets", len(again))
+	}
+}
+
+func TestValidateDownsampling(t *testing.T) {
+	tests := []struct {
+		name  string
+		tiers []DownsampleTier
+		ok    bool
+	}{
+		{"none", nil, true},
+		{"widening tiers", []DownsampleTier{{time.Hour, 5 * time.Minute}, {6 * time.Hour, time.Hour}}, true},
+		{"interval not a multiple", []DownsampleTier{{time.Hour, 5 * time.Minute}, {6 * time.Hour, 7 * time.Minute}}, false},
+		{"interval not wider", []DownsampleTier{{time.Hour, time.Minute}}, false},
+		{"tiers out of order", []DownsampleTier{{6 * time.Hour, 5 * time.Minute}, {time.Hour, time.Hour}}, false},
+	}
+	for _, tt := range tests {
+		if err := ValidateDownsampling(tt.tiers, time.Minute); (err == nil) != tt.ok {
+			t.Errorf("%s: expected ok=%v, got %v", tt.name, tt.ok, err)
+		}
+	}
+}
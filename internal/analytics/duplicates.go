@@ -0,0 +1,47 @@
+package analytics
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// DuplicateStats is one client's request duplication within the dedup window.
+type DuplicateStats struct {
+	Client     string  `json:"client"`
+	Requests   int     `json:"requests"`   // signed or idempotency-keyed requests seen
+	Duplicates int     `json:"duplicates"` // of those, repeats of a signature already seen
+	Rate       float64 `json:"rate"`       // duplicates / requests
+	Flagged    bool    `json:"flagged"`    // rate is abnormally high
+}
+
+// SetDuplicateStats allows main.go to inject the dedup tracker's per-client stats.
+func (api *AnalyticsAPI) SetDuplicateStats(fn func() []DuplicateStats) {
+	api.duplicateStats = fn
+}
+
+// handleDuplicates returns per-client duplication rates, flagged clients first.
+// GET /analytics/duplicates
+func (api *AnalyticsAPI) handleDuplicates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if api.duplicateStats == nil {
+		http.Error(w, "Deduplication tracking not enabled", http.StatusNotFound)
+		return
+	}
+
+	clients := api.duplicateStats()
+	flagged := 0
+	for _, c := range clients {
+		if c.Flagged {
+			flagged++
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"clients": clients,
+		"flagged": flagged,
+	})
+}
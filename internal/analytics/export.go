@@ -0,0 +1,153 @@
+package analytics
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// exportRow is one bucket in an export.
+type exportRow struct {
+	Series       string    `json:"series"` // route or backend
+	Timestamp    time.Time `json:"timestamp"`
+	WidthSeconds int       `json:"width_seconds"` // wider than the bucket size once downsampled
+	RequestCount int       `json:"request_count"`
+	ErrorCount   int       `json:"error_count"`
+	ErrorRate    float64   `json:"error_rate"`
+	AvgLatencyMs float64   `json:"avg_latency_ms"`
+	MaxLatencyMs float64   `json:"max_latency_ms"`
+	P50LatencyMs float64   `json:"p50_latency_ms"`
+	P95LatencyMs float64   `json:"p95_latency_ms"`
+	P99LatencyMs float64   `json:"p99_latency_ms"`
+	BytesIn      int64     `json:"bytes_in"`
+	BytesOut     int64     `json:"bytes_out"`
+	Rejected     int       `json:"rejected"`
+	Anonymous    int       `json:"anonymous"`
+}
+
+// exportColumns is the CSV header, in exportRow field order.
+var exportColumns = []string{
+	"series", "timestamp", "width_seconds", "request_count", "error_count", "error_rate",
+	"avg_latency_ms", "max_latency_ms", "p50_latency_ms", "p95_latency_ms", "p99_latency_ms",
+	"bytes_in", "bytes_out", "rejected", "anonymous",
+}
+
+func newExportRow(series string, b Bucket) exportRow {
+	return exportRow{
+		Series:       series,
+		Timestamp:    b.Timestamp,
+		WidthSeconds: int(b.Width / time.Second),
+		RequestCount: b.RequestCount,
+		ErrorCount:   b.ErrorCount,
+		ErrorRate:    b.ErrorRate(),
+		AvgLatencyMs: float64(b.AvgLatency()) / float64(time.Millisecond),
+		MaxLatencyMs: float64(b.MaxLatency) / float64(time.Millisecond),
+		P50LatencyMs: b.Latency.QuantileMs(0.50),
+		P95LatencyMs: b.Latency.QuantileMs(0.95),
+		P99LatencyMs: b.Latency.QuantileMs(0.99),
+		BytesIn:      b.BytesIn,
+		BytesOut:     b.BytesOut,
+		Rejected:     b.Rejected,
+		Anonymous:    b.Anonymous,
+	}
+}
+
+// csvRecord formats the row for encoding/csv.
+func (r exportRow) csvRecord() []string {
+	f := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	return []string{
+		r.Series, r.Timestamp.Format(time.RFC3339), strconv.Itoa(r.WidthSeconds), strconv.Itoa(r.RequestCount), strconv.Itoa(r.ErrorCount), f(r.ErrorRate),
+		f(r.AvgLatencyMs), f(r.MaxLatencyMs), f(r.P50LatencyMs), f(r.P95LatencyMs), f(r.P99LatencyMs),
+		strconv.FormatInt(r.BytesIn, 10), strconv.FormatInt(r.BytesOut, 10), strconv.Itoa(r.Rejected), strconv.Itoa(r.Anonymous),
+	}
+}
+
+// handleExport streams raw buckets as CSV or NDJSON for offline analysis.
+// GET /analytics/export?route=/api/v1&from=...&to=...&format=csv
+//
+//   - route: one route; omitted exports every route
+//   - backends=true: export per-backend buckets instead (route is ignored)
+//   - from, to: RFC 3339 times; default the last 24h up to now
+//   - format: "ndjson" (default) or "csv"
+func (api *AnalyticsAPI) handleExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	to := time.Now()
+	from := to.Add(-24 * time.Hour)
+	for name, dst := range map[string]*time.Time{"from": &from, "to": &to} {
+		if v := q.Get(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				http.Error(w, "invalid "+name+": "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			*dst = t
+		}
+	}
+	if !from.Before(to) {
+		http.Error(w, "from must be before to", http.StatusBadRequest)
+		return
+	}
+	format := q.Get("format")
+	if format == "" {
+		format = "ndjson"
+	}
+	if format != "ndjson" && format != "csv" {
+		http.Error(w, `format must be "ndjson" or "csv"`, http.StatusBadRequest)
+		return
+	}
+
+	var series map[string][]Bucket
+	switch {
+	case q.Get("backends") == "true":
+		series = api.store.GetBackendBuckets(from, to)
+	case q.Get("route") != "":
+		route := q.Get("route")
+		series = map[string][]Bucket{route: api.store.GetBuckets(route, from, to)}
+	default:
+		series = api.store.GetAllBuckets(from, to)
+	}
+	names := make([]string, 0, len(series))
+	for name := range series {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	filename := "traffic-" + from.UTC().Format("20060102T1504") + "." + format
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	flusher, _ := w.(http.Flusher)
+
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		cw := csv.NewWriter(w)
+		cw.Write(exportColumns)
+		for _, name := range names {
+			for _, b := range series[name] {
+				cw.Write(newExportRow(name, b).csvRecord())
+			}
+			cw.Flush()
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(w)
+	for _, name := range names {
+		for _, b := range series[name] {
+			enc.Encode(newExportRow(name, b))
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
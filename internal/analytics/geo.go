@@ -0,0 +1,234 @@
+package analytics
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// UnknownCountry groups traffic from IPs GeoIP couldn't place, such as
+// private addresses.
+const UnknownCountry = "(unknown)"
+
+// maxBucketASNs bounds the distinct ASNs kept per country per bucket;
+// traffic from further ones is counted under ASN 0.
+const maxBucketASNs = 100
+
+// CountryTraffic is one country's share of traffic over a window.
+type CountryTraffic struct {
+	Country      string       `json:"country"` // ISO code, or UnknownCountry
+	Requests     int          `json:"requests"`
+	Errors       int          `json:"errors"`
+	ErrorRate    float64      `json:"error_rate"`
+	AvgLatencyMs float64      `json:"avg_latency_ms"`
+	BytesOut     int64        `json:"bytes_out"`
+	Rejected     int          `json:"rejected"` // gateway-generated responses, excluded from the counts above
+	TopASNs      []ASNTraffic `json:"top_asns,omitempty"`
+}
+
+// ASNTraffic is one autonomous system's requests within a country.
+type ASNTraffic struct {
+	ASN      uint32 `json:"asn"` // 0 for unknown or folded-in ASNs
+	Org      string `json:"org,omitempty"`
+	Requests int    `json:"requests"`
+}
+
+// countryBucket aggregates one country's traffic in one bucket.
+type countryBucket struct {
+	requests     int
+	errors       int
+	rejected     int
+	totalLatency time.Duration
+	bytesOut     int64
+	asns         map[uint32]int
+}
+
+// GeoStats aggregates traffic per country (and ASN) in time buckets,
+// from events tagged by GeoIP. It is kept in memory alongside the
+// TrafficStore rather than as extra series in it, so the per-route
+// analyzer, alerts, and persistent stores are unaffected.
+type GeoStats struct {
+	bucketSize time.Duration
+	retention  time.Duration
+
+	mu      sync.Mutex
+	buckets map[time.Time]map[string]*countryBucket
+	orgs    map[uint32]string // ASN -> organization, as last seen
+}
+
+// NewGeoStats creates a GeoStats with the given bucket width (default 1m)
+// and retention (default 24h).
+func NewGeoStats(bucketSize, retention time.Duration) *GeoStats {
+	if bucketSize <= 0 {
+		bucketSize = DefaultBucketSize
+	}
+	if retention <= 0 {
+		retention = 24 * time.Hour
+	}
+	return &GeoStats{
+		bucketSize: bucketSize,
+		retention:  retention,
+		buckets:    make(map[time.Time]map[string]*countryBucket),
+		orgs:       make(map[uint32]string),
+	}
+}
+
+// BucketSize returns the width of each bucket.
+func (g *GeoStats) BucketSize() time.Duration {
+	return g.bucketSize
+}
+
+// RecordBatch adds events to their countries' buckets. Expired buckets
+// are dropped whenever a new one is started.
+func (g *GeoStats) RecordBatch(events []TrafficEvent) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for i := range events {
+		e := &events[i]
+		start := e.Timestamp.Truncate(g.bucketSize)
+		countries, ok := g.buckets[start]
+		if !ok {
+			countries = make(map[string]*countryBucket)
+			g.buckets[start] = countries
+			g.expire(start)
+		}
+		country := e.Country
+		if country == "" {
+			country = UnknownCountry
+		}
+		b, ok := countries[country]
+		if !ok {
+			b = &countryBucket{asns: make(map[uint32]int)}
+			countries[country] = b
+		}
+
+		n := e.weight()
+		if e.GatewayGenerated {
+			b.rejected += n
+			continue
+		}
+		b.requests += n
+		b.totalLatency += time.Duration(n) * e.Latency
+		b.bytesOut += int64(n) * e.BytesOut
+		if e.Status >= 500 {
+			b.errors += n
+		}
+		asn := e.ASN
+		if _, seen := b.asns[asn]; !seen && len(b.asns) >= maxBucketASNs {
+			asn = 0
+		}
+		b.asns[asn] += n
+		if e.ASOrg != "" {
+			g.orgs[e.ASN] = e.ASOrg
+		}
+	}
+}
+
+// expire drops buckets older than the retention before now. Must hold g.mu.
+func (g *GeoStats) expire(now time.Time) {
+	cutoff := now.Add(-g.retention)
+	for ts := range g.buckets {
+		if ts.Before(cutoff) {
+			delete(g.buckets, ts)
+		}
+	}
+}
+
+// Countries returns per-country traffic within [from, to), busiest
+// first, each with its topASNs busiest autonomous systems.
+func (g *GeoStats) Countries(from, to time.Time, topASNs int) []CountryTraffic {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	totals := make(map[string]*countryBucket)
+	for ts, countries := range g.buckets {
+		if ts.Before(from) || !ts.Before(to) {
+			continue
+		}
+		for country, b := range countries {
+			t, ok := totals[country]
+			if !ok {
+				t = &countryBucket{asns: make(map[uint32]int)}
+				totals[country] = t
+			}
+			t.requests += b.requests
+			t.errors += b.errors
+			t.rejected += b.rejected
+			t.totalLatency += b.totalLatency
+			t.bytesOut += b.bytesOut
+			for asn, n := range b.asns {
+				t.asns[asn] += n
+			}
+		}
+	}
+
+	out := make([]CountryTraffic, 0, len(totals))
+	for country, t := range totals {
+		c := CountryTraffic{
+			Country:  country,
+			Requests: t.requests,
+			Errors:   t.errors,
+			BytesOut: t.bytesOut,
+			Rejected: t.rejected,
+		}
+		if t.requests > 0 {
+			c.ErrorRate = float64(t.errors) / float64(t.requests)
+			c.AvgLatencyMs = float64(t.totalLatency) / float64(t.requests) / float64(time.Millisecond)
+		}
+		for asn, n := range t.asns {
+			c.TopASNs = append(c.TopASNs, ASNTraffic{ASN: asn, Org: g.orgs[asn], Requests: n})
+		}
+		sort.Slice(c.TopASNs, func(i, j int) bool {
+			if c.TopASNs[i].Requests != c.TopASNs[j].Requests {
+				return c.TopASNs[i].Requests > c.TopASNs[j].Requests
+			}
+			return c.TopASNs[i].ASN < c.TopASNs[j].ASN
+		})
+		if len(c.TopASNs) > topASNs {
+			c.TopASNs = c.TopASNs[:topASNs]
+		}
+		out = append(out, c)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Requests != out[j].Requests {
+			return out[i].Requests > out[j].Requests
+		}
+		return out[i].Country < out[j].Country
+	})
+	return out
+}
+
+// SetGeoStats allows main.go to inject per-country traffic, when GeoIP
+// is configured.
+func (api *AnalyticsAPI) SetGeoStats(g *GeoStats) {
+	api.geo = g
+}
+
+// handleCountries returns traffic broken down by client country.
+// GET /analytics/countries?window=1h
+// window defaults to 1h and must be a multiple of the bucket size.
+func (api *AnalyticsAPI) handleCountries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if api.geo == nil {
+		http.Error(w, "GeoIP not enabled", http.StatusNotFound)
+		return
+	}
+	from, to, err := historyRange(r, api.geo.BucketSize())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"from":      from,
+		"to":        to,
+		"countries": api.geo.Countries(from, to, 5),
+	})
+}
@@ -0,0 +1,131 @@
+package analytics
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// histogramBinsPerDoubling sets the resolution of LatencyHistogram: each
+// bin is 2^(1/4) ≈ 19% wider than the previous, so a percentile read from
+// it is within about 10% of the true value.
+const histogramBinsPerDoubling = 4
+
+// histogramMaxBins bounds the histogram at about 65s (1ms × 2^16); slower
+// requests land in the last bin.
+const histogramMaxBins = 16*histogramBinsPerDoubling + 1
+
+// LatencyHistogram counts latencies in exponentially sized bins: bin 0
+// holds everything up to 1ms and bin i everything up to 1ms × 2^(i/4).
+// The slice only grows as far as the slowest bin seen, so a bucket of
+// fast requests stays small. Histograms from several buckets can be
+// merged, which is what makes true percentiles over a window possible;
+// averaging per-bucket percentiles is not.
+type LatencyHistogram []uint32
+
+// histogramBin returns the bin index for a latency.
+func histogramBin(d time.Duration) int {
+	if d <= time.Millisecond {
+		return 0
+	}
+	ms := float64(d) / float64(time.Millisecond)
+	bin := int(math.Ceil(math.Log2(ms) * histogramBinsPerDoubling))
+	return min(bin, histogramMaxBins-1)
+}
+
+// histogramUpper returns the upper bound of a bin.
+func histogramUpper(bin int) time.Duration {
+	return time.Duration(math.Exp2(float64(bin)/histogramBinsPerDoubling) * float64(time.Millisecond))
+}
+
+// Add counts one latency.
+func (h *LatencyHistogram) Add(d time.Duration) {
+	h.addN(d, 1)
+}
+
+// addN counts a latency n times, for sampled events.
+func (h *LatencyHistogram) addN(d time.Duration, n uint32) {
+	bin := histogramBin(d)
+	if bin >= len(*h) {
+		grown := make(LatencyHistogram, bin+1)
+		copy(grown, *h)
+		*h = grown
+	}
+	(*h)[bin] += n
+}
+
+// Merge adds other's counts into h.
+func (h *LatencyHistogram) Merge(other LatencyHistogram) {
+	if len(other) > len(*h) {
+		grown := make(LatencyHistogram, len(other))
+		copy(grown, *h)
+		*h = grown
+	}
+	for i, n := range other {
+		(*h)[i] += n
+	}
+}
+
+// Count returns the number of latencies recorded.
+func (h LatencyHistogram) Count() int {
+	total := 0
+	for _, n := range h {
+		total += int(n)
+	}
+	return total
+}
+
+// Quantile returns the latency below which a fraction q of the recorded
+// latencies fall, interpolated within the bin it lands in. Returns 0 for
+// an empty histogram.
+func (h LatencyHistogram) Quantile(q float64) time.Duration {
+	total := h.Count()
+	if total == 0 {
+		return 0
+	}
+	rank := max(int(math.Ceil(q*float64(total))), 1)
+	seen := 0
+	for i, n := range h {
+		if n == 0 || seen+int(n) < rank {
+			seen += int(n)
+			continue
+		}
+		var lower time.Duration
+		if i > 0 {
+			lower = histogramUpper(i - 1)
+		}
+		upper := histogramUpper(i)
+		return lower + time.Duration(float64(upper-lower)*float64(rank-seen)/float64(n))
+	}
+	return histogramUpper(len(h) - 1)
+}
+
+// QuantileMs is Quantile in milliseconds.
+func (h LatencyHistogram) QuantileMs(q float64) float64 {
+	return float64(h.Quantile(q)) / float64(time.Millisecond)
+}
+
+// String encodes the histogram as comma-separated bin counts, for storage.
+func (h LatencyHistogram) String() string {
+	parts := make([]string, len(h))
+	for i, n := range h {
+		parts[i] = strconv.FormatUint(uint64(n), 10)
+	}
+	return strings.Join(parts, ",")
+}
+
+// ParseLatencyHistogram decodes a histogram written by String. Malformed
+// bins are read as zero.
+func ParseLatencyHistogram(s string) LatencyHistogram {
+	if s == "" {
+		return nil
+	}
+	parts := strings.Split(s, ",")
+	h := make(LatencyHistogram, min(len(parts), histogramMaxBins))
+	for i := range h {
+		n, _ := strconv.ParseUint(parts[i], 10, 32)
+		h[i] = uint32(n)
+	}
+	return h
+}
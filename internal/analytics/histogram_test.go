@@ -0,0 +1,123 @@
+package analytics
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// histogramOf records each latency n times.
+func histogramOf(n int, latencies ...time.Duration) LatencyHistogram {
+	var h LatencyHistogram
+	for _, d := range latencies {
+		for range n {
+			h.Add(d)
+		}
+	}
+	return h
+}
+
+// closeTo reports whether got is within one bin width (about 19%) of want.
+func closeTo(got, want time.Duration) bool {
+	return got >= want*84/100 && got <= want*119/100
+}
+
+func TestLatencyHistogramQuantile(t *testing.T) {
+	tests := []struct {
+		name string
+		h    LatencyHistogram
+		q    float64
+		want time.Duration
+	}{
+		{"single bin median", histogramOf(10, 5*time.Millisecond), 0.5, 5 * time.Millisecond},
+		{"single bin max", histogramOf(10, 5*time.Millisecond), 1, 5 * time.Millisecond},
+		{"q of zero is the fastest", histogramOf(1, 2*time.Millisecond, 200*time.Millisecond), 0, 2 * time.Millisecond},
+		{"p50 of a bimodal window", histogramOf(50, 10*time.Millisecond, 400*time.Millisecond), 0.5, 10 * time.Millisecond},
+		{"p95 of a bimodal window", histogramOf(50, 10*time.Millisecond, 400*time.Millisecond), 0.95, 400 * time.Millisecond},
+		{"many bins", histogramOf(1, 1*time.Millisecond, 2*time.Millisecond, 4*time.Millisecond, 8*time.Millisecond), 0.75, 4 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := tt.h.Quantile(tt.q); !closeTo(got, tt.want) {
+			t.Errorf("%s: expected about %s, got %s", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestLatencyHistogramEdges(t *testing.T) {
+	var empty LatencyHistogram
+	if empty.Count() != 0 || empty.Quantile(0.99) != 0 || empty.QuantileMs(0.5) != 0 {
+		t.Errorf("Expected an empty histogram to read zero, got count %d p99 %s", empty.Count(), empty.Quantile(0.99))
+	}
+
+	// Everything up to 1ms shares the first bin
+	fast := histogramOf(4, 0, 100*time.Microsecond, time.Millisecond)
+	if len(fast) != 1 || fast.Count() != 12 {
+		t.Errorf("Expected sub-millisecond latencies in one bin, got %v", fast)
+	}
+	if got := fast.Quantile(1); got > time.Millisecond {
+		t.Errorf("Expected sub-millisecond p100 at most 1ms, got %s", got)
+	}
+
+	// Anything slower than the last bin lands in it
+	slow := histogramOf(1, 10*time.Minute, time.Hour)
+	if len(slow) != histogramMaxBins || slow[histogramMaxBins-1] != 2 {
+		t.Errorf("Expected overflowing latencies in the last of %d bins, got %d bins", histogramMaxBins, len(slow))
+	}
+	if got, want := slow.Quantile(1), histogramUpper(histogramMaxBins-1); got != want {
+		t.Errorf("Expected an overflowing p100 capped at %s, got %s", want, got)
+	}
+
+	// A sampled event counts for its weight
+	var weighted LatencyHistogram
+	weighted.addN(10*time.Millisecond, 9)
+	weighted.Add(time.Second)
+	if weighted.Count() != 10 || !closeTo(weighted.Quantile(0.9), 10*time.Millisecond) {
+		t.Errorf("Expected a weight of 9 to count nine times, got count %d p90 %s", weighted.Count(), weighted.Quantile(0.9))
+	}
+}
+
+func TestLatencyHistogramMerge(t *testing.T) {
+	// Two buckets: a fast one and a short slow one
+	fast := histogramOf(90, 10*time.Millisecond)
+	slow := histogramOf(10, time.Second)
+
+	var window LatencyHistogram
+	window.Merge(fast)
+	window.Merge(slow)
+	if window.Count() != 100 {
+		t.Fatalf("Expected 100 latencies merged, got %d", window.Count())
+	}
+	all := histogramOf(90, 10*time.Millisecond)
+	for range 10 {
+		all.Add(time.Second)
+	}
+	if window.String() != all.String() {
+		t.Errorf("Expected merging to equal recording everything in one, got %s vs %s", window, all)
+	}
+	if !closeTo(window.Quantile(0.5), 10*time.Millisecond) || !closeTo(window.Quantile(0.99), time.Second) {
+		t.Errorf("Expected p50 near 10ms and p99 near 1s, got %s and %s", window.Quantile(0.5), window.Quantile(0.99))
+	}
+
+	// Merging a shorter histogram into a longer one leaves the tail alone
+	slow.Merge(fast)
+	if slow.Count() != 100 || len(slow) != len(all) {
+		t.Errorf("Expected a shorter histogram merged in place, got %d latencies in %d bins", slow.Count(), len(slow))
+	}
+}
+
+func TestLatencyHistogramEncoding(t *testing.T) {
+	h := histogramOf(3, 0, 5*time.Millisecond)
+	if got := ParseLatencyHistogram(h.String()); got.String() != h.String() {
+		t.Errorf("Expected %s to round-trip, got %s", h, got)
+	}
+	if got := ParseLatencyHistogram(""); got != nil {
+		t.Errorf("Expected an empty string to parse as nil, got %v", got)
+	}
+	if got := ParseLatencyHistogram("3,x,2"); got.String() != "3,0,2" {
+		t.Errorf("Expected malformed bins read as zero, got %s", got)
+	}
+	long := strings.Repeat("1,", 2*histogramMaxBins) + "1"
+	if got := ParseLatencyHistogram(long); len(got) != histogramMaxBins {
+		t.Errorf("Expected a stored histogram capped at %d bins, got %d", histogramMaxBins, len(got))
+	}
+}
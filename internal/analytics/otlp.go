@@ -0,0 +1,508 @@
+package analytics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// otlpMaxBacklog bounds how far back an export reaches after failed
+// pushes, so a long collector outage doesn't end in one huge request.
+const otlpMaxBacklog = time.Hour
+
+// otlpMaxAnomalies bounds the anomalies queued while the collector is
+// unreachable; the oldest are dropped first.
+const otlpMaxAnomalies = 1000
+
+// OTLPConfig configures an OTLPExporter.
+type OTLPConfig struct {
+	// Endpoint is the collector's OTLP/HTTP base URL, e.g.
+	// "http://otel-collector:4318"; /v1/metrics and /v1/logs are appended.
+	Endpoint string
+	Headers  map[string]string // extra request headers, e.g. an API key
+	Interval time.Duration     // how often to push (default the store's bucket size)
+	Timeout  time.Duration     // bounds each push (default 10s)
+
+	ServiceName string // service.name resource attribute (default "gateway")
+	Instance    string // service.instance.id resource attribute
+
+	// Gatherer, if set, is also exported each interval, so the gateway's
+	// Prometheus metrics reach the collector without a scrape.
+	Gatherer prometheus.Gatherer
+}
+
+// OTLPExporter pushes per-route and per-backend traffic metrics (request
+// and error counts, rates, latency histograms and percentiles) to an
+// OpenTelemetry collector over OTLP/HTTP with JSON encoding, and anomalies
+// as log records. Each push covers the buckets completed since the last
+// successful one, as delta sums.
+type OTLPExporter struct {
+	config   OTLPConfig
+	store    TrafficStore
+	client   *http.Client
+	resource otlpResource
+	started  time.Time // start time of cumulative Prometheus series
+
+	mu        sync.Mutex
+	last      time.Time // end of the last exported bucket
+	anomalies []Anomaly // waiting for the next push
+
+	stop chan struct{} // closed by Stop
+	done chan struct{} // closed when the push loop exits
+}
+
+// NewOTLPExporter creates an exporter for store's traffic.
+func NewOTLPExporter(store TrafficStore, config OTLPConfig) (*OTLPExporter, error) {
+	if config.Endpoint == "" {
+		return nil, fmt.Errorf("otlp: endpoint is required")
+	}
+	config.Endpoint = strings.TrimSuffix(config.Endpoint, "/")
+	if config.Interval <= 0 {
+		config.Interval = store.BucketSize()
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+	if config.ServiceName == "" {
+		config.ServiceName = "gateway"
+	}
+
+	attrs := []otlpKeyValue{otlpString("service.name", config.ServiceName)}
+	if config.Instance != "" {
+		attrs = append(attrs, otlpString("service.instance.id", config.Instance))
+	}
+	now := time.Now()
+	return &OTLPExporter{
+		config:   config,
+		store:    store,
+		client:   &http.Client{Timeout: config.Timeout},
+		resource: otlpResource{Attributes: attrs},
+		started:  now,
+		last:     now.Truncate(store.BucketSize()),
+	}, nil
+}
+
+// Start launches the background push loop.
+func (e *OTLPExporter) Start() {
+	e.stop = make(chan struct{})
+	e.done = make(chan struct{})
+	ticker := time.NewTicker(e.config.Interval)
+	go func() {
+		defer close(e.done)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := e.export(time.Now()); err != nil {
+					log.Printf("[otlp] %v", err)
+				}
+			case <-e.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends the push loop, then pushes once more so completed buckets and
+// queued anomalies aren't lost on shutdown.
+func (e *OTLPExporter) Stop() {
+	if e.stop == nil {
+		return
+	}
+	close(e.stop)
+	<-e.done
+	e.stop = nil
+	if err := e.export(time.Now()); err != nil {
+		log.Printf("[otlp] %v", err)
+	}
+}
+
+// NotifyAnomaly queues an anomaly to be sent as a log record with the
+// next push.
+func (e *OTLPExporter) NotifyAnomaly(anomaly Anomaly) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.anomalies = append(e.anomalies, anomaly)
+	if over := len(e.anomalies) - otlpMaxAnomalies; over > 0 {
+		e.anomalies = e.anomalies[over:]
+	}
+}
+
+// export pushes the buckets completed before now and any queued
+// anomalies. What fails to send is retried on the next call.
+func (e *OTLPExporter) export(now time.Time) error {
+	end := now.Truncate(e.store.BucketSize()) // the current bucket is still filling
+	e.mu.Lock()
+	from := e.last
+	anomalies := e.anomalies
+	e.mu.Unlock()
+	from = later(from, end.Add(-otlpMaxBacklog))
+
+	var errs []string
+	metrics := e.trafficMetrics(from, end)
+	if e.config.Gatherer != nil {
+		families, err := e.config.Gatherer.Gather()
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("gathering prometheus metrics: %v", err))
+		}
+		metrics = append(metrics, prometheusMetrics(families, e.started, now)...)
+	}
+	if len(metrics) > 0 {
+		err := e.post("/v1/metrics", otlpMetricsRequest{ResourceMetrics: []otlpResourceMetrics{{
+			Resource:     e.resource,
+			ScopeMetrics: []otlpScopeMetrics{{Scope: otlpScope, Metrics: metrics}},
+		}}})
+		if err != nil {
+			return fmt.Errorf("pushing metrics: %w", err)
+		}
+	}
+	e.mu.Lock()
+	e.last = end
+	e.mu.Unlock()
+
+	if len(anomalies) > 0 {
+		records := make([]otlpLogRecord, len(anomalies))
+		for i, a := range anomalies {
+			records[i] = anomalyLogRecord(a)
+		}
+		err := e.post("/v1/logs", otlpLogsRequest{ResourceLogs: []otlpResourceLogs{{
+			Resource:  e.resource,
+			ScopeLogs: []otlpScopeLogs{{Scope: otlpScope, LogRecords: records}},
+		}}})
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("pushing anomalies: %v", err))
+		} else {
+			e.mu.Lock()
+			e.anomalies = e.anomalies[len(anomalies):]
+			e.mu.Unlock()
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// post sends one OTLP request.
+func (e *OTLPExporter) post(path string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), e.config.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.config.Endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.config.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("collector returned %s", resp.Status)
+	}
+	return nil
+}
+
+// trafficMetrics converts the route and backend buckets in [from, to)
+// into OTLP metrics named gateway.route.* and gateway.backend.*.
+func (e *OTLPExporter) trafficMetrics(from, to time.Time) []otlpMetric {
+	if !from.Before(to) {
+		return nil
+	}
+	var metrics []otlpMetric
+	for _, kind := range []string{"route", "backend"} {
+		var series map[string][]Bucket
+		if kind == "route" {
+			series = e.store.GetAllBuckets(from, to)
+		} else {
+			series = e.store.GetBackendBuckets(from, to)
+		}
+		if len(series) == 0 {
+			continue
+		}
+		names := make([]string, 0, len(series))
+		for name := range series {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		var requests, errors, rates, errorRates, quantiles []otlpNumberPoint
+		var latencies []otlpHistogramPoint
+		for _, name := range names {
+			for _, b := range series[name] {
+				attrs := []otlpKeyValue{otlpString(kind, name)}
+				start, end := otlpTime(b.Timestamp), otlpTime(b.Timestamp.Add(b.Width))
+				point := func(v float64) otlpNumberPoint {
+					return otlpNumberPoint{Attributes: attrs, StartTimeUnixNano: start, TimeUnixNano: end, AsDouble: v}
+				}
+				requests = append(requests, point(float64(b.RequestCount)))
+				errors = append(errors, point(float64(b.ErrorCount)))
+				rates = append(rates, point(b.RatePerMinute()))
+				if b.RequestCount == 0 {
+					continue
+				}
+				errorRates = append(errorRates, point(b.ErrorRate()))
+				latencies = append(latencies, latencyPoint(attrs, start, end, b))
+				for _, q := range []float64{0.50, 0.95, 0.99} {
+					p := point(b.Latency.QuantileMs(q))
+					p.Attributes = append([]otlpKeyValue{otlpDouble("quantile", q)}, attrs...)
+					quantiles = append(quantiles, p)
+				}
+			}
+		}
+
+		prefix := "gateway." + kind + "."
+		metrics = append(metrics,
+			otlpMetric{Name: prefix + "requests", Unit: "{request}", Description: "Requests served",
+				Sum: &otlpSum{DataPoints: requests, AggregationTemporality: otlpDelta, IsMonotonic: true}},
+			otlpMetric{Name: prefix + "errors", Unit: "{request}", Description: "Requests answered with a 5xx status",
+				Sum: &otlpSum{DataPoints: errors, AggregationTemporality: otlpDelta, IsMonotonic: true}},
+			otlpMetric{Name: prefix + "request_rate", Unit: "{request}/min", Description: "Requests per minute",
+				Gauge: &otlpGauge{DataPoints: rates}},
+			otlpMetric{Name: prefix + "error_rate", Unit: "1", Description: "Fraction of requests answered with a 5xx status",
+				Gauge: &otlpGauge{DataPoints: errorRates}},
+			otlpMetric{Name: prefix + "latency", Unit: "ms", Description: "Request latency",
+				Histogram: &otlpHistogram{DataPoints: latencies, AggregationTemporality: otlpDelta}},
+			otlpMetric{Name: prefix + "latency.quantile", Unit: "ms", Description: "Request latency percentiles",
+				Gauge: &otlpGauge{DataPoints: quantiles}},
+		)
+	}
+	return metrics
+}
+
+// latencyPoint converts a bucket's LatencyHistogram into an explicit-bounds
+// histogram point: bin i becomes the bucket up to histogramUpper(i).
+func latencyPoint(attrs []otlpKeyValue, start, end string, b Bucket) otlpHistogramPoint {
+	p := otlpHistogramPoint{
+		Attributes:        attrs,
+		StartTimeUnixNano: start,
+		TimeUnixNano:      end,
+		Count:             strconv.Itoa(b.Latency.Count()),
+		Sum:               float64(b.TotalLatency) / float64(time.Millisecond),
+		BucketCounts:      make([]string, len(b.Latency)+1),
+		ExplicitBounds:    make([]float64, len(b.Latency)),
+	}
+	for i, n := range b.Latency {
+		p.BucketCounts[i] = strconv.FormatUint(uint64(n), 10)
+		p.ExplicitBounds[i] = float64(histogramUpper(i)) / float64(time.Millisecond)
+	}
+	p.BucketCounts[len(b.Latency)] = "0"
+	return p
+}
+
+// anomalyLogRecord converts an anomaly into an OTLP log record.
+func anomalyLogRecord(a Anomaly) otlpLogRecord {
+	return otlpLogRecord{
+		TimeUnixNano:   otlpTime(a.Timestamp),
+		SeverityNumber: 13, // WARN
+		SeverityText:   "WARN",
+		Body: otlpValue{"stringValue": fmt.Sprintf("%s anomaly on %s: current=%.4g mean=%.4g z=%.2f",
+			a.Metric, a.Route, a.Current, a.Mean, a.ZScore)},
+		Attributes: []otlpKeyValue{
+			otlpString("event.name", "gateway.anomaly"),
+			otlpString("anomaly.id", a.ID),
+			otlpString("route", a.Route),
+			otlpString("metric", a.Metric),
+			otlpString("direction", string(a.Direction)),
+			otlpDouble("current", a.Current),
+			otlpDouble("mean", a.Mean),
+			otlpDouble("std_dev", a.StdDev),
+			otlpDouble("z_score", a.ZScore),
+		},
+	}
+}
+
+// prometheusMetrics converts gathered Prometheus metric families into
+// cumulative OTLP metrics. Summaries and untyped metrics are skipped.
+func prometheusMetrics(families []*dto.MetricFamily, started, now time.Time) []otlpMetric {
+	start, ts := otlpTime(started), otlpTime(now)
+	var metrics []otlpMetric
+	for _, mf := range families {
+		m := otlpMetric{Name: mf.GetName(), Description: mf.GetHelp()}
+		var points []otlpNumberPoint
+		var histograms []otlpHistogramPoint
+		for _, pm := range mf.GetMetric() {
+			var attrs []otlpKeyValue
+			for _, lp := range pm.GetLabel() {
+				attrs = append(attrs, otlpString(lp.GetName(), lp.GetValue()))
+			}
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				points = append(points, otlpNumberPoint{Attributes: attrs, StartTimeUnixNano: start, TimeUnixNano: ts, AsDouble: pm.GetCounter().GetValue()})
+			case dto.MetricType_GAUGE:
+				points = append(points, otlpNumberPoint{Attributes: attrs, TimeUnixNano: ts, AsDouble: pm.GetGauge().GetValue()})
+			case dto.MetricType_HISTOGRAM:
+				h := pm.GetHistogram()
+				p := otlpHistogramPoint{
+					Attributes:        attrs,
+					StartTimeUnixNano: start,
+					TimeUnixNano:      ts,
+					Count:             strconv.FormatUint(h.GetSampleCount(), 10),
+					Sum:               h.GetSampleSum(),
+				}
+				// Prometheus buckets are cumulative; OTLP's are per bucket
+				var prev uint64
+				for _, b := range h.GetBucket() {
+					p.ExplicitBounds = append(p.ExplicitBounds, b.GetUpperBound())
+					p.BucketCounts = append(p.BucketCounts, strconv.FormatUint(b.GetCumulativeCount()-prev, 10))
+					prev = b.GetCumulativeCount()
+				}
+				p.BucketCounts = append(p.BucketCounts, strconv.FormatUint(h.GetSampleCount()-prev, 10))
+				histograms = append(histograms, p)
+			}
+		}
+		switch mf.GetType() {
+		case dto.MetricType_COUNTER:
+			m.Sum = &otlpSum{DataPoints: points, AggregationTemporality: otlpCumulative, IsMonotonic: true}
+		case dto.MetricType_GAUGE:
+			m.Gauge = &otlpGauge{DataPoints: points}
+		case dto.MetricType_HISTOGRAM:
+			m.Histogram = &otlpHistogram{DataPoints: histograms, AggregationTemporality: otlpCumulative}
+		default:
+			continue
+		}
+		metrics = append(metrics, m)
+	}
+	return metrics
+}
+
+// later returns the later of two times.
+func later(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// The OTLP/JSON types below follow opentelemetry-proto's JSON mapping:
+// 64-bit integers are strings and enums are numbers.
+
+const (
+	otlpDelta      = 1 // AGGREGATION_TEMPORALITY_DELTA
+	otlpCumulative = 2 // AGGREGATION_TEMPORALITY_CUMULATIVE
+)
+
+var otlpScope = otlpInstrumentationScope{Name: "github.com/tanmay/gateway"}
+
+type otlpValue map[string]any // AnyValue, e.g. {"stringValue": "x"}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+func otlpString(key, v string) otlpKeyValue {
+	return otlpKeyValue{Key: key, Value: otlpValue{"stringValue": v}}
+}
+
+func otlpDouble(key string, v float64) otlpKeyValue {
+	return otlpKeyValue{Key: key, Value: otlpValue{"doubleValue": v}}
+}
+
+func otlpTime(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpInstrumentationScope struct {
+	Name string `json:"name"`
+}
+
+type otlpMetricsRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpInstrumentationScope `json:"scope"`
+	Metrics []otlpMetric             `json:"metrics"`
+}
+
+type otlpMetric struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Unit        string         `json:"unit,omitempty"`
+	Sum         *otlpSum       `json:"sum,omitempty"`
+	Gauge       *otlpGauge     `json:"gauge,omitempty"`
+	Histogram   *otlpHistogram `json:"histogram,omitempty"`
+}
+
+type otlpSum struct {
+	DataPoints             []otlpNumberPoint `json:"dataPoints"`
+	AggregationTemporality int               `json:"aggregationTemporality"`
+	IsMonotonic            bool              `json:"isMonotonic"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpNumberPoint `json:"dataPoints"`
+}
+
+type otlpHistogram struct {
+	DataPoints             []otlpHistogramPoint `json:"dataPoints"`
+	AggregationTemporality int                  `json:"aggregationTemporality"`
+}
+
+type otlpNumberPoint struct {
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      string         `json:"timeUnixNano"`
+	AsDouble          float64        `json:"asDouble"`
+}
+
+type otlpHistogramPoint struct {
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      string         `json:"timeUnixNano"`
+	Count             string         `json:"count"`
+	Sum               float64        `json:"sum"`
+	BucketCounts      []string       `json:"bucketCounts"`
+	ExplicitBounds    []float64      `json:"explicitBounds"`
+}
+
+type otlpLogsRequest struct {
+	ResourceLogs []otlpResourceLogs `json:"resourceLogs"`
+}
+
+type otlpResourceLogs struct {
+	Resource  otlpResource    `json:"resource"`
+	ScopeLogs []otlpScopeLogs `json:"scopeLogs"`
+}
+
+type otlpScopeLogs struct {
+	Scope      otlpInstrumentationScope `json:"scope"`
+	LogRecords []otlpLogRecord          `json:"logRecords"`
+}
+
+type otlpLogRecord struct {
+	TimeUnixNano   string         `json:"timeUnixNano"`
+	SeverityNumber int            `json:"severityNumber"`
+	SeverityText   string         `json:"severityText"`
+	Body           otlpValue      `json:"body"`
+	Attributes     []otlpKeyValue `json:"attributes"`
+}
@@ -0,0 +1,196 @@
+package analytics
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// otlpCollector is a fake OTLP/HTTP collector recording what it receives.
+type otlpCollector struct {
+	mu       sync.Mutex
+	status   int // answer with this status
+	requests []*http.Request
+	bodies   []string
+}
+
+func (c *otlpCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requests = append(c.requests, r)
+	c.bodies = append(c.bodies, string(body))
+	w.WriteHeader(c.status)
+}
+
+// received returns the bodies posted to path since the last call.
+func (c *otlpCollector) received(path string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var bodies, restBodies []string
+	var rest []*http.Request
+	for i, r := range c.requests {
+		if r.URL.Path == path {
+			bodies = append(bodies, c.bodies[i])
+		} else {
+			rest, restBodies = append(rest, r), append(restBodies, c.bodies[i])
+		}
+	}
+	c.requests, c.bodies = rest, restBodies
+	return bodies
+}
+
+// setStatus changes the status the collector answers with.
+func (c *otlpCollector) setStatus(status int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.status = status
+}
+
+// findMetric returns the named metric in a metrics request.
+func findMetric(req otlpMetricsRequest, name string) *otlpMetric {
+	for _, rm := range req.ResourceMetrics {
+		for _, sm := range rm.ScopeMetrics {
+			for i := range sm.Metrics {
+				if sm.Metrics[i].Name == name {
+					return &sm.Metrics[i]
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func TestOTLPExporterRetriesFailedPushes(t *testing.T) {
+	collector := &otlpCollector{status: http.StatusServiceUnavailable}
+	srv := httptest.NewServer(collector)
+	defer srv.Close()
+
+	store := NewMemoryTrafficStore(24*time.Hour, time.Minute)
+	e, err := NewOTLPExporter(store, OTLPConfig{
+		Endpoint:    srv.URL + "/",
+		Headers:     map[string]string{"Authorization": "Bearer otlp-key"},
+		ServiceName: "edge",
+		Instance:    "gw-1",
+	})
+	if err != nil {
+		t.Fatalf("NewOTLPExporter: %v", err)
+	}
+	base := time.Now().Add(-time.Hour).Truncate(time.Minute)
+	e.last = base
+
+	record := func(at time.Time, status int) {
+		store.Record(TrafficEvent{Route: "/api", Backend: "http://b1", Status: status, Latency: 5 * time.Millisecond, Timestamp: at})
+	}
+	record(base, http.StatusOK)
+	record(base, http.StatusOK)
+	record(base, http.StatusInternalServerError)
+	e.NotifyAnomaly(Anomaly{ID: "a-1", Route: "/api", Metric: "error_rate", Current: 0.33, Direction: DirectionAbove, Timestamp: base})
+
+	// The collector is down: nothing is acknowledged
+	if err := e.export(base.Add(2 * time.Minute)); err == nil {
+		t.Fatal("Expected an error while the collector returns 503")
+	}
+	if got := collector.received("/v1/metrics"); len(got) != 1 {
+		t.Fatalf("Expected one failed metrics push, got %d", len(got))
+	}
+
+	// Once it's back, the next push covers the missed buckets too
+	record(base.Add(2*time.Minute), http.StatusOK)
+	record(base.Add(2*time.Minute), http.StatusOK)
+	collector.setStatus(http.StatusOK)
+	if err := e.export(base.Add(3 * time.Minute)); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+
+	metrics := collector.received("/v1/metrics")
+	logs := collector.received("/v1/logs")
+	if len(metrics) != 1 {
+		t.Fatalf("Expected one metrics push after recovery, got %d", len(metrics))
+	}
+	for _, field := range []string{`"resourceMetrics"`, `"scopeMetrics"`, `"dataPoints"`, `"asDouble"`, `"timeUnixNano"`} {
+		if !strings.Contains(metrics[0], field) {
+			t.Errorf("Expected OTLP/JSON field %s in the payload", field)
+		}
+	}
+
+	var req otlpMetricsRequest
+	if err := json.Unmarshal([]byte(metrics[0]), &req); err != nil {
+		t.Fatalf("decode metrics: %v", err)
+	}
+	attrs := make(map[string]any)
+	for _, kv := range req.ResourceMetrics[0].Resource.Attributes {
+		attrs[kv.Key] = kv.Value["stringValue"]
+	}
+	if attrs["service.name"] != "edge" || attrs["service.instance.id"] != "gw-1" {
+		t.Errorf("Expected service.name and service.instance.id resource attributes, got %v", attrs)
+	}
+
+	requests := findMetric(req, "gateway.route.requests")
+	if requests == nil || requests.Sum == nil || requests.Sum.AggregationTemporality != otlpDelta {
+		t.Fatalf("Expected gateway.route.requests as a delta sum, got %+v", requests)
+	}
+	var total float64
+	for _, p := range requests.Sum.DataPoints {
+		total += p.AsDouble
+	}
+	if len(requests.Sum.DataPoints) != 2 || total != 5 {
+		t.Errorf("Expected 5 requests in 2 buckets, got %v in %d", total, len(requests.Sum.DataPoints))
+	}
+	if errs := findMetric(req, "gateway.backend.errors"); errs == nil || errs.Sum.DataPoints[0].AsDouble != 1 {
+		t.Errorf("Expected the backend's error counted, got %+v", errs)
+	}
+	latency := findMetric(req, "gateway.route.latency")
+	if latency == nil || latency.Histogram == nil {
+		t.Fatal("Expected a gateway.route.latency histogram")
+	}
+	p := latency.Histogram.DataPoints[0]
+	if p.Count != "3" || len(p.BucketCounts) != len(p.ExplicitBounds)+1 {
+		t.Errorf("Expected 3 latencies with one more bucket count than bounds, got count %s, %d counts, %d bounds", p.Count, len(p.BucketCounts), len(p.ExplicitBounds))
+	}
+
+	if len(logs) != 1 || !strings.Contains(logs[0], `"gateway.anomaly"`) || !strings.Contains(logs[0], `"a-1"`) {
+		t.Errorf("Expected the queued anomaly delivered as a log record, got %v", logs)
+	}
+
+	// Nothing new: nothing sent
+	if err := e.export(base.Add(3 * time.Minute)); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	if got := collector.received("/v1/metrics"); len(got) != 0 {
+		t.Errorf("Expected exported buckets not sent again, got %d pushes", len(got))
+	}
+	if got := collector.received("/v1/logs"); len(got) != 0 {
+		t.Errorf("Expected delivered anomalies not sent again, got %d pushes", len(got))
+	}
+}
+
+func TestOTLPExporterSendsHeaders(t *testing.T) {
+	var got http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+	}))
+	defer srv.Close()
+
+	store := NewMemoryTrafficStore(24*time.Hour, time.Minute)
+	e, err := NewOTLPExporter(store, OTLPConfig{Endpoint: srv.URL, Headers: map[string]string{"Authorization": "Bearer otlp-key"}})
+	if err != nil {
+		t.Fatalf("NewOTLPExporter: %v", err)
+	}
+	e.NotifyAnomaly(Anomaly{ID: "a-1", Route: "/api", Timestamp: time.Now()})
+	if err := e.export(time.Now()); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	if got.Get("Authorization") != "Bearer otlp-key" || got.Get("Content-Type") != "application/json" {
+		t.Errorf("Expected the configured headers and a JSON content type, got %v", got)
+	}
+
+	if _, err := NewOTLPExporter(store, OTLPConfig{}); err == nil {
+		t.Error("Expected an exporter without an endpoint refused")
+	}
+}
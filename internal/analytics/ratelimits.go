@@ -0,0 +1,50 @@
+package analytics
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// RouteRateLimit is the adaptive limit currently enforced on one route and
+// where it came from. Limits are in requests per minute.
+type RouteRateLimit struct {
+	Route        string    `json:"route"`
+	Mode         string    `json:"mode"` // "adaptive" or "cold_start"
+	Limit        float64   `json:"limit"`
+	HardCap      float64   `json:"hard_cap,omitempty"`      // two-tier mode only
+	Baseline     string    `json:"baseline,omitempty"`      // statistic the limit derives from: mean, p95, or peak
+	BaselineRate float64   `json:"baseline_rate,omitempty"` // that statistic's value at the last rebalance
+	Multiplier   float64   `json:"multiplier,omitempty"`    // after protection profile scaling
+	UpdatedAt    time.Time `json:"updated_at"`              // when the limit last changed
+}
+
+// RateLimitStatus describes what the adaptive rate limiter is enforcing.
+// Routes not listed fall back to their static limits.
+type RateLimitStatus struct {
+	Shadow           bool             `json:"shadow"`            // limits are computed but not enforced
+	LearningComplete bool             `json:"learning_complete"` // analyzer has enough data for adaptive limits
+	LastRebalance    *time.Time       `json:"last_rebalance,omitempty"`
+	Routes           []RouteRateLimit `json:"routes"`
+}
+
+// SetRateLimitStatus allows main.go to inject the adaptive rate limiter's state.
+func (api *AnalyticsAPI) SetRateLimitStatus(fn func() RateLimitStatus) {
+	api.rateLimitStatus = fn
+}
+
+// handleRateLimits returns the per-route adaptive limits and their baselines.
+// GET /analytics/ratelimits
+func (api *AnalyticsAPI) handleRateLimits(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if api.rateLimitStatus == nil {
+		http.Error(w, "Adaptive rate limiting not enabled", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(api.rateLimitStatus())
+}
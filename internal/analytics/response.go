@@ -0,0 +1,79 @@
+package analytics
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// ResponseInfo is what the gateway learns about a response while serving
+// it: the backend that handled it, or why the gateway answered itself.
+// It travels in the request context rather than in response headers, so
+// none of it reaches clients and backends cannot forge it.
+type ResponseInfo struct {
+	mu           sync.Mutex
+	backend      string
+	gatewayError string
+}
+
+type responseInfoKey struct{}
+
+// WithResponseInfo returns r carrying a ResponseInfo, reusing the one an
+// outer middleware already attached.
+func WithResponseInfo(r *http.Request) (*http.Request, *ResponseInfo) {
+	if info := ResponseInfoFrom(r.Context()); info != nil {
+		return r, info
+	}
+	info := &ResponseInfo{}
+	return r.WithContext(context.WithValue(r.Context(), responseInfoKey{}, info)), info
+}
+
+// ResponseInfoFrom returns the ResponseInfo attached to ctx, or nil. The
+// methods of a nil ResponseInfo do nothing, so callers need not check.
+func ResponseInfoFrom(ctx context.Context) *ResponseInfo {
+	info, _ := ctx.Value(responseInfoKey{}).(*ResponseInfo)
+	return info
+}
+
+// SetBackend records the backend the request was sent to. On retries the
+// last attempt wins.
+func (i *ResponseInfo) SetBackend(backend string) {
+	if i == nil {
+		return
+	}
+	i.mu.Lock()
+	i.backend = backend
+	i.mu.Unlock()
+}
+
+// Backend returns the backend that handled the request, if any.
+func (i *ResponseInfo) Backend() string {
+	if i == nil {
+		return ""
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.backend
+}
+
+// SetGatewayError marks the response as generated by the gateway itself,
+// with a short reason such as "rate_limited" or "circuit_open".
+func (i *ResponseInfo) SetGatewayError(reason string) {
+	if i == nil {
+		return
+	}
+	i.mu.Lock()
+	i.gatewayError = reason
+	i.mu.Unlock()
+}
+
+// GatewayError returns the reason the gateway answered the request
+// itself, or "" if the response came from a backend.
+func (i *ResponseInfo) GatewayError() string {
+	if i == nil {
+		return ""
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.gatewayError
+}
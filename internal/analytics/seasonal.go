@@ -0,0 +1,94 @@
+package analytics
+
+import (
+	"fmt"
+	"time"
+)
+
+// Seasonality selects how traffic is split into recurring slots for
+// seasonal baselines.
+type Seasonality string
+
+const (
+	// SeasonalityNone compares traffic only against the rolling window.
+	SeasonalityNone Seasonality = ""
+	// SeasonalityHour compares against the same hour of previous days.
+	SeasonalityHour Seasonality = "hour"
+	// SeasonalityHourWeekday also separates weekdays from weekends.
+	SeasonalityHourWeekday Seasonality = "hour_weekday"
+)
+
+// DefaultSeasonalDays is how many days back seasonal baselines look.
+const DefaultSeasonalDays = 7
+
+// minSeasonalDays is how many distinct days a slot needs before its
+// baseline is trusted over the rolling one.
+const minSeasonalDays = 2
+
+// slot names the recurring slot t falls in, in the gateway's local time,
+// e.g. "09h" or "09h weekend".
+func (s Seasonality) slot(t time.Time) string {
+	t = t.Local()
+	slot := fmt.Sprintf("%02dh", t.Hour())
+	if s == SeasonalityHourWeekday {
+		if wd := t.Weekday(); wd == time.Saturday || wd == time.Sunday {
+			slot += " weekend"
+		} else {
+			slot += " weekday"
+		}
+	}
+	return slot
+}
+
+// SeasonalBaseline holds a route's statistics for one recurring slot,
+// e.g. 09:00-10:00 on weekdays over the last week, so the morning ramp-up
+// is compared with previous mornings instead of the quiet hour before it.
+type SeasonalBaseline struct {
+	Slot          string  `json:"slot"`
+	MeanRate      float64 `json:"mean_rate"` // requests per minute
+	StdDevRate    float64 `json:"std_dev_rate"`
+	MeanErrorRate float64 `json:"mean_error_rate"`
+	StdDevError   float64 `json:"std_dev_error"`
+	MeanLatencyMs float64 `json:"mean_latency_ms"`
+	StdDevLatency float64 `json:"std_dev_latency"`
+	SampleSize    int     `json:"sample_size"` // buckets in the slot
+	Days          int     `json:"days"`        // distinct days they came from
+}
+
+// seasonalBaseline computes the baseline for the slot of current from a
+// route's history, or nil if seasonality is off or the slot has too few
+// days of history yet. The current bucket itself is left out.
+func (a *Analyzer) seasonalBaseline(history []Bucket, current Bucket) *SeasonalBaseline {
+	season := a.config.Seasonality
+	if season == SeasonalityNone {
+		return nil
+	}
+	slot := season.slot(current.Timestamp)
+
+	var rates, errorRates, latencies []float64
+	days := make(map[string]bool)
+	for _, b := range history {
+		if !b.Timestamp.Before(current.Timestamp) || season.slot(b.Timestamp) != slot {
+			continue
+		}
+		rates = append(rates, b.RatePerMinute())
+		errorRates = append(errorRates, b.ErrorRate())
+		latencies = append(latencies, float64(b.AvgLatency())/float64(time.Millisecond))
+		days[b.Timestamp.Local().Format(time.DateOnly)] = true
+	}
+	if len(days) < minSeasonalDays {
+		return nil
+	}
+
+	return &SeasonalBaseline{
+		Slot:          slot,
+		MeanRate:      mean(rates),
+		StdDevRate:    stddev(rates),
+		MeanErrorRate: mean(errorRates),
+		StdDevError:   stddev(errorRates),
+		MeanLatencyMs: mean(latencies),
+		StdDevLatency: stddev(latencies),
+		SampleSize:    len(rates),
+		Days:          len(days),
+	}
+}
@@ -0,0 +1,331 @@
+package analytics
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// sqlFlushInterval is how often dirty buckets are written to the database.
+const sqlFlushInterval = 15 * time.Second
+
+// bucketKey identifies one bucket of one route or backend series.
+type bucketKey struct {
+	kind  string // "route" or "backend"
+	name  string
+	start time.Time
+}
+
+// sqlDialect holds the statements that differ between databases. Every
+// statement takes the instance first, so gateways sharing a database keep
+// separate rows that can be aggregated across the fleet in SQL.
+type sqlDialect struct {
+	driver string // database/sql driver name
+	schema string // creates the traffic_buckets table if missing
+	load   string // (instance, since) → buckets
+	upsert string // (instance, kind, name, start, width, counts..., latency_hist, updated)
+	delete string // (instance, before): rows older than before
+	since  string // (instance, since): rows from since on
+	rollup string // (instance, before, width): rows older than before and narrower than width
+}
+
+// SQLTrafficStore keeps buckets in memory like MemoryTrafficStore, so reads
+// stay fast, and writes them through to a SQL database. On startup the
+// buckets within the retention period are loaded back, so baselines,
+// history, and anomaly detection pick up where they left off instead of
+// restarting the learning period on every deploy.
+type SQLTrafficStore struct {
+	*MemoryTrafficStore
+	db       *sql.DB
+	dialect  sqlDialect
+	instance string
+
+	dirtyMu sync.Mutex
+	dirty   map[bucketKey]struct{} // buckets changed since the last flush
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// openSQLTrafficStore connects to a database with the given dialect and
+// loads this instance's buckets within the retention period. Buckets
+// recorded with a different bucket size are merged into the current size.
+func openSQLTrafficStore(d sqlDialect, dsn string, opts StoreOptions) (*SQLTrafficStore, error) {
+	db, err := sql.Open(d.driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open analytics store: %w", err)
+	}
+
+	s := &SQLTrafficStore{
+		MemoryTrafficStore: NewMemoryTrafficStore(opts.Retention, opts.BucketSize),
+		db:                 db,
+		dialect:            d,
+		instance:           opts.Instance,
+		dirty:              make(map[bucketKey]struct{}),
+	}
+	if err := s.SetDownsampling(opts.Downsample); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if _, err := db.Exec(d.schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create traffic_buckets table: %w", err)
+	}
+	if err := s.load(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// load reads buckets within the retention period into memory.
+func (s *SQLTrafficStore) load() error {
+	since := time.Now().Add(-s.retention)
+	rows, err := s.db.Query(s.dialect.load, s.instance, since.Unix())
+	if err != nil {
+		return fmt.Errorf("failed to load traffic buckets: %w", err)
+	}
+	defer rows.Close()
+
+	loaded, realigned := 0, false
+	for rows.Next() {
+		var kind, name string
+		var start, width int64
+		var hist string
+		var b Bucket
+		if err := rows.Scan(&kind, &name, &start, &width, &b.RequestCount, &b.ErrorCount,
+			&b.TotalLatency, &b.MaxLatency, &b.BytesIn, &b.BytesOut, &b.Rejected, &b.Anonymous, &hist); err != nil {
+			return fmt.Errorf("failed to read traffic bucket: %w", err)
+		}
+		b.Latency = ParseLatencyHistogram(hist)
+		// Downsampled rows keep their width; the rest are aligned to the
+		// current bucket size
+		b.Width = max(time.Duration(width), s.bucketSize)
+		aligned := time.Unix(start, 0).Truncate(b.Width)
+		s.merge(kind, name, aligned, b)
+		s.dirty[bucketKey{kind, name, aligned}] = struct{}{}
+		realigned = realigned || aligned.Unix() != start
+		loaded++
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to load traffic buckets: %w", err)
+	}
+	rows.Close()
+
+	if realigned {
+		// The bucket size changed: replace the old rows with the merged
+		// buckets so nothing is counted twice on the next load
+		merged := make(map[bucketKey]Bucket, len(s.dirty))
+		for k := range s.dirty {
+			merged[k], _ = s.bucket(k.kind, k.name, k.start)
+		}
+		if _, err := s.db.Exec(s.dialect.since, s.instance, since.Unix()); err != nil {
+			return fmt.Errorf("failed to realign traffic buckets: %w", err)
+		}
+		if err := s.write(merged); err != nil {
+			return err
+		}
+	}
+	s.dirty = make(map[bucketKey]struct{})
+	log.Printf("[analytics] Loaded %d traffic buckets from the analytics store", loaded)
+	return nil
+}
+
+// mergeBucket adds b's counts into the bucket for key at start.
+func mergeBucket(m map[string]map[time.Time]*Bucket, key string, start time.Time, b Bucket) {
+	if m[key] == nil {
+		m[key] = make(map[time.Time]*Bucket)
+	}
+	dst, ok := m[key][start]
+	if !ok {
+		dst = &Bucket{Route: key, Timestamp: start, Width: b.Width}
+		m[key][start] = dst
+	}
+	dst.add(b)
+}
+
+// Record adds a TrafficEvent to memory and marks its buckets for writing.
+func (s *SQLTrafficStore) Record(event TrafficEvent) {
+	s.MemoryTrafficStore.Record(event)
+
+	start := event.Timestamp.Truncate(s.bucketSize)
+	s.dirtyMu.Lock()
+	s.dirty[bucketKey{"route", event.Route, start}] = struct{}{}
+	if event.Backend != "" {
+		s.dirty[bucketKey{"backend", event.Backend, start}] = struct{}{}
+	}
+	s.dirtyMu.Unlock()
+}
+
+// RecordBatch adds several events to memory and marks their buckets for
+// writing.
+func (s *SQLTrafficStore) RecordBatch(events []TrafficEvent) {
+	s.MemoryTrafficStore.RecordBatch(events)
+
+	s.dirtyMu.Lock()
+	for _, event := range events {
+		start := event.Timestamp.Truncate(s.bucketSize)
+		s.dirty[bucketKey{"route", event.Route, start}] = struct{}{}
+		if event.Backend != "" {
+			s.dirty[bucketKey{"backend", event.Backend, start}] = struct{}{}
+		}
+	}
+	s.dirtyMu.Unlock()
+}
+
+// Start launches the background goroutine that flushes dirty buckets and
+// prunes expired ones, in memory and in the database.
+func (s *SQLTrafficStore) Start() {
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go func() {
+		defer close(s.done)
+		flush := time.NewTicker(sqlFlushInterval)
+		defer flush.Stop()
+		cleanup := time.NewTicker(10 * time.Minute)
+		defer cleanup.Stop()
+		for {
+			select {
+			case <-flush.C:
+				if err := s.Flush(); err != nil {
+					log.Printf("[analytics] %v", err)
+				}
+			case <-cleanup.C:
+				s.expire()
+				if err := s.prune(); err != nil {
+					log.Printf("[analytics] %v", err)
+				}
+				if err := s.rollupRows(); err != nil {
+					log.Printf("[analytics] %v", err)
+				}
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Flush writes every bucket changed since the last flush.
+func (s *SQLTrafficStore) Flush() error {
+	s.dirtyMu.Lock()
+	keys := s.dirty
+	s.dirty = make(map[bucketKey]struct{})
+	s.dirtyMu.Unlock()
+	if len(keys) == 0 {
+		return nil
+	}
+
+	// Copy the buckets out so the database write doesn't block Record
+	rows := make(map[bucketKey]Bucket, len(keys))
+	for k := range keys {
+		if b, ok := s.bucket(k.kind, k.name, k.start); ok {
+			rows[k] = b
+		}
+	}
+
+	if err := s.write(rows); err != nil {
+		// Keep them dirty so the next flush retries
+		s.dirtyMu.Lock()
+		for k := range keys {
+			s.dirty[k] = struct{}{}
+		}
+		s.dirtyMu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// write upserts buckets in a single transaction.
+func (s *SQLTrafficStore) write(rows map[bucketKey]Bucket) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to flush traffic buckets: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := s.upsert(tx, rows); err != nil {
+		return fmt.Errorf("failed to flush traffic buckets: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to flush traffic buckets: %w", err)
+	}
+	return nil
+}
+
+// upsert writes buckets within tx.
+func (s *SQLTrafficStore) upsert(tx *sql.Tx, rows map[bucketKey]Bucket) error {
+	stmt, err := tx.Prepare(s.dialect.upsert)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	updated := time.Now().UnixNano()
+	for k, b := range rows {
+		if _, err := stmt.Exec(s.instance, k.kind, k.name, k.start.Unix(), int64(b.Width), b.RequestCount, b.ErrorCount,
+			int64(b.TotalLatency), int64(b.MaxLatency), b.BytesIn, b.BytesOut, b.Rejected, b.Anonymous,
+			b.Latency.String(), updated); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rollupRows downsamples buckets in memory and replaces the narrow rows
+// in the database with the merged ones, in one transaction.
+func (s *SQLTrafficStore) rollupRows() error {
+	now := time.Now()
+	changed := s.rollup(now)
+	if len(changed) == 0 {
+		return nil
+	}
+	rows := make(map[bucketKey]Bucket, len(changed))
+	for k := range changed {
+		if b, ok := s.bucket(k.kind, k.name, k.start); ok {
+			rows[k] = b
+		}
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to downsample traffic buckets: %w", err)
+	}
+	defer tx.Rollback()
+	for _, tier := range s.downsample {
+		if _, err := tx.Exec(s.dialect.rollup, s.instance, tier.cutoff(now).Unix(), int64(tier.Interval)); err != nil {
+			return fmt.Errorf("failed to downsample traffic buckets: %w", err)
+		}
+	}
+	if err := s.upsert(tx, rows); err != nil {
+		return fmt.Errorf("failed to downsample traffic buckets: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to downsample traffic buckets: %w", err)
+	}
+	return nil
+}
+
+// prune deletes this instance's rows older than the retention period.
+func (s *SQLTrafficStore) prune() error {
+	cutoff := time.Now().Add(-s.retention)
+	if _, err := s.db.Exec(s.dialect.delete, s.instance, cutoff.Unix()); err != nil {
+		return fmt.Errorf("failed to prune traffic buckets: %w", err)
+	}
+	return nil
+}
+
+// Close stops the background goroutine, flushes outstanding buckets, and
+// closes the database.
+func (s *SQLTrafficStore) Close() error {
+	if s.stop != nil {
+		close(s.stop)
+		<-s.done
+		s.stop = nil
+	}
+	err := s.Flush()
+	if cerr := s.db.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
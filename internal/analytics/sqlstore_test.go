@@ -0,0 +1,179 @@
+package analytics
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// openTestSQLStore opens the SQLite store at path without starting it, so
+// the test decides when to flush, prune, and roll up.
+func openTestSQLStore(t *testing.T, path string, opts StoreOptions) *SQLTrafficStore {
+	t.Helper()
+	s, err := OpenSQLiteTrafficStore(path, opts)
+	if err != nil {
+		t.Fatalf("OpenSQLiteTrafficStore: %v", err)
+	}
+	return s
+}
+
+// closeTestSQLStore flushes and closes s.
+func closeTestSQLStore(t *testing.T, s *SQLTrafficStore) {
+	t.Helper()
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+}
+
+// rowCount counts s's rows in the database.
+func rowCount(t *testing.T, s *SQLTrafficStore) int {
+	t.Helper()
+	var n int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM traffic_buckets`).Scan(&n); err != nil {
+		t.Fatalf("count rows: %v", err)
+	}
+	return n
+}
+
+// requestsIn sums the requests to route in [from, to).
+func requestsIn(store TrafficStore, route string, from, to time.Time) (n int, buckets int) {
+	for _, b := range store.GetBuckets(route, from, to) {
+		n += b.RequestCount
+		buckets++
+	}
+	return n, buckets
+}
+
+func TestSQLTrafficStoreReloadsWithoutDoubleCounting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "analytics.db")
+	opts := StoreOptions{Retention: 24 * time.Hour, BucketSize: time.Minute, Instance: "gw-1"}
+	from := time.Now().Add(-time.Hour).Truncate(time.Minute)
+	to := from.Add(10 * time.Minute)
+
+	s := openTestSQLStore(t, path, opts)
+	recordMinutes(s, "/api", from, to, 3, http.StatusOK)
+	s.Record(TrafficEvent{Route: "/api", Backend: "http://b1", Status: http.StatusInternalServerError, Latency: time.Millisecond, Timestamp: from})
+	if err := s.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	closeTestSQLStore(t, s)
+
+	// Reopen twice: loaded buckets must not be written back on top of themselves
+	for i := range 2 {
+		s = openTestSQLStore(t, path, opts)
+		if n, buckets := requestsIn(s, "/api", from, to); n != 31 || buckets != 10 {
+			t.Errorf("Reload %d: expected 31 requests in 10 buckets, got %d in %d", i+1, n, buckets)
+		}
+		b := s.GetBuckets("/api", from, from.Add(time.Minute))[0]
+		if b.ErrorCount != 1 || b.Latency.Count() != 4 {
+			t.Errorf("Reload %d: expected 1 error and 4 latencies in the first bucket, got %d and %d", i+1, b.ErrorCount, b.Latency.Count())
+		}
+		if backends := s.GetBackendBuckets(from, to); len(backends["http://b1"]) != 1 {
+			t.Errorf("Reload %d: expected the backend's bucket reloaded, got %v", i+1, backends)
+		}
+		if got := rowCount(t, s); got != 11 {
+			t.Errorf("Reload %d: expected 11 rows, got %d", i+1, got)
+		}
+		closeTestSQLStore(t, s)
+	}
+
+	// Another instance sharing the database sees none of it
+	s = openTestSQLStore(t, path, StoreOptions{Retention: 24 * time.Hour, BucketSize: time.Minute, Instance: "gw-2"})
+	defer closeTestSQLStore(t, s)
+	if n, _ := requestsIn(s, "/api", from, to); n != 0 {
+		t.Errorf("Expected another instance's buckets kept apart, got %d requests", n)
+	}
+}
+
+func TestSQLTrafficStoreRealignsBucketSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "analytics.db")
+	from := time.Now().Add(-time.Hour).Truncate(5 * time.Minute)
+	to := from.Add(10 * time.Minute)
+
+	s := openTestSQLStore(t, path, StoreOptions{Retention: 24 * time.Hour, BucketSize: time.Minute})
+	recordMinutes(s, "/api", from, to, 2, http.StatusOK)
+	closeTestSQLStore(t, s)
+
+	// Ten 1-minute buckets become two 5-minute ones, in memory and on disk
+	opts := StoreOptions{Retention: 24 * time.Hour, BucketSize: 5 * time.Minute}
+	for i := range 2 {
+		s = openTestSQLStore(t, path, opts)
+		n, buckets := requestsIn(s, "/api", from, to)
+		if n != 20 || buckets != 2 {
+			t.Errorf("Reload %d: expected 20 requests in 2 buckets, got %d in %d", i+1, n, buckets)
+		}
+		for _, b := range s.GetBuckets("/api", from, to) {
+			if b.Width != 5*time.Minute || b.RequestCount != 10 {
+				t.Errorf("Reload %d: expected 5m buckets of 10 requests, got %s with %d", i+1, b.Width, b.RequestCount)
+			}
+		}
+		if got := rowCount(t, s); got != 2 {
+			t.Errorf("Reload %d: expected the old rows replaced by 2, got %d", i+1, got)
+		}
+		closeTestSQLStore(t, s)
+	}
+}
+
+func TestSQLTrafficStoreRetention(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "analytics.db")
+	now := time.Now().Truncate(time.Minute)
+	old, recent := now.Add(-3*time.Hour), now.Add(-10*time.Minute)
+
+	s := openTestSQLStore(t, path, StoreOptions{Retention: 24 * time.Hour, BucketSize: time.Minute})
+	recordMinutes(s, "/api", old, old.Add(2*time.Minute), 1, http.StatusOK)
+	recordMinutes(s, "/api", recent, recent.Add(2*time.Minute), 1, http.StatusOK)
+	closeTestSQLStore(t, s)
+
+	// A shorter retention skips expired rows on load and prunes them
+	s = openTestSQLStore(t, path, StoreOptions{Retention: time.Hour, BucketSize: time.Minute})
+	defer closeTestSQLStore(t, s)
+	if n, _ := requestsIn(s, "/api", old, now); n != 2 {
+		t.Errorf("Expected only the 2 requests within retention loaded, got %d", n)
+	}
+	if got := rowCount(t, s); got != 4 {
+		t.Fatalf("Expected expired rows kept until pruned, got %d rows", got)
+	}
+	if err := s.prune(); err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+	if got := rowCount(t, s); got != 2 {
+		t.Errorf("Expected pruning to delete the 2 expired rows, got %d left", got)
+	}
+}
+
+func TestSQLTrafficStoreRollsUpRows(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "analytics.db")
+	opts := StoreOptions{
+		Retention:  24 * time.Hour,
+		BucketSize: time.Minute,
+		Downsample: []DownsampleTier{{After: time.Hour, Interval: 10 * time.Minute}},
+	}
+	from := time.Now().Add(-3 * time.Hour).Truncate(10 * time.Minute)
+	to := from.Add(20 * time.Minute)
+
+	s := openTestSQLStore(t, path, opts)
+	recordMinutes(s, "/api", from, to, 2, http.StatusOK)
+	if err := s.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if err := s.rollupRows(); err != nil {
+		t.Fatalf("rollupRows: %v", err)
+	}
+	if got := rowCount(t, s); got != 2 {
+		t.Errorf("Expected 20 narrow rows replaced by 2 rolled-up ones, got %d", got)
+	}
+	closeTestSQLStore(t, s)
+
+	s = openTestSQLStore(t, path, opts)
+	defer closeTestSQLStore(t, s)
+	n, buckets := requestsIn(s, "/api", from, to)
+	if n != 40 || buckets != 2 {
+		t.Errorf("Expected 40 requests in 2 rolled-up buckets after reload, got %d in %d", n, buckets)
+	}
+	for _, b := range s.GetBuckets("/api", from, to) {
+		if b.Width != 10*time.Minute {
+			t.Errorf("Expected rolled-up buckets to keep their width, got %s", b.Width)
+		}
+	}
+}
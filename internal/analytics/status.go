@@ -0,0 +1,147 @@
+package analytics
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RecorderStats describes the ingestion side of the pipeline (the TrafficRecorder).
+type RecorderStats struct {
+	EventsReceived  uint64 `json:"events_received"`
+	EventsDropped   uint64 `json:"events_dropped"`
+	RoutesOverflow  uint64 `json:"routes_overflow"` // events folded into the overflow series by the cardinality cap
+	SampledOut      uint64 `json:"sampled_out"`     // requests skipped by sampling, accounted for by the weight of those kept
+	Backlog         int    `json:"backlog"`
+	BacklogCapacity int    `json:"backlog_capacity"`
+}
+
+// statsReporter is implemented by stores that can describe their own contents.
+type statsReporter interface {
+	Stats() StoreStats
+}
+
+// PipelineStatus is the self-reported health of the analytics subsystem,
+// so "no anomalies" can be told apart from "pipeline broken".
+type PipelineStatus struct {
+	Healthy  bool     `json:"healthy"`
+	Problems []string `json:"problems"`
+
+	Recorder RecorderStats `json:"recorder"`
+	Store    *StoreStats   `json:"store,omitempty"`
+
+	LastAnalyzeAt         time.Time `json:"last_analyze_at"`
+	LastAnalyzeDurationMs float64   `json:"last_analyze_duration_ms"`
+	AnalyzeRuns           uint64    `json:"analyze_runs"`
+	AnalyzeErrors         uint64    `json:"analyze_errors"`
+}
+
+// SetRecorderStats allows main.go to inject the TrafficRecorder's counters.
+func (api *AnalyticsAPI) SetRecorderStats(fn func() RecorderStats) {
+	api.recorderStats = fn
+}
+
+// Status assembles the current pipeline status and flags obvious problems.
+func (api *AnalyticsAPI) Status() PipelineStatus {
+	st := PipelineStatus{Problems: []string{}}
+
+	if api.recorderStats != nil {
+		st.Recorder = api.recorderStats()
+	}
+	if sr, ok := api.store.(statsReporter); ok {
+		stats := sr.Stats()
+		st.Store = &stats
+	}
+
+	as := api.analyzer.Stats()
+	st.LastAnalyzeAt = as.LastAnalyzeAt
+	st.LastAnalyzeDurationMs = float64(as.LastAnalyzeDuration) / float64(time.Millisecond)
+	st.AnalyzeRuns = as.AnalyzeRuns
+	st.AnalyzeErrors = as.AnalyzeErrors
+
+	// Heuristics for "the pipeline itself is broken"
+	if as.LastAnalyzeAt.IsZero() {
+		st.Problems = append(st.Problems, "analyzer has not run yet")
+	} else if time.Since(as.LastAnalyzeAt) > 2*as.Interval {
+		st.Problems = append(st.Problems, "analyzer is stalled (no pass in over 2 intervals)")
+	}
+	if as.AnalyzeErrors > 0 {
+		st.Problems = append(st.Problems, "analyzer passes have failed")
+	}
+	if r := st.Recorder; r.EventsReceived > 0 && float64(r.EventsDropped)/float64(r.EventsReceived) > 0.01 {
+		st.Problems = append(st.Problems, "more than 1% of traffic events were dropped")
+	}
+	if r := st.Recorder; r.BacklogCapacity > 0 && float64(r.Backlog) >= 0.9*float64(r.BacklogCapacity) {
+		st.Problems = append(st.Problems, "recorder backlog is near capacity")
+	}
+
+	st.Healthy = len(st.Problems) == 0
+	return st
+}
+
+// handleStatus returns the analytics pipeline's own health.
+// GET /analytics/status
+func (api *AnalyticsAPI) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(api.Status())
+}
+
+// RegisterMetrics exports the pipeline status as Prometheus self-metrics.
+// Values are read from Status() at scrape time, so nothing is double-counted.
+func (api *AnalyticsAPI) RegisterMetrics(reg prometheus.Registerer) {
+	gauge := func(name, help string, fn func(PipelineStatus) float64) prometheus.Collector {
+		return prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: name, Help: help}, func() float64 {
+			return fn(api.Status())
+		})
+	}
+	counter := func(name, help string, fn func(PipelineStatus) float64) prometheus.Collector {
+		return prometheus.NewCounterFunc(prometheus.CounterOpts{Name: name, Help: help}, func() float64 {
+			return fn(api.Status())
+		})
+	}
+
+	reg.MustRegister(
+		counter("gateway_analytics_events_received_total", "Traffic events received by the recorder",
+			func(s PipelineStatus) float64 { return float64(s.Recorder.EventsReceived) }),
+		counter("gateway_analytics_events_dropped_total", "Traffic events dropped because the recorder channel was full",
+			func(s PipelineStatus) float64 { return float64(s.Recorder.EventsDropped) }),
+		counter("gateway_analytics_route_overflow_total", "Traffic events folded into the overflow series by the route cardinality cap",
+			func(s PipelineStatus) float64 { return float64(s.Recorder.RoutesOverflow) }),
+		counter("gateway_analytics_events_sampled_out_total", "Requests skipped by traffic sampling",
+			func(s PipelineStatus) float64 { return float64(s.Recorder.SampledOut) }),
+		gauge("gateway_analytics_recorder_backlog", "Traffic events waiting in the recorder channel",
+			func(s PipelineStatus) float64 { return float64(s.Recorder.Backlog) }),
+		gauge("gateway_analytics_buckets", "Time buckets held by the traffic store",
+			func(s PipelineStatus) float64 {
+				if s.Store == nil {
+					return 0
+				}
+				return float64(s.Store.Buckets)
+			}),
+		gauge("gateway_analytics_memory_bytes", "Approximate memory used by the traffic store",
+			func(s PipelineStatus) float64 {
+				if s.Store == nil {
+					return 0
+				}
+				return float64(s.Store.MemoryBytes)
+			}),
+		gauge("gateway_analytics_last_analyze_duration_seconds", "Duration of the most recent analyzer pass",
+			func(s PipelineStatus) float64 { return s.LastAnalyzeDurationMs / 1000 }),
+		counter("gateway_analytics_analyze_errors_total", "Analyzer passes that failed",
+			func(s PipelineStatus) float64 { return float64(s.AnalyzeErrors) }),
+		gauge("gateway_analytics_healthy", "1 if the analytics pipeline reports no problems",
+			func(s PipelineStatus) float64 {
+				if s.Healthy {
+					return 1
+				}
+				return 0
+			}),
+	)
+}
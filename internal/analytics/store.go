@@ -1,9 +1,12 @@
 package analytics
 
 import (
+	"fmt"
+	"slices"
 	"sort"
 	"sync"
 	"time"
+	"unsafe"
 )
 
 // TrafficEvent represents a single request data point captured by the traffic middleware.
@@ -16,18 +19,88 @@ type TrafficEvent struct {
 	BytesOut  int64         // Response body size
 	ClientIP  string        // Client IP address
 	Timestamp time.Time     // When the request was received
+
+	// GatewayGenerated is true when the response came from the gateway itself
+	// (rate limiter 429, circuit breaker 503, auth 401, ...) rather than a backend.
+	// Such events are counted separately and kept out of traffic, error, and
+	// latency baselines to avoid feedback loops.
+	GatewayGenerated bool
+
+	// Anonymous is true for requests without credentials on an
+	// anonymous-mode route.
+	Anonymous bool
+
+	// Weight is how many requests the event stands for when the recorder
+	// samples traffic, e.g. 10 for a success kept at a 10% sample rate.
+	// Zero counts as one.
+	Weight int
+
+	// Country (ISO code) and autonomous system of ClientIP, when GeoIP is
+	// configured.
+	Country string
+	ASN     uint32
+	ASOrg   string
+}
+
+// weight returns how many requests the event counts for.
+func (e *TrafficEvent) weight() int {
+	return max(e.Weight, 1)
 }
 
-// Bucket aggregates traffic for one route (or backend) during a 1-minute window.
+// GatewayResponseHeader is reserved for the gateway. It is dropped from
+// backend responses so a backend cannot pass its errors off as the
+// gateway's; the gateway itself tags its responses via ResponseInfo.
+const GatewayResponseHeader = "X-Gateway-Error"
+
+// DefaultBucketSize is the bucket width used when none is configured.
+const DefaultBucketSize = time.Minute
+
+// Bucket aggregates traffic for one route (or backend) during one bucket interval.
 type Bucket struct {
 	Route        string        `json:"route"`
-	Timestamp    time.Time     `json:"timestamp"`     // start of the 1-minute window
+	Timestamp    time.Time     `json:"timestamp"` // start of the bucket window
+	Width        time.Duration `json:"width"`     // the store's bucket size, or wider once downsampled
 	RequestCount int           `json:"request_count"`
-	ErrorCount   int           `json:"error_count"`   // status >= 500
+	ErrorCount   int           `json:"error_count"` // status >= 500
 	TotalLatency time.Duration `json:"total_latency"`
 	MaxLatency   time.Duration `json:"max_latency"`
 	BytesIn      int64         `json:"bytes_in"`
 	BytesOut     int64         `json:"bytes_out"`
+	Rejected     int           `json:"rejected"`            // gateway-generated responses, excluded from the counts above
+	Anonymous    int           `json:"anonymous,omitempty"` // requests without credentials on anonymous routes, served or rejected
+
+	// Latency is the distribution of latencies counted in RequestCount,
+	// for percentiles that hold up across buckets.
+	Latency LatencyHistogram `json:"latency_histogram,omitempty"`
+}
+
+// clone returns a copy of b that shares no memory with it.
+func (b *Bucket) clone() Bucket {
+	c := *b
+	c.Latency = slices.Clone(b.Latency)
+	return c
+}
+
+// RatePerMinute returns the bucket's request rate per minute, whatever
+// its width.
+func (b *Bucket) RatePerMinute() float64 {
+	if b.Width <= 0 {
+		return 0
+	}
+	return float64(b.RequestCount) * float64(time.Minute) / float64(b.Width)
+}
+
+// add adds other's counts into b.
+func (b *Bucket) add(other Bucket) {
+	b.RequestCount += other.RequestCount
+	b.ErrorCount += other.ErrorCount
+	b.TotalLatency += other.TotalLatency
+	b.MaxLatency = max(b.MaxLatency, other.MaxLatency)
+	b.BytesIn += other.BytesIn
+	b.BytesOut += other.BytesOut
+	b.Rejected += other.Rejected
+	b.Anonymous += other.Anonymous
+	b.Latency.Merge(other.Latency)
 }
 
 // AvgLatency returns the mean latency for this bucket.
@@ -50,6 +123,8 @@ func (b *Bucket) ErrorRate() float64 {
 type TrafficStore interface {
 	// Record adds a single traffic event to the appropriate bucket.
 	Record(event TrafficEvent)
+	// RecordBatch adds several events at once. The slice is not retained.
+	RecordBatch(events []TrafficEvent)
 	// GetBuckets returns buckets for a route within [from, to), sorted by time.
 	GetBuckets(route string, from, to time.Time) []Bucket
 	// GetAllBuckets returns buckets for all routes within [from, to).
@@ -58,99 +133,218 @@ type TrafficStore interface {
 	GetRoutes() []string
 	// GetBackendBuckets returns per-backend buckets within [from, to).
 	GetBackendBuckets(from, to time.Time) map[string][]Bucket
+	// BucketSize returns the width of each bucket.
+	BucketSize() time.Duration
+}
+
+// storeShards is the number of independently locked partitions of a
+// MemoryTrafficStore. Series are assigned to shards by name, so recording
+// and reading different routes rarely contend on the same lock.
+const storeShards = 32
+
+// storeShard holds the route and backend series that hash to it.
+type storeShard struct {
+	mu       sync.RWMutex
+	routes   map[string]map[time.Time]*Bucket // route -> bucket start -> bucket
+	backends map[string]map[time.Time]*Bucket // backend -> bucket start -> bucket
+}
+
+// series returns the shard's route or backend map. Must hold sh.mu.
+func (sh *storeShard) series(kind string) map[string]map[time.Time]*Bucket {
+	if kind == "backend" {
+		return sh.backends
+	}
+	return sh.routes
 }
 
 // MemoryTrafficStore is the in-memory implementation of TrafficStore.
-// Uses nested maps keyed by route/backend then minute-truncated timestamp.
+// Uses nested maps keyed by route/backend then bucket-truncated timestamp,
+// split into shards by series name.
 type MemoryTrafficStore struct {
-	mu        sync.RWMutex
-	routes    map[string]map[time.Time]*Bucket // route -> minute -> bucket
-	backends  map[string]map[time.Time]*Bucket // backend -> minute -> bucket
-	retention time.Duration                     // how long to keep buckets
+	shards     [storeShards]*storeShard
+	retention  time.Duration    // how long to keep buckets
+	bucketSize time.Duration    // width of each bucket
+	downsample []DownsampleTier // see SetDownsampling
+
+	stopCleanup chan struct{} // closed by StopCleanup
+	cleanupDone chan struct{} // closed when the cleanup loop exits
 }
 
 // NewMemoryTrafficStore creates a new in-memory traffic store.
-// retention specifies how long to keep historical buckets (default 48h).
-func NewMemoryTrafficStore(retention time.Duration) *MemoryTrafficStore {
+// retention specifies how long to keep historical buckets (default 48h);
+// bucketSize is the width of each bucket (default 1m).
+func NewMemoryTrafficStore(retention, bucketSize time.Duration) *MemoryTrafficStore {
 	if retention <= 0 {
 		retention = 48 * time.Hour
 	}
-	return &MemoryTrafficStore{
-		routes:    make(map[string]map[time.Time]*Bucket),
-		backends:  make(map[string]map[time.Time]*Bucket),
-		retention: retention,
+	if bucketSize <= 0 {
+		bucketSize = DefaultBucketSize
+	}
+	s := &MemoryTrafficStore{
+		retention:  retention,
+		bucketSize: bucketSize,
+	}
+	for i := range s.shards {
+		s.shards[i] = &storeShard{
+			routes:   make(map[string]map[time.Time]*Bucket),
+			backends: make(map[string]map[time.Time]*Bucket),
+		}
 	}
+	return s
+}
+
+// shardIndex hashes a series name (FNV-1a) to its shard.
+func shardIndex(key string) int {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return int(h % storeShards)
+}
+
+// shardFor returns the shard holding a series.
+func (s *MemoryTrafficStore) shardFor(key string) *storeShard {
+	return s.shards[shardIndex(key)]
+}
+
+// BucketSize returns the width of each bucket.
+func (s *MemoryTrafficStore) BucketSize() time.Duration {
+	return s.bucketSize
 }
 
-// Record adds a TrafficEvent to the correct 1-minute bucket for both route and backend.
+// Record adds a TrafficEvent to the correct bucket for both route and backend.
 func (s *MemoryTrafficStore) Record(event TrafficEvent) {
-	minute := event.Timestamp.Truncate(time.Minute)
+	start := event.Timestamp.Truncate(s.bucketSize)
 
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	sh := s.shardFor(event.Route)
+	sh.mu.Lock()
+	recordInto(sh.routes, event.Route, start, s.bucketSize, event)
+	sh.mu.Unlock()
 
-	s.recordInto(s.routes, event.Route, minute, event)
 	if event.Backend != "" {
-		s.recordInto(s.backends, event.Backend, minute, event)
+		sh := s.shardFor(event.Backend)
+		sh.mu.Lock()
+		recordInto(sh.backends, event.Backend, start, s.bucketSize, event)
+		sh.mu.Unlock()
 	}
 }
 
-// recordInto is the shared logic for inserting into a bucket map.
-func (s *MemoryTrafficStore) recordInto(
-	m map[string]map[time.Time]*Bucket, key string, minute time.Time, event TrafficEvent,
-) {
+// shardedEvent is an event queued for one of its series in RecordBatch.
+type shardedEvent struct {
+	backend bool
+	event   *TrafficEvent
+}
+
+// RecordBatch adds several events, taking each shard's lock once.
+func (s *MemoryTrafficStore) RecordBatch(events []TrafficEvent) {
+	var byShard [storeShards][]shardedEvent
+	for i := range events {
+		e := &events[i]
+		idx := shardIndex(e.Route)
+		byShard[idx] = append(byShard[idx], shardedEvent{event: e})
+		if e.Backend != "" {
+			idx := shardIndex(e.Backend)
+			byShard[idx] = append(byShard[idx], shardedEvent{backend: true, event: e})
+		}
+	}
+
+	for i, queued := range byShard {
+		if len(queued) == 0 {
+			continue
+		}
+		sh := s.shards[i]
+		sh.mu.Lock()
+		for _, q := range queued {
+			start := q.event.Timestamp.Truncate(s.bucketSize)
+			if q.backend {
+				recordInto(sh.backends, q.event.Backend, start, s.bucketSize, *q.event)
+			} else {
+				recordInto(sh.routes, q.event.Route, start, s.bucketSize, *q.event)
+			}
+		}
+		sh.mu.Unlock()
+	}
+}
+
+// recordInto is the shared logic for inserting into a bucket map. Must
+// hold the map's shard lock.
+func recordInto(m map[string]map[time.Time]*Bucket, key string, start time.Time, width time.Duration, event TrafficEvent) {
 	if m[key] == nil {
 		m[key] = make(map[time.Time]*Bucket)
 	}
-	b, exists := m[key][minute]
+	b, exists := m[key][start]
 	if !exists {
 		b = &Bucket{
 			Route:     key,
-			Timestamp: minute,
+			Timestamp: start,
+			Width:     width,
 		}
-		m[key][minute] = b
+		m[key][start] = b
+	}
+	n := event.weight()
+	if event.Anonymous {
+		b.Anonymous += n
 	}
-	b.RequestCount++
-	b.TotalLatency += event.Latency
+	if event.GatewayGenerated {
+		b.Rejected += n
+		return
+	}
+	b.RequestCount += n
+	b.Latency.addN(event.Latency, uint32(n))
+	b.TotalLatency += time.Duration(n) * event.Latency
 	if event.Latency > b.MaxLatency {
 		b.MaxLatency = event.Latency
 	}
 	if event.Status >= 500 {
-		b.ErrorCount++
+		b.ErrorCount += n
+	}
+	b.BytesIn += int64(n) * event.BytesIn
+	b.BytesOut += int64(n) * event.BytesOut
+}
+
+// merge adds b's counts into a series' bucket at start.
+func (s *MemoryTrafficStore) merge(kind, key string, start time.Time, b Bucket) {
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	mergeBucket(sh.series(kind), key, start, b)
+}
+
+// bucket returns a copy of a series' bucket at start.
+func (s *MemoryTrafficStore) bucket(kind, key string, start time.Time) (Bucket, bool) {
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+	b, ok := sh.series(kind)[key][start]
+	if !ok {
+		return Bucket{}, false
 	}
-	b.BytesIn += event.BytesIn
-	b.BytesOut += event.BytesOut
+	return b.clone(), true
 }
 
 // GetBuckets returns sorted buckets for a single route within [from, to).
 func (s *MemoryTrafficStore) GetBuckets(route string, from, to time.Time) []Bucket {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	return s.collectBuckets(s.routes[route], from, to)
+	sh := s.shardFor(route)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+	return collectBuckets(sh.routes[route], from, to)
 }
 
 // GetAllBuckets returns buckets for all routes within [from, to).
 func (s *MemoryTrafficStore) GetAllBuckets(from, to time.Time) map[string][]Bucket {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	result := make(map[string][]Bucket, len(s.routes))
-	for route, bucketMap := range s.routes {
-		if buckets := s.collectBuckets(bucketMap, from, to); len(buckets) > 0 {
-			result[route] = buckets
-		}
-	}
-	return result
+	return s.collectAll("route", from, to)
 }
 
 // GetRoutes returns all known route names.
 func (s *MemoryTrafficStore) GetRoutes() []string {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	routes := make([]string, 0, len(s.routes))
-	for route := range s.routes {
-		routes = append(routes, route)
+	var routes []string
+	for _, sh := range s.shards {
+		sh.mu.RLock()
+		for route := range sh.routes {
+			routes = append(routes, route)
+		}
+		sh.mu.RUnlock()
 	}
 	sort.Strings(routes)
 	return routes
@@ -158,28 +352,43 @@ func (s *MemoryTrafficStore) GetRoutes() []string {
 
 // GetBackendBuckets returns per-backend buckets within [from, to).
 func (s *MemoryTrafficStore) GetBackendBuckets(from, to time.Time) map[string][]Bucket {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	return s.collectAll("backend", from, to)
+}
 
-	result := make(map[string][]Bucket, len(s.backends))
-	for backend, bucketMap := range s.backends {
-		if buckets := s.collectBuckets(bucketMap, from, to); len(buckets) > 0 {
-			result[backend] = buckets
+// collectAll returns every route or backend series' buckets within [from, to).
+func (s *MemoryTrafficStore) collectAll(kind string, from, to time.Time) map[string][]Bucket {
+	result := make(map[string][]Bucket)
+	for _, sh := range s.shards {
+		sh.mu.RLock()
+		for key, bucketMap := range sh.series(kind) {
+			if buckets := collectBuckets(bucketMap, from, to); len(buckets) > 0 {
+				result[key] = buckets
+			}
 		}
+		sh.mu.RUnlock()
 	}
 	return result
 }
 
+// ValidateWindow checks that window is a positive multiple of bucketSize,
+// so that window math (baselines, history, sparklines) covers whole buckets.
+func ValidateWindow(window, bucketSize time.Duration) error {
+	if window <= 0 || bucketSize <= 0 || window%bucketSize != 0 {
+		return fmt.Errorf("window %s is not a multiple of bucket size %s", window, bucketSize)
+	}
+	return nil
+}
+
 // collectBuckets filters and sorts buckets from a timestamp map within [from, to).
-// Must be called with at least a read lock held.
-func (s *MemoryTrafficStore) collectBuckets(bucketMap map[time.Time]*Bucket, from, to time.Time) []Bucket {
+// Must be called with at least a read lock held on the map's shard.
+func collectBuckets(bucketMap map[time.Time]*Bucket, from, to time.Time) []Bucket {
 	if bucketMap == nil {
 		return nil
 	}
 	var result []Bucket
 	for ts, b := range bucketMap {
 		if !ts.Before(from) && ts.Before(to) {
-			result = append(result, *b)
+			result = append(result, b.clone())
 		}
 	}
 	sort.Slice(result, func(i, j int) bool {
@@ -188,26 +397,88 @@ func (s *MemoryTrafficStore) collectBuckets(bucketMap map[time.Time]*Bucket, fro
 	return result
 }
 
+// StoreStats describes how much data a TrafficStore currently holds.
+type StoreStats struct {
+	Routes      int   `json:"routes"`
+	Backends    int   `json:"backends"`
+	Buckets     int   `json:"buckets"`
+	MemoryBytes int64 `json:"memory_bytes"` // approximate
+}
+
+// approxBucketBytes is a rough per-bucket footprint (struct + map entry + key).
+const approxBucketBytes = int64(unsafe.Sizeof(Bucket{})) + 64
+
+// Stats returns the number of series and buckets held, with an approximate memory footprint.
+func (s *MemoryTrafficStore) Stats() StoreStats {
+	var stats StoreStats
+	for _, sh := range s.shards {
+		sh.mu.RLock()
+		stats.Routes += len(sh.routes)
+		stats.Backends += len(sh.backends)
+		for _, m := range sh.routes {
+			stats.Buckets += len(m)
+		}
+		for _, m := range sh.backends {
+			stats.Buckets += len(m)
+		}
+		sh.mu.RUnlock()
+	}
+	stats.MemoryBytes = int64(stats.Buckets) * approxBucketBytes
+	return stats
+}
+
 // StartCleanup launches a background goroutine that prunes expired buckets
 // every 10 minutes.
 func (s *MemoryTrafficStore) StartCleanup() {
+	s.stopCleanup = make(chan struct{})
+	s.cleanupDone = make(chan struct{})
 	ticker := time.NewTicker(10 * time.Minute)
 	go func() {
-		for range ticker.C {
-			s.cleanup()
+		defer close(s.cleanupDone)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.cleanup()
+			case <-s.stopCleanup:
+				return
+			}
 		}
 	}()
 }
 
-// cleanup removes all buckets older than the retention period.
+// StopCleanup ends the cleanup goroutine started by StartCleanup.
+func (s *MemoryTrafficStore) StopCleanup() {
+	if s.stopCleanup != nil {
+		close(s.stopCleanup)
+		<-s.cleanupDone
+		s.stopCleanup = nil
+	}
+}
+
+// Close stops background cleanup. The buckets stay readable.
+func (s *MemoryTrafficStore) Close() error {
+	s.StopCleanup()
+	return nil
+}
+
+// cleanup removes all buckets older than the retention period and rolls
+// up old ones per SetDownsampling.
 func (s *MemoryTrafficStore) cleanup() {
-	cutoff := time.Now().Add(-s.retention)
+	s.expire()
+	s.rollup(time.Now())
+}
 
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// expire removes all buckets older than the retention period.
+func (s *MemoryTrafficStore) expire() {
+	cutoff := time.Now().Add(-s.retention)
 
-	pruneMap(s.routes, cutoff)
-	pruneMap(s.backends, cutoff)
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+		pruneMap(sh.routes, cutoff)
+		pruneMap(sh.backends, cutoff)
+		sh.mu.Unlock()
+	}
 }
 
 // pruneMap removes entries older than cutoff from a nested bucket map.
@@ -0,0 +1,50 @@
+package analytics
+
+import (
+	_ "github.com/ClickHouse/clickhouse-go/v2" // registers the "clickhouse" database/sql driver
+)
+
+// clickhouseDialect stores buckets in ClickHouse. ClickHouse has no
+// upsert, so every flush inserts a new version of a bucket and
+// ReplacingMergeTree keeps the latest one; reads use FINAL to see only
+// that version before background merges catch up.
+var clickhouseDialect = sqlDialect{
+	driver: "clickhouse",
+	schema: `CREATE TABLE IF NOT EXISTS traffic_buckets (
+		instance      String,
+		kind          LowCardinality(String),
+		name          String,
+		start         Int64,
+		width         Int64,
+		request_count Int64,
+		error_count   Int64,
+		total_latency Int64,
+		max_latency   Int64,
+		bytes_in      Int64,
+		bytes_out     Int64,
+		rejected      Int64,
+		anonymous     Int64,
+		latency_hist  String,
+		updated       Int64
+	) ENGINE = ReplacingMergeTree(updated)
+	ORDER BY (instance, kind, name, start)`,
+	load: `SELECT kind, name, start, width, request_count, error_count, total_latency,
+		max_latency, bytes_in, bytes_out, rejected, anonymous, latency_hist
+		FROM traffic_buckets FINAL WHERE instance = ? AND start >= ?`,
+	upsert: `INSERT INTO traffic_buckets (instance, kind, name, start, width, request_count, error_count,
+		total_latency, max_latency, bytes_in, bytes_out, rejected, anonymous, latency_hist, updated)`,
+	delete: `ALTER TABLE traffic_buckets DELETE WHERE instance = ? AND start < ?`,
+	since:  `ALTER TABLE traffic_buckets DELETE WHERE instance = ? AND start >= ?`,
+	rollup: `ALTER TABLE traffic_buckets DELETE WHERE instance = ? AND start < ? AND width < ?`,
+}
+
+func init() {
+	RegisterStore("clickhouse", func(dsn string, opts StoreOptions) (TrafficStore, error) {
+		s, err := openSQLTrafficStore(clickhouseDialect, dsn, opts)
+		if err != nil {
+			return nil, err
+		}
+		s.Start()
+		return s, nil
+	})
+}
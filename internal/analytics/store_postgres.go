@@ -0,0 +1,55 @@
+package analytics
+
+import (
+	_ "github.com/jackc/pgx/v5/stdlib" // registers the "pgx" database/sql driver
+)
+
+// postgresDialect stores buckets in PostgreSQL, for long retention and
+// fleets of gateways sharing one database.
+var postgresDialect = sqlDialect{
+	driver: "pgx",
+	schema: `CREATE TABLE IF NOT EXISTS traffic_buckets (
+		instance      TEXT   NOT NULL,
+		kind          TEXT   NOT NULL,
+		name          TEXT   NOT NULL,
+		start         BIGINT NOT NULL,
+		width         BIGINT NOT NULL,
+		request_count BIGINT NOT NULL,
+		error_count   BIGINT NOT NULL,
+		total_latency BIGINT NOT NULL,
+		max_latency   BIGINT NOT NULL,
+		bytes_in      BIGINT NOT NULL,
+		bytes_out     BIGINT NOT NULL,
+		rejected      BIGINT NOT NULL,
+		anonymous     BIGINT NOT NULL,
+		latency_hist  TEXT   NOT NULL,
+		updated       BIGINT NOT NULL,
+		PRIMARY KEY (instance, kind, name, start)
+	)`,
+	load: `SELECT kind, name, start, width, request_count, error_count, total_latency,
+		max_latency, bytes_in, bytes_out, rejected, anonymous, latency_hist
+		FROM traffic_buckets WHERE instance = $1 AND start >= $2`,
+	upsert: `INSERT INTO traffic_buckets (instance, kind, name, start, width, request_count, error_count,
+		total_latency, max_latency, bytes_in, bytes_out, rejected, anonymous, latency_hist, updated)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+		ON CONFLICT (instance, kind, name, start) DO UPDATE SET
+		width = excluded.width, request_count = excluded.request_count, error_count = excluded.error_count,
+		total_latency = excluded.total_latency, max_latency = excluded.max_latency,
+		bytes_in = excluded.bytes_in, bytes_out = excluded.bytes_out,
+		rejected = excluded.rejected, anonymous = excluded.anonymous,
+		latency_hist = excluded.latency_hist, updated = excluded.updated`,
+	delete: `DELETE FROM traffic_buckets WHERE instance = $1 AND start < $2`,
+	since:  `DELETE FROM traffic_buckets WHERE instance = $1 AND start >= $2`,
+	rollup: `DELETE FROM traffic_buckets WHERE instance = $1 AND start < $2 AND width < $3`,
+}
+
+func init() {
+	RegisterStore("postgres", func(dsn string, opts StoreOptions) (TrafficStore, error) {
+		s, err := openSQLTrafficStore(postgresDialect, dsn, opts)
+		if err != nil {
+			return nil, err
+		}
+		s.Start()
+		return s, nil
+	})
+}
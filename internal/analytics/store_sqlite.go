@@ -0,0 +1,76 @@
+package analytics
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	_ "modernc.org/sqlite" // registers the "sqlite" database/sql driver
+)
+
+// sqliteDialect stores buckets in a local SQLite file.
+var sqliteDialect = sqlDialect{
+	driver: "sqlite",
+	schema: `CREATE TABLE IF NOT EXISTS traffic_buckets (
+		instance      TEXT    NOT NULL,
+		kind          TEXT    NOT NULL,
+		name          TEXT    NOT NULL,
+		start         INTEGER NOT NULL,
+		width         INTEGER NOT NULL,
+		request_count INTEGER NOT NULL,
+		error_count   INTEGER NOT NULL,
+		total_latency INTEGER NOT NULL,
+		max_latency   INTEGER NOT NULL,
+		bytes_in      INTEGER NOT NULL,
+		bytes_out     INTEGER NOT NULL,
+		rejected      INTEGER NOT NULL,
+		anonymous     INTEGER NOT NULL,
+		latency_hist  TEXT    NOT NULL,
+		updated       INTEGER NOT NULL,
+		PRIMARY KEY (instance, kind, name, start)
+	)`,
+	load: `SELECT kind, name, start, width, request_count, error_count, total_latency,
+		max_latency, bytes_in, bytes_out, rejected, anonymous, latency_hist
+		FROM traffic_buckets WHERE instance = ? AND start >= ?`,
+	upsert: `INSERT INTO traffic_buckets (instance, kind, name, start, width, request_count, error_count,
+		total_latency, max_latency, bytes_in, bytes_out, rejected, anonymous, latency_hist, updated)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (instance, kind, name, start) DO UPDATE SET
+		width = excluded.width, request_count = excluded.request_count, error_count = excluded.error_count,
+		total_latency = excluded.total_latency, max_latency = excluded.max_latency,
+		bytes_in = excluded.bytes_in, bytes_out = excluded.bytes_out,
+		rejected = excluded.rejected, anonymous = excluded.anonymous,
+		latency_hist = excluded.latency_hist, updated = excluded.updated`,
+	delete: `DELETE FROM traffic_buckets WHERE instance = ? AND start < ?`,
+	since:  `DELETE FROM traffic_buckets WHERE instance = ? AND start >= ?`,
+	rollup: `DELETE FROM traffic_buckets WHERE instance = ? AND start < ? AND width < ?`,
+}
+
+// OpenSQLiteTrafficStore opens (or creates) a SQLite database at path
+// (default "data/analytics.db") and loads its buckets. The store is not
+// started; call Start.
+func OpenSQLiteTrafficStore(path string, opts StoreOptions) (*SQLTrafficStore, error) {
+	if path == "" {
+		path = "data/analytics.db"
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create analytics store dir: %w", err)
+	}
+	s, err := openSQLTrafficStore(sqliteDialect, path, opts)
+	if err != nil {
+		return nil, err
+	}
+	s.db.SetMaxOpenConns(1) // SQLite allows a single writer
+	return s, nil
+}
+
+func init() {
+	RegisterStore("sqlite", func(dsn string, opts StoreOptions) (TrafficStore, error) {
+		s, err := OpenSQLiteTrafficStore(dsn, opts)
+		if err != nil {
+			return nil, err
+		}
+		s.Start()
+		return s, nil
+	})
+}
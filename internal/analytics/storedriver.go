@@ -0,0 +1,76 @@
+package analytics
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// StoreOptions are the settings every TrafficStore driver receives.
+type StoreOptions struct {
+	Retention  time.Duration // how long to keep buckets (default 48h)
+	BucketSize time.Duration // width of each bucket (default 1m)
+	Instance   string        // this gateway's name, for stores shared by a fleet
+
+	// Downsample rolls old buckets up into wider ones (default none).
+	Downsample []DownsampleTier
+}
+
+// StoreOpener opens a TrafficStore from a driver-specific DSN. The returned
+// store is running (cleanup, flushing); if it implements io.Closer, Close
+// flushes and releases it on shutdown.
+type StoreOpener func(dsn string, opts StoreOptions) (TrafficStore, error)
+
+var (
+	storeDriversMu sync.RWMutex
+	storeDrivers   = make(map[string]StoreOpener)
+)
+
+// RegisterStore makes a TrafficStore driver available under name, usually
+// from an init function. It panics if name is registered twice.
+func RegisterStore(name string, open StoreOpener) {
+	storeDriversMu.Lock()
+	defer storeDriversMu.Unlock()
+	if _, dup := storeDrivers[name]; dup {
+		panic("analytics: RegisterStore called twice for driver " + name)
+	}
+	storeDrivers[name] = open
+}
+
+// StoreDrivers returns the names of the registered drivers, sorted.
+func StoreDrivers() []string {
+	storeDriversMu.RLock()
+	defer storeDriversMu.RUnlock()
+	names := make([]string, 0, len(storeDrivers))
+	for name := range storeDrivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// OpenStore opens a TrafficStore with the named driver ("memory" if empty).
+func OpenStore(driver, dsn string, opts StoreOptions) (TrafficStore, error) {
+	if driver == "" {
+		driver = "memory"
+	}
+	storeDriversMu.RLock()
+	open, ok := storeDrivers[driver]
+	storeDriversMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown analytics store %q (available: %v)", driver, StoreDrivers())
+	}
+	return open(dsn, opts)
+}
+
+func init() {
+	RegisterStore("memory", func(_ string, opts StoreOptions) (TrafficStore, error) {
+		s := NewMemoryTrafficStore(opts.Retention, opts.BucketSize)
+		if err := s.SetDownsampling(opts.Downsample); err != nil {
+			return nil, err
+		}
+		s.StartCleanup()
+		return s, nil
+	})
+}
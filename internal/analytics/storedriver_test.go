@@ -0,0 +1,145 @@
+package analytics
+
+import (
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOpenStoreDrivers(t *testing.T) {
+	for _, name := range []string{"memory", "sqlite", "postgres", "clickhouse"} {
+		if !slices.Contains(StoreDrivers(), name) {
+			t.Errorf("Expected driver %q registered, got %v", name, StoreDrivers())
+		}
+	}
+
+	s, err := OpenStore("", "", StoreOptions{Retention: time.Hour, BucketSize: time.Minute})
+	if err != nil {
+		t.Fatalf("OpenStore: %v", err)
+	}
+	if _, ok := s.(*MemoryTrafficStore); !ok {
+		t.Errorf("Expected the memory store by default, got %T", s)
+	}
+	s.(*MemoryTrafficStore).StopCleanup()
+
+	_, err = OpenStore("mysql", "", StoreOptions{})
+	if err == nil || !strings.Contains(err.Error(), `unknown analytics store "mysql"`) {
+		t.Errorf("Expected an unknown driver refused, got %v", err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected registering a driver twice to panic")
+		}
+	}()
+	RegisterStore("memory", nil)
+}
+
+var (
+	numberedPlaceholder = regexp.MustCompile(`\$(\d+)`)
+	insertColumns       = regexp.MustCompile(`(?s)INSERT INTO traffic_buckets \((.*?)\)`)
+	selectColumns       = regexp.MustCompile(`(?s)SELECT (.*?)\s+FROM`)
+)
+
+// placeholders returns how many parameters stmt takes, checking that it
+// uses only the dialect's style and numbers them 1..n.
+func placeholders(t *testing.T, dialect, stmt string, numbered bool) int {
+	t.Helper()
+	positional := strings.Count(stmt, "?")
+	matches := numberedPlaceholder.FindAllStringSubmatch(stmt, -1)
+	if !numbered {
+		if len(matches) > 0 {
+			t.Errorf("%s: unexpected $n placeholders in %q", dialect, stmt)
+		}
+		return positional
+	}
+	if positional > 0 {
+		t.Errorf("%s: unexpected ? placeholders in %q", dialect, stmt)
+	}
+	for i, m := range matches {
+		if n, _ := strconv.Atoi(m[1]); n != i+1 {
+			t.Errorf("%s: placeholder $%d out of order in %q", dialect, n, stmt)
+		}
+	}
+	return len(matches)
+}
+
+// columns splits a comma-separated column list.
+func columns(list string) []string {
+	var cols []string
+	for _, c := range strings.Split(list, ",") {
+		cols = append(cols, strings.TrimSpace(c))
+	}
+	return cols
+}
+
+func TestSQLDialects(t *testing.T) {
+	tests := []struct {
+		name     string
+		dialect  sqlDialect
+		numbered bool // $1 placeholders instead of ?
+		upsertIn int  // parameters in the upsert statement itself
+	}{
+		{"sqlite", sqliteDialect, false, 15},
+		{"postgres", postgresDialect, true, 15},
+		// The ClickHouse driver appends each Exec's values to a batch insert
+		{"clickhouse", clickhouseDialect, false, 0},
+	}
+	for _, tt := range tests {
+		d := tt.dialect
+		params := []struct {
+			stmt string
+			want int
+		}{
+			{d.schema, 0},
+			{d.load, 2},
+			{d.upsert, tt.upsertIn},
+			{d.delete, 2},
+			{d.since, 2},
+			{d.rollup, 3},
+		}
+		for _, p := range params {
+			if got := placeholders(t, tt.name, p.stmt, tt.numbered); got != p.want {
+				t.Errorf("%s: expected %d parameters, got %d in %q", tt.name, p.want, got, p.stmt)
+			}
+		}
+
+		// upsert binds 15 values and load scans 13 columns, all in the table
+		m := insertColumns.FindStringSubmatch(d.upsert)
+		if m == nil {
+			t.Fatalf("%s: upsert is not an INSERT into traffic_buckets", tt.name)
+		}
+		inserted := columns(m[1])
+		if len(inserted) != 15 {
+			t.Errorf("%s: expected upsert to write 15 columns, got %v", tt.name, inserted)
+		}
+		selected := columns(selectColumns.FindStringSubmatch(d.load)[1])
+		if len(selected) != 13 {
+			t.Errorf("%s: expected load to read 13 columns, got %v", tt.name, selected)
+		}
+		for _, col := range append(inserted, selected...) {
+			if !regexp.MustCompile(`\n\s*` + col + `\s`).MatchString(d.schema) {
+				t.Errorf("%s: column %s is missing from the schema", tt.name, col)
+			}
+		}
+		if !strings.Contains(d.load, "instance = ") {
+			t.Errorf("%s: load must be scoped to the instance", tt.name)
+		}
+	}
+
+	// Where the database can upsert, every written column but the key is updated
+	for _, d := range []sqlDialect{sqliteDialect, postgresDialect} {
+		for _, col := range columns(insertColumns.FindStringSubmatch(d.upsert)[1]) {
+			switch col {
+			case "instance", "kind", "name", "start":
+				continue
+			}
+			if !strings.Contains(d.upsert, col+" = excluded."+col) {
+				t.Errorf("%s: upsert does not update %s", d.driver, col)
+			}
+		}
+	}
+}
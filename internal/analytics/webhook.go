@@ -0,0 +1,211 @@
+package analytics
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"text/template"
+	"time"
+)
+
+// DefaultWebhookRetries is how many times a failed delivery is retried
+// unless configured.
+const DefaultWebhookRetries = 3
+
+// Webhook is an endpoint notified of every anomaly the analyzer detects
+// and every alert rule that starts or stops firing.
+type Webhook struct {
+	Name string // used in logs (default the URL)
+	URL  string
+
+	// Template renders the JSON payload with text/template. .Event is
+	// "anomaly" or "alert" and .Instance names the gateway; the rest are the
+	// Anomaly's or Alert's fields (.Route, .Metric, .ZScore, .Rule, .State,
+	// ...). The json function quotes a value, e.g.
+	//   {"text": {{printf "%s anomaly on %s (z=%.1f)" .Metric .Route .ZScore | json}}}
+	// Empty sends the event itself as JSON.
+	Template string
+
+	// Secret, if set, signs each delivery: X-Gateway-Signature carries
+	// "sha256=" and the hex HMAC-SHA256 of "<X-Gateway-Timestamp>.<body>".
+	Secret string
+
+	Headers map[string]string // extra request headers, e.g. Authorization
+	Retries int               // retries after a failed delivery (default 3, negative disables)
+	Timeout time.Duration     // bounds each attempt (default 5s)
+}
+
+// anomalyPayload and alertPayload are the data webhook templates are
+// rendered with.
+type anomalyPayload struct {
+	Event string `json:"event"`
+	Anomaly
+	Instance string `json:"instance,omitempty"`
+}
+
+type alertPayload struct {
+	Event string `json:"event"`
+	Alert
+	Instance string `json:"instance,omitempty"`
+}
+
+// webhookFuncs are the functions available to webhook templates.
+var webhookFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// WebhookNotifier delivers anomalies to webhooks, so alerts reach chat or
+// paging tools without anyone polling /analytics/anomalies. Deliveries run
+// in the background and are retried with exponential backoff on network
+// errors, 429s, and 5xx responses.
+type WebhookNotifier struct {
+	hooks     []Webhook
+	templates []*template.Template // nil where the default payload is used
+	instance  string
+	client    *http.Client
+	backoff   time.Duration // first retry delay, doubled on each attempt
+}
+
+// NewWebhookNotifier parses the webhooks' templates. instance is made
+// available to templates as .Instance.
+func NewWebhookNotifier(hooks []Webhook, instance string) (*WebhookNotifier, error) {
+	n := &WebhookNotifier{
+		hooks:     append([]Webhook(nil), hooks...),
+		templates: make([]*template.Template, len(hooks)),
+		instance:  instance,
+		client:    &http.Client{},
+		backoff:   time.Second,
+	}
+	for i := range n.hooks {
+		hook := &n.hooks[i]
+		if hook.URL == "" {
+			return nil, fmt.Errorf("webhook %d has no url", i)
+		}
+		if hook.Name == "" {
+			hook.Name = hook.URL
+		}
+		if hook.Retries == 0 {
+			hook.Retries = DefaultWebhookRetries
+		}
+		if hook.Timeout <= 0 {
+			hook.Timeout = 5 * time.Second
+		}
+		if hook.Template == "" {
+			continue
+		}
+		tmpl, err := template.New(hook.Name).Funcs(webhookFuncs).Parse(hook.Template)
+		if err != nil {
+			return nil, fmt.Errorf("webhook %s: invalid template: %w", hook.Name, err)
+		}
+		n.templates[i] = tmpl
+	}
+	return n, nil
+}
+
+// Run delivers every anomaly received on anomalies until it is closed.
+// Typically started as go n.Run(analyzer.AnomalyChannel).
+func (n *WebhookNotifier) Run(anomalies <-chan Anomaly) {
+	for anomaly := range anomalies {
+		n.Notify(anomaly)
+	}
+}
+
+// Notify sends an anomaly to every webhook in the background.
+func (n *WebhookNotifier) Notify(anomaly Anomaly) {
+	n.send(anomalyPayload{Event: "anomaly", Anomaly: anomaly, Instance: n.instance})
+}
+
+// NotifyAlert sends an alert rule's state change to every webhook in the
+// background. It can be passed to AlertEngine.OnAlert.
+func (n *WebhookNotifier) NotifyAlert(alert Alert) {
+	n.send(alertPayload{Event: "alert", Alert: alert, Instance: n.instance})
+}
+
+// send renders data for every webhook and delivers it.
+func (n *WebhookNotifier) send(data any) {
+	for i := range n.hooks {
+		body, err := n.render(i, data)
+		if err != nil {
+			log.Printf("[webhook] %s: %v", n.hooks[i].Name, err)
+			continue
+		}
+		go n.deliver(n.hooks[i], body)
+	}
+}
+
+// render builds the payload of webhook i.
+func (n *WebhookNotifier) render(i int, data any) ([]byte, error) {
+	tmpl := n.templates[i]
+	if tmpl == nil {
+		return json.Marshal(data)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("failed to render payload: %w", err)
+	}
+	if !json.Valid(buf.Bytes()) {
+		return nil, fmt.Errorf("template did not render valid JSON: %s", buf.String())
+	}
+	return buf.Bytes(), nil
+}
+
+// deliver posts body to a webhook, retrying failed attempts.
+func (n *WebhookNotifier) deliver(hook Webhook, body []byte) {
+	delay := n.backoff
+	for attempt := 0; ; attempt++ {
+		retry, err := n.post(hook, body)
+		if err == nil {
+			return
+		}
+		if !retry || attempt >= hook.Retries {
+			log.Printf("[webhook] %s: delivery failed after %d attempt(s): %v", hook.Name, attempt+1, err)
+			return
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// post makes one delivery attempt, reporting whether a failure is worth
+// retrying.
+func (n *WebhookNotifier) post(hook Webhook, body []byte) (retry bool, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), hook.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range hook.Headers {
+		req.Header.Set(k, v)
+	}
+	if hook.Secret != "" {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		mac := hmac.New(sha256.New, []byte(hook.Secret))
+		mac.Write([]byte(ts + "."))
+		mac.Write(body)
+		req.Header.Set("X-Gateway-Timestamp", ts)
+		req.Header.Set("X-Gateway-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry = resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("webhook returned %s", resp.Status)
+}
@@ -0,0 +1,107 @@
+package analytics
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWebhookSignsAndRendersPayload(t *testing.T) {
+	type delivery struct {
+		header http.Header
+		body   string
+	}
+	received := make(chan delivery, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- delivery{r.Header.Clone(), string(body)}
+	}))
+	defer srv.Close()
+
+	n, err := NewWebhookNotifier([]Webhook{{
+		URL:      srv.URL,
+		Secret:   "whsec-test",
+		Headers:  map[string]string{"Authorization": "Bearer hook-token"},
+		Template: `{"text": {{printf "%s anomaly on %s" .Metric .Route | json}}, "from": {{json .Instance}}}`,
+	}}, "gw-1")
+	if err != nil {
+		t.Fatalf("NewWebhookNotifier: %v", err)
+	}
+	n.Notify(Anomaly{Route: "/api", Metric: "latency"})
+
+	var d delivery
+	select {
+	case d = <-received:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the webhook delivered")
+	}
+	if want := `{"text": "latency anomaly on /api", "from": "gw-1"}`; d.body != want {
+		t.Errorf("Expected payload %s, got %s", want, d.body)
+	}
+	if d.header.Get("Authorization") != "Bearer hook-token" || d.header.Get("Content-Type") != "application/json" {
+		t.Errorf("Expected the configured headers and a JSON content type, got %v", d.header)
+	}
+
+	ts := d.header.Get("X-Gateway-Timestamp")
+	mac := hmac.New(sha256.New, []byte("whsec-test"))
+	mac.Write([]byte(ts + "." + d.body))
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); d.header.Get("X-Gateway-Signature") != want {
+		t.Errorf("Expected signature %s over %q, got %s", want, ts+"."+d.body, d.header.Get("X-Gateway-Signature"))
+	}
+}
+
+func TestWebhookRejectsBadTemplates(t *testing.T) {
+	if _, err := NewWebhookNotifier([]Webhook{{URL: "http://hooks.example.com", Template: "{{.Route"}}, ""); err == nil {
+		t.Error("Expected a template that doesn't parse refused")
+	}
+	if _, err := NewWebhookNotifier([]Webhook{{Template: "{}"}}, ""); err == nil {
+		t.Error("Expected a webhook without a url refused")
+	}
+
+	n, err := NewWebhookNotifier([]Webhook{{URL: "http://hooks.example.com", Template: `{"route": {{.Route}}}`}}, "")
+	if err != nil {
+		t.Fatalf("NewWebhookNotifier: %v", err)
+	}
+	if _, err := n.render(0, anomalyPayload{Anomaly: Anomaly{Route: "/api"}}); err == nil {
+		t.Error("Expected a template rendering invalid JSON refused")
+	}
+}
+
+func TestWebhookRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int // answered in turn, then 200
+		retries  int
+		want     int // attempts
+	}{
+		{"succeeds after 5xx and 429", []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}, 3, 3},
+		{"gives up after the retries", []int{http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError}, 2, 3},
+		{"does not retry a 4xx", []int{http.StatusBadRequest}, 3, 1},
+		{"retries disabled", []int{http.StatusBadGateway}, -1, 1},
+	}
+	for _, tt := range tests {
+		var attempts atomic.Int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if i := int(attempts.Add(1)) - 1; i < len(tt.statuses) {
+				w.WriteHeader(tt.statuses[i])
+			}
+		}))
+
+		n, err := NewWebhookNotifier([]Webhook{{URL: srv.URL, Retries: tt.retries}}, "")
+		if err != nil {
+			t.Fatalf("NewWebhookNotifier: %v", err)
+		}
+		n.backoff = time.Millisecond
+		n.deliver(n.hooks[0], []byte(`{}`))
+		if got := int(attempts.Load()); got != tt.want {
+			t.Errorf("%s: expected %d attempts, got %d", tt.name, tt.want, got)
+		}
+		srv.Close()
+	}
+}
@@ -0,0 +1,65 @@
+package analytics
+
+import (
+	"sort"
+	"time"
+)
+
+// maxWeightSamples bounds each backend's weight history: a week of
+// rebalancing at the default 5-minute interval.
+const maxWeightSamples = 7 * 24 * 12
+
+// WeightSample is the load balancer weight assigned to a backend at a
+// point in time.
+type WeightSample struct {
+	Timestamp time.Time `json:"timestamp"`
+	Weight    float64   `json:"weight"`
+}
+
+// RecordWeights notes the weights a load balancer just assigned, so they
+// can be lined up with the backends' latency and error history. Called by
+// WeightedLoadBalancer on every rebalance; unchanged weights are not
+// recorded again.
+func (a *Analyzer) RecordWeights(weights map[string]float64) {
+	now := time.Now()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for backend, weight := range weights {
+		samples := a.weights[backend]
+		if n := len(samples); n > 0 && samples[n-1].Weight == weight {
+			continue
+		}
+		samples = append(samples, WeightSample{Timestamp: now, Weight: weight})
+		if over := len(samples) - maxWeightSamples; over > 0 {
+			samples = samples[over:]
+		}
+		a.weights[backend] = samples
+	}
+}
+
+// WeightHistory returns a backend's weight changes within [from, to),
+// preceded by the weight already in effect at from, if known.
+func (a *Analyzer) WeightHistory(backend string, from, to time.Time) []WeightSample {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	samples := a.weights[backend]
+	start := sort.Search(len(samples), func(i int) bool { return !samples[i].Timestamp.Before(from) })
+	end := sort.Search(len(samples), func(i int) bool { return !samples[i].Timestamp.Before(to) })
+	if start > 0 {
+		start--
+	}
+	return append([]WeightSample(nil), samples[start:end]...)
+}
+
+// weightAt returns the weight in effect at t from samples sorted by time,
+// or nil if none was assigned yet.
+func weightAt(samples []WeightSample, t time.Time) *float64 {
+	i := sort.Search(len(samples), func(i int) bool { return samples[i].Timestamp.After(t) })
+	if i == 0 {
+		return nil
+	}
+	w := samples[i-1].Weight
+	return &w
+}
@@ -0,0 +1,87 @@
+// Package apierror defines the JSON body returned by every error the gateway
+// generates itself (as opposed to errors relayed from a backend), so clients
+// can branch on a stable code instead of parsing prose.
+package apierror
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Error codes. These are part of the public API — add new ones, never rename.
+const (
+	CodeRateLimited        = "RATE_LIMITED"
+	CodeCircuitOpen        = "CIRCUIT_OPEN"
+	CodeUnauthorized       = "UNAUTHORIZED"
+	CodeForbidden          = "FORBIDDEN"
+	CodeUpgradeDenied      = "UPGRADE_DENIED"
+	CodeRouteNotFound      = "ROUTE_NOT_FOUND"
+	CodeNoBackends         = "NO_BACKENDS"
+	CodeBadBackend         = "BAD_BACKEND"
+	CodeBadGateway         = "BAD_GATEWAY"
+	CodeGatewayTimeout     = "GATEWAY_TIMEOUT"
+	CodeReplayDetected     = "REPLAY_DETECTED"
+	CodeQuotaExceeded      = "QUOTA_EXCEEDED"
+	CodeConcurrencyLimited = "CONCURRENCY_LIMITED"
+	CodeAuthUnavailable    = "AUTH_UNAVAILABLE"
+	CodeBulkheadFull       = "BULKHEAD_FULL"
+)
+
+// Error is the JSON body of a gateway-generated error response.
+type Error struct {
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+	RequestID  string `json:"request_id,omitempty"`
+	RetryAfter int    `json:"retry_after,omitempty"` // seconds, mirrors the Retry-After header
+	DocsURL    string `json:"docs_url,omitempty"`
+}
+
+// DefaultDocsURL is where error codes are documented unless overridden.
+const DefaultDocsURL = "https://github.com/neontvn/microgate/blob/main/docs/errors.md"
+
+var (
+	mu      sync.RWMutex
+	docsURL = DefaultDocsURL
+)
+
+// SetDocsURL sets the base documentation URL; each error links to
+// base#<lowercase code>. An empty base omits docs_url.
+func SetDocsURL(base string) {
+	mu.Lock()
+	docsURL = base
+	mu.Unlock()
+}
+
+// CodeFor converts a short reason tag (e.g. "rate_limited", as recorded
+// for traffic analytics) into its error code ("RATE_LIMITED").
+func CodeFor(reason string) string {
+	return strings.ToUpper(reason)
+}
+
+// Write sends a JSON error response. The request ID and retry hint are taken
+// from the X-Request-ID and Retry-After headers already set on w, so callers
+// only need to set those headers as they normally would.
+func Write(w http.ResponseWriter, status int, code, message string) {
+	e := Error{
+		Code:      code,
+		Message:   message,
+		RequestID: w.Header().Get("X-Request-ID"),
+	}
+	if ra := w.Header().Get("Retry-After"); ra != "" {
+		e.RetryAfter, _ = strconv.Atoi(ra)
+	}
+
+	mu.RLock()
+	if docsURL != "" {
+		e.DocsURL = docsURL + "#" + strings.ToLower(code)
+	}
+	mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(e)
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -15,6 +16,105 @@ type Route struct {
 	Backend  string   `yaml:"backend,omitempty"`  // single backend (backward compatible)
 	Backends []string `yaml:"backends,omitempty"` // multiple backends for load balancing
 	Strategy string   `yaml:"strategy,omitempty"` // "round-robin" or "random"
+
+	// Timeout bounds how long a regular request may take end-to-end (e.g. "5s").
+	// IdleTimeout bounds the silence between bytes once a response turns out to
+	// be a stream (SSE or upgraded connection); streams have no overall deadline.
+	// Empty means no limit.
+	Timeout     string `yaml:"timeout,omitempty"`
+	IdleTimeout string `yaml:"idle_timeout,omitempty"`
+
+	// Upgrades lists the protocols clients may switch to via the Upgrade
+	// header (e.g. ["websocket"]). Defaults to WebSocket only; ["none"] refuses all.
+	Upgrades []string `yaml:"upgrades,omitempty"`
+
+	// Trusted makes the route internal-only: callers from these networks or
+	// with these mTLS identities skip auth, everyone else is refused.
+	Trusted *TrustedCallersConfig `yaml:"trusted,omitempty"`
+
+	// Auth selects the credentials the route accepts: "any" (default, API
+	// key or JWT), "api_key", "jwt", "none" for public endpoints, or
+	// "anonymous" to also admit callers without credentials under the
+	// stricter ratelimit.anonymous limit.
+	Auth string `yaml:"auth,omitempty"`
+
+	// RequiredScopes must all be granted to the caller, and at least one
+	// of RequiredRoles if any are listed; otherwise 403. Grants come from
+	// JWT claims (scope/scp, roles) or auth.keys entries.
+	RequiredScopes []string `yaml:"required_scopes,omitempty"`
+	RequiredRoles  []string `yaml:"required_roles,omitempty"`
+
+	// OIDC requires a browser login through auth.oidc instead of API keys
+	// or JWTs. Unauthenticated page loads are redirected to the provider.
+	OIDC bool `yaml:"oidc,omitempty"`
+
+	// ForwardAuth hands the auth decision to an external service instead
+	// of checking API keys or JWTs.
+	ForwardAuth *ForwardAuthConfig `yaml:"forward_auth,omitempty"`
+
+	// AdaptiveBaseline overrides adaptive_rate_limit.baseline for this route.
+	AdaptiveBaseline string `yaml:"adaptive_baseline,omitempty"`
+
+	// Anomaly tunes anomaly detection for the route. Zero fields fall back
+	// to the analytics settings.
+	Anomaly *RouteAnomalyConfig `yaml:"anomaly,omitempty"`
+
+	// RateLimit gives the route its own static limiter (separate buckets)
+	// instead of sharing the global one. Zero fields fall back to the
+	// global ratelimit values.
+	RateLimit *RateLimitConfig `yaml:"ratelimit,omitempty"`
+
+	// Cost is how many rate limit tokens one request takes (default 1), so
+	// heavy endpoints drain a shared bucket faster. MethodCosts overrides it
+	// per HTTP method, e.g. {"POST": 5}.
+	Cost        float64            `yaml:"cost,omitempty"`
+	MethodCosts map[string]float64 `yaml:"method_costs,omitempty"`
+
+	// ReplayProtection rejects requests repeating an Idempotency-Key or
+	// payload signature within the dedup window (needs dedup.enabled).
+	ReplayProtection bool `yaml:"replay_protection,omitempty"`
+
+	// CircuitBreaker gives the route its own breaker (separate failure
+	// budget) or, with enabled: false, none at all. Zero fields fall back
+	// to the global circuitbreaker values.
+	CircuitBreaker *CircuitBreakerConfig `yaml:"circuitbreaker,omitempty"`
+
+	// MaxConcurrent caps requests in flight on the route; extra requests get
+	// 503 CONCURRENCY_LIMITED. Zero means no cap.
+	MaxConcurrent int `yaml:"max_concurrent,omitempty"`
+
+	// Retries is how many times an idempotent, bodyless request is retried
+	// on another backend after a connection error or a 502/503/504.
+	// Retries draw on the route's retry budget. Zero means no retries.
+	Retries int `yaml:"retries,omitempty"`
+
+	// Profile is the route's initial protection profile: "conservative",
+	// "balanced" (default), or "aggressive". Can be changed at runtime.
+	Profile string `yaml:"profile,omitempty"`
+}
+
+// RouteAnomalyConfig overrides anomaly detection for one route, since a
+// low-traffic admin route needs different sensitivity than a busy API.
+type RouteAnomalyConfig struct {
+	Window     string  `yaml:"window,omitempty"`      // baseline lookback, e.g. "6h"; a multiple of analytics.bucket_interval
+	ZScore     float64 `yaml:"z_score,omitempty"`     // threshold for every metric of the route
+	MinSamples int     `yaml:"min_samples,omitempty"` // buckets of history needed before anomalies are flagged
+}
+
+// ForwardAuthConfig points a route at an external auth service. The
+// gateway sends it each request's method and headers (plus X-Forwarded-Method,
+// -Uri, -Host, -Proto, -For); a 2xx allows the request, anything else is
+// returned to the client unchanged.
+type ForwardAuthConfig struct {
+	URL             string   `yaml:"url"`
+	ResponseHeaders []string `yaml:"response_headers,omitempty"` // copied upstream on success, e.g. ["X-User-Id"]
+	Timeout         string   `yaml:"timeout,omitempty"`          // default 5s; an unreachable service fails closed with 503
+}
+
+// TrustedCallersConfig lists the callers allowed on an internal-only route.
+type TrustedCallersConfig struct {
+	CIDRs      []string `yaml:"cidrs,omitempty"`      // e.g. ["10.0.0.0/8"]
+	Identities []string `yaml:"identities,omitempty"` // client cert CN / DNS SAN / URI SAN
 }
 
 // GetBackends returns the list of backend URLs for this route.
@@ -29,39 +129,276 @@ func (r Route) GetBackends() []string {
 	return nil
 }
 
+// BackendConfig holds optional per-backend settings, matched to routes by URL.
+type BackendConfig struct {
+	URL         string             `yaml:"url"`
+	MaxRate     float64            `yaml:"max_rate,omitempty"` // requests per minute the backend can comfortably serve (0 = unknown)
+	Capacity    float64            `yaml:"capacity,omitempty"` // relative instance size, multiplies the learned weight (default 1.0)
+	HealthCheck BackendProbeConfig `yaml:"health_check,omitempty"`
+
+	// Bulkhead: cap on concurrent proxied requests to this backend across
+	// all routes (0 = unlimited). Excess requests wait up to QueueTimeout
+	// for a slot (e.g. "100ms", default no wait) before a 503.
+	MaxConcurrent int    `yaml:"max_concurrent,omitempty"`
+	QueueTimeout  string `yaml:"queue_timeout,omitempty"`
+}
+
+// BackendProbeConfig describes how to probe a single backend's health.
+// Zero values fall back to GET / expecting 200.
+type BackendProbeConfig struct {
+	Type           string            `yaml:"type,omitempty"`            // "http" (default) or "tcp" (connect only)
+	Path           string            `yaml:"path,omitempty"`            // e.g. "/healthz"
+	Method         string            `yaml:"method,omitempty"`          // e.g. "HEAD"
+	ExpectedStatus []int             `yaml:"expected_status,omitempty"` // e.g. [200, 204]
+	ExpectBody     string            `yaml:"expect_body,omitempty"`     // substring the body must contain
+	Headers        map[string]string `yaml:"headers,omitempty"`
+}
+
 // ServerConfig holds the gateway server settings.
 type ServerConfig struct {
 	Port int `yaml:"port"`
+
+	// Optional TLS. When ClientCAFile is set, client certificates signed by
+	// that CA are verified (but not required), enabling mTLS identities.
+	TLSCertFile  string `yaml:"tls_cert_file,omitempty"`
+	TLSKeyFile   string `yaml:"tls_key_file,omitempty"`
+	ClientCAFile string `yaml:"client_ca_file,omitempty"`
+
+	// ErrorDocsURL is linked from gateway error bodies as docs_url (base#code).
+	ErrorDocsURL string `yaml:"error_docs_url,omitempty"`
 }
 
 // RateLimitConfig holds rate limiter settings.
 type RateLimitConfig struct {
 	MaxTokens  float64 `yaml:"max_tokens"`
 	RefillRate float64 `yaml:"refill_rate"`
+	Algorithm  string  `yaml:"algorithm"`   // "token_bucket" (default), "sliding_window", or "gcra"
+	Key        string  `yaml:"key"`         // "ip" (default), "api_key", "jwt_sub", or "header"
+	KeyHeader  string  `yaml:"key_header"`  // header to key on when key is "header"
+	Headers    string  `yaml:"headers"`     // RateLimit response fields: "off" (default), "separate", or "combined"
+	IdleTTL    string  `yaml:"idle_ttl"`    // drop client buckets idle this long, e.g. "10m" (default)
+	MaxBuckets int     `yaml:"max_buckets"` // cap on tracked clients per limiter (default 100000)
+
+	// Allowlist exempts callers from rate limiting (global block only)
+	Allowlist RateLimitAllowlist `yaml:"allowlist,omitempty"`
+
+	// MethodCosts sets token costs per HTTP method for routes without their
+	// own cost settings (global block only), e.g. {"POST": 2}
+	MethodCosts map[string]float64 `yaml:"method_costs,omitempty"`
+
+	// Anonymous is the per-IP limit for requests without credentials on
+	// routes with `auth: anonymous` (global block only). Defaults to a
+	// tenth of the global burst and refill rate.
+	Anonymous *RateLimitConfig `yaml:"anonymous,omitempty"`
+}
+
+// AnonymousRateLimit returns the limiter config for anonymous callers,
+// filled in from the global ratelimit block and always keyed by IP.
+func (c *Config) AnonymousRateLimit() RateLimitConfig {
+	var rl RateLimitConfig
+	if c.RateLimit.Anonymous != nil {
+		rl = *c.RateLimit.Anonymous
+	}
+	if rl.MaxTokens <= 0 {
+		rl.MaxTokens = max(c.RateLimit.MaxTokens/10, 1)
+	}
+	if rl.RefillRate <= 0 {
+		rl.RefillRate = c.RateLimit.RefillRate / 10
+	}
+	rl = c.withRateLimitDefaults(rl)
+	rl.Key, rl.KeyHeader = "ip", ""
+	return rl
+}
+
+// RateLimitAllowlist lists callers that are never rate limited.
+type RateLimitAllowlist struct {
+	CIDRs   []string `yaml:"cidrs"`    // e.g. ["10.0.0.0/8"] for internal services and probes
+	APIKeys []string `yaml:"api_keys"` // X-API-Key values exempt from limits
 }
 
 // AuthConfig holds authentication settings.
 type AuthConfig struct {
-	APIKeys   []string `yaml:"api_keys"`
-	JWTSecret string   `yaml:"jwt_secret"`
+	APIKeys   []string   `yaml:"api_keys"`
+	Keys      []APIKey   `yaml:"keys,omitempty"` // API keys with scopes/roles, hashes, expiry
+	JWTSecret string     `yaml:"jwt_secret"`
+	JWT       JWTConfig  `yaml:"jwt,omitempty"`
+	OIDC      OIDCConfig `yaml:"oidc,omitempty"`
+}
+
+// APIKey is an API key with the scopes and roles it grants, for routes
+// with required_scopes / required_roles. Give either the key itself or its
+// prefix and salted hash, as printed by `go run ./cmd/keygen`.
+type APIKey struct {
+	Key    string   `yaml:"key,omitempty"`
+	Prefix string   `yaml:"prefix,omitempty"` // first characters of the key, shown in audit logs
+	Hash   string   `yaml:"hash,omitempty"`   // "sha256$<salt>$<hash>"
+	Scopes []string `yaml:"scopes"`
+	Roles  []string `yaml:"roles"`
+	Tier   string   `yaml:"tier,omitempty"` // plan from the top-level tiers block
+
+	// Expires retires the key at this RFC 3339 time. Set it on the old key
+	// when rotating, so it keeps working alongside its replacement until
+	// clients have switched over.
+	Expires string `yaml:"expires,omitempty"`
+}
+
+// OIDCConfig enables browser login through an OpenID Connect provider for
+// routes with `oidc: true`.
+type OIDCConfig struct {
+	Issuer       string   `yaml:"issuer"` // e.g. "https://accounts.google.com"
+	ClientID     string   `yaml:"client_id"`
+	ClientSecret string   `yaml:"client_secret"`
+	RedirectURL  string   `yaml:"redirect_url"`  // e.g. "https://gw.example.com/oauth2/callback"
+	Scopes       []string `yaml:"scopes"`        // default ["openid", "profile", "email"]
+	CookieSecret string   `yaml:"cookie_secret"` // signs session cookies, at least 32 characters
+	SessionTTL   string   `yaml:"session_ttl"`   // e.g. "8h" (default)
+}
+
+// JWTConfig holds the claims and algorithms Bearer tokens must satisfy
+// beyond a valid signature.
+type JWTConfig struct {
+	Issuer     string   `yaml:"issuer"`      // required iss claim
+	Audience   string   `yaml:"audience"`    // required aud claim entry
+	Leeway     string   `yaml:"leeway"`      // clock skew tolerated on exp/nbf, e.g. "30s"
+	Algorithms []string `yaml:"algorithms"`  // allowed algorithms (default HS* with a JWT secret, plus RS*/PS*/ES* with jwks_url)
+	RequireExp bool     `yaml:"require_exp"` // reject tokens without exp
+
+	// JWKSURL enables RS*/PS*/ES* tokens, verified against the provider's
+	// published keys (e.g. https://tenant.auth0.com/.well-known/jwks.json)
+	JWKSURL     string `yaml:"jwks_url"`
+	JWKSRefresh string `yaml:"jwks_refresh"` // how often keys are refetched, e.g. "1h" (default)
 }
 
 // CircuitBreakerConfig holds circuit breaker settings.
 type CircuitBreakerConfig struct {
-	Threshold int `yaml:"threshold"`
-	Timeout   int `yaml:"timeout"` // seconds
+	Enabled   *bool  `yaml:"enabled,omitempty"` // default true
+	Threshold int    `yaml:"threshold"`         // failures within the window before tripping
+	Timeout   int    `yaml:"timeout"`           // seconds
+	Window    string `yaml:"window,omitempty"`  // rolling window outcomes are counted over, e.g. "1m" (default)
+
+	// SuccessThreshold is how many probes in a row must succeed while
+	// half-open before the breaker closes; HalfOpenProbes caps probes in
+	// flight at once. Both default to 1.
+	SuccessThreshold int `yaml:"success_threshold,omitempty"`
+	HalfOpenProbes   int `yaml:"half_open_probes,omitempty"`
+}
+
+// RetryBudgetConfig bounds retries per route to a fraction of its recent
+// requests. The fraction comes from the route's protection profile
+// (conservative 0, balanced 10%, aggressive 20%).
+type RetryBudgetConfig struct {
+	Window     string `yaml:"window,omitempty"`      // how far back requests and retries count, e.g. "10s" (default)
+	MinRetries int    `yaml:"min_retries,omitempty"` // retries always allowed per window, so quiet routes can retry
+}
+
+// IsEnabled reports whether the breaker is on (the default).
+func (c CircuitBreakerConfig) IsEnabled() bool {
+	return c.Enabled == nil || *c.Enabled
+}
+
+// RouteCircuitBreaker returns the breaker config for a route, filled in
+// from the global circuitbreaker block. own is true if the route sets any
+// breaker setting and so gets a breaker of its own.
+func (c *Config) RouteCircuitBreaker(route Route) (cb CircuitBreakerConfig, own bool) {
+	if route.CircuitBreaker == nil {
+		return c.CircuitBreaker, false
+	}
+	cb = *route.CircuitBreaker
+	own = cb.Threshold > 0 || cb.Timeout > 0 || cb.Window != "" || cb.SuccessThreshold > 0 || cb.HalfOpenProbes > 0
+	if cb.Threshold <= 0 {
+		cb.Threshold = c.CircuitBreaker.Threshold
+	}
+	if cb.Timeout <= 0 {
+		cb.Timeout = c.CircuitBreaker.Timeout
+	}
+	if cb.Enabled == nil {
+		cb.Enabled = c.CircuitBreaker.Enabled
+	}
+	if cb.Window == "" {
+		cb.Window = c.CircuitBreaker.Window
+	}
+	if cb.SuccessThreshold <= 0 {
+		cb.SuccessThreshold = c.CircuitBreaker.SuccessThreshold
+	}
+	if cb.HalfOpenProbes <= 0 {
+		cb.HalfOpenProbes = c.CircuitBreaker.HalfOpenProbes
+	}
+	return cb, own
 }
 
 // HealthCheckConfig holds health check settings.
 type HealthCheckConfig struct {
-	Interval int `yaml:"interval"` // seconds between checks
+	Interval           int `yaml:"interval"`            // seconds between checks
+	UnhealthyThreshold int `yaml:"unhealthy_threshold"` // consecutive failures before marking down (default 1)
+	HealthyThreshold   int `yaml:"healthy_threshold"`   // consecutive successes before marking up (default 1)
+	MaxBackoff         int `yaml:"max_backoff"`         // seconds; back off probes of down backends up to this (0 = disabled)
+	Concurrency        int `yaml:"concurrency"`         // max backends probed in parallel (default 10)
+	CycleTimeout       int `yaml:"cycle_timeout"`       // seconds; deadline for one full check cycle (0 = none)
+	FlapThreshold      int `yaml:"flap_threshold"`      // state changes within flap_window that flag a backend as flapping (default 4)
+	FlapWindow         int `yaml:"flap_window"`         // minutes (default 10)
+	MinHealthy         int `yaml:"min_healthy"`         // healthy backends required for /readyz (default 1)
+	TimelineRetention  int `yaml:"timeline_retention"`  // hours of health transitions to keep (default 168)
 }
 
 // DashboardConfig holds dashboard settings
 type DashboardConfig struct {
-	Enabled     bool `yaml:"enabled"`
-	LogCapacity int  `yaml:"log_capacity"`
-	SSEBuffer   int  `yaml:"sse_buffer"`
+	Enabled         bool             `yaml:"enabled"`
+	LogCapacity     int              `yaml:"log_capacity"`               // request logs kept in memory (default 1000)
+	SSEBuffer       int              `yaml:"sse_buffer"`                 // events queued for broadcast and per client (default 256)
+	SSEHeartbeat    string           `yaml:"sse_heartbeat,omitempty"`    // keep-alive interval on idle streams, e.g. "15s" (default)
+	MetricsInterval string           `yaml:"metrics_interval,omitempty"` // how often metrics events are sent, e.g. "5s" (default)
+	MetricsDelta    float64          `yaml:"metrics_delta,omitempty"`    // only send metrics that moved by this fraction, e.g. 0.05; 0 sends every interval
+	Federation      FederationConfig `yaml:"federation,omitempty"`
+
+	// Auth requires a login for the dashboard API and event stream. Without
+	// it anyone who can reach the gateway can start and stop processes.
+	Auth *DashboardAuthConfig `yaml:"auth,omitempty"`
+
+	// LogFile keeps request logs on disk so they survive restarts.
+	LogFile *DashboardLogFileConfig `yaml:"log_file,omitempty"`
+}
+
+// DashboardLogFileConfig persists the dashboard's request logs to an
+// append-only JSON Lines file, compacted to half its size when it
+// outgrows max_size_mb.
+type DashboardLogFileConfig struct {
+	Path      string `yaml:"path"`
+	MaxSizeMB int    `yaml:"max_size_mb"` // default 64
+}
+
+// DashboardAuthConfig lists who may use the dashboard. Passwords and tokens
+// are given as salted hashes, as printed by `go run ./cmd/keygen -key <secret>`.
+type DashboardAuthConfig struct {
+	Users        []DashboardUserConfig `yaml:"users,omitempty"`
+	Tokens       []string              `yaml:"tokens,omitempty"`        // bearer token hashes, for scripts and federation peers
+	ViewerTokens []string              `yaml:"viewer_tokens,omitempty"` // same, but read-only
+	OIDC         bool                  `yaml:"oidc,omitempty"`          // also accept logins through auth.oidc
+	OIDCRole     string                `yaml:"oidc_role,omitempty"`     // "viewer" (default) or "admin"
+	CookieSecret string                `yaml:"cookie_secret,omitempty"` // at least 32 characters; random per restart if unset
+	SessionTTL   string                `yaml:"session_ttl,omitempty"`   // e.g. "8h" (default)
+}
+
+// DashboardUserConfig is a dashboard login. Viewers can see processes,
+// logs, metrics, and analytics but get 403 on anything that changes them.
+type DashboardUserConfig struct {
+	Username     string `yaml:"username"`
+	PasswordHash string `yaml:"password_hash"`  // bcrypt, "$2a$..."
+	Role         string `yaml:"role,omitempty"` // "admin" (default) or "viewer"
+}
+
+// FederationConfig lists peer gateways whose dashboard data is aggregated
+// into this gateway's /dashboard/api/federation/ view.
+type FederationConfig struct {
+	Instance string       `yaml:"instance"` // this gateway's name in combined views (default "local")
+	Peers    []PeerConfig `yaml:"peers"`
+	Timeout  string       `yaml:"timeout"` // per-peer request timeout, e.g. "3s"
+}
+
+// PeerConfig is one peer gateway.
+type PeerConfig struct {
+	Name  string `yaml:"name"`
+	URL   string `yaml:"url"`             // base URL, e.g. "http://gw-2:8080"
+	Token string `yaml:"token,omitempty"` // bearer token for the peer's dashboard auth
 }
 
 // ProcessConfig holds managed process settings
@@ -71,44 +408,289 @@ type ProcessConfig struct {
 	Args      []string `yaml:"args"`
 	Port      int      `yaml:"port"`
 	AutoStart bool     `yaml:"auto_start"`
+
+	// Env is added to the gateway's environment for the process. Values may
+	// use $VAR or ${VAR} for the gateway's variables, plus $PORT and
+	// $PROCESS_ID for the process's own.
+	Env map[string]string `yaml:"env,omitempty"`
+	Dir string            `yaml:"dir,omitempty"` // working directory (default: the gateway's)
+
+	// A started process gets no traffic until ready_url answers with a 2xx,
+	// or without one until its port accepts connections. It is killed as
+	// crashed if that takes longer than ready_timeout.
+	ReadyURL     string `yaml:"ready_url,omitempty"`
+	ReadyTimeout string `yaml:"ready_timeout,omitempty"` // default "30s"
+
+	// Restart starts the process again when it exits on its own: "always",
+	// "on-failure" (non-zero exit), or "never" (default). Waits double from
+	// restart_backoff up to restart_max_backoff, and after max_restarts
+	// attempts in a row the process is left down.
+	Restart           string `yaml:"restart,omitempty"`
+	MaxRestarts       int    `yaml:"max_restarts,omitempty"`        // default 5
+	RestartBackoff    string `yaml:"restart_backoff,omitempty"`     // default "1s"
+	RestartMaxBackoff string `yaml:"restart_max_backoff,omitempty"` // default "1m"
 }
 
 // AnalyticsConfig holds traffic analytics settings.
 type AnalyticsConfig struct {
 	Enabled          bool   `yaml:"enabled"`
-	BucketInterval   string `yaml:"bucket_interval"`   // e.g., "1m"
-	Retention        string `yaml:"retention"`          // e.g., "48h"
-	AnalyzerInterval string `yaml:"analyzer_interval"`  // e.g., "5m"
+	BucketInterval   string `yaml:"bucket_interval"`   // e.g., "1m"; width of traffic buckets and sparkline points
+	Retention        string `yaml:"retention"`         // e.g., "48h"; must be a multiple of bucket_interval
+	AnalyzerInterval string `yaml:"analyzer_interval"` // e.g., "5m"
+	AnalyzerWindow   string `yaml:"analyzer_window"`   // e.g., "1h"; baseline lookback, must be a multiple of bucket_interval
+	UnmatchedRoutes  string `yaml:"unmatched_routes"`  // "group" (default), "first_segment", or "raw"
+	MaxRoutes        int    `yaml:"max_routes"`        // cap on distinct route series (default 1000)
+
+	Sampling *SamplingConfig `yaml:"sampling,omitempty"` // record a fraction of requests on very busy gateways
+
+	// Downsample rolls old buckets up into wider ones to keep long
+	// retention cheap, e.g. 5m buckets after 6h and 1h buckets after 24h.
+	// Tiers are ordered by age, each interval a multiple of the last.
+	Downsample []DownsampleConfig `yaml:"downsample,omitempty"`
+
+	// Seasonality compares each route against the same hour of previous
+	// days instead of only the last analyzer_window: "hour", or
+	// "hour_weekday" to also keep weekdays and weekends apart. Needs a
+	// retention (and usually a persistent store) spanning a few days;
+	// SeasonalDays bounds the lookback (default 7).
+	Seasonality  string `yaml:"seasonality,omitempty"`
+	SeasonalDays int    `yaml:"seasonal_days,omitempty"`
+
+	// Thresholds tunes anomaly detection per metric: request_rate,
+	// error_rate, or latency.
+	Thresholds map[string]AnomalyThresholdConfig `yaml:"thresholds,omitempty"`
+
+	// Store selects the traffic store driver: "memory" (default, lost on
+	// restart), "sqlite", "postgres", or "clickhouse". StoreDSN is the
+	// driver's data source (a file path for sqlite, default
+	// "data/analytics.db"). Instance names this gateway's rows in a
+	// database shared by a fleet (default the hostname).
+	Store    string `yaml:"store,omitempty"`
+	StoreDSN string `yaml:"store_dsn,omitempty"`
+	Instance string `yaml:"instance,omitempty"`
+
+	ColdStart *ColdStartConfig `yaml:"cold_start,omitempty"` // conservative limits for routes without history
+
+	Webhooks []WebhookConfig `yaml:"webhooks,omitempty"` // endpoints notified of each detected anomaly
+
+	OTLP *OTLPConfig `yaml:"otlp,omitempty"` // push metrics and anomalies to an OpenTelemetry collector
+}
+
+// OTLPConfig configures the OpenTelemetry exporter, which pushes route and
+// backend metrics and anomaly events over OTLP/HTTP (JSON).
+type OTLPConfig struct {
+	Endpoint    string            `yaml:"endpoint"` // collector base URL, e.g. "http://otel-collector:4318"
+	Headers     map[string]string `yaml:"headers,omitempty"`
+	Interval    string            `yaml:"interval,omitempty"`     // push interval (default bucket_interval)
+	Timeout     string            `yaml:"timeout,omitempty"`      // per-push timeout (default "10s")
+	ServiceName string            `yaml:"service_name,omitempty"` // service.name resource attribute (default "gateway")
+	Prometheus  bool              `yaml:"prometheus,omitempty"`   // also push the gateway's Prometheus metrics
+}
+
+// WebhookConfig is an endpoint called whenever the analyzer detects an
+// anomaly.
+type WebhookConfig struct {
+	Name     string            `yaml:"name,omitempty"` // used in logs (default the URL)
+	URL      string            `yaml:"url"`
+	Template string            `yaml:"template,omitempty"` // text/template for the JSON payload (default the anomaly as JSON)
+	Secret   string            `yaml:"secret,omitempty"`   // HMAC-SHA256 signs deliveries in X-Gateway-Signature
+	Headers  map[string]string `yaml:"headers,omitempty"`
+	Retries  int               `yaml:"retries,omitempty"` // retries on network errors, 429s, and 5xx (default 3, -1 disables)
+	Timeout  string            `yaml:"timeout,omitempty"` // per-attempt timeout, e.g. "5s"
+}
+
+// SamplingConfig bounds traffic recording overhead. Requests kept are
+// weighted to stand for the ones skipped, so counts and rates stay
+// unbiased; errors and slow requests are always kept.
+type SamplingConfig struct {
+	Rate          float64 `yaml:"rate"`                     // fraction of requests to record, e.g. 0.1
+	SlowThreshold string  `yaml:"slow_threshold,omitempty"` // requests at least this slow are always recorded, e.g. "500ms"
+}
+
+// DownsampleConfig is one downsampling tier.
+type DownsampleConfig struct {
+	After    string `yaml:"after"`    // age at which buckets are rolled up, e.g. "6h"
+	Interval string `yaml:"interval"` // width of the rolled-up buckets, e.g. "5m"
+}
+
+// AnomalyThresholdConfig sets when a metric is flagged as anomalous.
+type AnomalyThresholdConfig struct {
+	ZScore float64 `yaml:"z_score,omitempty"` // default 3.0
+	// Direction is "above" (spikes), "below" (drops), or "both". Defaults
+	// to "both" for request_rate and latency and "above" for error_rate.
+	Direction string `yaml:"direction,omitempty"`
+}
+
+// ColdStartConfig holds the policy applied to routes and backends until they
+// have enough traffic history for learned limits and thresholds.
+type ColdStartConfig struct {
+	MinSamples       int     `yaml:"min_samples"`        // buckets of history needed (default 10)
+	RateLimit        float64 `yaml:"rate_limit"`         // per-client req/min on cold routes (default 60)
+	BreakerErrorRate float64 `yaml:"breaker_error_rate"` // breaker trip error rate for cold backends (default 0.2)
 }
 
 // AdaptiveRateLimitConfig holds adaptive rate limiter settings.
 type AdaptiveRateLimitConfig struct {
 	Enabled        bool    `yaml:"enabled"`
 	Multiplier     float64 `yaml:"multiplier"`      // allow up to N× normal traffic
-	MinLimit       float64 `yaml:"min_limit"`        // never go below this
-	MaxLimit       float64 `yaml:"max_limit"`        // never go above this
-	LearningPeriod string  `yaml:"learning_period"`  // e.g., "1h"
+	MinLimit       float64 `yaml:"min_limit"`       // never go below this
+	MaxLimit       float64 `yaml:"max_limit"`       // never go above this
+	LearningPeriod string  `yaml:"learning_period"` // e.g., "1h"
+	Baseline       string  `yaml:"baseline"`        // "mean" (default), "p95", or "peak"
+	HardMultiplier float64 `yaml:"hard_multiplier"` // > 1 enables soft/hard mode: hard cap = adaptive limit × this
+	Shadow         bool    `yaml:"shadow"`          // count would-be rejections without enforcing (static limits still apply)
+}
+
+// DedupConfig holds duplicate request tracking settings.
+type DedupConfig struct {
+	Enabled          bool     `yaml:"enabled"`
+	Window           string   `yaml:"window"`            // how long signatures are remembered, e.g. "5m"
+	SignatureHeaders []string `yaml:"signature_headers"` // default ["X-Signature", "X-Hub-Signature-256"]
+	FlagRate         float64  `yaml:"flag_rate"`         // duplicate rate that flags a client (default 0.2)
+}
+
+// QuotaConfig holds long-horizon request quotas per API key. Zero limits
+// mean unlimited.
+type QuotaConfig struct {
+	Enabled bool                   `yaml:"enabled"`
+	Daily   int64                  `yaml:"daily"`   // requests per key per UTC day
+	Monthly int64                  `yaml:"monthly"` // requests per key per UTC month
+	Keys    map[string]QuotaLimits `yaml:"keys"`    // per-key overrides, keyed by API key
+}
+
+// TierConfig is a commercial plan API keys can belong to (see APIKey.Tier).
+// Its rate limit replaces the global one for the tier's keys, with a bucket
+// per key; its quota replaces the default quotas (needs quotas.enabled).
+// Per-route rate limits and per-key quotas still take precedence.
+type TierConfig struct {
+	RateLimit *RateLimitConfig `yaml:"ratelimit,omitempty"`
+	Quota     QuotaLimits      `yaml:"quota,omitempty"`
+}
+
+// QuotaLimits overrides the default quotas for one API key.
+type QuotaLimits struct {
+	Daily   int64 `yaml:"daily"`
+	Monthly int64 `yaml:"monthly"`
 }
 
 // WeightedLBConfig holds weighted load balancer settings.
 type WeightedLBConfig struct {
-	Enabled            bool   `yaml:"enabled"`
-	RebalanceInterval  string `yaml:"rebalance_interval"` // e.g., "5m"
+	Enabled           bool   `yaml:"enabled"`
+	RebalanceInterval string `yaml:"rebalance_interval"` // e.g., "5m"
+}
+
+// StateConfig holds settings for persisting runtime state across restarts.
+type StateConfig struct {
+	Enabled      bool   `yaml:"enabled"`
+	Dir          string `yaml:"dir"`           // directory for state snapshots (default "data/state")
+	SyncInterval string `yaml:"sync_interval"` // e.g., "30s"
+}
+
+// GeoIPConfig points at MaxMind-format databases used to tag request
+// logs and analytics with the client's country and ASN. Either may be
+// left out.
+type GeoIPConfig struct {
+	CountryDB string `yaml:"country_db,omitempty"` // e.g. "data/GeoLite2-Country.mmdb" (a City database also works)
+	ASNDB     string `yaml:"asn_db,omitempty"`     // e.g. "data/GeoLite2-ASN.mmdb"
+}
+
+// AlertsConfig holds threshold alert rules evaluated against analytics
+// traffic. Rule changes are sent to analytics.webhooks. Needs analytics.
+type AlertsConfig struct {
+	Interval string            `yaml:"interval,omitempty"` // how often rules are evaluated, e.g. "1m"
+	Rules    []AlertRuleConfig `yaml:"rules"`
+}
+
+// AlertRuleConfig is one alert rule, e.g. condition "error_rate > 5%" for
+// "5m" on route "/api/v1".
+type AlertRuleConfig struct {
+	Name      string `yaml:"name"`
+	Route     string `yaml:"route,omitempty"`   // watch a route, or
+	Backend   string `yaml:"backend,omitempty"` // watch a backend
+	Condition string `yaml:"condition"`         // "<metric> <op> <value>", e.g. "requests == 0"
+	For       string `yaml:"for,omitempty"`     // how long the condition must hold, e.g. "10m"
 }
 
 // Config is the top-level configuration for the gateway.
 type Config struct {
 	Server            ServerConfig            `yaml:"server"`
 	Routes            []Route                 `yaml:"routes"`
+	Backends          []BackendConfig         `yaml:"backends,omitempty"`
 	RateLimit         RateLimitConfig         `yaml:"ratelimit"`
 	Auth              AuthConfig              `yaml:"auth"`
 	CircuitBreaker    CircuitBreakerConfig    `yaml:"circuitbreaker"`
+	RetryBudget       RetryBudgetConfig       `yaml:"retry_budget,omitempty"`
 	HealthCheck       HealthCheckConfig       `yaml:"healthcheck"`
 	Dashboard         DashboardConfig         `yaml:"dashboard,omitempty"`
 	Processes         []ProcessConfig         `yaml:"processes,omitempty"`
 	Analytics         AnalyticsConfig         `yaml:"analytics,omitempty"`
+	Alerts            AlertsConfig            `yaml:"alerts,omitempty"`
 	AdaptiveRateLimit AdaptiveRateLimitConfig `yaml:"adaptive_rate_limit,omitempty"`
 	WeightedLB        WeightedLBConfig        `yaml:"weighted_lb,omitempty"`
+	Dedup             DedupConfig             `yaml:"dedup,omitempty"`
+	Quotas            QuotaConfig             `yaml:"quotas,omitempty"`
+	Tiers             map[string]TierConfig   `yaml:"tiers,omitempty"`
+	State             StateConfig             `yaml:"state,omitempty"`
+	GeoIP             GeoIPConfig             `yaml:"geoip,omitempty"`
+}
+
+// Backend returns the per-backend settings for a URL.
+// Backends without an entry get a zero-value BackendConfig with only URL set.
+func (c *Config) Backend(url string) BackendConfig {
+	for _, b := range c.Backends {
+		if b.URL == url {
+			return b
+		}
+	}
+	return BackendConfig{URL: url}
+}
+
+// RouteRateLimit returns a route's rate limit settings with unset fields
+// filled in from the global ratelimit block. ok is false if the route has
+// no ratelimit block and should share the global limiter.
+func (c *Config) RouteRateLimit(route Route) (rl RateLimitConfig, ok bool) {
+	if route.RateLimit == nil {
+		return c.RateLimit, false
+	}
+	return c.withRateLimitDefaults(*route.RateLimit), true
+}
+
+// TierRateLimit returns the limiter config for an API key tier, filled in
+// from the global ratelimit block like route limits. Tier buckets are
+// always per API key. ok is false if the tier has no rate limit.
+func (c *Config) TierRateLimit(tier TierConfig) (rl RateLimitConfig, ok bool) {
+	if tier.RateLimit == nil {
+		return c.RateLimit, false
+	}
+	rl = c.withRateLimitDefaults(*tier.RateLimit)
+	rl.Key, rl.KeyHeader = "api_key", ""
+	return rl, true
+}
+
+// withRateLimitDefaults fills unset fields of rl from the global ratelimit block.
+func (c *Config) withRateLimitDefaults(rl RateLimitConfig) RateLimitConfig {
+	if rl.MaxTokens <= 0 {
+		rl.MaxTokens = c.RateLimit.MaxTokens
+	}
+	if rl.RefillRate <= 0 {
+		rl.RefillRate = c.RateLimit.RefillRate
+	}
+	if rl.Algorithm == "" {
+		rl.Algorithm = c.RateLimit.Algorithm
+	}
+	if rl.IdleTTL == "" {
+		rl.IdleTTL = c.RateLimit.IdleTTL
+	}
+	if rl.MaxBuckets <= 0 {
+		rl.MaxBuckets = c.RateLimit.MaxBuckets
+	}
+	if rl.Headers == "" {
+		rl.Headers = c.RateLimit.Headers
+	}
+	if rl.Key == "" {
+		rl.Key, rl.KeyHeader = c.RateLimit.Key, c.RateLimit.KeyHeader
+	}
+	return rl
 }
 
 // LoadConfig reads a YAML config file and parses it into a Config struct.
@@ -123,5 +705,178 @@ func LoadConfig(filename string) (*Config, error) {
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
 
+	if err := cfg.Analytics.validate(cfg.Routes); err != nil {
+		return nil, fmt.Errorf("invalid analytics config: %w", err)
+	}
+	if err := cfg.Dashboard.validate(); err != nil {
+		return nil, fmt.Errorf("invalid dashboard config: %w", err)
+	}
+	if err := cfg.validateRateLimits(); err != nil {
+		return nil, fmt.Errorf("invalid ratelimit config: %w", err)
+	}
+
 	return &cfg, nil
 }
+
+// Limits on dashboard buffers, so a typo can't exhaust memory.
+const (
+	maxLogCapacity = 1_000_000
+	maxSSEBuffer   = 65536
+)
+
+// validate checks the dashboard's buffer sizes. Zero means the default.
+func (d DashboardConfig) validate() error {
+	if d.LogCapacity < 0 || d.LogCapacity > maxLogCapacity {
+		return fmt.Errorf("log_capacity %d must be between 0 (default) and %d", d.LogCapacity, maxLogCapacity)
+	}
+	if d.SSEBuffer < 0 || d.SSEBuffer > maxSSEBuffer {
+		return fmt.Errorf("sse_buffer %d must be between 0 (default) and %d", d.SSEBuffer, maxSSEBuffer)
+	}
+	return nil
+}
+
+// validateRateLimits checks every limiter the gateway builds: the global
+// one, the anonymous one, and those of routes and tiers, each with unset
+// fields filled in from the global block, and every request cost.
+func (c *Config) validateRateLimits() error {
+	if err := c.RateLimit.validate(); err != nil {
+		return err
+	}
+	if err := validateCosts(0, c.RateLimit.MethodCosts); err != nil {
+		return err
+	}
+	if err := c.AnonymousRateLimit().validate(); err != nil {
+		return fmt.Errorf("anonymous: %w", err)
+	}
+	for _, route := range c.Routes {
+		if rl, ok := c.RouteRateLimit(route); ok {
+			if err := rl.validate(); err != nil {
+				return fmt.Errorf("route %s: %w", route.Path, err)
+			}
+		}
+		if err := validateCosts(route.Cost, route.MethodCosts); err != nil {
+			return fmt.Errorf("route %s: %w", route.Path, err)
+		}
+	}
+	for name, tier := range c.Tiers {
+		if rl, ok := c.TierRateLimit(tier); ok {
+			if err := rl.validate(); err != nil {
+				return fmt.Errorf("tier %s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// validateCosts checks that requests take tokens rather than handing them
+// out: a negative cost would refill the bucket, and a zero method cost
+// would make the request free. cost is 0 when unset, meaning 1 token.
+func validateCosts(cost float64, methods map[string]float64) error {
+	if cost < 0 {
+		return fmt.Errorf("cost %v must be > 0", cost)
+	}
+	for method, n := range methods {
+		if n <= 0 {
+			return fmt.Errorf("method_costs.%s %v must be > 0", method, n)
+		}
+	}
+	return nil
+}
+
+// validate checks that the limits suit the algorithm. Sliding windows and
+// GCRA derive their window or emission interval from refill_rate, so unlike
+// a token bucket they can't run without refill.
+func (rl RateLimitConfig) validate() error {
+	switch rl.Algorithm {
+	case "sliding_window", "gcra":
+		if rl.RefillRate <= 0 {
+			return fmt.Errorf("algorithm %s needs refill_rate > 0, got %v", rl.Algorithm, rl.RefillRate)
+		}
+		if rl.MaxTokens < 1 {
+			return fmt.Errorf("algorithm %s needs max_tokens >= 1, got %v", rl.Algorithm, rl.MaxTokens)
+		}
+	}
+	return nil
+}
+
+// validate checks that analytics windows, including each route's anomaly
+// window, cover a whole number of buckets. Empty values fall back to defaults and are not checked.
+func (a AnalyticsConfig) validate(routes []Route) error {
+	bucket := time.Minute
+	if a.BucketInterval != "" {
+		d, err := time.ParseDuration(a.BucketInterval)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("bucket_interval %q is not a positive duration", a.BucketInterval)
+		}
+		bucket = d
+	}
+
+	switch a.Seasonality {
+	case "", "hour", "hour_weekday":
+	default:
+		return fmt.Errorf("seasonality %q must be \"hour\" or \"hour_weekday\"", a.Seasonality)
+	}
+	for metric, th := range a.Thresholds {
+		switch metric {
+		case "request_rate", "error_rate", "latency":
+		default:
+			return fmt.Errorf("thresholds: unknown metric %q", metric)
+		}
+		switch th.Direction {
+		case "", "above", "below", "both":
+		default:
+			return fmt.Errorf("thresholds.%s: direction %q must be \"above\", \"below\", or \"both\"", metric, th.Direction)
+		}
+	}
+
+	windows := map[string]string{
+		"retention":       a.Retention,
+		"analyzer_window": a.AnalyzerWindow,
+	}
+	for _, route := range routes {
+		if route.Anomaly != nil {
+			windows[route.Path+": anomaly.window"] = route.Anomaly.Window
+		}
+	}
+	for name, value := range windows {
+		if value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%s %q is not a valid duration", name, value)
+		}
+		if d%bucket != 0 {
+			return fmt.Errorf("%s %s is not a multiple of bucket_interval %s", name, d, bucket)
+		}
+	}
+
+	if s := a.Sampling; s != nil {
+		if s.Rate <= 0 || s.Rate > 1 {
+			return fmt.Errorf("sampling.rate %v must be in (0, 1]", s.Rate)
+		}
+		if s.SlowThreshold != "" {
+			if _, err := time.ParseDuration(s.SlowThreshold); err != nil {
+				return fmt.Errorf("sampling.slow_threshold %q is not a valid duration", s.SlowThreshold)
+			}
+		}
+	}
+	if a.OTLP != nil && a.OTLP.Endpoint == "" {
+		return fmt.Errorf("otlp: endpoint is required")
+	}
+
+	var prevAfter time.Duration
+	prevInterval := bucket
+	for i, tier := range a.Downsample {
+		after, err := time.ParseDuration(tier.After)
+		if err != nil || after <= prevAfter {
+			return fmt.Errorf("downsample[%d]: after %q must be a duration later than the previous tier's", i, tier.After)
+		}
+		interval, err := time.ParseDuration(tier.Interval)
+		if err != nil || interval <= prevInterval || interval%prevInterval != 0 {
+			return fmt.Errorf("downsample[%d]: interval %q must be a multiple of %s", i, tier.Interval, prevInterval)
+		}
+		prevAfter, prevInterval = after, interval
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// loadYAML writes a config file and loads it.
+func loadYAML(t *testing.T, data string) (*Config, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "gateway.yaml")
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return LoadConfig(path)
+}
+
+func TestAnalyticsWindowsMatchBuckets(t *testing.T) {
+	tests := []struct {
+		name      string
+		analytics string
+		anomaly   string
+		err       string // substring of the expected error, "" for none
+	}{
+		{"defaults", "", "", ""},
+		{"whole buckets", "bucket_interval: 5m\n  analyzer_window: 1h", "window: 6h", ""},
+		{"analyzer_window", "bucket_interval: 5m\n  analyzer_window: 62m", "", "analyzer_window 1h2m0s is not a multiple of bucket_interval 5m0s"},
+		{"route window", "bucket_interval: 5m", "window: 90m\n      z_score: 4", ""},
+		{"partial route window", "bucket_interval: 5m", "window: 7m", "/api: anomaly.window 7m0s is not a multiple of bucket_interval 5m0s"},
+		{"route window against the default bucket", "", "window: 90s", "/api: anomaly.window 1m30s is not a multiple of bucket_interval 1m0s"},
+		{"unparsable route window", "", "window: soon", `/api: anomaly.window "soon" is not a valid duration`},
+	}
+	for _, tt := range tests {
+		yaml := "routes:\n  - path: /api\n    backend: http://localhost:9001\n"
+		if tt.anomaly != "" {
+			yaml += "    anomaly:\n      " + tt.anomaly + "\n"
+		}
+		if tt.analytics != "" {
+			yaml += "analytics:\n  " + tt.analytics + "\n"
+		}
+		_, err := loadYAML(t, yaml)
+		if tt.err == "" {
+			if err != nil {
+				t.Errorf("%s: expected the config accepted, got %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: expected error %q, got %v", tt.name, tt.err, err)
+		}
+	}
+}
@@ -3,11 +3,13 @@ package dashboard
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/tanmay/gateway/internal/analytics"
 	"github.com/tanmay/gateway/internal/health"
 	"github.com/tanmay/gateway/internal/proxy"
 )
@@ -19,6 +21,21 @@ type API struct {
 	proxy *proxy.Proxy
 	store *LogStore
 	broker *Broker
+
+	// Protection profiles live in the middleware package, which imports
+	// dashboard, so they're injected as functions (see SetProfileProvider)
+	listProfiles func() interface{}
+	setProfile   func(route, profile string) error
+
+	federation *Federation            // optional multi-gateway view (see SetFederation)
+	traffic    analytics.TrafficStore // per-route history for /top (see SetTrafficStore)
+
+	rateLimitAdmin http.Handler // rate limiter admin API (see SetRateLimitAdmin)
+	breakerAdmin   http.Handler // circuit breaker admin API (see SetCircuitBreakerAdmin)
+
+	metricsDelta float64       // change needed to broadcast metrics (see SetMetricsDelta)
+	metricsStop  chan struct{} // closed by StopMetricsBroadcast
+	metricsDone  chan struct{} // closed when the broadcast loop exits
 }
 
 // NewAPI creates a new dashboard API
@@ -46,7 +63,7 @@ func (api *API) Handler() http.Handler {
 	corsHandler := func(h http.HandlerFunc) http.HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("Access-Control-Allow-Origin", "*")
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
 			w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
 
 			if r.Method == "OPTIONS" {
@@ -61,12 +78,24 @@ func (api *API) Handler() http.Handler {
 	mux.HandleFunc("/processes", corsHandler(api.handleProcesses))
 	mux.HandleFunc("/processes/", corsHandler(api.handleProcessAction))
 	mux.HandleFunc("/routes", corsHandler(api.handleRoutes))
+	mux.HandleFunc("/routes/", corsHandler(api.handleRouteBackends))
+	mux.HandleFunc("/profiles", corsHandler(api.handleProfiles))
+	mux.HandleFunc("/backends", corsHandler(api.handleBackends))
+	mux.HandleFunc("/backends/", corsHandler(api.handleBackendDetail))
+	mux.HandleFunc("/health/", corsHandler(api.handleHealthAction))
 	mux.HandleFunc("/metrics", corsHandler(api.handleMetrics))
 	mux.HandleFunc("/logs", corsHandler(api.handleLogs))
 	mux.HandleFunc("/logs/", corsHandler(api.handleLogDetail))
+	mux.HandleFunc("/logs/export", corsHandler(api.handleLogExport))
+	mux.HandleFunc("/federation/", corsHandler(api.handleFederation))
+	mux.HandleFunc("/ratelimit/", corsHandler(api.handleRateLimit))
+	mux.HandleFunc("/circuit-breakers", corsHandler(api.handleCircuitBreakers))
+	mux.HandleFunc("/top", corsHandler(api.handleTop))
 
 	// Server-Sent Events stream
 	mux.HandleFunc("/stream", api.broker.StreamHandler())
+	// The same feed over WebSocket, for proxies that buffer SSE
+	mux.HandleFunc("/ws", api.broker.WebSocketHandler())
 
 	return mux
 }
@@ -80,6 +109,12 @@ func (api *API) handleProcesses(w http.ResponseWriter, r *http.Request) {
 		type ProcessWithHealth struct {
 			ManagedProcess
 			Healthy bool `json:"healthy"`
+			Drained bool `json:"drained"`
+
+			// Probe diagnostics, so "unhealthy" can be explained in the UI
+			ProbeDurationMs     float64 `json:"probe_duration_ms"`
+			ConsecutiveFailures int     `json:"consecutive_failures"`
+			LastError           string  `json:"last_error,omitempty"`
 		}
 
 		out := make([]ProcessWithHealth, 0, len(list))
@@ -92,10 +127,17 @@ func (api *API) handleProcesses(w http.ResponseWriter, r *http.Request) {
 				isHealthy = false
 			}
 
-			out = append(out, ProcessWithHealth{
+			entry := ProcessWithHealth{
 				ManagedProcess: p,
 				Healthy:        isHealthy,
-			})
+				Drained:        api.hc.IsDrained(url),
+			}
+			if status, ok := api.hc.Status(url); ok {
+				entry.ProbeDurationMs = status.ProbeDurationMs
+				entry.ConsecutiveFailures = status.ConsecutiveFailures
+				entry.LastError = status.LastError
+			}
+			out = append(out, entry)
 		}
 
 		w.Header().Set("Content-Type", "application/json")
@@ -112,6 +154,12 @@ func (api *API) handleProcesses(w http.ResponseWriter, r *http.Request) {
 			Args    []string `json:"args"`
 			Port    int      `json:"port"`
 			Route   string   `json:"route"`
+
+			Restart     RestartMode       `json:"restart"`      // always | on-failure | never (default)
+			MaxRestarts int               `json:"max_restarts"` // restarts in a row before giving up (default 5)
+			Env         map[string]string `json:"env"`
+			Dir         string            `json:"dir"`
+			ReadyURL    string            `json:"ready_url"`
 		}
 
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -119,7 +167,13 @@ func (api *API) handleProcesses(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		if err := api.pm.Add(req.ID, req.Command, req.Args, req.Port); err != nil {
+		opts := ProcessOptions{
+			Restart:  RestartPolicy{Mode: req.Restart, MaxRestarts: req.MaxRestarts},
+			Env:      req.Env,
+			Dir:      req.Dir,
+			ReadyURL: req.ReadyURL,
+		}
+		if err := api.pm.Add(req.ID, req.Command, req.Args, req.Port, opts); err != nil {
 			http.Error(w, err.Error(), http.StatusConflict)
 			return
 		}
@@ -142,10 +196,14 @@ func (api *API) handleProcesses(w http.ResponseWriter, r *http.Request) {
 }
 
 // handleProcessAction handles POST /processes/{id}/start, /processes/{id}/stop,
-// and GET /processes/{id}/logs
+// GET /processes/{id}/logs, and DELETE /processes/{id}
 func (api *API) handleProcessAction(w http.ResponseWriter, r *http.Request) {
 	// Simple path parsing: /processes/{id}/{action}
 	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/processes/"), "/")
+	if len(parts) == 1 && r.Method == http.MethodDelete {
+		api.removeProcess(w, parts[0])
+		return
+	}
 	if len(parts) != 2 {
 		http.Error(w, "Invalid path", http.StatusBadRequest)
 		return
@@ -199,7 +257,29 @@ func (api *API) handleProcessAction(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
-// handleLogs handles GET /logs to list recent request logs with optional filters
+// removeProcess stops and forgets a managed process, and retires its backend
+// from every route and from health monitoring.
+func (api *API) removeProcess(w http.ResponseWriter, id string) {
+	p, err := api.pm.Remove(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	backendURL := fmt.Sprintf("http://localhost:%d", p.Port)
+	routes := api.proxy.RemoveBackend(backendURL)
+	api.hc.RemoveBackend(backendURL)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":      id,
+		"backend": backendURL,
+		"routes":  routes,
+	})
+}
+
+// handleLogs handles GET /logs to list recent request logs, newest first,
+// with optional filters (see parseLogFilter) that can be combined
 func (api *API) handleLogs(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -215,26 +295,25 @@ func (api *API) handleLogs(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	status := 0
-	if s := q.Get("status"); s != "" {
-		if parsed, err := strconv.Atoi(s); err == nil {
-			status = parsed
-		}
+	filter, err := parseLogFilter(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	path := q.Get("path")
-
-	// If no specific filters, use Recent() for faster retrieval
-	var logs []RequestLog
-	if status == 0 && path == "" {
-		logs = api.store.Recent(limit)
-	} else {
-		logs = api.store.Search(limit, status, path)
+	logs, more, err := api.store.Page(filter, limit, LogCursor{
+		Before: q.Get("before"),
+		After:  q.Get("after"),
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"logs": logs,
+		"logs":     logs,
+		"has_more": more,
 	})
 }
 
@@ -251,6 +330,353 @@ func (api *API) handleRoutes(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// routeErrorWindow is how far back a backend's error rate looks.
+const routeErrorWindow = 5 * time.Minute
+
+// handleRouteBackends handles GET /routes/{path}/backends: where a route's
+// traffic is going, with each backend's health, share of traffic, requests
+// in flight, and error rate over the last few minutes of logged requests.
+// {path} is the route without its leading slash, or percent-encoded whole.
+func (api *API) handleRouteBackends(w http.ResponseWriter, r *http.Request) {
+	route, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/routes/"), "/backends")
+	if !ok || route == "" {
+		http.Error(w, "Invalid path", http.StatusBadRequest)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !strings.HasPrefix(route, "/") {
+		route = "/" + route
+	}
+	backends, ok := api.proxy.RouteBackends(route)
+	if !ok {
+		http.Error(w, fmt.Sprintf("route %q not found", route), http.StatusNotFound)
+		return
+	}
+
+	type RouteBackend struct {
+		proxy.RouteBackend
+		Healthy   bool    `json:"healthy"`
+		Drained   bool    `json:"drained"`
+		Requests  int     `json:"requests"` // logged in the error rate window
+		ErrorRate float64 `json:"error_rate"`
+	}
+	traffic := api.store.BackendTraffic(time.Now().Add(-routeErrorWindow))
+	out := make([]RouteBackend, 0, len(backends))
+	for _, b := range backends {
+		entry := RouteBackend{
+			RouteBackend: b,
+			Healthy:      api.hc.IsHealthy(b.URL),
+			Drained:      api.hc.IsDrained(b.URL),
+		}
+		if t := traffic[b.URL]; t.Requests > 0 {
+			entry.Requests = t.Requests
+			entry.ErrorRate = float64(t.Errors) / float64(t.Requests)
+		}
+		out = append(out, entry)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"route":             route,
+		"backends":          out,
+		"error_rate_window": routeErrorWindow.String(),
+	})
+}
+
+// SetProfileProvider wires per-route protection profiles into the API.
+// list returns the available profiles and current assignments; set changes
+// one route's profile.
+func (api *API) SetProfileProvider(list func() interface{}, set func(route, profile string) error) {
+	api.listProfiles = list
+	api.setProfile = set
+}
+
+// SetRateLimitAdmin mounts the rate limiter admin API under /ratelimit/.
+// It lives in the middleware package, which imports dashboard, so it's
+// injected as a handler.
+func (api *API) SetRateLimitAdmin(h http.Handler) {
+	api.rateLimitAdmin = h
+}
+
+// handleRateLimit forwards /ratelimit/... to the rate limiter admin API
+func (api *API) handleRateLimit(w http.ResponseWriter, r *http.Request) {
+	if api.rateLimitAdmin == nil {
+		http.Error(w, "Rate limiter admin not configured", http.StatusNotFound)
+		return
+	}
+	http.StripPrefix("/ratelimit", api.rateLimitAdmin).ServeHTTP(w, r)
+}
+
+// SetCircuitBreakerAdmin mounts the circuit breaker admin API at
+// /circuit-breakers. Injected as a handler for the same reason as
+// SetRateLimitAdmin.
+func (api *API) SetCircuitBreakerAdmin(h http.Handler) {
+	api.breakerAdmin = h
+}
+
+// handleCircuitBreakers forwards /circuit-breakers to the breaker admin API
+func (api *API) handleCircuitBreakers(w http.ResponseWriter, r *http.Request) {
+	if api.breakerAdmin == nil {
+		http.Error(w, "Circuit breaker admin not configured", http.StatusNotFound)
+		return
+	}
+	api.breakerAdmin.ServeHTTP(w, r)
+}
+
+// handleProfiles handles GET /profiles to list protection profiles and
+// per-route assignments, and POST /profiles with {"route", "profile"} to
+// switch a route's profile
+func (api *API) handleProfiles(w http.ResponseWriter, r *http.Request) {
+	if api.listProfiles == nil {
+		http.Error(w, "Protection profiles not configured", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var req struct {
+			Route   string `json:"route"`
+			Profile string `json:"profile"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !api.hasRoute(req.Route) {
+			http.Error(w, fmt.Sprintf("route %q not found", req.Route), http.StatusNotFound)
+			return
+		}
+		if err := api.setProfile(req.Route, req.Profile); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(api.listProfiles())
+}
+
+// hasRoute reports whether route is a configured proxy route
+func (api *API) hasRoute(route string) bool {
+	for _, name := range api.proxy.RouteNames() {
+		if name == route {
+			return true
+		}
+	}
+	return false
+}
+
+// handleBackends handles GET /backends to list health status (including flapping) for every backend
+func (api *API) handleBackends(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"backends": api.hc.Statuses(),
+		"paused":   api.hc.Paused(),
+	})
+}
+
+// handleBackendDetail handles per-backend actions, where {url} is the
+// percent-encoded backend URL (e.g. http%3A%2F%2Flocalhost%3A9001):
+//   - GET  /backends/{url}/history
+//   - GET  /backends/{url}/timeline?window=24h
+//   - POST /backends/{url}/pause
+//   - POST /backends/{url}/resume
+//   - POST /backends/{url}/drain   (optional body: {"reason": "..."})
+//   - POST /backends/{url}/undrain
+func (api *API) handleBackendDetail(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/backends/")
+	idx := strings.LastIndex(path, "/")
+	if idx <= 0 {
+		http.Error(w, "Invalid path", http.StatusBadRequest)
+		return
+	}
+	backend, action := path[:idx], path[idx+1:]
+
+	switch action {
+	case "history":
+		api.handleBackendHistory(w, r, backend)
+	case "timeline":
+		api.handleBackendTimeline(w, r, backend)
+	case "pause", "resume":
+		api.handleHealthPause(w, r, backend, action)
+	case "drain", "undrain":
+		api.handleDrain(w, r, backend, action)
+	default:
+		http.Error(w, "Invalid action", http.StatusBadRequest)
+	}
+}
+
+// handleHealthAction handles POST /health/pause and POST /health/resume,
+// pausing or resuming active probing for all backends
+func (api *API) handleHealthAction(w http.ResponseWriter, r *http.Request) {
+	action := strings.TrimPrefix(r.URL.Path, "/health/")
+	if action != "pause" && action != "resume" {
+		http.Error(w, "Invalid action", http.StatusBadRequest)
+		return
+	}
+	api.handleHealthPause(w, r, "", action)
+}
+
+// handleHealthPause pauses or resumes probing for one backend, or for all
+// backends when backend is empty. Resuming re-checks immediately.
+func (api *API) handleHealthPause(w http.ResponseWriter, r *http.Request, backend, action string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var err error
+	if action == "pause" {
+		err = api.hc.Pause(backend)
+	} else {
+		err = api.hc.Resume(backend)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"backends": api.hc.Statuses(),
+		"paused":   api.hc.Paused(),
+	})
+}
+
+// handleDrain forces a backend down (drain) or lifts that (undrain),
+// regardless of probe results
+func (api *API) handleDrain(w http.ResponseWriter, r *http.Request, backend, action string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var err error
+	if action == "drain" {
+		var req struct {
+			Reason string `json:"reason"`
+		}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		err = api.hc.Drain(backend, req.Reason)
+	} else {
+		err = api.hc.Undrain(backend)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"backends": api.hc.Statuses(),
+		"paused":   api.hc.Paused(),
+	})
+}
+
+// handleBackendHistory handles GET /backends/{url}/history
+func (api *API) handleBackendHistory(w http.ResponseWriter, r *http.Request, backend string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	history, flapping, ok := api.hc.History(backend)
+	if !ok {
+		http.Error(w, "Backend not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"url":      backend,
+		"flapping": flapping,
+		"history":  history,
+	})
+}
+
+// handleBackendTimeline handles GET /backends/{url}/timeline, returning the
+// backend's health transitions and uptime over ?window= (default 24h)
+func (api *API) handleBackendTimeline(w http.ResponseWriter, r *http.Request, backend string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	window := 24 * time.Hour
+	if v := r.URL.Query().Get("window"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			http.Error(w, "Invalid window", http.StatusBadRequest)
+			return
+		}
+		window = d
+	}
+
+	transitions, uptime, ok := api.hc.Timeline(backend, window)
+	if !ok {
+		http.Error(w, "Backend not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"url":            backend,
+		"window":         window.String(),
+		"uptime_percent": uptime,
+		"transitions":    transitions,
+	})
+}
+
+// SetFederation enables the aggregated multi-gateway view at /federation/.
+func (api *API) SetFederation(f *Federation) {
+	api.federation = f
+}
+
+// handleFederation handles GET /federation/{metrics,processes,health,anomalies},
+// returning each gateway's response plus a combined view with per-instance
+// attribution
+func (api *API) handleFederation(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if api.federation == nil {
+		http.Error(w, "Federation not configured", http.StatusNotFound)
+		return
+	}
+
+	resource := strings.TrimPrefix(r.URL.Path, "/federation/")
+	results, err := api.federation.Fetch(r.Context(), resource)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"resource":  resource,
+		"combined":  Combine(resource, results),
+		"instances": results,
+	})
+}
+
 // handleMetrics handles GET /metrics to return real-time gateway metrics
 func (api *API) handleMetrics(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -265,6 +691,8 @@ func (api *API) handleMetrics(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"requests_per_minute": snap.RequestsPerMinute,
 		"avg_latency_ms":     snap.AvgLatencyMs,
+		"p95_latency_ms":     snap.P95LatencyMs,
+		"p99_latency_ms":     snap.P99LatencyMs,
 		"error_rate":         snap.ErrorRate,
 		"healthy_backends":   healthy,
 		"total_backends":     total,
@@ -273,16 +701,58 @@ func (api *API) handleMetrics(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// StartMetricsBroadcast sends a metrics SSE event every interval.
+// SetMetricsDelta makes the metrics broadcast skip ticks where nothing
+// changed by more than delta, a fraction (0.05 = 5%) of requests per
+// minute, average or p95 latency, or error rate; a change in backend counts is
+// always sent. Zero, the default, broadcasts every tick. Must be called
+// before StartMetricsBroadcast.
+func (api *API) SetMetricsDelta(delta float64) {
+	api.metricsDelta = delta
+}
+
+// metricsMoved reports whether snap differs from last, the metrics last
+// broadcast, by more than the delta.
+func (api *API) metricsMoved(last, snap MetricsSnapshot) bool {
+	beyond := func(a, b float64) bool {
+		return math.Abs(a-b) > api.metricsDelta*math.Max(math.Abs(a), math.Abs(b))
+	}
+	return beyond(float64(last.RequestsPerMinute), float64(snap.RequestsPerMinute)) ||
+		beyond(float64(last.AvgLatencyMs), float64(snap.AvgLatencyMs)) ||
+		beyond(float64(last.P95LatencyMs), float64(snap.P95LatencyMs)) ||
+		beyond(last.ErrorRate, snap.ErrorRate)
+}
+
+// StartMetricsBroadcast sends a metrics SSE event every interval (default
+// 5s), or only on change with SetMetricsDelta.
 func (api *API) StartMetricsBroadcast(interval time.Duration) {
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	api.metricsStop = make(chan struct{})
+	api.metricsDone = make(chan struct{})
 	ticker := time.NewTicker(interval)
 	go func() {
-		for range ticker.C {
+		defer close(api.metricsDone)
+		defer ticker.Stop()
+		var last MetricsSnapshot
+		lastHealthy, lastTotal, sent := 0, 0, false
+		for {
+			select {
+			case <-ticker.C:
+			case <-api.metricsStop:
+				return
+			}
 			snap := api.store.Metrics()
 			healthy, total := api.hc.BackendCounts()
+			if api.metricsDelta > 0 && sent && healthy == lastHealthy && total == lastTotal && !api.metricsMoved(last, snap) {
+				continue
+			}
+			last, lastHealthy, lastTotal, sent = snap, healthy, total, true
 			api.broker.Broadcast("metrics", map[string]interface{}{
 				"requests_per_minute": snap.RequestsPerMinute,
 				"avg_latency_ms":     snap.AvgLatencyMs,
+				"p95_latency_ms":     snap.P95LatencyMs,
+				"p99_latency_ms":     snap.P99LatencyMs,
 				"error_rate":         snap.ErrorRate,
 				"healthy_backends":   healthy,
 				"total_backends":     total,
@@ -293,6 +763,15 @@ func (api *API) StartMetricsBroadcast(interval time.Duration) {
 	}()
 }
 
+// StopMetricsBroadcast ends the broadcast started by StartMetricsBroadcast.
+func (api *API) StopMetricsBroadcast() {
+	if api.metricsStop != nil {
+		close(api.metricsStop)
+		<-api.metricsDone
+		api.metricsStop = nil
+	}
+}
+
 // handleLogDetail handles GET /logs/{id} to get a single log
 func (api *API) handleLogDetail(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -0,0 +1,27 @@
+package dashboard
+
+import "testing"
+
+func TestMetricsMovedBeyondDelta(t *testing.T) {
+	api := &API{metricsDelta: 0.1}
+	last := MetricsSnapshot{RequestsPerMinute: 100, AvgLatencyMs: 20, ErrorRate: 0.02}
+
+	tests := []struct {
+		name string
+		snap MetricsSnapshot
+		want bool
+	}{
+		{"unchanged", last, false},
+		{"within delta", MetricsSnapshot{RequestsPerMinute: 105, AvgLatencyMs: 21, ErrorRate: 0.021}, false},
+		{"requests jump", MetricsSnapshot{RequestsPerMinute: 150, AvgLatencyMs: 20, ErrorRate: 0.02}, true},
+		{"errors start", MetricsSnapshot{RequestsPerMinute: 100, AvgLatencyMs: 20, ErrorRate: 0.5}, true},
+	}
+	for _, tt := range tests {
+		if got := api.metricsMoved(last, tt.snap); got != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+	if api.metricsMoved(MetricsSnapshot{}, MetricsSnapshot{}) {
+		t.Error("Expected an idle gateway to stay quiet")
+	}
+}
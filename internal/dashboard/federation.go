@@ -0,0 +1,283 @@
+package dashboard
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// federatedResources maps each resource the federation view aggregates to
+// its path on a gateway.
+var federatedResources = map[string]string{
+	"metrics":   "/dashboard/api/metrics",
+	"processes": "/dashboard/api/processes",
+	"health":    "/health",
+	"anomalies": "/analytics/anomalies",
+}
+
+// Peer is another gateway whose dashboard data is aggregated.
+type Peer struct {
+	Name  string
+	URL   string // base URL, e.g. http://gw-2:8080
+	Token string // bearer token, if the peer requires a dashboard login
+}
+
+// InstanceResult is one gateway's answer for a federated resource.
+type InstanceResult struct {
+	Instance string          `json:"instance"`
+	URL      string          `json:"url,omitempty"` // empty for the local gateway
+	Status   int             `json:"status,omitempty"`
+	Error    string          `json:"error,omitempty"`
+	Data     json.RawMessage `json:"data,omitempty"`
+}
+
+// Federation fans dashboard queries out to peer gateways so one dashboard
+// can show several. The local gateway is queried in-process through the
+// same handler that serves its own routes.
+type Federation struct {
+	instance string
+	peers    []Peer
+	client   *http.Client
+	local    http.Handler
+}
+
+// NewFederation creates a federation of the local gateway (named instance)
+// and its peers. timeout bounds each peer request (default 3s); a slow or
+// down peer is reported with an error rather than failing the whole view.
+func NewFederation(instance string, peers []Peer, timeout time.Duration) *Federation {
+	if instance == "" {
+		instance = "local"
+	}
+	if timeout <= 0 {
+		timeout = 3 * time.Second
+	}
+	for i := range peers {
+		peers[i].URL = strings.TrimRight(peers[i].URL, "/")
+		if peers[i].Name == "" {
+			peers[i].Name = peers[i].URL
+		}
+	}
+	return &Federation{
+		instance: instance,
+		peers:    peers,
+		client:   &http.Client{Timeout: timeout},
+	}
+}
+
+// SetLocal sets the handler serving the local gateway's routes (the
+// top-level mux). Until it's set the local instance is reported as unavailable.
+func (f *Federation) SetLocal(h http.Handler) {
+	f.local = h
+}
+
+// Fetch queries every instance for a resource concurrently. Results are in
+// a stable order: local gateway first, then peers as configured.
+func (f *Federation) Fetch(ctx context.Context, resource string) ([]InstanceResult, error) {
+	path, ok := federatedResources[resource]
+	if !ok {
+		return nil, fmt.Errorf("unknown resource %q", resource)
+	}
+
+	results := make([]InstanceResult, len(f.peers)+1)
+	results[0] = f.fetchLocal(ctx, path)
+
+	var wg sync.WaitGroup
+	for i, peer := range f.peers {
+		wg.Add(1)
+		go func(i int, peer Peer) {
+			defer wg.Done()
+			results[i+1] = f.fetchPeer(ctx, peer, path)
+		}(i, peer)
+	}
+	wg.Wait()
+	return results, nil
+}
+
+// fetchLocal serves path through the local handler without a network hop.
+func (f *Federation) fetchLocal(ctx context.Context, path string) InstanceResult {
+	res := InstanceResult{Instance: f.instance}
+	if f.local == nil {
+		res.Error = "local gateway not available"
+		return res
+	}
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, path, nil)
+	rec := &bufferedResponse{header: make(http.Header), status: http.StatusOK}
+	f.local.ServeHTTP(rec, req)
+	return decodeResult(res, rec.status, rec.body.Bytes())
+}
+
+// fetchPeer queries a peer gateway over HTTP.
+func (f *Federation) fetchPeer(ctx context.Context, peer Peer, path string) InstanceResult {
+	res := InstanceResult{Instance: peer.Name, URL: peer.URL}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, peer.URL+path, nil)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	if peer.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+peer.Token)
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	return decodeResult(res, resp.StatusCode, body)
+}
+
+// decodeResult keeps a JSON body as the instance's data. Non-2xx responses
+// still count if they carry JSON (/health answers 503 when degraded).
+func decodeResult(res InstanceResult, status int, body []byte) InstanceResult {
+	res.Status = status
+	if !json.Valid(body) {
+		res.Error = fmt.Sprintf("status %d: %s", status, strings.TrimSpace(string(body)))
+		return res
+	}
+	res.Data = body
+	return res
+}
+
+// Combine merges per-instance data into one view, tagging each item with
+// the instance it came from. Instances that errored are skipped.
+func Combine(resource string, results []InstanceResult) interface{} {
+	switch resource {
+	case "metrics":
+		return combineMetrics(results)
+	case "processes":
+		return flattenItems(results, func(data json.RawMessage) []map[string]interface{} {
+			var items []map[string]interface{}
+			json.Unmarshal(data, &items)
+			return items
+		})
+	case "anomalies":
+		return flattenItems(results, func(data json.RawMessage) []map[string]interface{} {
+			var body struct {
+				Anomalies []map[string]interface{} `json:"anomalies"`
+			}
+			json.Unmarshal(data, &body)
+			return body.Anomalies
+		})
+	case "health":
+		return combineHealth(results)
+	}
+	return nil
+}
+
+// flattenItems concatenates list items from every instance, adding an
+// "instance" field to each.
+func flattenItems(results []InstanceResult, items func(json.RawMessage) []map[string]interface{}) []map[string]interface{} {
+	out := []map[string]interface{}{}
+	for _, res := range results {
+		if res.Data == nil {
+			continue
+		}
+		for _, item := range items(res.Data) {
+			item["instance"] = res.Instance
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// combineMetrics sums traffic and backend counts across instances. Latency
+// and error rate are averaged weighted by each instance's request rate.
+func combineMetrics(results []InstanceResult) map[string]interface{} {
+	var rpm, latencyWeighted, errorWeighted float64
+	var healthy, total int
+	for _, res := range results {
+		if res.Data == nil {
+			continue
+		}
+		var m struct {
+			RequestsPerMinute float64 `json:"requests_per_minute"`
+			AvgLatencyMs      float64 `json:"avg_latency_ms"`
+			ErrorRate         float64 `json:"error_rate"`
+			HealthyBackends   int     `json:"healthy_backends"`
+			TotalBackends     int     `json:"total_backends"`
+		}
+		if json.Unmarshal(res.Data, &m) != nil {
+			continue
+		}
+		rpm += m.RequestsPerMinute
+		latencyWeighted += m.AvgLatencyMs * m.RequestsPerMinute
+		errorWeighted += m.ErrorRate * m.RequestsPerMinute
+		healthy += m.HealthyBackends
+		total += m.TotalBackends
+	}
+
+	out := map[string]interface{}{
+		"requests_per_minute": rpm,
+		"avg_latency_ms":      0.0,
+		"error_rate":          0.0,
+		"healthy_backends":    healthy,
+		"total_backends":      total,
+	}
+	if rpm > 0 {
+		out["avg_latency_ms"] = latencyWeighted / rpm
+		out["error_rate"] = errorWeighted / rpm
+	}
+	return out
+}
+
+// combineHealth lists every instance's backends and reports "healthy" only
+// if every instance answered and was healthy.
+func combineHealth(results []InstanceResult) map[string]interface{} {
+	status := "healthy"
+	backends := []map[string]interface{}{}
+	for _, res := range results {
+		if res.Data == nil {
+			status = "degraded"
+			continue
+		}
+		var h struct {
+			Status   string                            `json:"status"`
+			Backends map[string]map[string]interface{} `json:"backends"`
+		}
+		if json.Unmarshal(res.Data, &h) != nil {
+			status = "degraded"
+			continue
+		}
+		if h.Status != "healthy" {
+			status = "degraded"
+		}
+		urls := make([]string, 0, len(h.Backends))
+		for url := range h.Backends {
+			urls = append(urls, url)
+		}
+		sort.Strings(urls)
+		for _, url := range urls {
+			b := h.Backends[url]
+			b["instance"] = res.Instance
+			b["url"] = url
+			backends = append(backends, b)
+		}
+	}
+	return map[string]interface{}{
+		"status":   status,
+		"backends": backends,
+	}
+}
+
+// bufferedResponse captures an in-process response for fetchLocal.
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header         { return b.header }
+func (b *bufferedResponse) Write(p []byte) (int, error) { return b.body.Write(p) }
+func (b *bufferedResponse) WriteHeader(status int)      { b.status = status }
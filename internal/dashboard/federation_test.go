@@ -0,0 +1,52 @@
+package dashboard
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFederationCombinesMetrics(t *testing.T) {
+	metrics := func(body string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(body))
+		})
+	}
+
+	peer := httptest.NewServer(metrics(`{"requests_per_minute": 30, "avg_latency_ms": 40, "healthy_backends": 1, "total_backends": 2}`))
+	defer peer.Close()
+
+	f := NewFederation("gw-1", []Peer{
+		{Name: "gw-2", URL: peer.URL},
+		{Name: "gw-down", URL: "http://127.0.0.1:1"},
+	}, 0)
+	f.SetLocal(metrics(`{"requests_per_minute": 10, "avg_latency_ms": 80, "healthy_backends": 2, "total_backends": 2}`))
+
+	results, err := f.Fetch(context.Background(), "metrics")
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if len(results) != 3 || results[0].Instance != "gw-1" || results[1].Instance != "gw-2" {
+		t.Fatalf("Expected local then peers in order, got %+v", results)
+	}
+	if results[2].Error == "" {
+		t.Error("Expected unreachable peer to report an error")
+	}
+
+	combined := Combine("metrics", results).(map[string]interface{})
+	if combined["requests_per_minute"] != 40.0 {
+		t.Errorf("Expected summed rpm 40, got %v", combined["requests_per_minute"])
+	}
+	if combined["avg_latency_ms"] != 50.0 {
+		t.Errorf("Expected rpm-weighted latency 50, got %v", combined["avg_latency_ms"])
+	}
+	if combined["healthy_backends"] != 3 || combined["total_backends"] != 4 {
+		t.Errorf("Expected 3/4 backends, got %v/%v", combined["healthy_backends"], combined["total_backends"])
+	}
+
+	if _, err := f.Fetch(context.Background(), "secrets"); err == nil {
+		t.Error("Expected error for unknown resource")
+	}
+}
@@ -0,0 +1,76 @@
+package dashboard
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// logExportColumns is the CSV header for exported request logs.
+var logExportColumns = []string{
+	"id", "timestamp", "method", "path", "status", "latency_ms", "client_ip",
+	"bytes_in", "bytes_out", "backend", "error", "country", "asn",
+}
+
+// csvRecord renders a log as a row under logExportColumns.
+func (l RequestLog) csvRecord() []string {
+	asn := ""
+	if l.ASN != 0 {
+		asn = strconv.FormatUint(uint64(l.ASN), 10)
+	}
+	return []string{
+		l.ID, l.Timestamp.UTC().Format(time.RFC3339Nano), l.Method, l.Path,
+		strconv.Itoa(l.Status), strconv.FormatFloat(float64(l.Latency)/float64(time.Millisecond), 'f', 3, 64),
+		l.ClientIP, strconv.FormatInt(l.BytesIn, 10), strconv.FormatInt(l.BytesOut, 10),
+		l.Backend, l.Error, l.Country, asn,
+	}
+}
+
+// handleLogExport handles GET /logs/export?format=ndjson|csv, downloading
+// every buffered log that matches the same filters as /logs, oldest first,
+// for attaching to incident reports.
+func (api *API) handleLogExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	filter, err := parseLogFilter(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	format := q.Get("format")
+	if format == "" {
+		format = "ndjson"
+	}
+	if format != "ndjson" && format != "csv" {
+		http.Error(w, `format must be "ndjson" or "csv"`, http.StatusBadRequest)
+		return
+	}
+
+	logs := api.store.Query(filter, api.store.size)
+	slices.Reverse(logs)
+
+	filename := "request-logs-" + time.Now().UTC().Format("20060102T150405") + "." + format
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		cw := csv.NewWriter(w)
+		cw.Write(logExportColumns)
+		for _, l := range logs {
+			cw.Write(l.csvRecord())
+		}
+		cw.Flush()
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(w)
+	for _, l := range logs {
+		enc.Encode(l)
+	}
+}
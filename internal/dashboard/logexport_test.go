@@ -0,0 +1,43 @@
+package dashboard
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogExport(t *testing.T) {
+	store := NewLogStore(10)
+	now := time.Now()
+	store.Add(RequestLog{ID: "1", Timestamp: now, Method: "GET", Path: "/api", Status: 200})
+	store.Add(RequestLog{ID: "2", Timestamp: now, Method: "POST", Path: "/api", Status: 502, Error: "upstream, reset"})
+	store.Add(RequestLog{ID: "3", Timestamp: now, Method: "GET", Path: "/api", Status: 503})
+	api := &API{store: store}
+
+	export := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		api.handleLogExport(rec, httptest.NewRequest(http.MethodGet, "/logs/export?"+query, nil))
+		return rec
+	}
+
+	rec := export("status=5xx")
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"id":"2"`) || !strings.Contains(lines[1], `"id":"3"`) {
+		t.Errorf("Expected logs 2 and 3 as NDJSON, oldest first, got %q", rec.Body.String())
+	}
+	if cd := rec.Header().Get("Content-Disposition"); !strings.HasPrefix(cd, "attachment;") {
+		t.Errorf("Expected a download, got Content-Disposition %q", cd)
+	}
+
+	rec = export("format=csv&method=POST")
+	lines = strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "id,timestamp,") || !strings.Contains(lines[1], `"upstream, reset"`) {
+		t.Errorf("Expected a CSV header and log 2, got %q", rec.Body.String())
+	}
+
+	if rec := export("format=xml"); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown format, got %d", rec.Code)
+	}
+}
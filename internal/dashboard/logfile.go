@@ -0,0 +1,204 @@
+package dashboard
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultLogFileMaxSize caps a request log file when no size is configured.
+const DefaultLogFileMaxSize = 64 << 20
+
+// LogFile persists request logs to an append-only JSON Lines file, so the
+// dashboard's recent requests survive a restart. Appends are buffered and
+// flushed periodically (see Start). Once the file grows past its maximum
+// size it is compacted: rewritten with only the newest entries that fit in
+// half of it, so compaction runs rarely.
+type LogFile struct {
+	path    string
+	maxSize int64
+
+	mu   sync.Mutex
+	f    *os.File // nil once closed
+	w    *bufio.Writer
+	size int64 // bytes in the file, including buffered ones
+
+	stop chan struct{} // closed by Stop
+	done chan struct{} // closed when the flush loop exits
+}
+
+// OpenLogFile opens (or creates) the log file at path. maxSize <= 0
+// uses DefaultLogFileMaxSize.
+func OpenLogFile(path string, maxSize int64) (*LogFile, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultLogFileMaxSize
+	}
+	lf := &LogFile{path: path, maxSize: maxSize}
+	if err := lf.open(); err != nil {
+		return nil, err
+	}
+	return lf, nil
+}
+
+// open opens the file for appending. Must hold lf.mu (or not be shared yet).
+func (lf *LogFile) open() error {
+	f, err := os.OpenFile(lf.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open request log file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to open request log file: %w", err)
+	}
+	lf.f, lf.w, lf.size = f, bufio.NewWriter(f), info.Size()
+	return nil
+}
+
+// Recent returns up to n of the newest logs in the file, oldest first.
+// Lines that don't decode, such as one cut short by a crash, are skipped.
+func (lf *LogFile) Recent(n int) ([]RequestLog, error) {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	if lf.w != nil {
+		lf.w.Flush()
+	}
+	lines, err := lf.tail(lf.size)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []RequestLog
+	for _, line := range lines {
+		var entry RequestLog
+		if json.Unmarshal(line, &entry) == nil {
+			out = append(out, entry)
+		}
+	}
+	if len(out) > n {
+		out = out[len(out)-n:]
+	}
+	return out, nil
+}
+
+// tail returns the newest whole lines of the file totalling at most limit
+// bytes, oldest first. Must hold lf.mu.
+func (lf *LogFile) tail(limit int64) ([][]byte, error) {
+	data, err := os.ReadFile(lf.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request log file: %w", err)
+	}
+	lines := bytes.Split(bytes.TrimSuffix(data, []byte("\n")), []byte("\n"))
+	var kept int64
+	i := len(lines)
+	for i > 0 && kept+int64(len(lines[i-1]))+1 <= limit {
+		i--
+		kept += int64(len(lines[i])) + 1
+	}
+	return lines[i:], nil
+}
+
+// append buffers one log entry. It is a no-op once the file is closed.
+func (lf *LogFile) append(entry RequestLog) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	if lf.f == nil {
+		return
+	}
+	n, _ := lf.w.Write(append(data, '\n'))
+	lf.size += int64(n)
+}
+
+// flush writes buffered entries to disk, compacting the file if it has
+// outgrown its maximum size.
+func (lf *LogFile) flush() {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	if lf.f == nil {
+		return
+	}
+	if err := lf.w.Flush(); err != nil {
+		log.Printf("[dashboard] failed to write request log file: %v", err)
+		return
+	}
+	if lf.size > lf.maxSize {
+		if err := lf.compact(); err != nil {
+			log.Printf("[dashboard] failed to compact request log file: %v", err)
+		}
+	}
+}
+
+// compact rewrites the file with the newest entries that fit in half its
+// maximum size. The new file is written beside it and renamed into place,
+// so a crash mid-compaction leaves the old one intact. Must hold lf.mu.
+func (lf *LogFile) compact() error {
+	lines, err := lf.tail(lf.maxSize / 2)
+	if err != nil {
+		return err
+	}
+	tmp := lf.path + ".tmp"
+	var buf bytes.Buffer
+	for _, line := range lines {
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	lf.f.Close()
+	lf.f = nil
+	if err := os.Rename(tmp, lf.path); err != nil {
+		os.Remove(tmp)
+		return lf.open()
+	}
+	return lf.open()
+}
+
+// Start flushes buffered entries every interval (default 1s) until Stop.
+func (lf *LogFile) Start(interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	lf.stop = make(chan struct{})
+	lf.done = make(chan struct{})
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer close(lf.done)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				lf.flush()
+			case <-lf.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends periodic flushing, then flushes and closes the file. Entries
+// added afterwards are dropped.
+func (lf *LogFile) Stop() {
+	if lf.stop != nil {
+		close(lf.stop)
+		<-lf.done
+		lf.stop = nil
+	}
+	lf.flush()
+
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	if lf.f != nil {
+		lf.f.Close()
+		lf.f = nil
+	}
+}
@@ -0,0 +1,69 @@
+package dashboard
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestLogFileSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "requests.jsonl")
+	lf, err := OpenLogFile(path, 0)
+	if err != nil {
+		t.Fatalf("OpenLogFile: %v", err)
+	}
+	store := NewLogStore(3)
+	if err := store.SetLogFile(lf); err != nil {
+		t.Fatalf("SetLogFile: %v", err)
+	}
+	for i := 1; i <= 4; i++ {
+		store.Add(RequestLog{ID: strconv.Itoa(i), Path: "/api"})
+	}
+	lf.Stop()
+
+	// A crash can leave a partial line behind
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	f.WriteString(`{"id":"5","pa`)
+	f.Close()
+
+	lf, err = OpenLogFile(path, 0)
+	if err != nil {
+		t.Fatalf("OpenLogFile: %v", err)
+	}
+	defer lf.Stop()
+	restored := NewLogStore(3)
+	if err := restored.SetLogFile(lf); err != nil {
+		t.Fatalf("SetLogFile: %v", err)
+	}
+	recent := restored.Recent(3)
+	if len(recent) != 3 || recent[0].ID != "4" || recent[2].ID != "2" {
+		t.Errorf("Expected logs 4, 3, 2 restored, got %+v", recent)
+	}
+}
+
+func TestLogFileCompacts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "requests.jsonl")
+	lf, err := OpenLogFile(path, 2000)
+	if err != nil {
+		t.Fatalf("OpenLogFile: %v", err)
+	}
+	defer lf.Stop()
+	for i := 0; i < 100; i++ {
+		lf.append(RequestLog{ID: strconv.Itoa(i)})
+	}
+	lf.flush()
+
+	info, err := os.Stat(path)
+	if err != nil || info.Size() > 1000 {
+		t.Fatalf("Expected the file compacted to at most half its max size, got %v (%v)", info.Size(), err)
+	}
+	logs, _ := lf.Recent(1000)
+	if len(logs) == 0 || logs[len(logs)-1].ID != "99" {
+		t.Errorf("Expected the newest entries kept, got %+v", logs)
+	}
+	lf.append(RequestLog{ID: "100"})
+	if logs, _ := lf.Recent(1); len(logs) != 1 || logs[0].ID != "100" {
+		t.Errorf("Expected appends to continue after compaction, got %+v", logs)
+	}
+}
@@ -0,0 +1,96 @@
+package dashboard
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LogFilter selects request logs. Zero fields match everything; set
+// fields must all match.
+type LogFilter struct {
+	Method      string        // exact, case-insensitive
+	Path        string        // substring
+	ClientIP    string        // exact
+	Backend     string        // substring, so "9001" finds http://localhost:9001
+	Status      int           // exact status code
+	StatusClass int           // first digit of the status, e.g. 5 for 5xx
+	From        time.Time     // at or after
+	To          time.Time     // before
+	MinLatency  time.Duration // at least this slow
+}
+
+// Matches reports whether log passes the filter.
+func (f LogFilter) Matches(log RequestLog) bool {
+	switch {
+	case f.Method != "" && !strings.EqualFold(log.Method, f.Method):
+		return false
+	case f.Path != "" && !strings.Contains(log.Path, f.Path):
+		return false
+	case f.ClientIP != "" && log.ClientIP != f.ClientIP:
+		return false
+	case f.Backend != "" && !strings.Contains(log.Backend, f.Backend):
+		return false
+	case f.Status != 0 && log.Status != f.Status:
+		return false
+	case f.StatusClass != 0 && log.Status/100 != f.StatusClass:
+		return false
+	case !f.From.IsZero() && log.Timestamp.Before(f.From):
+		return false
+	case !f.To.IsZero() && !log.Timestamp.Before(f.To):
+		return false
+	case f.MinLatency > 0 && log.Latency < f.MinLatency:
+		return false
+	}
+	return true
+}
+
+// parseLogFilter reads a LogFilter from query parameters:
+//
+//	method=POST  path=/api  client_ip=203.0.113.9  backend=9001
+//	status=503 or status=5xx  from=<RFC 3339>  to=<RFC 3339>  min_latency=250ms
+func parseLogFilter(q url.Values) (LogFilter, error) {
+	f := LogFilter{
+		Method:   q.Get("method"),
+		Path:     q.Get("path"),
+		ClientIP: q.Get("client_ip"),
+		Backend:  q.Get("backend"),
+	}
+	if s := q.Get("status"); s != "" {
+		if class, ok := strings.CutSuffix(strings.ToLower(s), "xx"); ok {
+			n, err := strconv.Atoi(class)
+			if err != nil || n < 1 || n > 5 {
+				return f, fmt.Errorf("invalid status class %q", s)
+			}
+			f.StatusClass = n
+		} else {
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				return f, fmt.Errorf("invalid status %q", s)
+			}
+			f.Status = n
+		}
+	}
+	for _, p := range []struct {
+		name string
+		t    *time.Time
+	}{{"from", &f.From}, {"to", &f.To}} {
+		if s := q.Get(p.name); s != "" {
+			t, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				return f, fmt.Errorf("invalid %s: want RFC 3339", p.name)
+			}
+			*p.t = t
+		}
+	}
+	if s := q.Get("min_latency"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return f, fmt.Errorf("invalid min_latency %q", s)
+		}
+		f.MinLatency = d
+	}
+	return f, nil
+}
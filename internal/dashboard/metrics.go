@@ -0,0 +1,103 @@
+package dashboard
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Process manager metrics that are event driven are registered at init via
+// promauto; point-in-time values (state, uptime, exit code, restarts) are
+// read from the manager at scrape time by processCollector.
+var (
+	processOutputLines = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_process_output_lines_total",
+			Help: "Lines written by managed processes, by stream",
+		},
+		[]string{"process", "stream"},
+	)
+
+	processReadySeconds = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "gateway_process_ready_seconds",
+			Help:    "Time from process start to passing its readiness check",
+			Buckets: []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+		},
+		[]string{"process"},
+	)
+)
+
+// forgetProcessMetrics drops the label series of a removed process.
+func forgetProcessMetrics(id string) {
+	processOutputLines.DeleteLabelValues(id, "stdout")
+	processOutputLines.DeleteLabelValues(id, "stderr")
+	processReadySeconds.DeleteLabelValues(id)
+}
+
+var (
+	processStateDesc = prometheus.NewDesc(
+		"gateway_process_state",
+		"Current state of a managed process (1 for the active state, 0 otherwise)",
+		[]string{"process", "state"}, nil,
+	)
+	processRestartsDesc = prometheus.NewDesc(
+		"gateway_process_restarts_total",
+		"Times a managed process was started again after its first start",
+		[]string{"process"}, nil,
+	)
+	processUptimeDesc = prometheus.NewDesc(
+		"gateway_process_uptime_seconds",
+		"Seconds since the managed process was started (0 when not running)",
+		[]string{"process"}, nil,
+	)
+	processExitCodeDesc = prometheus.NewDesc(
+		"gateway_process_last_exit_code",
+		"Exit code of the last run of a managed process",
+		[]string{"process"}, nil,
+	)
+)
+
+// processCollector reports per-process gauges from a ProcessManager snapshot.
+type processCollector struct {
+	m *ProcessManager
+}
+
+func (c processCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- processStateDesc
+	ch <- processRestartsDesc
+	ch <- processUptimeDesc
+	ch <- processExitCodeDesc
+}
+
+func (c processCollector) Collect(ch chan<- prometheus.Metric) {
+	now := time.Now()
+	for _, p := range c.m.List() {
+		for _, s := range []ProcessStatus{StatusStarting, StatusRunning, StatusStopped, StatusCrashed} {
+			v := 0.0
+			if p.Status == s {
+				v = 1
+			}
+			ch <- prometheus.MustNewConstMetric(processStateDesc, prometheus.GaugeValue, v, p.ID, string(s))
+		}
+
+		ch <- prometheus.MustNewConstMetric(processRestartsDesc, prometheus.CounterValue, float64(p.Restarts), p.ID)
+
+		uptime := 0.0
+		if p.StartedAt != nil {
+			uptime = now.Sub(*p.StartedAt).Seconds()
+		}
+		ch <- prometheus.MustNewConstMetric(processUptimeDesc, prometheus.GaugeValue, uptime, p.ID)
+
+		if p.LastExitCode != nil {
+			ch <- prometheus.MustNewConstMetric(processExitCodeDesc, prometheus.GaugeValue, float64(*p.LastExitCode), p.ID)
+		}
+	}
+}
+
+// RegisterMetrics exports per-process state, restarts, uptime, and last
+// exit code on reg.
+func (m *ProcessManager) RegisterMetrics(reg prometheus.Registerer) error {
+	return reg.Register(processCollector{m: m})
+}
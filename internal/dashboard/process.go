@@ -2,11 +2,17 @@ package dashboard
 
 import (
 	"bufio"
+	"cmp"
 	"context"
 	"fmt"
 	"io"
+	"maps"
+	"net"
+	"net/http"
 	"os"
 	"os/exec"
+	"slices"
+	"strconv"
 	"sync"
 	"time"
 )
@@ -15,11 +21,116 @@ import (
 type ProcessStatus string
 
 const (
-	StatusRunning ProcessStatus = "running"
-	StatusStopped ProcessStatus = "stopped"
-	StatusCrashed ProcessStatus = "crashed"
+	StatusStarting ProcessStatus = "starting" // launched, waiting to pass its readiness check
+	StatusRunning  ProcessStatus = "running"
+	StatusStopped  ProcessStatus = "stopped"
+	StatusCrashed  ProcessStatus = "crashed"
 )
 
+// RestartMode says whether a process that exits on its own is started again.
+type RestartMode string
+
+const (
+	RestartNever     RestartMode = "never"
+	RestartOnFailure RestartMode = "on-failure" // only after a crash
+	RestartAlways    RestartMode = "always"
+)
+
+// restartStableAfter is how long a run must last for the next crash to
+// count as a new failure rather than another attempt in a row.
+const restartStableAfter = time.Minute
+
+// RestartPolicy restarts a process after it exits on its own, waiting
+// Backoff before the first attempt and doubling the wait up to MaxBackoff.
+// After MaxRestarts attempts in a row it gives up and leaves the process
+// down until started by hand.
+type RestartPolicy struct {
+	Mode        RestartMode
+	MaxRestarts int           // default 5
+	Backoff     time.Duration // default 1s
+	MaxBackoff  time.Duration // default 1m
+}
+
+// withDefaults validates the policy and fills in unset fields.
+func (rp RestartPolicy) withDefaults() (RestartPolicy, error) {
+	switch rp.Mode {
+	case "":
+		rp.Mode = RestartNever
+	case RestartNever, RestartOnFailure, RestartAlways:
+	default:
+		return rp, fmt.Errorf("unknown restart policy %q (want always, on-failure, or never)", rp.Mode)
+	}
+	if rp.MaxRestarts <= 0 {
+		rp.MaxRestarts = 5
+	}
+	if rp.Backoff <= 0 {
+		rp.Backoff = time.Second
+	}
+	if rp.MaxBackoff <= 0 {
+		rp.MaxBackoff = time.Minute
+	}
+	rp.MaxBackoff = max(rp.MaxBackoff, rp.Backoff)
+	return rp, nil
+}
+
+// delay returns the wait before restart attempt n (0 for the first).
+func (rp RestartPolicy) delay(n int) time.Duration {
+	d := rp.Backoff
+	for i := 0; i < n && d < rp.MaxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, rp.MaxBackoff)
+}
+
+// ProcessOptions configures a managed process beyond its command line.
+type ProcessOptions struct {
+	Restart RestartPolicy
+
+	// Env is added to the gateway's own environment. Values may refer to
+	// gateway variables as $VAR or ${VAR}, and to the process's $PORT and
+	// $PROCESS_ID.
+	Env map[string]string
+	Dir string // working directory; the gateway's if empty
+
+	// A started process stays StatusStarting until ReadyURL answers with a
+	// 2xx, or without one until its port accepts connections. If neither
+	// happens within ReadyTimeout (default 30s) it is killed as crashed.
+	// Processes without a port are running as soon as they start.
+	ReadyURL     string
+	ReadyTimeout time.Duration
+}
+
+// readyPollInterval is how often a starting process is checked.
+const readyPollInterval = 100 * time.Millisecond
+
+// processEnv expands env for the process id on port, returning it as
+// KEY=value pairs in key order.
+func processEnv(env map[string]string, id string, port int) []string {
+	lookup := func(name string) string {
+		switch name {
+		case "PORT":
+			return strconv.Itoa(port)
+		case "PROCESS_ID":
+			return id
+		}
+		return os.Getenv(name)
+	}
+	out := make([]string, 0, len(env))
+	for _, k := range slices.Sorted(maps.Keys(env)) {
+		out = append(out, k+"="+os.Expand(env[k], lookup))
+	}
+	return out
+}
+
+// RestartEvent reports an automatic restart being scheduled, or given up.
+type RestartEvent struct {
+	ID       string `json:"id"`
+	Attempt  int    `json:"attempt"` // restarts in a row, including this one
+	DelayMs  int64  `json:"delay_ms"`
+	ExitCode *int   `json:"exit_code,omitempty"`
+	GaveUp   bool   `json:"gave_up"` // max restarts reached; the process stays down
+}
+
 // lineBuffer is a thread-safe ring buffer that stores the last N output lines.
 type lineBuffer struct {
 	lines []string
@@ -78,16 +189,56 @@ type ManagedProcess struct {
 	PID       int           `json:"pid,omitempty"`
 	StartedAt *time.Time    `json:"started_at,omitempty"`
 
+	Restarts     int  `json:"restarts"`                 // starts after the first one
+	LastExitCode *int `json:"last_exit_code,omitempty"` // nil until the process has exited once
+
+	Dir           string      `json:"dir,omitempty"`
+	ReadyURL      string      `json:"ready_url,omitempty"`
+	RestartPolicy RestartMode `json:"restart_policy"`
+	NextRestart   *time.Time  `json:"next_restart,omitempty"` // when a pending automatic restart is due
+
 	cmd    *exec.Cmd
 	cancel context.CancelFunc
 	output *lineBuffer
+	starts int  // total successful starts
+	ready  bool // readiness observed for the current run (see MarkReady)
+
+	readyTimeout time.Duration
+	notReady     bool // killed for failing its readiness check
+
+	env          []string // KEY=value, added to the gateway's environment
+	restart      RestartPolicy
+	attempts     int         // automatic restarts in a row
+	restartTimer *time.Timer // pending automatic restart
+	restartGen   int         // bumped to invalidate a timer that already fired
+}
+
+// active reports whether the process has been launched and not exited.
+func (p *ManagedProcess) active() bool {
+	return p.Status == StatusRunning || p.Status == StatusStarting
+}
+
+// cancelRestart drops a pending automatic restart. Must hold the manager's lock.
+func (p *ManagedProcess) cancelRestart() {
+	if p.restartTimer != nil {
+		p.restartTimer.Stop()
+		p.restartTimer = nil
+	}
+	p.NextRestart = nil
+	p.restartGen++
 }
 
 // ProcessManager controls the lifecycle of backend processes
 type ProcessManager struct {
 	processes     map[string]*ManagedProcess
 	mu            sync.RWMutex
+	stopping      bool                   // set by StopAll; no more automatic restarts
 	OnStateChange func(p ManagedProcess) // hook for SSE updates
+	OnRestart     func(e RestartEvent)   // hook for SSE updates on automatic restarts
+
+	// OnReady is called when a process passes its readiness check, outside
+	// the manager's lock, e.g. to put its backend into rotation.
+	OnReady func(p ManagedProcess)
 }
 
 // NewProcessManager creates a new process manager
@@ -98,7 +249,12 @@ func NewProcessManager() *ProcessManager {
 }
 
 // Add registers a new process to be managed
-func (m *ProcessManager) Add(id, command string, args []string, port int) error {
+func (m *ProcessManager) Add(id, command string, args []string, port int, opts ProcessOptions) error {
+	restart, err := opts.Restart.withDefaults()
+	if err != nil {
+		return err
+	}
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -107,17 +263,24 @@ func (m *ProcessManager) Add(id, command string, args []string, port int) error
 	}
 
 	m.processes[id] = &ManagedProcess{
-		ID:      id,
-		Command: command,
-		Args:    args,
-		Port:    port,
-		Status:  StatusStopped,
+		ID:            id,
+		Command:       command,
+		Args:          args,
+		Port:          port,
+		Status:        StatusStopped,
+		Dir:           opts.Dir,
+		ReadyURL:      opts.ReadyURL,
+		RestartPolicy: restart.Mode,
+		env:           processEnv(opts.Env, id, port),
+		restart:       restart,
+		readyTimeout:  cmp.Or(opts.ReadyTimeout, 30*time.Second),
 	}
 
 	return nil
 }
 
-// Start launches a managed process
+// Start launches a managed process. Starting it by hand cancels a pending
+// automatic restart and resets its backoff.
 func (m *ProcessManager) Start(id string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -127,13 +290,24 @@ func (m *ProcessManager) Start(id string) error {
 		return fmt.Errorf("process with ID %s not found", id)
 	}
 
-	if p.Status == StatusRunning {
+	if p.active() {
 		return fmt.Errorf("process %s is already running", id)
 	}
 
+	p.cancelRestart()
+	p.attempts = 0
+	return m.start(p)
+}
+
+// start launches p. Must hold m.mu.
+func (m *ProcessManager) start(p *ManagedProcess) error {
 	// Create context for cancellation
 	ctx, cancel := context.WithCancel(context.Background())
 	cmd := exec.CommandContext(ctx, p.Command, p.Args...)
+	cmd.Dir = p.Dir
+	if len(p.env) > 0 {
+		cmd.Env = append(os.Environ(), p.env...)
+	}
 
 	// Initialize output buffer if needed
 	if p.output == nil {
@@ -160,16 +334,18 @@ func (m *ProcessManager) Start(id string) error {
 	}
 
 	// Scan stdout and stderr in background goroutines
-	scanPipe := func(pipe io.ReadCloser, dest *os.File) {
+	scanPipe := func(pipe io.ReadCloser, dest *os.File, stream string) {
+		lines := processOutputLines.WithLabelValues(p.ID, stream)
 		scanner := bufio.NewScanner(pipe)
 		for scanner.Scan() {
 			line := scanner.Text()
 			p.output.Add(line)
+			lines.Inc()
 			fmt.Fprintln(dest, line)
 		}
 	}
-	go scanPipe(stdoutPipe, os.Stdout)
-	go scanPipe(stderrPipe, os.Stderr)
+	go scanPipe(stdoutPipe, os.Stdout, "stdout")
+	go scanPipe(stderrPipe, os.Stderr, "stderr")
 
 	// Update state
 	now := time.Now()
@@ -178,6 +354,16 @@ func (m *ProcessManager) Start(id string) error {
 	p.PID = cmd.Process.Pid
 	p.Status = StatusRunning
 	p.StartedAt = &now
+	p.ready = false
+	p.notReady = false
+	if p.starts > 0 {
+		p.Restarts++
+	}
+	p.starts++
+	if p.Port != 0 || p.ReadyURL != "" {
+		p.Status = StatusStarting
+		go m.awaitReady(p, cmd)
+	}
 
 	// Fire event
 	if m.OnStateChange != nil {
@@ -193,19 +379,27 @@ func (m *ProcessManager) Start(id string) error {
 
 		// If the process we're monitoring is still the active one
 		if proc.cmd == c {
+			if proc.StartedAt != nil && time.Since(*proc.StartedAt) >= restartStableAfter {
+				proc.attempts = 0
+			}
 			proc.cmd = nil
 			proc.cancel = nil
 			proc.PID = 0
 			proc.StartedAt = nil
+			if c.ProcessState != nil {
+				code := c.ProcessState.ExitCode()
+				proc.LastExitCode = &code
+			}
 
 			// If it exited with an error and wasn't explicitly stopped via context cancellation
-			if err != nil && c.ProcessState.ExitCode() != -1 {
+			if proc.notReady || (err != nil && c.ProcessState.ExitCode() != -1) {
 				fmt.Printf("[ProcessManager] process %s crashed: %v\n", proc.ID, err)
 				proc.Status = StatusCrashed
 			} else {
 				fmt.Printf("[ProcessManager] process %s stopped normally\n", proc.ID)
 				proc.Status = StatusStopped
 			}
+			m.scheduleRestart(proc)
 
 			// Fire event for the transition to stopped/crashed
 			if m.OnStateChange != nil {
@@ -217,7 +411,114 @@ func (m *ProcessManager) Start(id string) error {
 	return nil
 }
 
-// Stop terminates a managed process
+// awaitReady polls a starting process until it is ready, then marks it
+// running, or kills it once its readiness timeout passes. It gives up
+// quietly if the run ends first.
+func (m *ProcessManager) awaitReady(p *ManagedProcess, c *exec.Cmd) {
+	deadline := time.Now().Add(p.readyTimeout)
+	client := &http.Client{Timeout: readyPollInterval * 10}
+	check := func() bool {
+		if p.ReadyURL != "" {
+			resp, err := client.Get(p.ReadyURL)
+			if err != nil {
+				return false
+			}
+			resp.Body.Close()
+			return resp.StatusCode >= 200 && resp.StatusCode < 300
+		}
+		conn, err := net.DialTimeout("tcp", net.JoinHostPort("localhost", strconv.Itoa(p.Port)), readyPollInterval*10)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	}
+	// still reports whether the run being checked is current. Must hold m.mu.
+	still := func() bool { return p.cmd == c && p.Status == StatusStarting }
+
+	for {
+		ready := check()
+
+		m.mu.Lock()
+		if !still() {
+			m.mu.Unlock()
+			return
+		}
+		if ready {
+			p.Status = StatusRunning
+			p.ready = true
+			processReadySeconds.WithLabelValues(p.ID).Observe(time.Since(*p.StartedAt).Seconds())
+			snapshot := *p
+			if m.OnStateChange != nil {
+				m.OnStateChange(snapshot)
+			}
+			m.mu.Unlock()
+			if m.OnReady != nil {
+				m.OnReady(snapshot)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			fmt.Printf("[ProcessManager] process %s not ready after %s, killing it\n", p.ID, p.readyTimeout)
+			p.notReady = true
+			p.cancel()
+			m.mu.Unlock()
+			return
+		}
+		m.mu.Unlock()
+		time.Sleep(readyPollInterval)
+	}
+}
+
+// scheduleRestart starts p again after its backoff if its restart policy
+// calls for it, or gives up after too many attempts. Must hold m.mu.
+func (m *ProcessManager) scheduleRestart(p *ManagedProcess) {
+	rp := p.restart
+	if m.stopping || rp.Mode == RestartNever || (rp.Mode == RestartOnFailure && p.Status != StatusCrashed) {
+		return
+	}
+
+	event := RestartEvent{ID: p.ID, Attempt: p.attempts + 1, ExitCode: p.LastExitCode}
+	if p.attempts >= rp.MaxRestarts {
+		event.Attempt, event.GaveUp = p.attempts, true
+		fmt.Printf("[ProcessManager] process %s: giving up after %d restarts\n", p.ID, p.attempts)
+	} else {
+		delay := rp.delay(p.attempts)
+		p.attempts++
+		due := time.Now().Add(delay)
+		p.NextRestart = &due
+		p.restartGen++
+		gen := p.restartGen
+		p.restartTimer = time.AfterFunc(delay, func() { m.autoRestart(p, gen) })
+		event.DelayMs = delay.Milliseconds()
+		fmt.Printf("[ProcessManager] process %s: restarting in %s (attempt %d)\n", p.ID, delay, p.attempts)
+	}
+	if m.OnRestart != nil {
+		m.OnRestart(event)
+	}
+}
+
+// autoRestart runs a scheduled restart, unless it was cancelled since.
+func (m *ProcessManager) autoRestart(p *ManagedProcess, gen int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.processes[p.ID] != p || p.restartGen != gen || p.active() || m.stopping {
+		return
+	}
+	p.restartTimer = nil
+	p.NextRestart = nil
+	if err := m.start(p); err != nil {
+		fmt.Printf("[ProcessManager] process %s: restart failed: %v\n", p.ID, err)
+		m.scheduleRestart(p)
+		if m.OnStateChange != nil {
+			m.OnStateChange(*p)
+		}
+	}
+}
+
+// Stop terminates a managed process, or cancels its pending automatic
+// restart.
 func (m *ProcessManager) Stop(id string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -227,7 +528,12 @@ func (m *ProcessManager) Stop(id string) error {
 		return fmt.Errorf("process with ID %s not found", id)
 	}
 
-	if p.Status != StatusRunning {
+	if p.restartTimer != nil {
+		p.cancelRestart()
+		p.Status = StatusStopped
+		return nil
+	}
+	if !p.active() {
 		return fmt.Errorf("process %s is not running", id)
 	}
 
@@ -245,6 +551,46 @@ func (m *ProcessManager) Stop(id string) error {
 	return nil
 }
 
+// Remove stops a managed process if it is running and forgets it.
+// Returns the removed process so callers can clean up its backend registration.
+func (m *ProcessManager) Remove(id string) (ManagedProcess, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, exists := m.processes[id]
+	if !exists {
+		return ManagedProcess{}, fmt.Errorf("process with ID %s not found", id)
+	}
+
+	if p.active() && p.cancel != nil {
+		p.cancel()
+	}
+	// Clearing cmd makes the monitor goroutine treat the exit as stale
+	p.cancelRestart()
+	p.cmd = nil
+	p.cancel = nil
+	delete(m.processes, id)
+	forgetProcessMetrics(id)
+
+	return *p, nil
+}
+
+// MarkReady records that the process listening on port passed its first
+// health check since it was started, observing the start-to-ready latency.
+// Later calls for the same run are ignored.
+func (m *ProcessManager) MarkReady(port int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, p := range m.processes {
+		if p.Port != port || p.Status != StatusRunning || p.ready || p.StartedAt == nil {
+			continue
+		}
+		p.ready = true
+		processReadySeconds.WithLabelValues(p.ID).Observe(time.Since(*p.StartedAt).Seconds())
+	}
+}
+
 // List returns a snapshot of all managed processes
 func (m *ProcessManager) List() []ManagedProcess {
 	m.mu.RLock()
@@ -272,13 +618,16 @@ func (m *ProcessManager) Logs(id string, lines int) ([]string, error) {
 	return p.output.Recent(lines), nil
 }
 
-// StopAll gracefully shuts down all running processes
+// StopAll gracefully shuts down all running processes, for good: none are
+// restarted automatically afterwards.
 func (m *ProcessManager) StopAll() {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	m.stopping = true
 	for _, p := range m.processes {
-		if p.Status == StatusRunning && p.cancel != nil {
+		p.cancelRestart()
+		if p.active() && p.cancel != nil {
 			p.cancel()
 		}
 	}
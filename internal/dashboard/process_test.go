@@ -0,0 +1,165 @@
+package dashboard
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestProcessManagerRestartsCrashedProcess(t *testing.T) {
+	m := NewProcessManager()
+	events := make(chan RestartEvent, 10)
+	m.OnRestart = func(e RestartEvent) { events <- e }
+	err := m.Add("flaky", "sh", []string{"-c", "exit 3"}, 0, ProcessOptions{
+		Restart: RestartPolicy{Mode: RestartOnFailure, MaxRestarts: 2, Backoff: 10 * time.Millisecond},
+	})
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if err := m.Start("flaky"); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	next := func() RestartEvent {
+		select {
+		case e := <-events:
+			return e
+		case <-time.After(2 * time.Second):
+			t.Fatal("Expected a restart event")
+			return RestartEvent{}
+		}
+	}
+	if e := next(); e.Attempt != 1 || e.DelayMs != 10 || e.GaveUp || e.ExitCode == nil || *e.ExitCode != 3 {
+		t.Errorf("Expected a first restart after 10ms, got %+v", e)
+	}
+	if e := next(); e.Attempt != 2 || e.DelayMs != 20 || e.GaveUp {
+		t.Errorf("Expected the backoff to double on the second restart, got %+v", e)
+	}
+	if e := next(); !e.GaveUp {
+		t.Errorf("Expected to give up after max restarts, got %+v", e)
+	}
+	if p := m.List()[0]; p.Status != StatusCrashed || p.Restarts != 2 || p.NextRestart != nil {
+		t.Errorf("Expected the process left crashed after 2 restarts, got %+v", p)
+	}
+}
+
+func TestProcessManagerStopCancelsPendingRestart(t *testing.T) {
+	m := NewProcessManager()
+	events := make(chan RestartEvent, 1)
+	m.OnRestart = func(e RestartEvent) { events <- e }
+	m.Add("flaky", "sh", []string{"-c", "exit 1"}, 0, ProcessOptions{
+		Restart: RestartPolicy{Mode: RestartAlways, Backoff: time.Hour},
+	})
+	m.Start("flaky")
+	select {
+	case <-events:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected a restart to be scheduled")
+	}
+
+	if p := m.List()[0]; p.NextRestart == nil {
+		t.Fatal("Expected a pending restart")
+	}
+	if err := m.Stop("flaky"); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if p := m.List()[0]; p.Status != StatusStopped || p.NextRestart != nil {
+		t.Errorf("Expected Stop to cancel the pending restart, got %+v", p)
+	}
+}
+
+func TestProcessManagerRejectsUnknownRestartPolicy(t *testing.T) {
+	m := NewProcessManager()
+	if err := m.Add("p", "true", nil, 0, ProcessOptions{Restart: RestartPolicy{Mode: "sometimes"}}); err == nil {
+		t.Error("Expected an unknown restart policy to be rejected")
+	}
+}
+
+func TestProcessManagerEnvAndDir(t *testing.T) {
+	t.Setenv("GATEWAY_GREETING", "hello")
+	dir := t.TempDir()
+	m := NewProcessManager()
+	err := m.Add("env", "sh", []string{"-c", `echo "$GREETING $LISTEN" > out.tmp && mv out.tmp out`}, 9123, ProcessOptions{
+		Env: map[string]string{
+			"GREETING": "${GATEWAY_GREETING}, world",
+			"LISTEN":   "$PROCESS_ID:$PORT",
+		},
+		Dir: dir,
+	})
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if err := m.Start("env"); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	// Written relative to the working directory
+	deadline := time.Now().Add(2 * time.Second)
+	out, err := os.ReadFile(filepath.Join(dir, "out"))
+	for err != nil && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		out, err = os.ReadFile(filepath.Join(dir, "out"))
+	}
+	if string(out) != "hello, world env:9123\n" {
+		t.Errorf("Expected the expanded env in the working directory, got %q (%v)", out, err)
+	}
+}
+
+func TestProcessManagerWaitsForReadiness(t *testing.T) {
+	// Reserve a free port, then release it so nothing listens yet
+	ln, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	m := NewProcessManager()
+	ready := make(chan ManagedProcess, 1)
+	m.OnReady = func(p ManagedProcess) { ready <- p }
+	m.Add("slow", "sleep", []string{"5"}, port, ProcessOptions{})
+	if err := m.Start("slow"); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer m.StopAll()
+
+	if p := m.List()[0]; p.Status != StatusStarting {
+		t.Fatalf("Expected the process to be starting until its port is up, got %s", p.Status)
+	}
+	ln, err = net.Listen("tcp", net.JoinHostPort("localhost", strconv.Itoa(port)))
+	if err != nil {
+		t.Skipf("port %d was taken in between: %v", port, err)
+	}
+	defer ln.Close()
+
+	select {
+	case p := <-ready:
+		if p.Status != StatusRunning {
+			t.Errorf("Expected the ready process to be running, got %s", p.Status)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the process to become ready once its port accepted connections")
+	}
+}
+
+func TestProcessManagerKillsProcessThatNeverGetsReady(t *testing.T) {
+	m := NewProcessManager()
+	m.Add("stuck", "sleep", []string{"5"}, 0, ProcessOptions{
+		ReadyURL:     "http://localhost:1/ready",
+		ReadyTimeout: 200 * time.Millisecond,
+	})
+	if err := m.Start("stuck"); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for m.List()[0].Status == StatusStarting && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if p := m.List()[0]; p.Status != StatusCrashed {
+		t.Errorf("Expected a process that never got ready to be crashed, got %s", p.Status)
+	}
+}
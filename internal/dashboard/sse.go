@@ -5,31 +5,71 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
 // Event represents a single Server-Sent Event payload
 type Event struct {
+	ID   uint64 `json:"id"` // increasing, assigned by the broker
 	Type string `json:"type"`
 	JSON []byte `json:"data"`
 }
 
+// DefaultBuffer is how many events the broker queues for broadcast, and
+// for each client on top of a replay, when no size is given.
+const DefaultBuffer = 256
+
+// replaySize is how many recent events the broker keeps for clients that
+// reconnect with Last-Event-ID.
+const replaySize = 256
+
 // Broker manages connected SSE clients and broadcasts events
 type Broker struct {
 	mu         sync.RWMutex
-	clients    map[chan Event]bool
+	clients    map[chan Event]map[string]bool // client → event types it wants, nil = all
 	broadcast  chan Event
-	register   chan chan Event
+	register   chan subscription
 	unregister chan chan Event
+	heartbeat  time.Duration // keep-alive interval on idle streams, see SetHeartbeat
+	buffer     int           // per-client channel size, before replay room
+
+	// Owned by the start goroutine
+	lastID uint64
+	recent []Event // the last replaySize events, oldest first
 }
 
-// NewBroker creates and starts a new SSE Broker
-func NewBroker() *Broker {
+// DefaultHeartbeat is how often idle SSE streams get a keep-alive comment.
+const DefaultHeartbeat = 15 * time.Second
+
+// subscription is a client registering with the broker.
+type subscription struct {
+	ch     chan Event
+	types  map[string]bool // nil = all
+	resume bool            // replay events after lastID
+	lastID uint64
+}
+
+// wants reports whether the subscriber receives events of type t.
+func (sub subscription) wants(t string) bool {
+	return sub.types == nil || sub.types[t]
+}
+
+// NewBroker creates and starts a new SSE Broker that queues up to buffer
+// events (DefaultBuffer if <= 0) before dropping them for a slow client.
+func NewBroker(buffer int) *Broker {
+	if buffer <= 0 {
+		buffer = DefaultBuffer
+	}
 	b := &Broker{
-		clients:    make(map[chan Event]bool),
-		broadcast:  make(chan Event, 256),
-		register:   make(chan chan Event),
+		clients:    make(map[chan Event]map[string]bool),
+		broadcast:  make(chan Event, buffer),
+		register:   make(chan subscription),
 		unregister: make(chan chan Event),
+		heartbeat:  DefaultHeartbeat,
+		buffer:     buffer,
 	}
 	go b.start()
 	return b
@@ -38,9 +78,19 @@ func NewBroker() *Broker {
 func (b *Broker) start() {
 	for {
 		select {
-		case ch := <-b.register:
+		case sub := <-b.register:
+			// Replay what a reconnecting client missed before it joins,
+			// so nothing is lost or repeated. An ID from before a restart
+			// can't be placed, so nothing is replayed for it.
+			if sub.resume && sub.lastID <= b.lastID {
+				for _, event := range b.recent {
+					if event.ID > sub.lastID && sub.wants(event.Type) {
+						sub.ch <- event
+					}
+				}
+			}
 			b.mu.Lock()
-			b.clients[ch] = true
+			b.clients[sub.ch] = sub.types
 			b.mu.Unlock()
 			log.Printf("SSE Broker: New client connected (total: %d)", len(b.clients))
 
@@ -54,8 +104,18 @@ func (b *Broker) start() {
 			b.mu.Unlock()
 
 		case event := <-b.broadcast:
+			b.lastID++
+			event.ID = b.lastID
+			if len(b.recent) == replaySize {
+				b.recent = append(b.recent[:0], b.recent[1:]...)
+			}
+			b.recent = append(b.recent, event)
+
 			b.mu.RLock()
-			for ch := range b.clients {
+			for ch, types := range b.clients {
+				if types != nil && !types[event.Type] {
+					continue
+				}
 				// Use non-blocking send to avoid slow clients blocking the broker
 				select {
 				case ch <- event:
@@ -68,11 +128,61 @@ func (b *Broker) start() {
 	}
 }
 
-// Subscribe adds a new client and returns a channel to listen for events
-func (b *Broker) Subscribe() chan Event {
-	ch := make(chan Event, 256)
-	b.register <- ch
-	return ch
+// SetHeartbeat sets how often a stream with no events gets a `: ping`
+// comment, so proxies and browsers don't drop it as idle. Must be called
+// before serving.
+func (b *Broker) SetHeartbeat(d time.Duration) {
+	if d > 0 {
+		b.heartbeat = d
+	}
+}
+
+// Subscribe adds a new client and returns a channel to listen for events.
+// Given event types, the client only receives those; otherwise it
+// receives every event.
+func (b *Broker) Subscribe(types ...string) chan Event {
+	return b.subscribe(b.newSubscription(types))
+}
+
+// Resume is Subscribe for a client reconnecting after the event with ID
+// lastID: the buffered events it missed are delivered first.
+func (b *Broker) Resume(lastID uint64, types ...string) chan Event {
+	sub := b.newSubscription(types)
+	sub.resume, sub.lastID = true, lastID
+	return b.subscribe(sub)
+}
+
+// newSubscription creates a subscription to the given event types (all
+// if none).
+func (b *Broker) newSubscription(types []string) subscription {
+	// Room for a full replay on top of the usual backlog
+	return subscription{ch: make(chan Event, b.buffer+replaySize), types: typeSet(types)}
+}
+
+// typeSet turns event types into a client filter; nil means all types.
+func typeSet(types []string) map[string]bool {
+	if len(types) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(types))
+	for _, t := range types {
+		set[t] = true
+	}
+	return set
+}
+
+func (b *Broker) subscribe(sub subscription) chan Event {
+	b.register <- sub
+	return sub.ch
+}
+
+// setTypes changes which event types a client receives (all if none).
+func (b *Broker) setTypes(ch chan Event, types []string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.clients[ch]; ok {
+		b.clients[ch] = typeSet(types)
+	}
 }
 
 // Unsubscribe removes a client
@@ -90,7 +200,9 @@ func (b *Broker) Broadcast(eventType string, payload interface{}) {
 	b.broadcast <- Event{Type: eventType, JSON: data}
 }
 
-// StreamHandler returns an HTTP handler for establishing SSE connections
+// StreamHandler returns an HTTP handler for establishing SSE connections.
+// ?events=metrics,process limits the stream to those event types, so a
+// lightweight widget needn't receive every request log.
 func (b *Broker) StreamHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Set headers for Server-Sent Events
@@ -106,13 +218,29 @@ func (b *Broker) StreamHandler() http.HandlerFunc {
 			return
 		}
 
-		ch := b.Subscribe()
+		var types []string
+		for _, t := range strings.Split(r.URL.Query().Get("events"), ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				types = append(types, t)
+			}
+		}
+		// EventSource sends the last ID it saw when reconnecting
+		var ch chan Event
+		if lastID, err := strconv.ParseUint(r.Header.Get("Last-Event-ID"), 10, 64); err == nil {
+			ch = b.Resume(lastID, types...)
+		} else {
+			ch = b.Subscribe(types...)
+		}
 		defer b.Unsubscribe(ch)
 
 		// Send initial connection event (optional, helps React hook know it's connected)
 		fmt.Fprintf(w, "event: connected\ndata: {}\n\n")
 		flusher.Flush()
 
+		// Keep-alives only go out on streams that have been quiet
+		heartbeat := time.NewTicker(b.heartbeat)
+		defer heartbeat.Stop()
+
 		// Listen for connection close or new events
 		for {
 			select {
@@ -121,7 +249,11 @@ func (b *Broker) StreamHandler() http.HandlerFunc {
 				return
 			case event := <-ch:
 				// Write the event format exactly as standard demands
-				fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, event.JSON)
+				fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, event.JSON)
+				flusher.Flush()
+				heartbeat.Reset(b.heartbeat)
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": ping\n\n")
 				flusher.Flush()
 			}
 		}
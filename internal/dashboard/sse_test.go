@@ -0,0 +1,91 @@
+package dashboard
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBrokerFiltersEventTypes(t *testing.T) {
+	b := NewBroker(0)
+	all := b.Subscribe()
+	metricsOnly := b.Subscribe("metrics")
+	defer b.Unsubscribe(all)
+	defer b.Unsubscribe(metricsOnly)
+
+	b.Broadcast("request", map[string]string{"id": "1"})
+	b.Broadcast("metrics", map[string]int{"requests_per_minute": 3})
+
+	next := func(ch chan Event) string {
+		select {
+		case e := <-ch:
+			return e.Type
+		case <-time.After(time.Second):
+			return ""
+		}
+	}
+	if got := next(all); got != "request" {
+		t.Errorf("Expected the unfiltered client to get the request event, got %q", got)
+	}
+	if got := next(all); got != "metrics" {
+		t.Errorf("Expected the unfiltered client to get the metrics event, got %q", got)
+	}
+	if got := next(metricsOnly); got != "metrics" {
+		t.Errorf("Expected the filtered client to skip straight to metrics, got %q", got)
+	}
+}
+
+func TestStreamSendsHeartbeats(t *testing.T) {
+	b := NewBroker(0)
+	b.SetHeartbeat(10 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	rec := httptest.NewRecorder()
+	b.StreamHandler()(rec, httptest.NewRequest(http.MethodGet, "/stream", nil).WithContext(ctx))
+
+	if !strings.Contains(rec.Body.String(), ": ping\n\n") {
+		t.Errorf("Expected keep-alive comments on an idle stream, got %q", rec.Body.String())
+	}
+}
+
+func TestBrokerReplaysMissedEvents(t *testing.T) {
+	b := NewBroker(0)
+	first := b.Subscribe()
+	for i := 0; i < 3; i++ {
+		b.Broadcast("request", i)
+	}
+	var seen uint64
+	for i := 0; i < 3; i++ {
+		select {
+		case e := <-first:
+			if e.ID <= seen {
+				t.Fatalf("Expected increasing event IDs, got %d after %d", e.ID, seen)
+			}
+			seen = e.ID
+		case <-time.After(time.Second):
+			t.Fatal("Timed out waiting for events")
+		}
+	}
+	b.Unsubscribe(first)
+
+	// Reconnect after the first event: the other two come back first
+	resumed := b.Resume(seen - 2)
+	defer b.Unsubscribe(resumed)
+	b.Broadcast("metrics", nil)
+	var got []string
+	for i := 0; i < 3; i++ {
+		select {
+		case e := <-resumed:
+			got = append(got, e.Type+":"+string(e.JSON))
+		case <-time.After(time.Second):
+			t.Fatal("Timed out waiting for replay")
+		}
+	}
+	if want := "request:1,request:2,metrics:null"; strings.Join(got, ",") != want {
+		t.Errorf("Expected %s, got %s", want, strings.Join(got, ","))
+	}
+}
@@ -1,6 +1,9 @@
 package dashboard
 
 import (
+	"fmt"
+	"math"
+	"slices"
 	"sync"
 	"time"
 )
@@ -18,6 +21,8 @@ type RequestLog struct {
 	BytesOut  int64         `json:"bytes_out"`
 	Backend   string        `json:"backend"`
 	Error     string        `json:"error,omitempty"`
+	Country   string        `json:"country,omitempty"` // ISO code, when GeoIP is configured
+	ASN       uint32        `json:"asn,omitempty"`
 }
 
 // LogStore is a thread-safe ring buffer for storing recent request logs
@@ -28,6 +33,11 @@ type LogStore struct {
 	index int
 	count int
 
+	sparklineBucket time.Duration // width of each sparkline point (default 1m)
+
+	geoLookup func(ip string) (country string, asn uint32) // optional, set via SetGeoIP
+	file      *LogFile                                     // optional, set via SetLogFile
+
 	// OnAdd is an optional hook to fire when a new log is received
 	OnAdd func(log RequestLog)
 }
@@ -38,20 +48,53 @@ func NewLogStore(capacity int) *LogStore {
 		capacity = 1000 // default capacity
 	}
 	return &LogStore{
-		logs: make([]RequestLog, capacity),
-		size: capacity,
+		logs:            make([]RequestLog, capacity),
+		size:            capacity,
+		sparklineBucket: time.Minute,
 	}
 }
 
+// SetSparklineBucket sets the width of each sparkline point, normally the
+// analytics bucket_interval so the dashboard and analytics agree.
+func (s *LogStore) SetSparklineBucket(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	s.mu.Lock()
+	s.sparklineBucket = d
+	s.mu.Unlock()
+}
+
+// SetGeoIP tags logs added from now on with their client's country and
+// ASN. Must be called before serving.
+func (s *LogStore) SetGeoIP(lookup func(ip string) (country string, asn uint32)) {
+	s.geoLookup = lookup
+}
+
+// SetLogFile restores the newest logs in f into the ring buffer and
+// persists logs added from now on to it. Must be called before serving.
+func (s *LogStore) SetLogFile(f *LogFile) error {
+	logs, err := f.Recent(s.size)
+	if err != nil {
+		return err
+	}
+	for _, log := range logs {
+		s.insert(log)
+	}
+	s.file = f
+	return nil
+}
+
 // Add inserts a new request log into the ring buffer
 func (s *LogStore) Add(log RequestLog) {
-	s.mu.Lock()
-	s.logs[s.index] = log
-	s.index = (s.index + 1) % s.size
-	if s.count < s.size {
-		s.count++
+	if s.geoLookup != nil && log.Country == "" {
+		log.Country, log.ASN = s.geoLookup(log.ClientIP)
+	}
+
+	s.insert(log)
+	if s.file != nil {
+		s.file.append(log)
 	}
-	s.mu.Unlock()
 
 	// Fire event hook outside the lock
 	if s.OnAdd != nil {
@@ -59,6 +102,17 @@ func (s *LogStore) Add(log RequestLog) {
 	}
 }
 
+// insert writes a log into the ring buffer, evicting the oldest when full.
+func (s *LogStore) insert(log RequestLog) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logs[s.index] = log
+	s.index = (s.index + 1) % s.size
+	if s.count < s.size {
+		s.count++
+	}
+}
+
 // Recent returns the n most recent request logs, ordered newest to oldest
 func (s *LogStore) Recent(n int) []RequestLog {
 	s.mu.RLock()
@@ -114,8 +168,14 @@ func (s *LogStore) GetByID(id string) (RequestLog, bool) {
 	return RequestLog{}, false
 }
 
-// Search filters logs based on criteria, returning up to limit results
+// Search filters logs by status and path substring, returning up to
+// limit results
 func (s *LogStore) Search(limit int, status int, path string) []RequestLog {
+	return s.Query(LogFilter{Status: status, Path: path}, limit)
+}
+
+// Query returns up to limit logs matching f, newest first
+func (s *LogStore) Query(f LogFilter, limit int) []RequestLog {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
@@ -136,56 +196,150 @@ func (s *LogStore) Search(limit int, status int, path string) []RequestLog {
 			idx += s.size
 		}
 
-		log := s.logs[idx]
+		if log := s.logs[idx]; f.Matches(log) {
+			result = append(result, log)
+		}
+	}
 
-		// Apply filters
-		if status > 0 && log.Status != status {
-			continue
+	return result
+}
+
+// LogCursor pages through logs relative to a log ID or an RFC 3339 time.
+// Before selects older logs, After newer ones; both may be set.
+type LogCursor struct {
+	Before string
+	After  string
+}
+
+// cursorBound is a resolved cursor: a ring position (0 = newest), or a
+// time when the cursor isn't a logged ID.
+type cursorBound struct {
+	set bool
+	pos int
+	ts  time.Time
+}
+
+// resolveCursor finds the position of the log with ID c, or parses c as
+// a time. Must hold s.mu.
+func (s *LogStore) resolveCursor(c string) (cursorBound, error) {
+	if c == "" {
+		return cursorBound{}, nil
+	}
+	for i := 0; i < s.count; i++ {
+		if s.logs[s.ringIndex(i)].ID == c {
+			return cursorBound{set: true, pos: i}, nil
 		}
+	}
+	ts, err := time.Parse(time.RFC3339Nano, c)
+	if err != nil {
+		return cursorBound{}, fmt.Errorf("cursor %q is neither a buffered log ID nor an RFC 3339 time", c)
+	}
+	return cursorBound{set: true, pos: -1, ts: ts}, nil
+}
 
-		if path != "" && log.Path != path && !containsString(log.Path, path) {
-			continue
+// ringIndex maps a position (0 = newest) to its slot in s.logs.
+func (s *LogStore) ringIndex(i int) int {
+	idx := s.index - 1 - i
+	if idx < 0 {
+		idx += s.size
+	}
+	return idx
+}
+
+// Page returns up to limit logs matching f, newest first, that lie past
+// the cursor, and whether more matching logs lie beyond the page. With
+// only After set, the page is the logs just after it; otherwise it is the
+// newest ones before Before. Pass the last log's ID as Before to get the
+// next older page, or the first one's as After for the next newer one.
+func (s *LogStore) Page(f LogFilter, limit int, c LogCursor) ([]RequestLog, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if limit <= 0 {
+		limit = 50
+	}
+	before, err := s.resolveCursor(c.Before)
+	if err != nil {
+		return nil, false, err
+	}
+	after, err := s.resolveCursor(c.After)
+	if err != nil {
+		return nil, false, err
+	}
+	inRange := func(i int, log RequestLog) bool {
+		if before.set && (before.pos >= 0 && i <= before.pos || before.pos < 0 && !log.Timestamp.Before(before.ts)) {
+			return false
 		}
+		if after.set && (after.pos >= 0 && i >= after.pos || after.pos < 0 && !log.Timestamp.After(after.ts)) {
+			return false
+		}
+		return true
+	}
 
+	// Walk away from the cursor the page is anchored to
+	oldestFirst := after.set && !before.set
+	result := make([]RequestLog, 0, limit)
+	for n := 0; n < s.count; n++ {
+		i := n
+		if oldestFirst {
+			i = s.count - 1 - n
+		}
+		log := s.logs[s.ringIndex(i)]
+		if !inRange(i, log) || !f.Matches(log) {
+			continue
+		}
+		if len(result) == limit {
+			if oldestFirst {
+				slices.Reverse(result)
+			}
+			return result, true, nil
+		}
 		result = append(result, log)
 	}
-
-	return result
+	if oldestFirst {
+		slices.Reverse(result)
+	}
+	return result, false, nil
 }
 
 // SparklineData holds 30 time-bucketed data points for charting
 type SparklineData struct {
-	Requests []float64 `json:"requests"`
-	Latency  []float64 `json:"latency"`
-	Errors   []float64 `json:"errors"`
+	Requests      []float64 `json:"requests"`
+	Latency       []float64 `json:"latency"`
+	Errors        []float64 `json:"errors"`
+	BucketSeconds float64   `json:"bucket_seconds"` // width of each point
 }
 
 // MetricsSnapshot holds computed gateway metrics
 type MetricsSnapshot struct {
 	RequestsPerMinute int           `json:"requests_per_minute"`
 	AvgLatencyMs      int           `json:"avg_latency_ms"`
+	P95LatencyMs      int           `json:"p95_latency_ms"`
+	P99LatencyMs      int           `json:"p99_latency_ms"`
 	ErrorRate         float64       `json:"error_rate"`
 	Sparklines        SparklineData `json:"sparklines"`
 }
 
 // Metrics computes real-time metrics from the log store.
-// RPM, avg latency, and error rate are computed from the last 60 seconds.
-// Sparklines are 30 one-minute buckets covering the last 30 minutes.
+// RPM, avg/p95/p99 latency, and error rate are computed from the last 60 seconds.
+// Sparklines are 30 buckets of sparklineBucket width (30 minutes by default).
 func (s *LogStore) Metrics() MetricsSnapshot {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	now := time.Now()
 	oneMinuteAgo := now.Add(-60 * time.Second)
-	thirtyMinutesAgo := now.Add(-30 * time.Minute)
+	// Sparkline buckets: 30 windows of sparklineBucket each
+	const bucketCount = 30
+	sparkWindow := time.Duration(bucketCount) * s.sparklineBucket
+	sparkStart := now.Add(-sparkWindow)
 
 	// Summary stats for last 60 seconds
 	var recentCount int
 	var recentErrors int
 	var recentLatencySum time.Duration
+	var recentLatencies []time.Duration
 
-	// Sparkline buckets: 30 one-minute windows
-	const bucketCount = 30
 	bucketRequests := make([]float64, bucketCount)
 	bucketLatencySum := make([]float64, bucketCount)
 	bucketLatencyCount := make([]int, bucketCount)
@@ -213,15 +367,16 @@ func (s *LogStore) Metrics() MetricsSnapshot {
 		if log.Timestamp.After(oneMinuteAgo) {
 			recentCount++
 			recentLatencySum += log.Latency
+			recentLatencies = append(recentLatencies, log.Latency)
 			if log.Status >= 500 {
 				recentErrors++
 			}
 		}
 
-		// Sparklines: last 30 minutes
-		if log.Timestamp.After(thirtyMinutesAgo) {
+		// Sparklines: last bucketCount buckets
+		if log.Timestamp.After(sparkStart) {
 			elapsed := now.Sub(log.Timestamp)
-			bucket := int(elapsed.Minutes())
+			bucket := int(elapsed / s.sparklineBucket)
 			if bucket >= bucketCount {
 				bucket = bucketCount - 1
 			}
@@ -244,6 +399,10 @@ func (s *LogStore) Metrics() MetricsSnapshot {
 	if recentCount > 0 {
 		snap.AvgLatencyMs = int(recentLatencySum.Milliseconds()) / recentCount
 		snap.ErrorRate = float64(recentErrors) / float64(recentCount)
+
+		slices.Sort(recentLatencies)
+		snap.P95LatencyMs = int(latencyPercentile(recentLatencies, 0.95).Milliseconds())
+		snap.P99LatencyMs = int(latencyPercentile(recentLatencies, 0.99).Milliseconds())
 	}
 
 	// Compute sparkline averages for latency
@@ -255,22 +414,45 @@ func (s *LogStore) Metrics() MetricsSnapshot {
 	}
 
 	snap.Sparklines = SparklineData{
-		Requests: bucketRequests,
-		Latency:  sparkLatency,
-		Errors:   bucketErrors,
+		Requests:      bucketRequests,
+		Latency:       sparkLatency,
+		Errors:        bucketErrors,
+		BucketSeconds: s.sparklineBucket.Seconds(),
 	}
 
 	return snap
 }
 
-func containsString(s, substr string) bool {
-	// Basic substring check for the path filter
-	return len(s) >= len(substr) && func() bool {
-		for i := 0; i <= len(s)-len(substr); i++ {
-			if s[i:i+len(substr)] == substr {
-				return true
-			}
+// latencyPercentile returns the nearest-rank p-th percentile (0 < p <= 1)
+// of sorted, which must not be empty.
+func latencyPercentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	return sorted[max(rank, 0)]
+}
+
+// BackendTraffic counts a backend's logged requests over a window.
+type BackendTraffic struct {
+	Requests int
+	Errors   int // 5xx responses
+}
+
+// BackendTraffic tallies logged requests per backend since the given time.
+func (s *LogStore) BackendTraffic(since time.Time) map[string]BackendTraffic {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make(map[string]BackendTraffic)
+	for i := 0; i < s.count; i++ {
+		log := s.logs[i]
+		if log.Backend == "" || log.Timestamp.Before(since) {
+			continue
 		}
-		return false
-	}()
+		t := out[log.Backend]
+		t.Requests++
+		if log.Status >= 500 {
+			t.Errors++
+		}
+		out[log.Backend] = t
+	}
+	return out
 }
@@ -1,7 +1,9 @@
 package dashboard
 
 import (
+	"net/url"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
@@ -88,3 +90,115 @@ func TestLogStoreSearchAndGet(t *testing.T) {
 		t.Errorf("Expected limit 5 to be respected, got %d", len(results))
 	}
 }
+
+func TestLogStoreBackendTraffic(t *testing.T) {
+	store := NewLogStore(10)
+	now := time.Now()
+
+	store.Add(RequestLog{ID: "1", Timestamp: now.Add(-time.Hour), Status: 500, Backend: "http://localhost:9001"})
+	store.Add(RequestLog{ID: "2", Timestamp: now, Status: 200, Backend: "http://localhost:9001"})
+	store.Add(RequestLog{ID: "3", Timestamp: now, Status: 502, Backend: "http://localhost:9001"})
+	store.Add(RequestLog{ID: "4", Timestamp: now, Status: 200, Backend: "http://localhost:9002"})
+	store.Add(RequestLog{ID: "5", Timestamp: now, Status: 429})
+
+	traffic := store.BackendTraffic(now.Add(-time.Minute))
+	if len(traffic) != 2 {
+		t.Fatalf("Expected 2 backends, got %v", traffic)
+	}
+	if got := traffic["http://localhost:9001"]; got.Requests != 2 || got.Errors != 1 {
+		t.Errorf("Expected 2 requests and 1 error for 9001, got %+v", got)
+	}
+	if got := traffic["http://localhost:9002"]; got.Requests != 1 || got.Errors != 0 {
+		t.Errorf("Expected 1 request and no errors for 9002, got %+v", got)
+	}
+}
+
+func TestLogStoreQueryCombinesFilters(t *testing.T) {
+	store := NewLogStore(10)
+	now := time.Now()
+
+	store.Add(RequestLog{ID: "1", Timestamp: now.Add(-time.Hour), Method: "POST", Status: 503, ClientIP: "203.0.113.9", Latency: time.Second})
+	store.Add(RequestLog{ID: "2", Timestamp: now, Method: "POST", Status: 502, ClientIP: "203.0.113.9", Latency: time.Second})
+	store.Add(RequestLog{ID: "3", Timestamp: now, Method: "POST", Status: 502, ClientIP: "203.0.113.9", Latency: 10 * time.Millisecond})
+	store.Add(RequestLog{ID: "4", Timestamp: now, Method: "GET", Status: 500, ClientIP: "203.0.113.9", Latency: time.Second})
+	store.Add(RequestLog{ID: "5", Timestamp: now, Method: "POST", Status: 404, ClientIP: "203.0.113.9", Latency: time.Second})
+
+	filter, err := parseLogFilter(url.Values{
+		"method":      {"post"},
+		"status":      {"5xx"},
+		"client_ip":   {"203.0.113.9"},
+		"from":        {now.Add(-time.Minute).Format(time.RFC3339)},
+		"min_latency": {"500ms"},
+	})
+	if err != nil {
+		t.Fatalf("parseLogFilter: %v", err)
+	}
+	results := store.Query(filter, 10)
+	if len(results) != 1 || results[0].ID != "2" {
+		t.Errorf("Expected only log 2 to match every filter, got %+v", results)
+	}
+
+	if _, err := parseLogFilter(url.Values{"status": {"9xx"}}); err == nil {
+		t.Error("Expected an invalid status class to be rejected")
+	}
+}
+
+func TestLogStorePage(t *testing.T) {
+	store := NewLogStore(10)
+	start := time.Now()
+	for i := 1; i <= 7; i++ {
+		store.Add(RequestLog{ID: strconv.Itoa(i), Timestamp: start.Add(time.Duration(i) * time.Second)})
+	}
+	ids := func(logs []RequestLog) string {
+		var out []string
+		for _, l := range logs {
+			out = append(out, l.ID)
+		}
+		return strings.Join(out, ",")
+	}
+
+	tests := []struct {
+		cursor   LogCursor
+		want     string
+		wantMore bool
+	}{
+		{LogCursor{}, "7,6,5", true},
+		{LogCursor{Before: "5"}, "4,3,2", true},
+		{LogCursor{Before: "2"}, "1", false},
+		{LogCursor{After: "1"}, "4,3,2", true},
+		{LogCursor{After: "4"}, "7,6,5", false},
+		{LogCursor{After: "2", Before: "5"}, "4,3", false},
+		{LogCursor{Before: start.Add(3 * time.Second).Format(time.RFC3339Nano)}, "2,1", false},
+	}
+	for _, tt := range tests {
+		logs, more, err := store.Page(LogFilter{}, 3, tt.cursor)
+		if err != nil {
+			t.Fatalf("%+v: %v", tt.cursor, err)
+		}
+		if got := ids(logs); got != tt.want || more != tt.wantMore {
+			t.Errorf("%+v: expected %s (more %v), got %s (more %v)", tt.cursor, tt.want, tt.wantMore, got, more)
+		}
+	}
+
+	if _, _, err := store.Page(LogFilter{}, 3, LogCursor{Before: "evicted"}); err == nil {
+		t.Error("Expected an unknown cursor to be rejected")
+	}
+}
+
+func TestLogStoreMetricsLatencyPercentiles(t *testing.T) {
+	store := NewLogStore(200)
+	now := time.Now()
+	// 1ms..100ms, plus an old slow request outside the last minute
+	for i := 1; i <= 100; i++ {
+		store.Add(RequestLog{ID: strconv.Itoa(i), Timestamp: now, Status: 200, Latency: time.Duration(i) * time.Millisecond})
+	}
+	store.Add(RequestLog{ID: "old", Timestamp: now.Add(-2 * time.Minute), Status: 200, Latency: time.Second})
+
+	snap := store.Metrics()
+	if snap.P95LatencyMs != 95 || snap.P99LatencyMs != 99 {
+		t.Errorf("Expected p95 95ms and p99 99ms, got %d and %d", snap.P95LatencyMs, snap.P99LatencyMs)
+	}
+	if snap.AvgLatencyMs != 50 {
+		t.Errorf("Expected the average to stay 50ms, got %d", snap.AvgLatencyMs)
+	}
+}
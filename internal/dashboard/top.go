@@ -0,0 +1,117 @@
+package dashboard
+
+import (
+	"cmp"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/tanmay/gateway/internal/analytics"
+)
+
+// RouteTraffic summarizes a route's traffic over the /top window.
+type RouteTraffic struct {
+	Route        string  `json:"route"`
+	Requests     int     `json:"requests"`
+	ErrorRate    float64 `json:"error_rate"`
+	P95LatencyMs float64 `json:"p95_latency_ms"`
+}
+
+// SetTrafficStore lets /top rank routes from the analytics traffic store.
+func (api *API) SetTrafficStore(store analytics.TrafficStore) {
+	api.traffic = store
+}
+
+// topRoutes totals each route's buckets within [from, to).
+func topRoutes(store analytics.TrafficStore, from, to time.Time) []RouteTraffic {
+	var routes []RouteTraffic
+	for route, buckets := range store.GetAllBuckets(from, to) {
+		var requests, errors int
+		var latency analytics.LatencyHistogram
+		for _, b := range buckets {
+			requests += b.RequestCount
+			errors += b.ErrorCount
+			latency.Merge(b.Latency)
+		}
+		if requests == 0 {
+			continue
+		}
+		routes = append(routes, RouteTraffic{
+			Route:        route,
+			Requests:     requests,
+			ErrorRate:    float64(errors) / float64(requests),
+			P95LatencyMs: latency.QuantileMs(0.95),
+		})
+	}
+	return routes
+}
+
+// rankRoutes returns up to limit routes ordered by key, highest first,
+// skipping those where it is zero.
+func rankRoutes[T cmp.Ordered](routes []RouteTraffic, limit int, key func(RouteTraffic) T) []RouteTraffic {
+	var zero T
+	ranked := make([]RouteTraffic, 0, len(routes))
+	for _, rt := range routes {
+		if key(rt) != zero {
+			ranked = append(ranked, rt)
+		}
+	}
+	slices.SortFunc(ranked, func(a, b RouteTraffic) int {
+		if c := cmp.Compare(key(b), key(a)); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Route, b.Route)
+	})
+	if len(ranked) > limit {
+		ranked = ranked[:limit]
+	}
+	return ranked
+}
+
+// handleTop handles GET /top?window=1h&limit=10: the busiest routes, the
+// slowest by p95 latency, and those with the highest error rate.
+func (api *API) handleTop(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if api.traffic == nil {
+		http.Error(w, "Traffic analytics not enabled", http.StatusNotFound)
+		return
+	}
+
+	q := r.URL.Query()
+	window := time.Hour
+	if v := q.Get("window"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			http.Error(w, "invalid window: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		window = d
+	}
+	if err := analytics.ValidateWindow(window, api.traffic.BucketSize()); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit := 10
+	if l := q.Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 {
+			limit = parsed
+		}
+	}
+
+	// Whole buckets, up to and including the current one
+	to := time.Now().Truncate(api.traffic.BucketSize()).Add(api.traffic.BucketSize())
+	routes := topRoutes(api.traffic, to.Add(-window), to)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"window":      window.String(),
+		"busiest":     rankRoutes(routes, limit, func(rt RouteTraffic) int { return rt.Requests }),
+		"slowest":     rankRoutes(routes, limit, func(rt RouteTraffic) float64 { return rt.P95LatencyMs }),
+		"most_errors": rankRoutes(routes, limit, func(rt RouteTraffic) float64 { return rt.ErrorRate }),
+	})
+}
@@ -0,0 +1,55 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/tanmay/gateway/internal/analytics"
+)
+
+func TestTopRanksRoutes(t *testing.T) {
+	store := analytics.NewMemoryTrafficStore(time.Hour, time.Minute)
+	now := time.Now()
+	record := func(route string, n, status int, latency time.Duration) {
+		for i := 0; i < n; i++ {
+			store.Record(analytics.TrafficEvent{Route: route, Status: status, Latency: latency, Timestamp: now})
+		}
+	}
+	record("/api/busy", 50, 200, 10*time.Millisecond)
+	record("/api/slow", 5, 200, 800*time.Millisecond)
+	record("/api/flaky", 10, 200, 20*time.Millisecond)
+	record("/api/flaky", 10, 503, 20*time.Millisecond)
+
+	api := &API{}
+	api.SetTrafficStore(store)
+	rec := httptest.NewRecorder()
+	api.handleTop(rec, httptest.NewRequest(http.MethodGet, "/top?window=1h&limit=2", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var top struct {
+		Busiest    []RouteTraffic `json:"busiest"`
+		Slowest    []RouteTraffic `json:"slowest"`
+		MostErrors []RouteTraffic `json:"most_errors"`
+	}
+	json.NewDecoder(rec.Body).Decode(&top)
+	if len(top.Busiest) != 2 || top.Busiest[0].Route != "/api/busy" || top.Busiest[1].Route != "/api/flaky" {
+		t.Errorf("Expected busy then flaky as the busiest routes, got %+v", top.Busiest)
+	}
+	if len(top.Slowest) == 0 || top.Slowest[0].Route != "/api/slow" {
+		t.Errorf("Expected the slow route first by p95, got %+v", top.Slowest)
+	}
+	if len(top.MostErrors) != 1 || top.MostErrors[0].Route != "/api/flaky" || top.MostErrors[0].ErrorRate != 0.5 {
+		t.Errorf("Expected only the flaky route, at a 50%% error rate, got %+v", top.MostErrors)
+	}
+
+	rec = httptest.NewRecorder()
+	api.handleTop(rec, httptest.NewRequest(http.MethodGet, "/top?window=90s", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a window that isn't whole buckets, got %d", rec.Code)
+	}
+}
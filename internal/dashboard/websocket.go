@@ -0,0 +1,285 @@
+package dashboard
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The WebSocket feed is for environments where intermediaries buffer or
+// break SSE. Only what it needs of RFC 6455 is implemented: unfragmented
+// text messages, ping/pong, and close.
+
+// wsGUID is appended to the client's key to derive Sec-WebSocket-Accept.
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// wsMaxMessage bounds client messages, which are only subscriptions.
+const wsMaxMessage = 4096
+
+// WebSocket opcodes.
+const (
+	wsText  = 0x1
+	wsClose = 0x8
+	wsPing  = 0x9
+	wsPong  = 0xA
+)
+
+// wsMessage is an event as sent over the WebSocket feed.
+type wsMessage struct {
+	ID   uint64          `json:"id"`
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// wsSubscribe is a client message choosing which event types to receive;
+// an empty list means all of them.
+type wsSubscribe struct {
+	Subscribe []string `json:"subscribe"`
+}
+
+// wsConn is a server-side WebSocket connection. Writes may come from the
+// event loop and the reader (pongs), so they are serialized.
+type wsConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	mu   sync.Mutex
+}
+
+// wsAccept completes the opening handshake, taking over the connection.
+func wsAccept(w http.ResponseWriter, r *http.Request) (*wsConn, error) {
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") ||
+		!headerContainsToken(r.Header.Get("Connection"), "upgrade") {
+		http.Error(w, "Expected a WebSocket upgrade", http.StatusBadRequest)
+		return nil, errors.New("not a WebSocket upgrade")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "Unsupported WebSocket version", http.StatusUpgradeRequired)
+		return nil, errors.New("unsupported WebSocket version")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		http.Error(w, "Missing Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, errors.New("missing Sec-WebSocket-Key")
+	}
+	// Browsers let any site open a WebSocket, cookies and all
+	if origin := r.Header.Get("Origin"); origin != "" {
+		if u, err := url.Parse(origin); err != nil || u.Host != r.Host {
+			http.Error(w, "Cross-origin WebSocket not allowed", http.StatusForbidden)
+			return nil, errors.New("cross-origin WebSocket")
+		}
+	}
+
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, "WebSocket unsupported", http.StatusInternalServerError)
+		return nil, err
+	}
+	sum := sha1.Sum([]byte(key + wsGUID))
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n\r\n")
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &wsConn{conn: conn, r: rw.Reader}, nil
+}
+
+// headerContainsToken reports whether a comma-separated header has token.
+func headerContainsToken(header, token string) bool {
+	for _, t := range strings.Split(header, ",") {
+		if strings.EqualFold(strings.TrimSpace(t), token) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeFrame sends one unmasked, unfragmented frame.
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	hdr := make([]byte, 2, 10)
+	hdr[0] = 0x80 | opcode
+	switch n := len(payload); {
+	case n <= 125:
+		hdr[1] = byte(n)
+	case n <= 0xFFFF:
+		hdr[1] = 126
+		hdr = binary.BigEndian.AppendUint16(hdr, uint16(n))
+	default:
+		hdr[1] = 127
+		hdr = binary.BigEndian.AppendUint64(hdr, uint64(n))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	if _, err := c.conn.Write(hdr); err != nil {
+		return err
+	}
+	_, err := c.conn.Write(payload)
+	return err
+}
+
+// readFrame reads one client frame, unmasking its payload.
+func (c *wsConn) readFrame() (opcode byte, payload []byte, err error) {
+	var hdr [2]byte
+	if _, err := io.ReadFull(c.r, hdr[:]); err != nil {
+		return 0, nil, err
+	}
+	if hdr[0]&0x80 == 0 {
+		return 0, nil, errors.New("fragmented messages are not supported")
+	}
+	if hdr[1]&0x80 == 0 {
+		return 0, nil, errors.New("client frames must be masked")
+	}
+	n := uint64(hdr[1] & 0x7F)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if n > wsMaxMessage {
+		return 0, nil, errors.New("message too large")
+	}
+	var mask [4]byte
+	if _, err := io.ReadFull(c.r, mask[:]); err != nil {
+		return 0, nil, err
+	}
+	payload = make([]byte, n)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return hdr[0] & 0x0F, payload, nil
+}
+
+// WebSocketHandler serves the same event feed as StreamHandler over a
+// WebSocket. Each event is a text message {"id", "type", "data"}. Clients
+// choose event types by sending {"subscribe": ["metrics", "process"]}
+// (an empty list for all), or up front with ?events=; ?last_event_id=
+// replays missed events like Last-Event-ID does for SSE.
+func (b *Broker) WebSocketHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var types []string
+		for _, t := range strings.Split(r.URL.Query().Get("events"), ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				types = append(types, t)
+			}
+		}
+		var lastID uint64
+		v := r.URL.Query().Get("last_event_id")
+		resume := v != ""
+		if resume {
+			id, err := strconv.ParseUint(v, 10, 64)
+			if err != nil {
+				http.Error(w, "invalid last_event_id", http.StatusBadRequest)
+				return
+			}
+			lastID = id
+		}
+
+		c, err := wsAccept(w, r)
+		if err != nil {
+			return
+		}
+		defer c.conn.Close()
+
+		// The reader handles control frames and hands subscriptions over.
+		// closed tells the handler the client is gone; done tells the
+		// reader the handler is, so a pending handover can't block it.
+		subscriptions := make(chan []string)
+		closed := make(chan struct{})
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			defer close(closed)
+			for {
+				opcode, payload, err := c.readFrame()
+				if err != nil {
+					return
+				}
+				switch opcode {
+				case wsPing:
+					c.writeFrame(wsPong, payload)
+				case wsClose:
+					c.writeFrame(wsClose, nil)
+					return
+				case wsText:
+					var msg wsSubscribe
+					if err := json.Unmarshal(payload, &msg); err != nil {
+						log.Printf("WebSocket: ignoring message: %v", err)
+						continue
+					}
+					select {
+					case subscriptions <- msg.Subscribe:
+					case <-done:
+						return
+					}
+				}
+			}
+		}()
+
+		var ch chan Event
+		if resume {
+			ch = b.Resume(lastID, types...)
+		} else {
+			ch = b.Subscribe(types...)
+		}
+		defer b.Unsubscribe(ch)
+		filter := typeSet(types)
+
+		heartbeat := time.NewTicker(b.heartbeat)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case <-closed:
+				return
+			case types := <-subscriptions:
+				b.setTypes(ch, types)
+				filter = typeSet(types)
+			case event, ok := <-ch:
+				if !ok {
+					return
+				}
+				// Skip events queued before the subscription changed
+				if filter != nil && !filter[event.Type] {
+					continue
+				}
+				msg, _ := json.Marshal(wsMessage{ID: event.ID, Type: event.Type, Data: event.JSON})
+				if err := c.writeFrame(wsText, msg); err != nil {
+					return
+				}
+				heartbeat.Reset(b.heartbeat)
+			case <-heartbeat.C:
+				if err := c.writeFrame(wsPing, nil); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package dashboard
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// wsTestClient is a bare WebSocket client speaking just enough of the
+// protocol to exercise the handler.
+type wsTestClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dialWS(t *testing.T, srv *httptest.Server, path string) *wsTestClient {
+	t.Helper()
+	conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	req.Write(conn)
+
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, req)
+	if err != nil {
+		t.Fatalf("handshake: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Expected 101, got %d", resp.StatusCode)
+	}
+	// The example key and accept value from RFC 6455
+	if got := resp.Header.Get("Sec-WebSocket-Accept"); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("Unexpected Sec-WebSocket-Accept %q", got)
+	}
+	return &wsTestClient{t: t, conn: conn, r: r}
+}
+
+// send writes a masked text frame, as browsers do.
+func (c *wsTestClient) send(msg string) {
+	mask := [4]byte{1, 2, 3, 4}
+	frame := []byte{0x80 | wsText, 0x80 | byte(len(msg))}
+	frame = append(frame, mask[:]...)
+	for i := 0; i < len(msg); i++ {
+		frame = append(frame, msg[i]^mask[i%4])
+	}
+	c.conn.Write(frame)
+}
+
+// next returns the next text message, skipping control frames.
+func (c *wsTestClient) next() wsMessage {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		var hdr [2]byte
+		if _, err := io.ReadFull(c.r, hdr[:]); err != nil {
+			c.t.Fatalf("read: %v", err)
+		}
+		n := int(hdr[1] & 0x7F)
+		if n == 126 {
+			var ext [2]byte
+			io.ReadFull(c.r, ext[:])
+			n = int(binary.BigEndian.Uint16(ext[:]))
+		}
+		payload := make([]byte, n)
+		if _, err := io.ReadFull(c.r, payload); err != nil {
+			c.t.Fatalf("read: %v", err)
+		}
+		if hdr[0]&0x0F != wsText {
+			continue
+		}
+		var msg wsMessage
+		if err := json.Unmarshal(payload, &msg); err != nil {
+			c.t.Fatalf("decode %q: %v", payload, err)
+		}
+		return msg
+	}
+}
+
+func TestWebSocketDeliversSubscribedEvents(t *testing.T) {
+	b := NewBroker(0)
+	srv := httptest.NewServer(b.WebSocketHandler())
+	defer srv.Close()
+	c := dialWS(t, srv, "/ws?events=request")
+
+	waitForClients(t, b, 1)
+	b.Broadcast("metrics", map[string]int{"requests_per_minute": 3})
+	b.Broadcast("request", map[string]string{"path": "/api"})
+	msg := c.next()
+	if msg.Type != "request" || string(msg.Data) != `{"path":"/api"}` {
+		t.Fatalf("Expected only the request event, got %s %s", msg.Type, msg.Data)
+	}
+
+	c.send(`{"subscribe": ["metrics"]}`)
+	deadline := time.Now().Add(time.Second)
+	for !subscribedTo(b, "metrics") {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the subscription message to change the filter")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	b.Broadcast("request", map[string]string{"path": "/api"})
+	b.Broadcast("metrics", map[string]int{"requests_per_minute": 4})
+	msg = c.next()
+	if msg.Type != "metrics" || msg.ID == 0 {
+		t.Errorf("Expected a numbered metrics event after resubscribing, got %s %d", msg.Type, msg.ID)
+	}
+}
+
+// subscribedTo reports whether the broker's only client wants just t.
+func subscribedTo(b *Broker, t string) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, types := range b.clients {
+		return len(types) == 1 && types[t]
+	}
+	return false
+}
+
+func TestWebSocketRejectsCrossOrigin(t *testing.T) {
+	b := NewBroker(0)
+	req := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	req.Header.Set("Origin", "https://evil.example")
+	rec := httptest.NewRecorder()
+	b.WebSocketHandler()(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a cross-origin upgrade, got %d", rec.Code)
+	}
+}
+
+// waitForClients waits until the broker has registered n clients.
+func waitForClients(t *testing.T, b *Broker, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		b.mu.RLock()
+		got := len(b.clients)
+		b.mu.RUnlock()
+		if got == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d clients, got %d", n, got)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
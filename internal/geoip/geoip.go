@@ -0,0 +1,87 @@
+// Package geoip resolves client IPs to countries and autonomous systems
+// using MaxMind-format databases (GeoLite2/GeoIP2 Country or City, and
+// ASN), so traffic can be broken down by where it comes from.
+package geoip
+
+import (
+	"fmt"
+	"log"
+	"net/netip"
+)
+
+// Location is what the databases know about an IP. Fields are empty when
+// the IP isn't covered or no database for them was configured.
+type Location struct {
+	Country string // ISO 3166-1 alpha-2 code, e.g. "DE"
+	ASN     uint32 // autonomous system number
+	ASOrg   string // the AS's organization, e.g. "Deutsche Telekom AG"
+}
+
+// DB looks up IPs in a country (or city) database, an ASN database, or
+// both. It is safe for concurrent use.
+type DB struct {
+	country *reader
+	asn     *reader
+}
+
+// Open loads the databases at countryPath and asnPath. Either may be
+// empty to skip it.
+func Open(countryPath, asnPath string) (*DB, error) {
+	db := &DB{}
+	var err error
+	if countryPath != "" {
+		if db.country, err = openReader(countryPath); err != nil {
+			return nil, fmt.Errorf("country database: %w", err)
+		}
+		log.Printf("[geoip] Loaded %s from %s", db.country.dbType, countryPath)
+	}
+	if asnPath != "" {
+		if db.asn, err = openReader(asnPath); err != nil {
+			return nil, fmt.Errorf("ASN database: %w", err)
+		}
+		log.Printf("[geoip] Loaded %s from %s", db.asn.dbType, asnPath)
+	}
+	return db, nil
+}
+
+// Lookup resolves an IP address in text form. Unparseable, private, and
+// unknown addresses return an empty Location.
+func (db *DB) Lookup(ip string) Location {
+	var loc Location
+	addr, err := netip.ParseAddr(ip)
+	if err != nil || addr.IsPrivate() || addr.IsLoopback() {
+		return loc
+	}
+
+	if db.country != nil {
+		if rec, err := db.country.lookup(addr); err == nil {
+			// Prefer where the IP is used over where it is registered
+			loc.Country = isoCode(rec, "country")
+			if loc.Country == "" {
+				loc.Country = isoCode(rec, "registered_country")
+			}
+		}
+	}
+	if db.asn != nil {
+		if rec, err := db.asn.lookup(addr); err == nil {
+			if m, ok := rec.(map[string]any); ok {
+				switch n := m["autonomous_system_number"].(type) {
+				case uint32:
+					loc.ASN = n
+				case uint64:
+					loc.ASN = uint32(n)
+				}
+				loc.ASOrg, _ = m["autonomous_system_organization"].(string)
+			}
+		}
+	}
+	return loc
+}
+
+// isoCode reads rec[field]["iso_code"].
+func isoCode(rec any, field string) string {
+	m, _ := rec.(map[string]any)
+	c, _ := m[field].(map[string]any)
+	code, _ := c["iso_code"].(string)
+	return code
+}
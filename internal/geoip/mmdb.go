@@ -0,0 +1,318 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net/netip"
+	"os"
+)
+
+// metadataMarker precedes the metadata map at the end of a MaxMind DB file.
+var metadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// dataSectionSeparator is the run of zero bytes between the search tree
+// and the data section.
+const dataSectionSeparator = 16
+
+// reader reads a MaxMind DB (.mmdb) file: a binary search tree over IP
+// address bits whose leaves point into a section of self-describing
+// records. Only what lookups need is implemented; the whole file is held
+// in memory.
+type reader struct {
+	buf        []byte
+	data       []byte // the data section
+	nodeCount  uint
+	recordSize uint // bits per record: 24, 28, or 32
+	ipVersion  uint
+	dbType     string
+	ipv4Start  uint // node reached by the 96 zero bits IPv4 addresses are mapped under
+}
+
+// openReader loads and checks an .mmdb file.
+func openReader(path string) (*reader, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	i := bytes.LastIndex(buf, metadataMarker)
+	if i < 0 {
+		return nil, fmt.Errorf("%s: not a MaxMind DB file", path)
+	}
+	meta := buf[i+len(metadataMarker):]
+	v, _, err := decode(meta, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%s: metadata: %w", path, err)
+	}
+	m, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s: metadata is not a map", path)
+	}
+
+	r := &reader{buf: buf}
+	r.nodeCount = uintField(m, "node_count")
+	r.recordSize = uintField(m, "record_size")
+	r.ipVersion = uintField(m, "ip_version")
+	r.dbType, _ = m["database_type"].(string)
+	switch r.recordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("%s: unsupported record size %d", path, r.recordSize)
+	}
+	treeSize := r.nodeCount * r.recordSize / 4
+	if treeSize+dataSectionSeparator > uint(i) {
+		return nil, fmt.Errorf("%s: search tree overruns the file", path)
+	}
+	r.data = buf[treeSize+dataSectionSeparator : i]
+
+	if r.ipVersion == 6 {
+		node := uint(0)
+		for range 96 {
+			if node >= r.nodeCount {
+				break
+			}
+			node = r.record(node, 0)
+		}
+		r.ipv4Start = node
+	}
+	return r, nil
+}
+
+// uintField reads an unsigned metadata field, 0 if absent.
+func uintField(m map[string]any, key string) uint {
+	switch v := m[key].(type) {
+	case uint64:
+		return uint(v)
+	case uint32:
+		return uint(v)
+	case uint16:
+		return uint(v)
+	}
+	return 0
+}
+
+// record returns the left (bit 0) or right (bit 1) record of a node.
+func (r *reader) record(node uint, bit byte) uint {
+	switch r.recordSize {
+	case 24:
+		b := r.buf[node*6+uint(bit)*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		b := r.buf[node*7:]
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(r.buf[node*8+uint(bit)*4:]))
+	}
+}
+
+// lookup returns the record for ip, or nil if the database has none.
+func (r *reader) lookup(ip netip.Addr) (any, error) {
+	ip = ip.Unmap()
+	var bits []byte
+	node := uint(0)
+	if ip.Is4() {
+		b := ip.As4()
+		bits = b[:]
+		if r.ipVersion == 6 {
+			node = r.ipv4Start
+		}
+	} else {
+		if r.ipVersion != 6 {
+			return nil, nil
+		}
+		b := ip.As16()
+		bits = b[:]
+	}
+
+	for i := 0; i < len(bits)*8 && node < r.nodeCount; i++ {
+		node = r.record(node, (bits[i/8]>>(7-i%8))&1)
+	}
+	switch {
+	case node == r.nodeCount:
+		return nil, nil
+	case node < r.nodeCount:
+		return nil, errors.New("search tree ended inside the tree")
+	}
+	offset := node - r.nodeCount - dataSectionSeparator
+	if offset >= uint(len(r.data)) {
+		return nil, errors.New("record pointer outside the data section")
+	}
+	v, _, err := decode(r.data, offset)
+	return v, err
+}
+
+// Data section field types.
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeDouble
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeArray
+	typeContainer
+	typeEndMarker
+	typeBool
+	typeFloat
+)
+
+var errTruncated = errors.New("truncated data section")
+
+// maxDecodeDepth bounds nesting, so a corrupt file whose pointers loop
+// can't recurse forever.
+const maxDecodeDepth = 64
+
+// decode decodes the field at offset in section, returning it and the
+// offset just past it. Maps decode to map[string]any, arrays to []any,
+// unsigned integers to their own width (uint128 as []byte), and pointers
+// to the value they point at.
+func decode(section []byte, offset uint) (any, uint, error) {
+	return decodeAt(section, offset, 0)
+}
+
+// decodeAt is decode at a nesting depth.
+func decodeAt(section []byte, offset uint, depth int) (any, uint, error) {
+	if depth > maxDecodeDepth {
+		return nil, 0, errors.New("data nested too deeply")
+	}
+	if offset >= uint(len(section)) {
+		return nil, 0, errTruncated
+	}
+	ctrl := section[offset]
+	offset++
+	typ := uint(ctrl >> 5)
+
+	if typ == typePointer {
+		size := uint(ctrl>>3) & 0x3
+		if offset+size+1 > uint(len(section)) {
+			return nil, 0, errTruncated
+		}
+		b := section[offset : offset+size+1]
+		var ptr uint
+		switch size {
+		case 0:
+			ptr = uint(ctrl&0x7)<<8 | uint(b[0])
+		case 1:
+			ptr = (uint(ctrl&0x7)<<16 | uint(b[0])<<8 | uint(b[1])) + 2048
+		case 2:
+			ptr = (uint(ctrl&0x7)<<24 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])) + 526336
+		case 3:
+			ptr = uint(binary.BigEndian.Uint32(b))
+		}
+		v, _, err := decodeAt(section, ptr, depth+1)
+		return v, offset + size + 1, err
+	}
+
+	if typ == typeExtended {
+		if offset >= uint(len(section)) {
+			return nil, 0, errTruncated
+		}
+		typ = 7 + uint(section[offset])
+		offset++
+	}
+
+	size := uint(ctrl & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		if offset+n > uint(len(section)) {
+			return nil, 0, errTruncated
+		}
+		var ext uint
+		for _, b := range section[offset : offset+n] {
+			ext = ext<<8 | uint(b)
+		}
+		offset += n
+		switch size {
+		case 29:
+			size = 29 + ext
+		case 30:
+			size = 285 + ext
+		default:
+			size = 65821 + ext
+		}
+	}
+
+	switch typ {
+	case typeMap:
+		m := make(map[string]any, min(size, 64))
+		for range size {
+			k, next, err := decodeAt(section, offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, 0, errors.New("map key is not a string")
+			}
+			v, next, err := decodeAt(section, next, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[key] = v
+			offset = next
+		}
+		return m, offset, nil
+	case typeArray:
+		a := make([]any, 0, min(size, 64))
+		for range size {
+			v, next, err := decodeAt(section, offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, v)
+			offset = next
+		}
+		return a, offset, nil
+	case typeBool:
+		return size != 0, offset, nil
+	case typeContainer, typeEndMarker:
+		return nil, offset, nil
+	}
+
+	if offset+size > uint(len(section)) {
+		return nil, 0, errTruncated
+	}
+	b := section[offset : offset+size]
+	offset += size
+	switch typ {
+	case typeString:
+		return string(b), offset, nil
+	case typeBytes, typeUint128:
+		return bytes.Clone(b), offset, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("double of size %d", size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), offset, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("float of size %d", size)
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(b)), offset, nil
+	case typeUint16, typeUint32, typeUint64, typeInt32:
+		var n uint64
+		for _, c := range b {
+			n = n<<8 | uint64(c)
+		}
+		switch typ {
+		case typeUint16:
+			return uint16(n), offset, nil
+		case typeUint32:
+			return uint32(n), offset, nil
+		case typeInt32:
+			return int32(uint32(n)), offset, nil
+		}
+		return n, offset, nil
+	}
+	return nil, 0, fmt.Errorf("unknown field type %d", typ)
+}
@@ -0,0 +1,332 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Encoders for the data section, enough to build test databases.
+
+func mmdbHeader(typ, size int) []byte {
+	var ctrl []byte
+	switch {
+	case size < 29:
+		ctrl = []byte{byte(size)}
+	case size < 285:
+		ctrl = []byte{29, byte(size - 29)}
+	default:
+		ctrl = []byte{30, byte((size - 285) >> 8), byte(size - 285)}
+	}
+	if typ > typeMap {
+		return append([]byte{ctrl[0], byte(typ - 7)}, ctrl[1:]...)
+	}
+	ctrl[0] |= byte(typ << 5)
+	return ctrl
+}
+
+func mmdbString(s string) []byte {
+	return append(mmdbHeader(typeString, len(s)), s...)
+}
+
+func mmdbUint16(n uint16) []byte {
+	return binary.BigEndian.AppendUint16(mmdbHeader(typeUint16, 2), n)
+}
+
+func mmdbUint32(n uint32) []byte {
+	return binary.BigEndian.AppendUint32(mmdbHeader(typeUint32, 4), n)
+}
+
+func mmdbBool(v bool) []byte {
+	if v {
+		return mmdbHeader(typeBool, 1)
+	}
+	return mmdbHeader(typeBool, 0)
+}
+
+// mmdbMap encodes alternating keys and encoded values.
+func mmdbMap(kv ...any) []byte {
+	b := mmdbHeader(typeMap, len(kv)/2)
+	for i := 0; i < len(kv); i += 2 {
+		b = append(b, mmdbString(kv[i].(string))...)
+		b = append(b, kv[i+1].([]byte)...)
+	}
+	return b
+}
+
+// mmdbPointer encodes a pointer of the given size (0-3) to offset.
+func mmdbPointer(size int, offset uint) []byte {
+	switch size {
+	case 0:
+		return []byte{0x20 | byte(offset>>8), byte(offset)}
+	case 1:
+		offset -= 2048
+		return []byte{0x28 | byte(offset>>16), byte(offset >> 8), byte(offset)}
+	case 2:
+		offset -= 526336
+		return []byte{0x30 | byte(offset>>24), byte(offset >> 16), byte(offset >> 8), byte(offset)}
+	}
+	return binary.BigEndian.AppendUint32([]byte{0x38}, uint32(offset))
+}
+
+// buildMMDB builds a database mapping each network to the record at a data
+// section offset. IPv4 networks in an IPv6 database go under ::/96.
+func buildMMDB(t *testing.T, recordSize, ipVersion int, data []byte, networks map[string]uint) []byte {
+	t.Helper()
+	// Node records: 0 is empty, n > 0 is node n, -(d+1) is data offset d
+	nodes := [][2]int{{}}
+	for network, offset := range networks {
+		p := netip.MustParsePrefix(network)
+		bits := p.Bits()
+		var raw []byte
+		switch a := p.Addr(); {
+		case a.Is4() && ipVersion == 6:
+			a4 := a.As4()
+			raw = append(make([]byte, 12), a4[:]...)
+			bits += 96
+		case a.Is4():
+			a4 := a.As4()
+			raw = a4[:]
+		default:
+			a16 := a.As16()
+			raw = a16[:]
+		}
+		node := 0
+		for i := range bits {
+			bit := raw[i/8] >> (7 - i%8) & 1
+			if i == bits-1 {
+				nodes[node][bit] = -int(offset) - 1
+				break
+			}
+			if nodes[node][bit] <= 0 {
+				nodes = append(nodes, [2]int{})
+				nodes[node][bit] = len(nodes) - 1
+			}
+			node = nodes[node][bit]
+		}
+	}
+
+	nodeCount := uint(len(nodes))
+	var tree []byte
+	for _, n := range nodes {
+		var rec [2]uint
+		for i, v := range n {
+			switch {
+			case v > 0:
+				rec[i] = uint(v)
+			case v == 0:
+				rec[i] = nodeCount
+			default:
+				rec[i] = nodeCount + dataSectionSeparator + uint(-v-1)
+			}
+		}
+		tree = append(tree, encodeNode(recordSize, rec[0], rec[1])...)
+	}
+
+	buf := append(tree, make([]byte, dataSectionSeparator)...)
+	buf = append(buf, data...)
+	buf = append(buf, metadataMarker...)
+	return append(buf, mmdbMap(
+		"node_count", mmdbUint32(uint32(nodeCount)),
+		"record_size", mmdbUint16(uint16(recordSize)),
+		"ip_version", mmdbUint16(uint16(ipVersion)),
+		"database_type", mmdbString("Test-Country"),
+	)...)
+}
+
+// encodeNode encodes one search tree node.
+func encodeNode(recordSize int, left, right uint) []byte {
+	switch recordSize {
+	case 24:
+		return []byte{byte(left >> 16), byte(left >> 8), byte(left), byte(right >> 16), byte(right >> 8), byte(right)}
+	case 28:
+		return []byte{byte(left >> 16), byte(left >> 8), byte(left), byte(left>>24)<<4 | byte(right>>24)&0x0f, byte(right >> 16), byte(right >> 8), byte(right)}
+	}
+	return binary.BigEndian.AppendUint32(binary.BigEndian.AppendUint32(nil, uint32(left)), uint32(right))
+}
+
+// writeMMDB writes buf to a file and returns its path.
+func writeMMDB(t *testing.T, buf []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.mmdb")
+	if err := os.WriteFile(path, buf, 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	return path
+}
+
+// countryData is a data section with records reached directly and through
+// pointers of both small sizes, and the offsets of those records.
+func countryData() (data []byte, germany, france, us uint) {
+	de := uint(len(data))
+	data = append(data, mmdbMap("iso_code", mmdbString("DE"))...)
+	// Pad past 2048 bytes so France needs a two-byte pointer
+	data = append(data, mmdbString(strings.Repeat("x", 3000))...)
+	fr := uint(len(data))
+	data = append(data, mmdbMap("iso_code", mmdbString("FR"))...)
+
+	germany = uint(len(data))
+	data = append(data, mmdbMap("country", mmdbPointer(0, de), "is_in_european_union", mmdbBool(true))...)
+	france = uint(len(data))
+	data = append(data, mmdbMap("country", mmdbPointer(1, fr))...)
+	us = uint(len(data))
+	data = append(data, mmdbMap("registered_country", mmdbMap("iso_code", mmdbString("US")))...)
+	return data, germany, france, us
+}
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{"1.2.3.4", "DE"},
+		{"::ffff:1.2.3.4", "DE"},
+		{"2.5.5.5", "FR"},
+		{"2001:db8::1", "US"},
+		{"8.8.8.8", ""},
+		{"2001:4860::8888", ""},
+		{"not an ip", ""},
+	}
+	for _, recordSize := range []int{24, 28, 32} {
+		data, germany, france, us := countryData()
+		buf := buildMMDB(t, recordSize, 6, data, map[string]uint{
+			"1.2.3.0/24":    germany,
+			"2.0.0.0/8":     france,
+			"2001:db8::/32": us,
+		})
+		db, err := Open(writeMMDB(t, buf), "")
+		if err != nil {
+			t.Fatalf("%d-bit records: Open: %v", recordSize, err)
+		}
+		for _, tt := range tests {
+			if got := db.Lookup(tt.ip).Country; got != tt.want {
+				t.Errorf("%d-bit records: %s: expected %q, got %q", recordSize, tt.ip, tt.want, got)
+			}
+		}
+	}
+}
+
+func TestLookupIPv4Database(t *testing.T) {
+	data, germany, _, _ := countryData()
+	r, err := openReader(writeMMDB(t, buildMMDB(t, 24, 4, data, map[string]uint{"1.2.3.0/24": germany})))
+	if err != nil {
+		t.Fatalf("openReader: %v", err)
+	}
+	if rec, err := r.lookup(netip.MustParseAddr("::ffff:1.2.3.4")); err != nil || isoCode(rec, "country") != "DE" {
+		t.Errorf("Expected an IPv4-mapped address found in an IPv4 database, got %v, %v", rec, err)
+	}
+	if rec, err := r.lookup(netip.MustParseAddr("2001:db8::1")); err != nil || rec != nil {
+		t.Errorf("Expected no record for IPv6 in an IPv4 database, got %v, %v", rec, err)
+	}
+}
+
+func TestRecordSizes(t *testing.T) {
+	tests := []struct {
+		recordSize  int
+		node        []byte
+		left, right uint
+	}{
+		{24, []byte{0xab, 0xcd, 0xef, 0x12, 0x34, 0x56}, 0xabcdef, 0x123456},
+		{28, []byte{0xbc, 0xde, 0xf1, 0xa1, 0x23, 0x45, 0x67}, 0xabcdef1, 0x1234567},
+		{32, []byte{0xde, 0xad, 0xbe, 0xef, 0x01, 0x23, 0x45, 0x67}, 0xdeadbeef, 0x01234567},
+	}
+	for _, tt := range tests {
+		// Node 1, so the offset of the second node is exercised too
+		r := &reader{buf: append(make([]byte, len(tt.node)), tt.node...), recordSize: uint(tt.recordSize)}
+		if got := r.record(1, 0); got != tt.left {
+			t.Errorf("%d-bit: expected left record %#x, got %#x", tt.recordSize, tt.left, got)
+		}
+		if got := r.record(1, 1); got != tt.right {
+			t.Errorf("%d-bit: expected right record %#x, got %#x", tt.recordSize, tt.right, got)
+		}
+	}
+}
+
+func TestDecodePointers(t *testing.T) {
+	for size, target := range []uint{100, 3000, 526336 + 100, 600000} {
+		section := mmdbPointer(size, target)
+		section = append(section, make([]byte, int(target)-len(section))...)
+		section = append(section, mmdbString("DE")...)
+		v, next, err := decode(section, 0)
+		if err != nil || v != "DE" {
+			t.Errorf("%d-byte pointer: expected \"DE\", got %v, %v", size+1, v, err)
+		}
+		if want := uint(size + 2); next != want {
+			t.Errorf("%d-byte pointer: expected decoding to resume at %d, got %d", size+1, want, next)
+		}
+	}
+}
+
+func TestDecodeCorrupt(t *testing.T) {
+	tests := []struct {
+		name    string
+		section []byte
+	}{
+		{"empty", nil},
+		{"string past the end", append(mmdbHeader(typeString, 10), "abc"...)},
+		{"long string length past the end", []byte{0x40 | 30, 0x01}},
+		{"map missing its values", mmdbHeader(typeMap, 2)},
+		{"map with a non-string key", append(mmdbHeader(typeMap, 1), append(mmdbUint16(1), mmdbUint16(2)...)...)},
+		{"pointer past the end", []byte{0x20}},
+		{"pointer outside the section", mmdbPointer(0, 500)},
+		{"pointer to itself", mmdbPointer(0, 0)},
+		{"extended type past the end", []byte{0x00}},
+		{"double of the wrong size", append(mmdbHeader(typeDouble, 4), 0, 0, 0, 0)},
+		{"unknown type", []byte{0x00, 0x20}},
+	}
+	for _, tt := range tests {
+		if v, _, err := decode(tt.section, 0); err == nil {
+			t.Errorf("%s: expected an error, got %v", tt.name, v)
+		}
+	}
+}
+
+func TestOpenCorrupt(t *testing.T) {
+	data, germany, _, _ := countryData()
+	valid := buildMMDB(t, 24, 6, data, map[string]uint{"1.2.3.0/24": germany})
+	marker := bytes.LastIndex(valid, metadataMarker)
+
+	withMetadata := func(kv ...any) []byte {
+		buf := bytes.Clone(valid[:marker+len(metadataMarker)])
+		return append(buf, mmdbMap(kv...)...)
+	}
+	tests := []struct {
+		name string
+		buf  []byte
+	}{
+		{"empty", nil},
+		{"no metadata", valid[:marker]},
+		{"truncated metadata", valid[:len(valid)-3]},
+		{"metadata not a map", append(bytes.Clone(valid[:marker+len(metadataMarker)]), mmdbString("x")...)},
+		{"unsupported record size", withMetadata(
+			"node_count", mmdbUint32(3), "record_size", mmdbUint16(20), "ip_version", mmdbUint16(6),
+		)},
+		{"tree overruns the file", withMetadata(
+			"node_count", mmdbUint32(1_000_000), "record_size", mmdbUint16(24), "ip_version", mmdbUint16(6),
+		)},
+	}
+	for _, tt := range tests {
+		if _, err := openReader(writeMMDB(t, tt.buf)); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
+
+func TestLookupCorruptRecordPointer(t *testing.T) {
+	data, _, _, _ := countryData()
+	r, err := openReader(writeMMDB(t, buildMMDB(t, 24, 6, data, map[string]uint{"1.2.3.0/24": uint(len(data)) + 10})))
+	if err != nil {
+		t.Fatalf("openReader: %v", err)
+	}
+	if _, err := r.lookup(netip.MustParseAddr("1.2.3.4")); err == nil {
+		t.Error("Expected an error for a record pointing past the data section")
+	}
+	db := &DB{country: r}
+	if loc := db.Lookup("1.2.3.4"); loc != (Location{}) {
+		t.Errorf("Expected an empty location for a corrupt record, got %+v", loc)
+	}
+}
@@ -1,10 +1,21 @@
 package health
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net"
 	"net/http"
+	"net/url"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/tanmay/gateway/internal/state"
 )
 
 // BackendStatus tracks the health of a single backend.
@@ -12,17 +23,115 @@ type BackendStatus struct {
 	URL       string    `json:"url"`
 	Healthy   bool      `json:"healthy"`
 	LastCheck time.Time `json:"last_check"`
+	Flapping  bool      `json:"flapping"` // changed state too often recently
+	Paused    bool      `json:"paused"`   // probing paused for maintenance; state is frozen
+
+	// Drained backends are forced down by an operator regardless of probe
+	// results. Healthy still reflects the probes.
+	Drained     bool   `json:"drained"`
+	DrainReason string `json:"drain_reason,omitempty"`
+
+	// Diagnostics from the most recent probes
+	ProbeDurationMs     float64    `json:"probe_duration_ms"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	LastError           string     `json:"last_error,omitempty"` // most recent probe failure, kept after recovery
+	LastErrorAt         *time.Time `json:"last_error_at,omitempty"`
+
+	consecutiveSuccesses int
+	nextCheck            time.Time // zero = check on every tick; set while backing off
+
+	history     []CheckResult // ring of recent probe results
+	historyNext int           // next write position in history
+	transitions []time.Time   // recent health state changes, for flap detection
+}
+
+// serving reports whether the backend should receive traffic: probed
+// healthy and not manually drained.
+func (s *BackendStatus) serving() bool {
+	return s.Healthy && !s.Drained
+}
+
+// record applies a probe result, flipping Healthy only once the configured
+// number of consecutive failures/successes is reached. The very first probe
+// of a backend decides its state directly, since the initial value is a guess.
+// Returns true if the health state changed.
+func (s *BackendStatus) record(ok bool, unhealthyThreshold, healthyThreshold int) bool {
+	firstCheck := s.LastCheck.IsZero()
+	s.LastCheck = time.Now()
+
+	if ok {
+		s.consecutiveSuccesses++
+		s.ConsecutiveFailures = 0
+	} else {
+		s.ConsecutiveFailures++
+		s.consecutiveSuccesses = 0
+	}
+
+	wasHealthy := s.Healthy
+	switch {
+	case firstCheck:
+		s.Healthy = ok
+	case ok && !s.Healthy && s.consecutiveSuccesses >= healthyThreshold:
+		s.Healthy = true
+	case !ok && s.Healthy && s.ConsecutiveFailures >= unhealthyThreshold:
+		s.Healthy = false
+	}
+	return s.Healthy != wasHealthy
 }
 
+// Probe types
+const (
+	ProbeHTTP = "http" // HTTP request, response matched against expectations (default)
+	ProbeTCP  = "tcp"  // only verify a TCP connection can be established
+)
+
+// Probe describes how a backend is checked. The zero value means
+// GET <backend>/ and expect a 200.
+type Probe struct {
+	Type           string            // ProbeHTTP (default) or ProbeTCP
+	Path           string            // appended to the backend URL (e.g. "/healthz")
+	Method         string            // defaults to GET
+	ExpectedStatus []int             // defaults to [200]
+	ExpectBody     string            // optional substring the response body must contain
+	Headers        map[string]string // extra request headers (e.g. Host, auth)
+}
+
+// maxProbeBody caps how much of a probe response is read when matching ExpectBody.
+const maxProbeBody = 64 * 1024
+
 // HealthChecker monitors backend health and exposes a /health endpoint.
 // It runs background checks on a timer and caches the results so that
 // the /health endpoint doesn't need to probe backends on every request.
 type HealthChecker struct {
-	backends      map[string]*BackendStatus
-	mu            sync.RWMutex
+	backends map[string]*BackendStatus
+	probes   map[string]Probe // per-backend probe overrides
+	mu       sync.RWMutex
+
+	unhealthyThreshold int // consecutive failures before marking a backend down
+	healthyThreshold   int // consecutive successes before bringing it back
+
+	workers      int           // max probes in flight at once
+	cycleTimeout time.Duration // overall deadline for one RunChecks pass (0 = none)
+
+	flapThreshold int // transitions within flapWindow that count as flapping (0 = off)
+	flapWindow    time.Duration
+
+	timeline          map[string][]Transition // per-backend health transitions (see SetTimeline)
+	timelineStore     state.Store             // optional persistence for timeline
+	timelineRetention time.Duration
+
+	paused     bool        // probing paused for all backends (see Pause)
+	ready      atomic.Bool // listener up and not shutting down (see SetReady)
+	minHealthy int         // healthy backends required for readiness
+
+	interval      time.Duration // normal probe interval (set by StartBackground)
+	maxBackoff    time.Duration // cap for probe backoff on down backends (0 = no backoff)
 	startTime     time.Time
 	client        *http.Client
 	OnStateChange func(url string, isHealthy bool) // hook for SSE updates
+
+	stop chan struct{} // closed by Stop
+	done chan struct{} // closed when the probe loop exits
 }
 
 // NewHealthChecker creates a HealthChecker for the given backend URLs.
@@ -37,56 +146,325 @@ func NewHealthChecker(backendURLs []string) *HealthChecker {
 
 	return &HealthChecker{
 		backends:  backends,
+		probes:    make(map[string]Probe),
+		timeline:  make(map[string][]Transition),
 		startTime: time.Now(),
+
+		unhealthyThreshold: 1,
+		healthyThreshold:   1,
+		workers:            10,
+		minHealthy:         1,
+		timelineRetention:  7 * 24 * time.Hour,
+		flapThreshold:      4,
+		flapWindow:         10 * time.Minute,
 		client: &http.Client{
 			Timeout: 5 * time.Second, // don't hang on slow backends
 		},
 	}
 }
 
-// checkBackend makes an HTTP GET to the backend and returns true if it responds 200.
-func (hc *HealthChecker) checkBackend(url string) bool {
-	resp, err := hc.client.Get(url)
+// SetThresholds sets how many consecutive failed/successful checks are needed
+// before a backend flips to unhealthy/healthy. Values below 1 are treated as 1,
+// which flips on every single result.
+func (hc *HealthChecker) SetThresholds(unhealthy, healthy int) {
+	if unhealthy < 1 {
+		unhealthy = 1
+	}
+	if healthy < 1 {
+		healthy = 1
+	}
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	hc.unhealthyThreshold = unhealthy
+	hc.healthyThreshold = healthy
+}
+
+// SetConcurrency bounds how many backends are probed in parallel and how long
+// a whole check cycle may take. Probes still running at the cycle deadline are
+// abandoned without changing that backend's state. workers < 1 keeps the default.
+func (hc *HealthChecker) SetConcurrency(workers int, cycleTimeout time.Duration) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	if workers >= 1 {
+		hc.workers = workers
+	}
+	hc.cycleTimeout = cycleTimeout
+}
+
+// SetMaxBackoff enables exponential probe backoff for backends that are down:
+// each further failed check doubles the wait (with jitter) up to max, and
+// the normal interval resumes as soon as a check succeeds. 0 disables backoff.
+func (hc *HealthChecker) SetMaxBackoff(max time.Duration) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	hc.maxBackoff = max
+}
+
+// backoffDelay returns the wait before the next probe of a backend that has
+// failed `excess` checks beyond the unhealthy threshold.
+// Must be called with the lock held.
+func (hc *HealthChecker) backoffDelay(excess int) time.Duration {
+	delay := hc.interval
+	for i := 0; i < excess && delay < hc.maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > hc.maxBackoff {
+		delay = hc.maxBackoff
+	}
+	// ±20% jitter so many failing backends don't get probed in lockstep
+	jitter := 0.8 + rand.Float64()*0.4
+	return time.Duration(float64(delay) * jitter)
+}
+
+// SetProbe configures how a specific backend is checked.
+func (hc *HealthChecker) SetProbe(url string, probe Probe) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	hc.probes[url] = probe
+}
+
+// checkBackend probes the backend as configured by its Probe (GET / expecting
+// 200 by default) and returns nil if the response matches expectations, or
+// an error describing why the probe failed.
+func (hc *HealthChecker) checkBackend(ctx context.Context, url string) error {
+	hc.mu.RLock()
+	probe := hc.probes[url]
+	hc.mu.RUnlock()
+
+	if probe.Type == ProbeTCP {
+		return hc.checkTCP(ctx, url)
+	}
+
+	method := probe.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(url, "/")+probe.Path, nil)
 	if err != nil {
-		return false
+		return err
+	}
+	for k, v := range probe.Headers {
+		if strings.EqualFold(k, "Host") {
+			req.Host = v
+			continue
+		}
+		req.Header.Set(k, v)
+	}
+
+	resp, err := hc.client.Do(req)
+	if err != nil {
+		return err
 	}
 	defer resp.Body.Close()
-	return resp.StatusCode == http.StatusOK
+
+	if !probe.statusOK(resp.StatusCode) {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	if probe.ExpectBody != "" {
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxProbeBody))
+		if err != nil {
+			return fmt.Errorf("reading body: %w", err)
+		}
+		if !strings.Contains(string(body), probe.ExpectBody) {
+			return fmt.Errorf("body does not contain %q", probe.ExpectBody)
+		}
+	}
+	return nil
+}
+
+// checkTCP returns nil if a TCP connection to the backend's host:port
+// can be established. Used for databases, gRPC services, and other
+// backends where an HTTP GET is wrong or expensive.
+func (hc *HealthChecker) checkTCP(ctx context.Context, backendURL string) error {
+	addr := backendURL
+	if u, err := url.Parse(backendURL); err == nil && u.Host != "" {
+		addr = u.Host
+		if u.Port() == "" {
+			switch u.Scheme {
+			case "https":
+				addr = net.JoinHostPort(u.Hostname(), "443")
+			default:
+				addr = net.JoinHostPort(u.Hostname(), "80")
+			}
+		}
+	}
+
+	dialer := net.Dialer{Timeout: hc.client.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	conn.Close()
+	return nil
+}
+
+// statusOK reports whether a probe response status counts as healthy.
+func (p Probe) statusOK(code int) bool {
+	if len(p.ExpectedStatus) == 0 {
+		return code == http.StatusOK
+	}
+	for _, s := range p.ExpectedStatus {
+		if code == s {
+			return true
+		}
+	}
+	return false
 }
 
 // RunChecks performs a one-time health check of all backends.
+// Backends are probed concurrently by a bounded worker pool, and the whole
+// pass is cut off at the configured cycle timeout.
 // Updates the cached status for each backend.
 func (hc *HealthChecker) RunChecks() {
-	for url := range hc.backends {
-		healthy := hc.checkBackend(url)
+	now := time.Now()
+	hc.mu.RLock()
+	if hc.paused {
+		hc.mu.RUnlock()
+		return
+	}
+	urls := make([]string, 0, len(hc.backends))
+	for url, status := range hc.backends {
+		if status.Paused {
+			continue // under maintenance
+		}
+		if now.Before(status.nextCheck) {
+			continue // backing off a failing backend
+		}
+		urls = append(urls, url)
+	}
+	workers := hc.workers
+	cycleTimeout := hc.cycleTimeout
+	hc.mu.RUnlock()
 
-		hc.mu.Lock()
-		wasHealthy := hc.backends[url].Healthy
-		hc.backends[url].Healthy = healthy
-		hc.backends[url].LastCheck = time.Now()
-		hc.mu.Unlock()
+	ctx := context.Background()
+	if cycleTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cycleTimeout)
+		defer cancel()
+	}
+
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	skipped := 0
+	for i, url := range urls {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			skipped = len(urls) - i
+		}
+		if skipped > 0 {
+			break
+		}
+
+		wg.Add(1)
+		go func(url string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			hc.checkAndRecord(ctx, url)
+		}(url)
+	}
+	wg.Wait()
+
+	if skipped > 0 {
+		log.Printf("[health] check cycle hit its %s deadline; %d backends not probed", cycleTimeout, skipped)
+	}
+}
 
-		// Fire event outside the lock, but only if state changed
-		if hc.OnStateChange != nil && wasHealthy != healthy {
-			hc.OnStateChange(url, healthy)
+// checkAndRecord probes one backend and applies the result.
+func (hc *HealthChecker) checkAndRecord(ctx context.Context, url string) {
+	start := time.Now()
+	probeErr := hc.checkBackend(ctx, url)
+	duration := time.Since(start)
+	ok := probeErr == nil
+	if ctx.Err() != nil {
+		// Cut off by the cycle deadline — inconclusive, keep the previous state
+		return
+	}
+
+	hc.mu.Lock()
+	status, exists := hc.backends[url]
+	if !exists || status.Paused || hc.paused {
+		// Removed or paused while the probe was in flight
+		hc.mu.Unlock()
+		return
+	}
+	changed := status.record(ok, hc.unhealthyThreshold, hc.healthyThreshold)
+	healthy := status.Healthy
+	drained := status.Drained
+	status.ProbeDurationMs = float64(duration) / float64(time.Millisecond)
+	result := CheckResult{Time: status.LastCheck, OK: ok, Healthy: healthy, DurationMs: status.ProbeDurationMs}
+	if probeErr != nil {
+		at := status.LastCheck
+		status.LastError = probeErr.Error()
+		status.LastErrorAt = &at
+		result.Error = status.LastError
+	}
+	var timelineSnapshot map[string][]Transition
+	if hc.timelineChanged(url, healthy) {
+		t := Transition{Time: status.LastCheck, Healthy: healthy}
+		if !healthy {
+			t.Error = status.LastError
 		}
+		timelineSnapshot = hc.addTransition(url, t)
+	}
+	wasFlapping := status.Flapping
+	status.addHistory(result, changed)
+	status.updateFlapping(status.LastCheck, hc.flapThreshold, hc.flapWindow)
+	if status.Flapping && !wasFlapping {
+		log.Printf("[health] backend %s is flapping (%d transitions within %s)", url, len(status.transitions), hc.flapWindow)
+	}
+	status.nextCheck = time.Time{}
+	if !healthy && hc.maxBackoff > 0 && hc.interval > 0 {
+		excess := status.ConsecutiveFailures - hc.unhealthyThreshold
+		status.nextCheck = time.Now().Add(hc.backoffDelay(excess))
+	}
+	hc.mu.Unlock()
+
+	hc.saveTimeline(timelineSnapshot)
+
+	// Fire event outside the lock, but only if state changed. A drained
+	// backend stays down for routing, so its probe flips aren't announced.
+	if hc.OnStateChange != nil && changed && !drained {
+		hc.OnStateChange(url, healthy)
 	}
 }
 
 // StartBackground launches a goroutine that checks backends on a timer.
 // Uses time.NewTicker to fire every `interval` duration.
-// The goroutine runs until the program exits.
+// The goroutine runs until Stop is called.
 func (hc *HealthChecker) StartBackground(interval time.Duration) {
+	hc.mu.Lock()
+	hc.interval = interval
+	hc.mu.Unlock()
+
+	hc.stop = make(chan struct{})
+	hc.done = make(chan struct{})
 	ticker := time.NewTicker(interval)
 	go func() {
+		defer close(hc.done)
+		defer ticker.Stop()
 		// Run an initial check immediately
 		hc.RunChecks()
-		for range ticker.C {
-			hc.RunChecks()
+		for {
+			select {
+			case <-ticker.C:
+				hc.RunChecks()
+			case <-hc.stop:
+				return
+			}
 		}
 	}()
 }
 
+// Stop ends the background checks and waits for a running pass to finish.
+func (hc *HealthChecker) Stop() {
+	if hc.stop != nil {
+		close(hc.stop)
+		<-hc.done
+		hc.stop = nil
+	}
+}
+
 // AddBackend registers a new backend URL for health monitoring at runtime.
 // It will be picked up on the next health check tick.
 func (hc *HealthChecker) AddBackend(url string) {
@@ -100,14 +478,53 @@ func (hc *HealthChecker) AddBackend(url string) {
 	}
 }
 
-// IsHealthy returns whether a specific backend is currently healthy.
+// RemoveBackend stops monitoring a backend and forgets its status, so retired
+// backends are no longer probed and no longer count toward /health.
+func (hc *HealthChecker) RemoveBackend(url string) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	delete(hc.backends, url)
+	delete(hc.probes, url)
+}
+
+// SetHealthy records the outcome of a check made elsewhere, such as a
+// managed process passing or starting its readiness check, taking effect
+// at once rather than after the probe thresholds. Probes carry on as usual.
+func (hc *HealthChecker) SetHealthy(url string, healthy bool) error {
+	hc.mu.Lock()
+	status, exists := hc.backends[url]
+	if !exists {
+		hc.mu.Unlock()
+		return fmt.Errorf("backend %q not found", url)
+	}
+	changed := status.Healthy != healthy
+	status.Healthy = healthy
+	status.LastCheck = time.Now()
+	status.ConsecutiveFailures, status.consecutiveSuccesses = 0, 0
+	status.nextCheck = time.Time{}
+	drained := status.Drained
+	var timelineSnapshot map[string][]Transition
+	if hc.timelineChanged(url, healthy) {
+		timelineSnapshot = hc.addTransition(url, Transition{Time: status.LastCheck, Healthy: healthy})
+	}
+	hc.mu.Unlock()
+
+	hc.saveTimeline(timelineSnapshot)
+	if hc.OnStateChange != nil && changed && !drained {
+		hc.OnStateChange(url, healthy)
+	}
+	return nil
+}
+
+// IsHealthy returns whether a specific backend is currently healthy and
+// not manually drained, i.e. whether it should receive traffic.
 // Uses RLock (read lock) so multiple goroutines can check simultaneously
 // without blocking each other — only writes need an exclusive lock.
 func (hc *HealthChecker) IsHealthy(url string) bool {
 	hc.mu.RLock()
 	defer hc.mu.RUnlock()
 	if status, exists := hc.backends[url]; exists {
-		return status.Healthy
+		return status.serving()
 	}
 	return false
 }
@@ -123,7 +540,7 @@ func (hc *HealthChecker) BackendCounts() (healthy, total int) {
 	defer hc.mu.RUnlock()
 	total = len(hc.backends)
 	for _, s := range hc.backends {
-		if s.Healthy {
+		if s.serving() {
 			healthy++
 		}
 	}
@@ -134,6 +551,7 @@ func (hc *HealthChecker) BackendCounts() (healthy, total int) {
 type healthResponse struct {
 	Status   string                    `json:"status"`
 	Uptime   string                    `json:"uptime"`
+	Paused   bool                      `json:"paused,omitempty"` // checking paused globally
 	Backends map[string]*BackendStatus `json:"backends"`
 }
 
@@ -144,10 +562,11 @@ func (hc *HealthChecker) Handler() http.HandlerFunc {
 		hc.mu.RLock()
 		defer hc.mu.RUnlock()
 
-		// Check if all backends are healthy
+		// Check if all backends are healthy. Drained backends are down on
+		// purpose and don't degrade the gateway; they're labeled per backend.
 		allHealthy := true
 		for _, status := range hc.backends {
-			if !status.Healthy {
+			if !status.Healthy && !status.Drained {
 				allHealthy = false
 				break
 			}
@@ -158,14 +577,15 @@ func (hc *HealthChecker) Handler() http.HandlerFunc {
 			Status:   "healthy",
 			Uptime:   time.Since(hc.startTime).Round(time.Second).String(),
 			Backends: hc.backends,
+			Paused:   hc.paused,
 		}
 
+		w.Header().Set("Content-Type", "application/json")
 		if !allHealthy {
 			resp.Status = "degraded"
 			w.WriteHeader(http.StatusServiceUnavailable)
 		}
 
-		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(resp)
 	}
 }
@@ -0,0 +1,300 @@
+package health
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHealthCheckerThresholds(t *testing.T) {
+	var up atomic.Bool
+	up.Store(true)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !up.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	hc := NewHealthChecker([]string{backend.URL})
+	hc.SetThresholds(3, 2)
+
+	hc.RunChecks()
+	if !hc.IsHealthy(backend.URL) {
+		t.Fatalf("Expected backend healthy after first successful check")
+	}
+
+	// Two failures stay below the unhealthy threshold
+	up.Store(false)
+	hc.RunChecks()
+	hc.RunChecks()
+	if !hc.IsHealthy(backend.URL) {
+		t.Errorf("Expected backend to stay healthy after 2 failures (threshold 3)")
+	}
+
+	// Third consecutive failure flips it
+	hc.RunChecks()
+	if hc.IsHealthy(backend.URL) {
+		t.Errorf("Expected backend unhealthy after 3 consecutive failures")
+	}
+
+	// One success is not enough to come back
+	up.Store(true)
+	hc.RunChecks()
+	if hc.IsHealthy(backend.URL) {
+		t.Errorf("Expected backend to stay unhealthy after 1 success (threshold 2)")
+	}
+	hc.RunChecks()
+	if !hc.IsHealthy(backend.URL) {
+		t.Errorf("Expected backend healthy after 2 consecutive successes")
+	}
+}
+
+func TestHealthCheckerFirstCheckDecides(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer backend.Close()
+
+	hc := NewHealthChecker([]string{backend.URL})
+	hc.SetThresholds(3, 3)
+
+	hc.RunChecks()
+	if hc.IsHealthy(backend.URL) {
+		t.Errorf("Expected first failed check to mark backend unhealthy regardless of threshold")
+	}
+}
+
+func TestHealthCheckerFlapDetection(t *testing.T) {
+	var up atomic.Bool
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if up.Load() {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer backend.Close()
+
+	hc := NewHealthChecker([]string{backend.URL})
+	hc.SetThresholds(1, 1)
+	hc.SetFlapDetection(3, time.Minute)
+
+	// Initial check plus alternating results: up, down, up, down
+	for i := 0; i < 4; i++ {
+		up.Store(i%2 == 0)
+		hc.RunChecks()
+	}
+
+	history, flapping, ok := hc.History(backend.URL)
+	if !ok {
+		t.Fatalf("Expected history for known backend")
+	}
+	if len(history) != 4 {
+		t.Errorf("Expected 4 history entries, got %d", len(history))
+	}
+	if history[0].Healthy != true || history[1].Healthy != false {
+		t.Errorf("Expected history oldest first, got %+v", history)
+	}
+	if !flapping {
+		t.Errorf("Expected backend to be flagged as flapping after 3 transitions")
+	}
+}
+
+func TestReadinessIndependentOfLiveness(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer backend.Close()
+
+	hc := NewHealthChecker([]string{backend.URL})
+	hc.RunChecks()
+
+	rec := httptest.NewRecorder()
+	hc.LivenessHandler()(rec, httptest.NewRequest(http.MethodGet, "/livez", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected /livez 200 with backends down, got %d", rec.Code)
+	}
+
+	hc.SetReady(true)
+	rec = httptest.NewRecorder()
+	hc.ReadinessHandler()(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected /readyz 503 below backend quorum, got %d", rec.Code)
+	}
+}
+
+func TestHealthCheckerPauseFreezesState(t *testing.T) {
+	var up atomic.Bool
+	up.Store(true)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if up.Load() {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer backend.Close()
+
+	hc := NewHealthChecker([]string{backend.URL})
+	hc.RunChecks()
+
+	if err := hc.Pause(backend.URL); err != nil {
+		t.Fatalf("Pause: %v", err)
+	}
+	up.Store(false)
+	hc.RunChecks()
+	if !hc.IsHealthy(backend.URL) {
+		t.Errorf("Expected paused backend to keep its last state")
+	}
+
+	// Resume re-checks immediately
+	if err := hc.Resume(backend.URL); err != nil {
+		t.Fatalf("Resume: %v", err)
+	}
+	if hc.IsHealthy(backend.URL) {
+		t.Errorf("Expected resume to re-check and mark backend unhealthy")
+	}
+
+	if err := hc.Pause("http://unknown"); err == nil {
+		t.Errorf("Expected error pausing unknown backend")
+	}
+}
+
+func TestHealthCheckerDrainOverridesProbes(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	hc := NewHealthChecker([]string{backend.URL})
+	if err := hc.Drain(backend.URL, "deploy"); err != nil {
+		t.Fatalf("Drain: %v", err)
+	}
+	hc.RunChecks()
+	if hc.IsHealthy(backend.URL) {
+		t.Errorf("Expected drained backend to be down despite passing probes")
+	}
+
+	// A drained backend doesn't degrade /health
+	rec := httptest.NewRecorder()
+	hc.Handler()(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected /health 200 with only a drained backend down, got %d", rec.Code)
+	}
+
+	if err := hc.Undrain(backend.URL); err != nil {
+		t.Fatalf("Undrain: %v", err)
+	}
+	if !hc.IsHealthy(backend.URL) {
+		t.Errorf("Expected backend healthy after undrain")
+	}
+}
+
+func TestHealthCheckerRecordsProbeDiagnostics(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer backend.Close()
+
+	hc := NewHealthChecker([]string{backend.URL})
+	hc.RunChecks()
+	hc.RunChecks()
+
+	status, ok := hc.Status(backend.URL)
+	if !ok {
+		t.Fatalf("Expected status for known backend")
+	}
+	if status.ConsecutiveFailures != 2 {
+		t.Errorf("Expected 2 consecutive failures, got %d", status.ConsecutiveFailures)
+	}
+	if status.LastError != "unexpected status 500" {
+		t.Errorf("Expected last error to name the status, got %q", status.LastError)
+	}
+	if status.LastErrorAt == nil {
+		t.Errorf("Expected last error timestamp to be set")
+	}
+}
+
+func TestHealthCheckerTimelineRecordsTransitions(t *testing.T) {
+	var up atomic.Bool
+	up.Store(true)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if up.Load() {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer backend.Close()
+
+	hc := NewHealthChecker([]string{backend.URL})
+	hc.RunChecks()
+	hc.RunChecks()
+	up.Store(false)
+	hc.RunChecks()
+
+	transitions, uptime, ok := hc.Timeline(backend.URL, time.Hour)
+	if !ok {
+		t.Fatal("Expected timeline for known backend")
+	}
+	if len(transitions) != 2 || !transitions[0].Healthy || transitions[1].Healthy {
+		t.Fatalf("Expected up then down transitions, got %+v", transitions)
+	}
+	if transitions[1].Error == "" {
+		t.Error("Expected down transition to carry the probe error")
+	}
+	if uptime <= 0 || uptime >= 100 {
+		t.Errorf("Expected partial uptime, got %.2f", uptime)
+	}
+}
+
+func TestHealthCheckerStopEndsProbing(t *testing.T) {
+	var probes atomic.Int64
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probes.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	hc := NewHealthChecker([]string{backend.URL})
+	hc.StartBackground(10 * time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	hc.Stop()
+
+	stopped := probes.Load()
+	if stopped == 0 {
+		t.Fatalf("Expected probes before Stop")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := probes.Load(); n != stopped {
+		t.Errorf("Expected no probes after Stop, got %d more", n-stopped)
+	}
+	hc.Stop() // a second Stop is a no-op
+}
+
+func TestHealthCheckerSetHealthySkipsThresholds(t *testing.T) {
+	hc := NewHealthChecker(nil)
+	hc.SetThresholds(3, 3)
+	hc.AddBackend("http://localhost:9001")
+	var changes []bool
+	hc.OnStateChange = func(url string, healthy bool) { changes = append(changes, healthy) }
+
+	if err := hc.SetHealthy("http://localhost:9001", true); err != nil {
+		t.Fatalf("SetHealthy: %v", err)
+	}
+	if !hc.IsHealthy("http://localhost:9001") {
+		t.Error("Expected the backend in rotation at once, despite the thresholds")
+	}
+	hc.SetHealthy("http://localhost:9001", true)
+	if len(changes) != 1 || !changes[0] {
+		t.Errorf("Expected one state change, got %v", changes)
+	}
+	if err := hc.SetHealthy("http://localhost:9999", true); err == nil {
+		t.Error("Expected an error for an unknown backend")
+	}
+}
@@ -0,0 +1,130 @@
+package health
+
+import (
+	"sort"
+	"time"
+)
+
+// historySize is how many recent probe results are kept per backend.
+const historySize = 50
+
+// CheckResult is a single probe outcome kept in a backend's history.
+type CheckResult struct {
+	Time    time.Time `json:"time"`
+	OK      bool      `json:"ok"`      // whether the probe itself succeeded
+	Healthy bool      `json:"healthy"` // resulting health state after thresholds
+
+	DurationMs float64 `json:"duration_ms"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// addHistory appends a probe result to the backend's ring of recent results,
+// and records a transition timestamp if the health state changed.
+func (s *BackendStatus) addHistory(result CheckResult, changed bool) {
+	if len(s.history) < historySize {
+		s.history = append(s.history, result)
+	} else {
+		s.history[s.historyNext] = result
+	}
+	s.historyNext = (s.historyNext + 1) % historySize
+
+	if changed {
+		s.transitions = append(s.transitions, result.Time)
+	}
+}
+
+// recentHistory returns the stored results, oldest first.
+func (s *BackendStatus) recentHistory() []CheckResult {
+	out := make([]CheckResult, 0, len(s.history))
+	if len(s.history) < historySize {
+		return append(out, s.history...)
+	}
+	out = append(out, s.history[s.historyNext:]...)
+	return append(out, s.history[:s.historyNext]...)
+}
+
+// updateFlapping prunes transitions older than window and flags the backend
+// as flapping if at least threshold transitions remain.
+func (s *BackendStatus) updateFlapping(now time.Time, threshold int, window time.Duration) {
+	cutoff := now.Add(-window)
+	kept := s.transitions[:0]
+	for _, t := range s.transitions {
+		if t.After(cutoff) {
+			kept = append(kept, t)
+		}
+	}
+	s.transitions = kept
+	s.Flapping = threshold > 0 && len(s.transitions) >= threshold
+}
+
+// SetFlapDetection flags backends that change health state at least
+// threshold times within window. threshold 0 disables flap detection.
+func (hc *HealthChecker) SetFlapDetection(threshold int, window time.Duration) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	hc.flapThreshold = threshold
+	if window > 0 {
+		hc.flapWindow = window
+	}
+}
+
+// History returns a backend's recent probe results (oldest first) and
+// whether it is currently flapping. ok is false for unknown backends.
+func (hc *HealthChecker) History(url string) (history []CheckResult, flapping bool, ok bool) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	status, exists := hc.backends[url]
+	if !exists {
+		return nil, false, false
+	}
+	status.updateFlapping(time.Now(), hc.flapThreshold, hc.flapWindow)
+	return status.recentHistory(), status.Flapping, true
+}
+
+// Statuses returns a snapshot of every backend's status, sorted by URL.
+func (hc *HealthChecker) Statuses() []BackendStatus {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	now := time.Now()
+	out := make([]BackendStatus, 0, len(hc.backends))
+	for _, s := range hc.backends {
+		s.updateFlapping(now, hc.flapThreshold, hc.flapWindow)
+		out = append(out, s.snapshot())
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].URL < out[j].URL })
+	return out
+}
+
+// Status returns a snapshot of one backend's status.
+func (hc *HealthChecker) Status(url string) (BackendStatus, bool) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	s, exists := hc.backends[url]
+	if !exists {
+		return BackendStatus{}, false
+	}
+	s.updateFlapping(time.Now(), hc.flapThreshold, hc.flapWindow)
+	return s.snapshot(), true
+}
+
+// snapshot copies the exported fields, leaving out history and counters.
+func (s *BackendStatus) snapshot() BackendStatus {
+	return BackendStatus{
+		URL:       s.URL,
+		Healthy:   s.Healthy,
+		LastCheck: s.LastCheck,
+		Flapping:  s.Flapping,
+		Paused:    s.Paused,
+
+		Drained:     s.Drained,
+		DrainReason: s.DrainReason,
+
+		ProbeDurationMs:     s.ProbeDurationMs,
+		ConsecutiveFailures: s.ConsecutiveFailures,
+		LastError:           s.LastError,
+		LastErrorAt:         s.LastErrorAt,
+	}
+}
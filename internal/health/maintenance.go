@@ -0,0 +1,122 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Pause stops active probing during planned maintenance, so backends keep
+// their last known state instead of being marked down and flooding alerts.
+// An empty url pauses checking globally; otherwise only that backend.
+func (hc *HealthChecker) Pause(url string) error {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	if url == "" {
+		hc.paused = true
+		log.Printf("[health] checking paused for all backends")
+		return nil
+	}
+	status, exists := hc.backends[url]
+	if !exists {
+		return fmt.Errorf("backend %q not found", url)
+	}
+	status.Paused = true
+	log.Printf("[health] checking paused for %s", url)
+	return nil
+}
+
+// Resume re-enables probing (globally for an empty url, otherwise for one
+// backend) and immediately re-checks the affected backends, so their state
+// reflects reality as soon as maintenance ends.
+func (hc *HealthChecker) Resume(url string) error {
+	hc.mu.Lock()
+	if url == "" {
+		hc.paused = false
+		for _, status := range hc.backends {
+			status.nextCheck = time.Time{}
+		}
+		hc.mu.Unlock()
+		log.Printf("[health] checking resumed for all backends")
+		hc.RunChecks()
+		return nil
+	}
+
+	status, exists := hc.backends[url]
+	if !exists {
+		hc.mu.Unlock()
+		return fmt.Errorf("backend %q not found", url)
+	}
+	status.Paused = false
+	status.nextCheck = time.Time{}
+	globallyPaused := hc.paused
+	hc.mu.Unlock()
+
+	log.Printf("[health] checking resumed for %s", url)
+	if !globallyPaused {
+		hc.checkAndRecord(context.Background(), url)
+	}
+	return nil
+}
+
+// Paused reports whether checking is paused globally.
+func (hc *HealthChecker) Paused() bool {
+	hc.mu.RLock()
+	defer hc.mu.RUnlock()
+	return hc.paused
+}
+
+// Drain administratively marks a backend down regardless of probe results,
+// so traffic can be shifted away before a deploy. Probing continues, so the
+// real state is known the moment the drain is lifted.
+func (hc *HealthChecker) Drain(url, reason string) error {
+	hc.mu.Lock()
+	status, exists := hc.backends[url]
+	if !exists {
+		hc.mu.Unlock()
+		return fmt.Errorf("backend %q not found", url)
+	}
+	wasServing := status.serving()
+	status.Drained = true
+	status.DrainReason = reason
+	hc.mu.Unlock()
+
+	log.Printf("[health] backend %s drained (reason: %q)", url, reason)
+	if wasServing && hc.OnStateChange != nil {
+		hc.OnStateChange(url, false)
+	}
+	return nil
+}
+
+// Undrain lifts a manual drain; the backend's probed state applies again.
+func (hc *HealthChecker) Undrain(url string) error {
+	hc.mu.Lock()
+	status, exists := hc.backends[url]
+	if !exists {
+		hc.mu.Unlock()
+		return fmt.Errorf("backend %q not found", url)
+	}
+	wasDrained := status.Drained
+	status.Drained = false
+	status.DrainReason = ""
+	healthy := status.Healthy
+	hc.mu.Unlock()
+
+	log.Printf("[health] backend %s undrained", url)
+	if wasDrained && healthy && hc.OnStateChange != nil {
+		hc.OnStateChange(url, true)
+	}
+	return nil
+}
+
+// IsDrained reports whether a backend has been manually drained.
+func (hc *HealthChecker) IsDrained(url string) bool {
+	hc.mu.RLock()
+	defer hc.mu.RUnlock()
+	if status, exists := hc.backends[url]; exists {
+		return status.Drained
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package health
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// SetReady marks whether the gateway is accepting traffic. main sets it once
+// the listener is bound and clears it when shutdown begins, so orchestrators
+// stop routing to the gateway before connections are drained.
+func (hc *HealthChecker) SetReady(ready bool) {
+	hc.ready.Store(ready)
+}
+
+// SetMinHealthy sets how many backends must be healthy for /readyz to pass.
+// Values below 1 default to 1; the quorum never exceeds the number of backends.
+func (hc *HealthChecker) SetMinHealthy(n int) {
+	if n < 1 {
+		n = 1
+	}
+	hc.mu.Lock()
+	hc.minHealthy = n
+	hc.mu.Unlock()
+}
+
+// probeResponse is the JSON structure returned by /livez and /readyz.
+type probeResponse struct {
+	Status string            `json:"status"`
+	Uptime string            `json:"uptime"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// LivenessHandler returns the /livez handler. It reports only that the
+// process is running and serving HTTP; backend health never affects it,
+// so a backend outage doesn't get the gateway itself restarted.
+func (hc *HealthChecker) LivenessHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeProbe(w, http.StatusOK, probeResponse{
+			Status: "alive",
+			Uptime: time.Since(hc.startTime).Round(time.Second).String(),
+		})
+	}
+}
+
+// ReadinessHandler returns the /readyz handler. The gateway is ready when
+// its listener is up (config was loaded before that) and at least
+// minHealthy backends are healthy. Returns 503 otherwise.
+func (hc *HealthChecker) ReadinessHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		healthy, total := hc.BackendCounts()
+
+		hc.mu.RLock()
+		quorum := hc.minHealthy
+		hc.mu.RUnlock()
+		if quorum > total {
+			quorum = total
+		}
+
+		resp := probeResponse{
+			Status: "ready",
+			Uptime: time.Since(hc.startTime).Round(time.Second).String(),
+			Checks: map[string]string{
+				"config":   "ok",
+				"listener": "ok",
+				"backends": fmt.Sprintf("ok (%d/%d healthy, need %d)", healthy, total, quorum),
+			},
+		}
+		code := http.StatusOK
+
+		if !hc.ready.Load() {
+			resp.Status = "not_ready"
+			resp.Checks["listener"] = "not accepting traffic"
+			code = http.StatusServiceUnavailable
+		}
+		if healthy < quorum {
+			resp.Status = "not_ready"
+			resp.Checks["backends"] = fmt.Sprintf("below quorum (%d/%d healthy, need %d)", healthy, total, quorum)
+			code = http.StatusServiceUnavailable
+		}
+
+		writeProbe(w, code, resp)
+	}
+}
+
+func writeProbe(w http.ResponseWriter, code int, resp probeResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(resp)
+}
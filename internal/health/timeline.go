@@ -0,0 +1,141 @@
+package health
+
+import (
+	"log"
+	"time"
+
+	"github.com/tanmay/gateway/internal/state"
+)
+
+// timelineStateKey is the state store key for persisted health timelines.
+const timelineStateKey = "health_timeline"
+
+// Transition is one change of a backend's probed health state. The first
+// probe of a backend is recorded too, so uptime can be computed from it.
+type Transition struct {
+	Time    time.Time `json:"time"`
+	Healthy bool      `json:"healthy"`
+	Error   string    `json:"error,omitempty"` // probe error that caused a transition to down
+}
+
+// SetTimeline configures how long health transitions are kept (default 7
+// days) and, if store is non-nil, persists them there so the timeline
+// survives restarts. Previously saved transitions are loaded immediately.
+func (hc *HealthChecker) SetTimeline(store state.Store, retention time.Duration) {
+	if retention <= 0 {
+		retention = 7 * 24 * time.Hour
+	}
+
+	var saved map[string][]Transition
+	if store != nil {
+		if ok, err := store.Load(timelineStateKey, &saved); err != nil {
+			log.Printf("[health] failed to load timeline: %v", err)
+		} else if ok {
+			log.Printf("[health] restored health timeline for %d backends", len(saved))
+		}
+	}
+
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	hc.timelineStore = store
+	hc.timelineRetention = retention
+	for url, transitions := range saved {
+		hc.timeline[url] = transitions
+	}
+	hc.pruneTimeline(time.Now())
+}
+
+// timelineChanged reports whether healthy differs from the last recorded
+// transition, which also covers a backend's first probe and the first probe
+// after restoring a persisted timeline. Must hold hc.mu.
+func (hc *HealthChecker) timelineChanged(url string, healthy bool) bool {
+	ts := hc.timeline[url]
+	return len(ts) == 0 || ts[len(ts)-1].Healthy != healthy
+}
+
+// addTransition appends a transition and returns a copy of the whole
+// timeline to persist, or nil if there's no store. Must hold hc.mu.
+func (hc *HealthChecker) addTransition(url string, t Transition) map[string][]Transition {
+	hc.timeline[url] = append(hc.timeline[url], t)
+	hc.pruneTimeline(t.Time)
+	if hc.timelineStore == nil {
+		return nil
+	}
+	snapshot := make(map[string][]Transition, len(hc.timeline))
+	for u, ts := range hc.timeline {
+		snapshot[u] = append([]Transition(nil), ts...)
+	}
+	return snapshot
+}
+
+// saveTimeline persists a timeline snapshot. Called without hc.mu held;
+// transitions are rare, so saving on each one is cheap.
+func (hc *HealthChecker) saveTimeline(snapshot map[string][]Transition) {
+	if snapshot == nil {
+		return
+	}
+	if err := hc.timelineStore.Save(timelineStateKey, snapshot); err != nil {
+		log.Printf("[health] failed to save timeline: %v", err)
+	}
+}
+
+// pruneTimeline drops transitions older than the retention period, keeping
+// the last one before the cutoff so the state at the start is still known.
+// Must hold hc.mu.
+func (hc *HealthChecker) pruneTimeline(now time.Time) {
+	cutoff := now.Add(-hc.timelineRetention)
+	for url, ts := range hc.timeline {
+		i := 0
+		for i+1 < len(ts) && ts[i+1].Time.Before(cutoff) {
+			i++
+		}
+		if i > 0 {
+			hc.timeline[url] = append([]Transition(nil), ts[i:]...)
+		}
+	}
+}
+
+// Timeline returns a backend's transitions within [now-window, now) and its
+// uptime percentage over that window. Time before the first recorded probe
+// doesn't count either way. ok is false if nothing is known about the backend.
+func (hc *HealthChecker) Timeline(url string, window time.Duration) (transitions []Transition, uptimePercent float64, ok bool) {
+	hc.mu.RLock()
+	ts := append([]Transition(nil), hc.timeline[url]...)
+	hc.mu.RUnlock()
+	if len(ts) == 0 {
+		return nil, 0, false
+	}
+
+	now := time.Now()
+	from := now.Add(-window)
+
+	var up, known time.Duration
+	for i, t := range ts {
+		end := now
+		if i+1 < len(ts) {
+			end = ts[i+1].Time
+		}
+		start := t.Time
+		if start.Before(from) {
+			start = from
+		}
+		if !end.After(start) {
+			continue
+		}
+		known += end.Sub(start)
+		if t.Healthy {
+			up += end.Sub(start)
+		}
+		if !t.Time.Before(from) {
+			transitions = append(transitions, t)
+		}
+	}
+
+	if known > 0 {
+		uptimePercent = 100 * float64(up) / float64(known)
+	}
+	if transitions == nil {
+		transitions = []Transition{}
+	}
+	return transitions, uptimePercent, true
+}
@@ -2,8 +2,8 @@ package middleware
 
 import (
 	"log"
-	"net"
 	"net/http"
+	"sort"
 	"sync"
 	"time"
 
@@ -17,23 +17,66 @@ type AdaptiveRateLimitConfig struct {
 	MinLimit       float64       // never go below this (default 10)
 	MaxLimit       float64       // never go above this (default 10000)
 	LearningPeriod time.Duration // don't enforce adaptive limits until this much data (default 1h)
+
+	// Baseline selects which traffic statistic the limit is derived from:
+	// "mean" (default), "p95" (95th percentile bucket), or "peak" (busiest
+	// bucket in the window). Spiky-but-normal routes should use p95 or peak
+	// so legitimate peaks aren't throttled. RouteBaselines overrides per route.
+	Baseline       string
+	RouteBaselines map[string]string
+
+	// HardMultiplier enables two-tier enforcement when > 1. The adaptive limit
+	// becomes a soft limit: requests above it are allowed but tagged with
+	// SoftLimitHeader, logged, and counted as pressure. Only requests above
+	// the hard cap (soft limit × HardMultiplier) are rejected with 429.
+	HardMultiplier float64
+
+	// Shadow computes adaptive (and cold-start) limits and counts the
+	// requests they would reject, but never blocks on them: the static
+	// limiter stays in charge. Use it to validate learned limits before
+	// enforcing them.
+	Shadow bool
 }
 
-// AdaptiveRateLimiter wraps a static RateLimiter and dynamically adjusts
-// per-route limits based on learned traffic baselines from the Analyzer.
+// SoftLimitHeader is set on responses to requests that exceeded a route's
+// soft limit but were still allowed under its hard cap.
+const SoftLimitHeader = "X-RateLimit-Soft-Exceeded"
+
+// softLogInterval throttles soft-limit log lines to one per route per interval.
+const softLogInterval = time.Minute
+
+// Baseline statistics the adaptive limit can be derived from.
+const (
+	BaselineMean = "mean"
+	BaselineP95  = "p95"
+	BaselinePeak = "peak"
+)
+
+// AdaptiveRateLimiter wraps the static per-route limiters and dynamically
+// adjusts per-route limits based on learned traffic baselines from the Analyzer.
 type AdaptiveRateLimiter struct {
-	static   *RateLimiter
+	static   *RouteRateLimiter
 	analyzer *analytics.Analyzer
 	config   AdaptiveRateLimitConfig
 
-	mu             sync.RWMutex
-	routeLimiters  map[string]*RateLimiter // per-route rate limiters with adaptive limits
-	lastRebalance  time.Time
+	mu            sync.RWMutex
+	routeLimiters map[string]*RateLimiter             // per-route rate limiters with adaptive limits
+	hardLimiters  map[string]*RateLimiter             // per-route hard caps (two-tier mode only)
+	coldLimiters  map[string]*RateLimiter             // per-route cold-start limits (see analytics.ColdStartPolicy)
+	coldSince     map[string]time.Time                // when each cold-start limiter was created
+	derivations   map[string]analytics.RouteRateLimit // how each adaptive limit was derived, for Status
+	lastRebalance time.Time
+	lastSoftLog   map[string]time.Time
+	shadowCounts  map[string]int64 // route → would-be rejections (shadow mode)
+	lastShadowLog map[string]time.Time
+
+	profiles       *ProfileManager // optional per-route protection profiles
+	profileVersion uint64          // profiles.Version() at the last rebalance
 }
 
 // NewAdaptiveRateLimiter creates an adaptive rate limiter.
-// If the analyzer has insufficient data, it falls back to the static limiter.
-func NewAdaptiveRateLimiter(static *RateLimiter, analyzer *analytics.Analyzer, cfg AdaptiveRateLimitConfig) *AdaptiveRateLimiter {
+// If the analyzer has insufficient data, it falls back to the route's static limiter.
+func NewAdaptiveRateLimiter(static *RouteRateLimiter, analyzer *analytics.Analyzer, cfg AdaptiveRateLimitConfig) *AdaptiveRateLimiter {
 	if cfg.Multiplier <= 0 {
 		cfg.Multiplier = 3.0
 	}
@@ -46,13 +89,57 @@ func NewAdaptiveRateLimiter(static *RateLimiter, analyzer *analytics.Analyzer, c
 	if cfg.LearningPeriod <= 0 {
 		cfg.LearningPeriod = 1 * time.Hour
 	}
+	if cfg.Baseline == "" {
+		cfg.Baseline = BaselineMean
+	}
 
-	return &AdaptiveRateLimiter{
+	a := &AdaptiveRateLimiter{
 		static:        static,
 		analyzer:      analyzer,
 		config:        cfg,
 		routeLimiters: make(map[string]*RateLimiter),
+		hardLimiters:  make(map[string]*RateLimiter),
+		coldLimiters:  make(map[string]*RateLimiter),
+		coldSince:     make(map[string]time.Time),
+		derivations:   make(map[string]analytics.RouteRateLimit),
+		lastSoftLog:   make(map[string]time.Time),
+		shadowCounts:  make(map[string]int64),
+		lastShadowLog: make(map[string]time.Time),
+	}
+	static.mu.Lock()
+	static.derived = a.derivedLimiters
+	static.mu.Unlock()
+	return a
+}
+
+// derivedLimiters returns the adaptive, hard-cap, and cold-start limiters,
+// so the admin API can inspect and reset their buckets too.
+func (a *AdaptiveRateLimiter) derivedLimiters() []*RateLimiter {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	out := make([]*RateLimiter, 0, len(a.routeLimiters)+len(a.hardLimiters)+len(a.coldLimiters))
+	for _, m := range []map[string]*RateLimiter{a.routeLimiters, a.hardLimiters, a.coldLimiters} {
+		for _, rl := range m {
+			out = append(out, rl)
+		}
 	}
+	sort.Slice(out, func(i, j int) bool { return out[i].name < out[j].name })
+	return out
+}
+
+// SetProfiles applies per-route protection profiles: each route's limit
+// multiplier is scaled by its profile's LimitScale. Limits are recomputed
+// as soon as an assignment changes.
+func (a *AdaptiveRateLimiter) SetProfiles(pm *ProfileManager) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.profiles = pm
+}
+
+// twoTier reports whether soft/hard enforcement is enabled.
+func (a *AdaptiveRateLimiter) twoTier() bool {
+	return a.config.HardMultiplier > 1
 }
 
 // currentLimit computes the dynamic rate limit for a route based on analyzer baselines.
@@ -62,9 +149,32 @@ func (a *AdaptiveRateLimiter) currentLimit(route string) float64 {
 	if baseline == nil || baseline.SampleSize < 5 {
 		return 0 // not enough data
 	}
+	limit, _ := a.limitFor(baseline)
+	return limit
+}
 
-	// Dynamic limit = mean request rate per minute × multiplier
-	limit := baseline.MeanRate * a.config.Multiplier
+// baselineKind returns the configured baseline statistic for a route.
+func (a *AdaptiveRateLimiter) baselineKind(route string) string {
+	if kind, ok := a.config.RouteBaselines[route]; ok && kind != "" {
+		return kind
+	}
+	return a.config.Baseline
+}
+
+// limitFor derives the clamped per-minute limit for a route baseline.
+// Dynamic limit = chosen baseline rate × multiplier. Also returns the
+// baseline rate it was derived from, for logging.
+func (a *AdaptiveRateLimiter) limitFor(baseline *analytics.RouteBaseline) (limit, rate float64) {
+	switch a.baselineKind(baseline.Route) {
+	case BaselineP95:
+		rate = baseline.P95Rate
+	case BaselinePeak:
+		rate = baseline.PeakRate
+	default:
+		rate = baseline.MeanRate
+	}
+
+	limit = rate * a.multiplier(baseline.Route)
 
 	// Clamp to configured bounds
 	if limit < a.config.MinLimit {
@@ -74,7 +184,12 @@ func (a *AdaptiveRateLimiter) currentLimit(route string) float64 {
 		limit = a.config.MaxLimit
 	}
 
-	return limit
+	return limit, rate
+}
+
+// multiplier returns the route's effective multiplier after its protection profile.
+func (a *AdaptiveRateLimiter) multiplier(route string) float64 {
+	return a.config.Multiplier * a.profiles.For(route).LimitScale
 }
 
 // rebalance updates per-route rate limiters based on current baselines.
@@ -89,26 +204,77 @@ func (a *AdaptiveRateLimiter) rebalance() {
 			continue
 		}
 
-		limit := baseline.MeanRate * a.config.Multiplier
-		if limit < a.config.MinLimit {
-			limit = a.config.MinLimit
-		}
-		if limit > a.config.MaxLimit {
-			limit = a.config.MaxLimit
-		}
+		limit, rate := a.limitFor(baseline)
 
 		// maxTokens = burst capacity, refillRate = sustained rate per second
 		refillRate := limit / 60.0
 
+		d := a.derivations[route]
+		d.Route, d.Mode, d.Limit = route, "adaptive", limit
+		d.Baseline, d.BaselineRate, d.Multiplier = a.baselineKind(route), rate, a.multiplier(route)
+
+		// Existing limiters are resized in place so clients keep their
+		// bucket state across the change
 		existing, ok := a.routeLimiters[route]
-		if !ok || existing.maxTokens != limit {
-			a.routeLimiters[route] = NewRateLimiter(limit, refillRate)
-			log.Printf("[adaptive-rl] route=%s limit=%.0f req/min (mean=%.1f × %.1f)",
-				route, limit, baseline.MeanRate, a.config.Multiplier)
+		changed := !ok
+		if ok {
+			current, _ := existing.limits()
+			changed = current != limit
+		}
+		if changed {
+			d.UpdatedAt = time.Now()
+			static := a.static.For(route)
+			if ok {
+				existing.resize(limit, refillRate)
+			} else {
+				a.routeLimiters[route] = static.derive(limit, refillRate)
+				a.routeLimiters[route].SetName("adaptive:" + route)
+			}
+			log.Printf("[adaptive-rl] route=%s limit=%.0f req/min (%s=%.1f × %.1f)",
+				route, limit, a.baselineKind(route), rate, a.multiplier(route))
+
+			if a.twoTier() {
+				hard := limit * a.config.HardMultiplier
+				if h, ok := a.hardLimiters[route]; ok {
+					h.resize(hard, hard/60.0)
+				} else {
+					a.hardLimiters[route] = static.derive(hard, hard/60.0)
+					a.hardLimiters[route].SetName("hard:" + route)
+				}
+				d.HardCap = hard
+				log.Printf("[adaptive-rl] route=%s hard cap=%.0f req/min (soft limit × %.1f)",
+					route, hard, a.config.HardMultiplier)
+			}
+		}
+		a.derivations[route] = d
+	}
+
+	// Routes that gathered enough history no longer need their cold-start limiter
+	for route := range a.coldLimiters {
+		if !a.analyzer.RouteIsCold(route) {
+			delete(a.coldLimiters, route)
+			delete(a.coldSince, route)
 		}
 	}
 
 	a.lastRebalance = time.Now()
+	a.profileVersion = a.profiles.Version()
+}
+
+// coldLimiter returns the cold-start limiter for a route, creating it on first use.
+func (a *AdaptiveRateLimiter) coldLimiter(route string) *RateLimiter {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if rl, ok := a.coldLimiters[route]; ok {
+		return rl
+	}
+	limit := a.analyzer.ColdStart().RateLimit
+	rl := a.static.For(route).derive(limit, limit/60.0)
+	rl.SetName("cold:" + route)
+	a.coldLimiters[route] = rl
+	a.coldSince[route] = time.Now()
+	log.Printf("[adaptive-rl] route=%s cold start, limit=%.0f req/min until it has enough history", route, limit)
+	return rl
 }
 
 // Middleware returns the rate limiting middleware.
@@ -116,23 +282,71 @@ func (a *AdaptiveRateLimiter) rebalance() {
 func (a *AdaptiveRateLimiter) Middleware(routeResolver func(path string) string) Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Resolve the route for this request path
+			route := routeResolver(r.URL.Path)
+			w, r, done := a.static.countRejections(w, r, route)
+			defer done()
+			static := a.static.forRequest(route, r)
+
+			// Banned clients are cut off; allowlisted callers skip every limit
+			if a.static.rejectBanned(w, r, static) {
+				return
+			}
+			if a.static.exempt(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			cost := a.static.cost(route, r.Method)
+
+			// A route without enough history is held to the conservative
+			// cold-start limit, on top of its static limit
+			if a.analyzer.RouteIsCold(route) {
+				client := static.key(r)
+				cold := a.coldLimiter(route)
+				ok, cq := cold.take(client, cost)
+				if a.config.Shadow {
+					if !ok {
+						a.shadowReject(route, client, "cold-start")
+					}
+					static.serve(w, r, next, cost)
+					return
+				}
+				if !ok {
+					cold.writeHeaders(w, cq)
+					cold.reject(w, r, cost)
+					return
+				}
+				// Report whichever of the two limits leaves less room
+				ok, sq := static.take(client, cost)
+				if !ok || sq.remaining < cq.remaining {
+					static.writeHeaders(w, sq)
+				} else {
+					cold.writeHeaders(w, cq)
+				}
+				if !ok {
+					static.reject(w, r, cost)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
 			// If adaptive is disabled or not enough data yet, use static limiter
 			if !a.config.Enabled || !a.analyzer.HasSufficientData() {
-				a.static.Middleware()(next).ServeHTTP(w, r)
+				static.serve(w, r, next, cost)
 				return
 			}
 
-			// Periodically rebalance (every 5 minutes)
+			// Periodically rebalance (every 5 minutes), or right away after a
+			// protection profile change
 			a.mu.RLock()
-			needsRebalance := time.Since(a.lastRebalance) > 5*time.Minute
+			needsRebalance := time.Since(a.lastRebalance) > 5*time.Minute ||
+				a.profileVersion != a.profiles.Version()
 			a.mu.RUnlock()
 			if needsRebalance {
 				a.rebalance()
 			}
 
-			// Resolve the route for this request path
-			route := routeResolver(r.URL.Path)
-
 			// Look up route-specific limiter
 			a.mu.RLock()
 			rl, ok := a.routeLimiters[route]
@@ -140,19 +354,51 @@ func (a *AdaptiveRateLimiter) Middleware(routeResolver func(path string) string)
 
 			if !ok {
 				// No adaptive data for this route — fall back to static
-				a.static.Middleware()(next).ServeHTTP(w, r)
+				static.serve(w, r, next, cost)
 				return
 			}
 
-			// Check the adaptive rate limit
-			ip, _, _ := net.SplitHostPort(r.RemoteAddr)
-			rl.mu.Lock()
-			b := rl.getBucket(ip)
-			allowed := b.allow()
-			rl.mu.Unlock()
+			// Check the adaptive rate limit, keyed like the route's static limiter
+			client := static.key(r)
+			allowed, q := rl.take(client, cost)
+			reported := rl
 
+			// Every request counts against the hard cap, so that it bounds
+			// the total admitted and not just what exceeds the soft limit
+			var hard *RateLimiter
+			if a.twoTier() {
+				a.mu.RLock()
+				hard = a.hardLimiters[route]
+				a.mu.RUnlock()
+			}
+			hardOK, hq := true, q
+			if hard != nil {
+				hardOK, hq = hard.take(client, cost)
+			}
+
+			if a.config.Shadow {
+				switch {
+				case !hardOK:
+					a.shadowReject(route, client, "hard cap")
+				case !allowed && hard == nil:
+					a.shadowReject(route, client, "adaptive")
+				}
+				static.serve(w, r, next, cost)
+				return
+			}
+
+			switch {
+			case !hardOK:
+				allowed, q, reported = false, hq, hard
+			case !allowed && hard != nil:
+				// Over the soft limit but under the hard cap: let it through
+				a.softExceeded(w, route, client)
+				allowed, q, reported = true, hq, hard
+			}
+
+			reported.writeHeaders(w, q)
 			if !allowed {
-				http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+				reported.reject(w, r, cost)
 				return
 			}
 
@@ -160,3 +406,84 @@ func (a *AdaptiveRateLimiter) Middleware(routeResolver func(path string) string)
 		})
 	}
 }
+
+// softExceeded tags, counts, and (throttled) logs a request that went over a
+// route's soft limit but stayed under its hard cap.
+func (a *AdaptiveRateLimiter) softExceeded(w http.ResponseWriter, route, client string) {
+	w.Header().Set(SoftLimitHeader, "true")
+	rateLimitPressure.WithLabelValues(route).Inc()
+
+	a.mu.Lock()
+	shouldLog := time.Since(a.lastSoftLog[route]) >= softLogInterval
+	if shouldLog {
+		a.lastSoftLog[route] = time.Now()
+	}
+	a.mu.Unlock()
+
+	if shouldLog {
+		log.Printf("[adaptive-rl] route=%s client=%s over soft limit, allowed under hard cap", route, client)
+	}
+}
+
+// shadowReject counts and (throttled) logs a request the adaptive limiter
+// would have rejected in shadow mode.
+func (a *AdaptiveRateLimiter) shadowReject(route, client, limit string) {
+	rateLimitShadowRejections.WithLabelValues(route).Inc()
+
+	a.mu.Lock()
+	a.shadowCounts[route]++
+	shouldLog := time.Since(a.lastShadowLog[route]) >= softLogInterval
+	if shouldLog {
+		a.lastShadowLog[route] = time.Now()
+	}
+	a.mu.Unlock()
+
+	if shouldLog {
+		log.Printf("[adaptive-rl] shadow: route=%s client=%s would be rejected by the %s limit", route, client, limit)
+	}
+}
+
+// ShadowRejections returns, per route, how many requests shadow mode would
+// have rejected since startup.
+func (a *AdaptiveRateLimiter) ShadowRejections() map[string]int64 {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	out := make(map[string]int64, len(a.shadowCounts))
+	for route, n := range a.shadowCounts {
+		out[route] = n
+	}
+	return out
+}
+
+// Status reports the limits the adaptive limiter is enforcing per route,
+// with the baselines they were derived from.
+func (a *AdaptiveRateLimiter) Status() analytics.RateLimitStatus {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	status := analytics.RateLimitStatus{
+		Shadow:           a.config.Shadow,
+		LearningComplete: a.analyzer.HasSufficientData(),
+		Routes:           make([]analytics.RouteRateLimit, 0, len(a.derivations)+len(a.coldLimiters)),
+	}
+	if !a.lastRebalance.IsZero() {
+		t := a.lastRebalance
+		status.LastRebalance = &t
+	}
+	for route, d := range a.derivations {
+		if _, cold := a.coldLimiters[route]; !cold {
+			status.Routes = append(status.Routes, d)
+		}
+	}
+	for route, rl := range a.coldLimiters {
+		status.Routes = append(status.Routes, analytics.RouteRateLimit{
+			Route:     route,
+			Mode:      "cold_start",
+			Limit:     rl.maxTokens,
+			UpdatedAt: a.coldSince[route],
+		})
+	}
+	sort.Slice(status.Routes, func(i, j int) bool { return status.Routes[i].Route < status.Routes[j].Route })
+	return status
+}
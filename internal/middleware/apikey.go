@@ -0,0 +1,114 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// keyPrefixLen is how many leading characters of an API key are kept in
+// clear text, to tell keys apart in logs and config.
+const keyPrefixLen = 8
+
+// apiKey is a configured API key. Only a salted hash of the key is held;
+// the prefix identifies it in logs.
+type apiKey struct {
+	prefix  string
+	salt    []byte
+	hash    []byte
+	grant   Grant
+	expires time.Time // zero = never; set on a key being rotated out
+}
+
+// matches reports whether key hashes to this entry.
+func (k *apiKey) matches(key string) bool {
+	return subtle.ConstantTimeCompare(saltedHash(k.salt, key), k.hash) == 1
+}
+
+// KeyPrefix returns the part of an API key that is safe to log: its first
+// 8 characters, or half of it for short keys.
+func KeyPrefix(key string) string {
+	n := min(keyPrefixLen, len(key)/2)
+	return key[:n]
+}
+
+// NewKeyHash returns a freshly salted hash of key, in the
+// "sha256$<salt>$<hash>" form accepted by AddHashedAPIKey.
+func NewKeyHash(key string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	return "sha256$" + hex.EncodeToString(salt) + "$" + hex.EncodeToString(saltedHash(salt, key)), nil
+}
+
+func saltedHash(salt []byte, key string) []byte {
+	h := sha256.New()
+	h.Write(salt)
+	h.Write([]byte(key))
+	return h.Sum(nil)
+}
+
+// parseKeyHash splits a "sha256$<salt>$<hash>" string.
+func parseKeyHash(s string) (salt, hash []byte, err error) {
+	parts := strings.Split(s, "$")
+	if len(parts) != 3 || parts[0] != "sha256" {
+		return nil, nil, fmt.Errorf("key hash must look like sha256$<salt>$<hash>")
+	}
+	if salt, err = hex.DecodeString(parts[1]); err != nil {
+		return nil, nil, fmt.Errorf("key hash salt: %w", err)
+	}
+	if hash, err = hex.DecodeString(parts[2]); err != nil || len(hash) != sha256.Size {
+		return nil, nil, fmt.Errorf("key hash is not a hex SHA-256 digest")
+	}
+	return salt, hash, nil
+}
+
+// AddAPIKey registers an API key with the scopes and roles it grants. The
+// key is hashed on the way in. A non-zero expires retires the key at that
+// time, so a replacement can be rolled out alongside it for a grace period.
+// Must be called before serving.
+func (a *Auth) AddAPIKey(key string, g Grant, expires time.Time) error {
+	if key == "" {
+		return fmt.Errorf("empty API key")
+	}
+	hash, err := NewKeyHash(key)
+	if err != nil {
+		return err
+	}
+	return a.AddHashedAPIKey(KeyPrefix(key), hash, g, expires)
+}
+
+// AddHashedAPIKey registers an API key by its prefix (see KeyPrefix) and
+// salted hash (see NewKeyHash), so the key itself never appears in config.
+// Must be called before serving.
+func (a *Auth) AddHashedAPIKey(prefix, hash string, g Grant, expires time.Time) error {
+	salt, sum, err := parseKeyHash(hash)
+	if err != nil {
+		return err
+	}
+	if prefix == "" {
+		return fmt.Errorf("hashed API key needs its prefix")
+	}
+	a.keys[prefix] = append(a.keys[prefix], &apiKey{prefix: prefix, salt: salt, hash: sum, grant: g, expires: expires})
+	return nil
+}
+
+// lookupAPIKey finds the configured entry for key. On failure, reason says
+// why (unknown or expired) for the audit log.
+func (a *Auth) lookupAPIKey(key string) (entry *apiKey, reason string) {
+	for _, k := range a.keys[KeyPrefix(key)] {
+		if !k.matches(key) {
+			continue
+		}
+		if !k.expires.IsZero() && time.Now().After(k.expires) {
+			return nil, "key expired"
+		}
+		return k, ""
+	}
+	return nil, "unknown key"
+}
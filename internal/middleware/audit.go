@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// AuditEvent is a security-relevant decision made by the gateway
+// (auth bypasses, policy denials, ...). Written as one JSON line to stdout,
+// alongside the request logs, with "audit": true so it can be filtered.
+type AuditEvent struct {
+	Audit     bool   `json:"audit"`
+	Timestamp string `json:"timestamp"`
+	Event     string `json:"event"` // e.g. "trusted_caller"
+	Outcome   string `json:"outcome"`
+	RequestID string `json:"request_id,omitempty"`
+	Route     string `json:"route,omitempty"`
+	Method    string `json:"method,omitempty"`
+	Path      string `json:"path,omitempty"`
+	ClientIP  string `json:"client_ip,omitempty"`
+	Identity  string `json:"identity,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+var (
+	auditMu      sync.Mutex
+	auditEncoder = json.NewEncoder(os.Stdout)
+)
+
+// Audit writes an audit event for the given request.
+func Audit(r *http.Request, event AuditEvent) {
+	event.Audit = true
+	event.Timestamp = time.Now().UTC().Format(time.RFC3339)
+	event.RequestID = GetRequestID(r.Context())
+	event.Method = r.Method
+	event.Path = r.URL.Path
+	if event.ClientIP == "" {
+		event.ClientIP, _, _ = net.SplitHostPort(r.RemoteAddr)
+	}
+
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	auditEncoder.Encode(event)
+}
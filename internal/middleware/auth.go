@@ -1,50 +1,159 @@
 package middleware
 
 import (
+	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// Route auth modes
+const (
+	AuthAny    = "any"     // API key or JWT (default)
+	AuthAPIKey = "api_key" // API key only
+	AuthJWT    = "jwt"     // Bearer JWT only
+	AuthNone   = "none"    // public route, no credentials needed
+
+	// AuthAnonymous admits requests without credentials as anonymous
+	// (under the stricter anonymous rate limit); credentials that are
+	// sent are still checked as for AuthAny.
+	AuthAnonymous = "anonymous"
+)
+
 // Auth holds valid API keys and the JWT signing secret.
 type Auth struct {
-	apiKeys   map[string]bool
+	keys      map[string][]*apiKey // key prefix → hashed keys, see AddAPIKey
 	jwtSecret []byte
+	jwtPolicy JWTPolicy                 // claim/algorithm checks, see SetJWTPolicy
+	jwks      *JWKS                     // provider keys for RS*/ES* tokens, nil = HMAC only
+	trusted   map[string]*TrustedPolicy // route → trusted-caller policy
+	oidc      *OIDC                     // browser login, see SetOIDC
+	oidcRoute map[string]bool           // routes that require an OIDC session
+	modes     map[string]string         // route → auth mode, see SetRouteAuth
+	required  map[string]Requirement    // route → scopes/roles needed, see SetRequirement
+	forward   map[string]*ForwardAuth   // route → external auth service, see SetForwardAuth
 }
 
 // NewAuth creates an Auth middleware with the given API keys and JWT secret.
+// Keys are kept only as salted hashes.
 func NewAuth(apiKeys []string, jwtSecret string) *Auth {
-	keys := make(map[string]bool)
+	a := &Auth{
+		keys:      make(map[string][]*apiKey),
+		jwtSecret: []byte(jwtSecret),
+		trusted:   make(map[string]*TrustedPolicy),
+		oidcRoute: make(map[string]bool),
+		modes:     make(map[string]string),
+		required:  make(map[string]Requirement),
+		forward:   make(map[string]*ForwardAuth),
+	}
 	for _, k := range apiKeys {
-		keys[k] = true
+		if k != "" {
+			a.AddAPIKey(k, Grant{}, time.Time{})
+		}
 	}
-	return &Auth{
-		apiKeys:   keys,
-		jwtSecret: []byte(jwtSecret),
+	return a
+}
+
+// ValidAPIKey reports whether key is one of the configured, unexpired API keys.
+func (a *Auth) ValidAPIKey(key string) bool {
+	k, _ := a.lookupAPIKey(key)
+	return k != nil
+}
+
+// SetTrustedPolicy marks a route as internal-only: callers matching the policy
+// skip API key/JWT checks, everyone else gets 403. Must be called before serving.
+func (a *Auth) SetTrustedPolicy(route string, policy *TrustedPolicy) {
+	a.trusted[route] = policy
+}
+
+// SetOIDC requires an OIDC login session on a route instead of API keys or
+// JWTs. Must be called before serving.
+func (a *Auth) SetOIDC(route string, o *OIDC) {
+	a.oidc = o
+	a.oidcRoute[route] = true
+}
+
+// SetRouteAuth sets which credentials a route accepts: AuthAny (default),
+// AuthAPIKey, AuthJWT, AuthNone for public routes such as webhooks and
+// docs, or AuthAnonymous for public reads that authenticated callers may
+// also use. Must be called before serving.
+func (a *Auth) SetRouteAuth(route, mode string) error {
+	switch mode {
+	case "", AuthAny, AuthAPIKey, AuthJWT, AuthNone, AuthAnonymous:
+		a.modes[route] = mode
+		return nil
 	}
+	return fmt.Errorf("unknown auth mode %q (want none, anonymous, api_key, jwt, or any)", mode)
 }
 
 // Middleware returns the auth Middleware.
-// Checks X-API-Key header first, then falls back to Authorization: Bearer <JWT>.
-// If neither is valid, returns 401 Unauthorized.
-func (a *Auth) Middleware() Middleware {
+// Routes with a trusted-caller policy are checked against it instead, OIDC
+// routes require a login session, and forward-auth routes ask their auth service.
+// Otherwise checks X-API-Key header first, then falls back to Authorization: Bearer <JWT>,
+// as far as the route's auth mode allows. If neither is valid, returns 401 Unauthorized.
+// Authenticated requests carry the caller's identity headers upstream.
+func (a *Auth) Middleware(routeResolver func(path string) string) Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := routeResolver(r.URL.Path)
+			stripIdentityHeaders(r)
+			if policy, ok := a.trusted[route]; ok {
+				identity, trusted, reason := policy.Check(r)
+				if !trusted {
+					Audit(r, AuditEvent{Event: "trusted_caller", Outcome: "denied", Route: route, Reason: reason})
+					gatewayError(w, r, "forbidden", "Forbidden", http.StatusForbidden)
+					return
+				}
+				Audit(r, AuditEvent{Event: "trusted_caller", Outcome: "allowed", Route: route, Identity: identity})
+				next.ServeHTTP(w, r)
+				return
+			}
+			if a.oidcRoute[route] {
+				a.oidc.serve(w, r, next)
+				return
+			}
+			if f, ok := a.forward[route]; ok {
+				f.serve(w, r, route, next)
+				return
+			}
+
+			mode := a.modes[route]
+			if mode == AuthNone {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if mode == AuthAnonymous && !hasCredentials(r) {
+				markAnonymous(r)
+				next.ServeHTTP(w, r)
+				return
+			}
+
 			// Check API key first
-			if key := r.Header.Get("X-API-Key"); key != "" {
-				if a.apiKeys[key] {
-					next.ServeHTTP(w, r)
+			if key := r.Header.Get("X-API-Key"); key != "" && mode != AuthJWT {
+				identity := "key:" + KeyPrefix(key)
+				k, reason := a.lookupAPIKey(key)
+				if k != nil {
+					if a.authorize(w, r, route, identity, k.grant) {
+						setIdentityHeaders(r, "", k.prefix, k.grant.Scopes)
+						next.ServeHTTP(w, r)
+					}
 					return
 				}
-				http.Error(w, "Invalid API Key", http.StatusUnauthorized)
+				Audit(r, AuditEvent{Event: "api_key", Outcome: "denied", Route: route, Identity: identity, Reason: reason})
+				gatewayError(w, r, "unauthorized", "Invalid API Key", http.StatusUnauthorized)
+				return
+			}
+			if mode == AuthAPIKey {
+				gatewayError(w, r, "unauthorized", "API Key Required", http.StatusUnauthorized)
 				return
 			}
 
 			// Fall back to JWT Bearer token
 			authHeader := r.Header.Get("Authorization")
 			if authHeader == "" {
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				gatewayError(w, r, "unauthorized", "Unauthorized", http.StatusUnauthorized)
 				return
 			}
 
@@ -52,22 +161,24 @@ func (a *Auth) Middleware() Middleware {
 			tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 			if tokenString == authHeader {
 				// No "Bearer " prefix found
-				http.Error(w, "Invalid Authorization Header", http.StatusUnauthorized)
+				gatewayError(w, r, "unauthorized", "Invalid Authorization Header", http.StatusUnauthorized)
 				return
 			}
 
-			// Parse and validate the JWT
-			token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-				// keyFunc returns the secret used to verify the token's signature
-				return a.jwtSecret, nil
-			})
-
+			// Parse and validate the JWT: signature, algorithm, and claims
+			token, err := a.parseToken(tokenString)
 			if err != nil || !token.Valid {
-				http.Error(w, "Invalid Token", http.StatusUnauthorized)
+				gatewayError(w, r, "unauthorized", "Invalid Token", http.StatusUnauthorized)
 				return
 			}
 
-			next.ServeHTTP(w, r)
+			claims, _ := token.Claims.(jwt.MapClaims)
+			sub, _ := claims.GetSubject()
+			grant := claimsGrant(claims)
+			if a.authorize(w, r, route, "sub:"+sub, grant) {
+				setIdentityHeaders(r, sub, "", grant.Scopes)
+				next.ServeHTTP(w, r)
+			}
 		})
 	}
 }
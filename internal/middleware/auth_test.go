@@ -0,0 +1,454 @@
+package middleware
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestAuthTrustedPolicy(t *testing.T) {
+	auth := NewAuth([]string{"key-abc"}, "secret")
+	policy, err := NewTrustedPolicy([]string{"10.0.0.0/8", "192.168.1.5"}, nil)
+	if err != nil {
+		t.Fatalf("NewTrustedPolicy: %v", err)
+	}
+	auth.SetTrustedPolicy("/internal", policy)
+
+	resolver := NewRouteMatcher([]string{"/internal", "/api"}).Resolve
+	handler := auth.Middleware(resolver)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name       string
+		path       string
+		remoteAddr string
+		apiKey     string
+		want       int
+	}{
+		{"trusted network skips auth", "/internal/jobs", "10.1.2.3:5000", "", http.StatusOK},
+		{"trusted single IP skips auth", "/internal/jobs", "192.168.1.5:5000", "", http.StatusOK},
+		{"untrusted caller refused", "/internal/jobs", "203.0.113.9:5000", "", http.StatusForbidden},
+		{"api key does not unlock internal route", "/internal/jobs", "203.0.113.9:5000", "key-abc", http.StatusForbidden},
+		{"regular route still needs auth", "/api/users", "10.1.2.3:5000", "", http.StatusUnauthorized},
+		{"regular route with api key", "/api/users", "203.0.113.9:5000", "key-abc", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.apiKey != "" {
+				req.Header.Set("X-API-Key", tt.apiKey)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			if rr.Code != tt.want {
+				t.Errorf("Expected status %d, got %d", tt.want, rr.Code)
+			}
+		})
+	}
+}
+
+func TestAuthJWTPolicy(t *testing.T) {
+	auth := NewAuth(nil, "secret")
+	if err := auth.SetJWTPolicy(JWTPolicy{Issuer: "https://auth.example.com", Audience: "gateway", Leeway: 10 * time.Second, RequireExp: true}); err != nil {
+		t.Fatalf("SetJWTPolicy: %v", err)
+	}
+	if err := auth.SetJWTPolicy(JWTPolicy{Algorithms: []string{"none"}}); err == nil {
+		t.Errorf("Expected alg none to be refused")
+	}
+
+	handler := auth.Middleware(NewRouteMatcher([]string{"/api"}).Resolve)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	sign := func(method jwt.SigningMethod, key interface{}, claims jwt.MapClaims) string {
+		s, err := jwt.NewWithClaims(method, claims).SignedString(key)
+		if err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+		return s
+	}
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{"sub": "user-1", "iss": "https://auth.example.com", "aud": "gateway", "exp": time.Now().Add(time.Hour).Unix()}
+	}
+	with := func(key string, value interface{}) jwt.MapClaims {
+		c := valid()
+		if value == nil {
+			delete(c, key)
+		} else {
+			c[key] = value
+		}
+		return c
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"valid token", sign(jwt.SigningMethodHS256, []byte("secret"), valid()), http.StatusOK},
+		{"expired", sign(jwt.SigningMethodHS256, []byte("secret"), with("exp", time.Now().Add(-time.Minute).Unix())), http.StatusUnauthorized},
+		{"expired within leeway", sign(jwt.SigningMethodHS256, []byte("secret"), with("exp", time.Now().Add(-5*time.Second).Unix())), http.StatusOK},
+		{"not yet valid", sign(jwt.SigningMethodHS256, []byte("secret"), with("nbf", time.Now().Add(time.Minute).Unix())), http.StatusUnauthorized},
+		{"wrong issuer", sign(jwt.SigningMethodHS256, []byte("secret"), with("iss", "https://evil.example.com")), http.StatusUnauthorized},
+		{"wrong audience", sign(jwt.SigningMethodHS256, []byte("secret"), with("aud", "billing")), http.StatusUnauthorized},
+		{"missing exp", sign(jwt.SigningMethodHS256, []byte("secret"), with("exp", nil)), http.StatusUnauthorized},
+		{"alg none", sign(jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, valid()), http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/users", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("Expected %d, got %d", tt.want, rec.Code)
+			}
+		})
+	}
+}
+
+func TestAuthJWKSRotation(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	b64 := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+	// The provider starts with only the RSA key and later rotates in the EC key
+	keys := []map[string]string{
+		{"kid": "rsa-1", "kty": "RSA", "use": "sig", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+	}
+	fetches := 0
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+	}))
+	defer provider.Close()
+
+	auth := NewAuth(nil, "")
+	auth.SetJWKS(NewJWKS(provider.URL, time.Hour))
+	handler := auth.Middleware(NewRouteMatcher([]string{"/api"}).Resolve)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	send := func(method jwt.SigningMethod, kid string, key interface{}) int {
+		token := jwt.NewWithClaims(method, jwt.MapClaims{"sub": "user-1", "exp": time.Now().Add(time.Hour).Unix()})
+		token.Header["kid"] = kid
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+		req := httptest.NewRequest(http.MethodGet, "/api/users", nil)
+		req.Header.Set("Authorization", "Bearer "+signed)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if got := send(jwt.SigningMethodRS256, "rsa-1", rsaKey); got != http.StatusOK {
+		t.Fatalf("Expected RS256 token accepted, got %d", got)
+	}
+	if got := send(jwt.SigningMethodHS256, "rsa-1", []byte("")); got != http.StatusUnauthorized {
+		t.Errorf("Expected HMAC token refused without a secret, got %d", got)
+	}
+
+	keys = append(keys, map[string]string{"kid": "ec-1", "kty": "EC", "crv": "P-256", "x": b64(ecKey.X.Bytes()), "y": b64(ecKey.Y.Bytes())})
+	auth.jwks.fetchedAt = time.Time{} // past the refetch throttle
+	if got := send(jwt.SigningMethodES256, "ec-1", ecKey); got != http.StatusOK {
+		t.Errorf("Expected rotated-in ES256 key fetched on kid miss, got %d", got)
+	}
+	if got := send(jwt.SigningMethodES256, "unknown", ecKey); got != http.StatusUnauthorized {
+		t.Errorf("Expected unknown kid refused, got %d", got)
+	}
+	if fetches != 2 {
+		t.Errorf("Expected unknown kid refetch to be throttled (2 fetches), got %d", fetches)
+	}
+}
+
+func TestJWKSSlowProviderDoesNotBlockCachedKeys(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	b64 := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+	keys := []map[string]string{
+		{"kid": "rsa-1", "kty": "RSA", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+	}
+	release := make(chan struct{})
+	slow := false
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if slow {
+			<-release
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+	}))
+	defer provider.Close()
+	defer close(release)
+
+	jwks := NewJWKS(provider.URL, time.Hour)
+	if err := jwks.Refresh(); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+
+	// An unknown kid waits on a fetch the provider is sitting on
+	slow = true
+	jwks.mu.Lock()
+	jwks.fetchedAt = time.Time{} // past the refetch throttle
+	jwks.mu.Unlock()
+	missed := make(chan error, 1)
+	go func() {
+		_, err := jwks.Key("rotated")
+		missed <- err
+	}()
+
+	found := make(chan error, 1)
+	go func() {
+		_, err := jwks.Key("rsa-1")
+		found <- err
+	}()
+	select {
+	case err := <-found:
+		if err != nil {
+			t.Errorf("Expected the cached key, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected a cached key lookup not to wait for the provider")
+	}
+
+	release <- struct{}{}
+	if err := <-missed; err == nil {
+		t.Error("Expected the unknown kid refused once the fetch returned")
+	}
+}
+
+func TestAuthRouteModes(t *testing.T) {
+	auth := NewAuth([]string{"key-abc"}, "secret")
+	for route, mode := range map[string]string{"/public": AuthNone, "/keys": AuthAPIKey, "/tokens": AuthJWT} {
+		if err := auth.SetRouteAuth(route, mode); err != nil {
+			t.Fatalf("SetRouteAuth: %v", err)
+		}
+	}
+	if err := auth.SetRouteAuth("/x", "basic"); err == nil {
+		t.Errorf("Expected unknown auth mode to be refused")
+	}
+
+	resolver := NewRouteMatcher([]string{"/public", "/keys", "/tokens", "/api"}).Resolve
+	handler := auth.Middleware(resolver)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "user-1"}).SignedString([]byte("secret"))
+
+	tests := []struct {
+		name, path, apiKey, bearer string
+		want                       int
+	}{
+		{"public route needs nothing", "/public/docs", "", "", http.StatusOK},
+		{"api_key route accepts key", "/keys/items", "key-abc", "", http.StatusOK},
+		{"api_key route refuses jwt", "/keys/items", "", token, http.StatusUnauthorized},
+		{"jwt route accepts jwt", "/tokens/items", "", token, http.StatusOK},
+		{"jwt route refuses key", "/tokens/items", "key-abc", "", http.StatusUnauthorized},
+		{"default route accepts either", "/api/items", "", token, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.apiKey != "" {
+				req.Header.Set("X-API-Key", tt.apiKey)
+			}
+			if tt.bearer != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.bearer)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("Expected %d, got %d", tt.want, rec.Code)
+			}
+		})
+	}
+}
+
+func TestAuthRouteRequirements(t *testing.T) {
+	auth := NewAuth(nil, "secret")
+	auth.AddAPIKey("key-ops", Grant{Scopes: []string{"admin:write"}, Roles: []string{"ops"}}, time.Time{})
+	auth.AddAPIKey("key-read", Grant{Scopes: []string{"admin:read"}}, time.Time{})
+	auth.SetRequirement("/admin", Requirement{Scopes: []string{"admin:write"}, Roles: []string{"ops", "admin"}})
+
+	resolver := NewRouteMatcher([]string{"/admin", "/api"}).Resolve
+	handler := auth.Middleware(resolver)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	sign := func(claims jwt.MapClaims) string {
+		token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+		return token
+	}
+
+	tests := []struct {
+		name, path, apiKey, bearer string
+		want                       int
+	}{
+		{"key with scope and role", "/admin/users", "key-ops", "", http.StatusOK},
+		{"key missing scope", "/admin/users", "key-read", "", http.StatusForbidden},
+		{"key on unrestricted route", "/api/items", "key-read", "", http.StatusOK},
+		{"jwt scope string and roles", "/admin/users", "", sign(jwt.MapClaims{"scope": "openid admin:write", "roles": []string{"admin"}}), http.StatusOK},
+		{"jwt scp and realm roles", "/admin/users", "", sign(jwt.MapClaims{"scp": []string{"admin:write"}, "realm_access": map[string]interface{}{"roles": []string{"ops"}}}), http.StatusOK},
+		{"jwt missing role", "/admin/users", "", sign(jwt.MapClaims{"scope": "admin:write"}), http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.apiKey != "" {
+				req.Header.Set("X-API-Key", tt.apiKey)
+			}
+			if tt.bearer != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.bearer)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("Expected %d, got %d", tt.want, rec.Code)
+			}
+		})
+	}
+}
+
+func TestAuthHashedKeyRotation(t *testing.T) {
+	auth := NewAuth(nil, "")
+	oldKey, newKey := "gw_old-key-0123456789", "gw_new-key-9876543210"
+	hash, err := NewKeyHash(newKey)
+	if err != nil {
+		t.Fatalf("NewKeyHash: %v", err)
+	}
+	if err := auth.AddHashedAPIKey(KeyPrefix(newKey), hash, Grant{}, time.Time{}); err != nil {
+		t.Fatalf("AddHashedAPIKey: %v", err)
+	}
+	if err := auth.AddAPIKey(oldKey, Grant{}, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("AddAPIKey: %v", err)
+	}
+	if err := auth.AddAPIKey("gw_retired-key-000", Grant{}, time.Now().Add(-time.Minute)); err != nil {
+		t.Fatalf("AddAPIKey: %v", err)
+	}
+	if err := auth.AddHashedAPIKey("gw_", "md5$00$00", Grant{}, time.Time{}); err == nil {
+		t.Errorf("Expected malformed hash to be refused")
+	}
+
+	for _, entries := range auth.keys {
+		for _, k := range entries {
+			if string(k.hash) == oldKey || string(k.hash) == newKey {
+				t.Fatalf("Expected only hashes to be stored")
+			}
+		}
+	}
+	if KeyPrefix(newKey) != "gw_new-k" {
+		t.Errorf("Expected 8-character prefix, got %q", KeyPrefix(newKey))
+	}
+
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{newKey, true},
+		{oldKey, true}, // still inside its grace period
+		{"gw_retired-key-000", false},
+		{"gw_new-key-0000000000", false}, // same prefix, wrong key
+	}
+	for _, tt := range tests {
+		if got := auth.ValidAPIKey(tt.key); got != tt.want {
+			t.Errorf("ValidAPIKey(%q) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestAuthForwardAuth(t *testing.T) {
+	authService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Forwarded-Uri") != "/internal/items?id=1" || r.Header.Get("X-Forwarded-Method") != http.MethodPost {
+			t.Errorf("Expected original method and URI, got %s %s", r.Header.Get("X-Forwarded-Method"), r.Header.Get("X-Forwarded-Uri"))
+		}
+		if r.Header.Get("Cookie") != "session=ok" {
+			w.Header().Set("Location", "https://login.example.com")
+			w.WriteHeader(http.StatusFound)
+			return
+		}
+		w.Header().Set("X-User-Id", "user-42")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer authService.Close()
+
+	auth := NewAuth(nil, "")
+	fa, err := NewForwardAuth(authService.URL, []string{"X-User-Id"}, 0)
+	if err != nil {
+		t.Fatalf("NewForwardAuth: %v", err)
+	}
+	auth.SetForwardAuth("/internal", fa)
+	handler := auth.Middleware(NewRouteMatcher([]string{"/internal"}).Resolve)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("X-User-Id")))
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/internal/items?id=1", nil)
+	req.Header.Set("Cookie", "session=ok")
+	req.Header.Set("X-User-Id", "spoofed")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Body.String() != "user-42" {
+		t.Errorf("Expected 200 with X-User-Id from the auth service, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/internal/items?id=1", nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusFound || rec.Header().Get("Location") != "https://login.example.com" {
+		t.Errorf("Expected the auth service's redirect to be relayed, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+
+	authService.Close()
+	req = httptest.NewRequest(http.MethodPost, "/internal/items?id=1", nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 when the auth service is down, got %d", rec.Code)
+	}
+}
+
+func TestAuthIdentityHeaders(t *testing.T) {
+	auth := NewAuth(nil, "secret")
+	auth.AddAPIKey("gw_reader-key-123", Grant{Scopes: []string{"items:read"}}, time.Time{})
+	auth.SetRouteAuth("/public", AuthNone)
+	var got http.Header
+	handler := auth.Middleware(NewRouteMatcher([]string{"/api", "/public"}).Resolve)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+	}))
+	token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "user-1", "scope": "items:read items:write"}).SignedString([]byte("secret"))
+
+	tests := []struct {
+		name, path, apiKey, bearer string
+		user, keyID, scopes        string
+	}{
+		{"jwt", "/api/items", "", token, "user-1", "", "items:read items:write"},
+		{"api key", "/api/items", "gw_reader-key-123", "", "", "gw_reade", "items:read"},
+		{"public route strips spoofed headers", "/public/docs", "", "", "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set(HeaderUserID, "admin")
+			req.Header.Set(HeaderAPIKeyID, "spoofed")
+			req.Header.Set(HeaderScopes, "everything")
+			if tt.apiKey != "" {
+				req.Header.Set("X-API-Key", tt.apiKey)
+			}
+			if tt.bearer != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.bearer)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+			if got.Get(HeaderUserID) != tt.user || got.Get(HeaderAPIKeyID) != tt.keyID || got.Get(HeaderScopes) != tt.scopes {
+				t.Errorf("Expected user=%q key=%q scopes=%q, got user=%q key=%q scopes=%q", tt.user, tt.keyID, tt.scopes,
+					got.Get(HeaderUserID), got.Get(HeaderAPIKeyID), got.Get(HeaderScopes))
+			}
+		})
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/tanmay/gateway/internal/analytics"
 	"github.com/tanmay/gateway/internal/dashboard"
 )
 
@@ -71,6 +72,7 @@ func Capture(store *dashboard.LogStore) Middleware {
 			wrapped := &responseCapture{ResponseWriter: w, statusCode: 0}
 
 			// Execute the rest of the chain
+			r, info := analytics.WithResponseInfo(r)
 			next.ServeHTTP(wrapped, r)
 
 			// If no status was explicitly set during the request, default to 200
@@ -83,8 +85,8 @@ func Capture(store *dashboard.LogStore) Middleware {
 				clientIP = r.RemoteAddr
 			}
 
-			// Try to identify backend from context or headers (if set by proxy)
-			backend := w.Header().Get("X-Proxy-Backend")
+			// Identify the backend, if the proxy picked one
+			backend := info.Backend()
 
 			// Push log to channel anonymously
 			select {
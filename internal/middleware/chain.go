@@ -1,6 +1,14 @@
 package middleware
 
-import "net/http"
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/tanmay/gateway/internal/analytics"
+	"github.com/tanmay/gateway/internal/apierror"
+)
 
 // Middleware is a function that wraps an http.Handler with additional behavior.
 type Middleware func(http.Handler) http.Handler
@@ -14,3 +22,21 @@ func Chain(handler http.Handler, middlewares ...Middleware) http.Handler {
 	}
 	return handler
 }
+
+// gatewayError writes a JSON error response generated by the gateway itself,
+// tagging the request so traffic analytics can tell it apart from backend
+// errors. The error code is the upper-cased reason (rate_limited → RATE_LIMITED).
+func gatewayError(w http.ResponseWriter, r *http.Request, reason, message string, code int) {
+	analytics.ResponseInfoFrom(r.Context()).SetGatewayError(reason)
+	apierror.Write(w, code, apierror.CodeFor(reason), message)
+}
+
+// setRetryAfter sets the Retry-After header in whole seconds (at least 1),
+// which gatewayError also reports as retry_after in the error body.
+func setRetryAfter(w http.ResponseWriter, d time.Duration) {
+	secs := int(math.Ceil(d.Seconds()))
+	if secs < 1 {
+		secs = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(secs))
+}
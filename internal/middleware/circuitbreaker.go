@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"math"
 	"net/http"
 	"sync"
 	"time"
@@ -12,24 +13,48 @@ import (
 const (
 	StateClosed   = iota // normal — requests flow through
 	StateOpen            // tripped — all requests rejected
-	StateHalfOpen        // testing — allow one request to check if backend recovered
+	StateHalfOpen        // testing — let a few probe requests check if the backend recovered
 )
 
+// StateName returns the API name of a breaker state.
+func StateName(state int) string {
+	switch state {
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half_open"
+	}
+	return "closed"
+}
+
 // CircuitBreaker prevents cascading failures by tracking backend errors.
-// If failures exceed the threshold, it "opens" and rejects requests
-// until a timeout passes, then lets one request through to test recovery.
+// If failures within a rolling window (see SetWindow) exceed the
+// threshold, it "opens" and rejects requests
+// until a timeout passes, then goes half-open: up to maxProbes requests at
+// a time are let through to test recovery, and successThreshold successes
+// in a row close it again.
 //
 // When an Analyzer is set via SetAnalyzer(), the threshold is dynamically
 // computed as 5× the baseline error rate (with a minimum floor of 5%).
 type CircuitBreaker struct {
-	state        int
-	failureCount int
-	threshold    int           // static failures before opening
-	timeout      time.Duration // how long to stay open before trying again
-	lastFailure  time.Time
-	mu           sync.Mutex
-	analyzer     *analytics.Analyzer // optional — enables dynamic thresholds
-	totalCount   int                 // total requests in current window (for error rate)
+	name        string // reported in metrics and the admin API
+	state       int
+	outcomes    *outcomeWindow // request outcomes over the rolling window
+	threshold   int            // static failures within the window before opening
+	timeout     time.Duration  // how long to stay open before trying again
+	lastFailure time.Time
+	lastChange  time.Time // last state transition
+	forced      bool      // opened by an operator; stays open until Reset
+	successes   int       // consecutive probe successes while half-open
+	probes      int       // probe requests in flight while half-open
+	needed      int       // probe successes needed to close (default 1)
+	maxProbes   int       // concurrent probes allowed while half-open (default 1)
+	mu          sync.Mutex
+	analyzer    *analytics.Analyzer // optional — enables dynamic thresholds
+	profiles    *ProfileManager     // optional — per-route threshold/timeout scaling
+	budget      *RetryBudget        // optional — trips when retries hide failures
+	onChange    func(BreakerEvent)  // optional — notified of state transitions
+	pending     []BreakerEvent      // transitions to report once mu is released
 }
 
 // NewCircuitBreaker creates a circuit breaker.
@@ -37,12 +62,52 @@ type CircuitBreaker struct {
 // timeout = how long to wait before trying again (e.g., 30s)
 func NewCircuitBreaker(threshold int, timeout time.Duration) *CircuitBreaker {
 	return &CircuitBreaker{
+		name:      DefaultBreaker,
 		state:     StateClosed,
+		outcomes:  newOutcomeWindow(DefaultBreakerWindow),
 		threshold: threshold,
 		timeout:   timeout,
+		needed:    1,
+		maxProbes: 1,
 	}
 }
 
+// SetName sets the label the breaker's metrics are reported under
+// (the route, or "default"). Must be called before serving.
+func (cb *CircuitBreaker) SetName(name string) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.name = name
+	breakerState.WithLabelValues(name).Set(float64(cb.state))
+}
+
+// SetOnStateChange registers a hook called after every state transition,
+// outside the breaker's lock. Must be called before serving.
+func (cb *CircuitBreaker) SetOnStateChange(fn func(BreakerEvent)) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.onChange = fn
+}
+
+// SetWindow sets how far back request outcomes count towards tripping
+// (default 1m). Must be called before serving.
+func (cb *CircuitBreaker) SetWindow(window time.Duration) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.outcomes = newOutcomeWindow(window)
+}
+
+// SetHalfOpen sets how many consecutive probe successes close the breaker
+// and how many probes may be in flight at once while half-open, so one
+// lucky request doesn't send full traffic back to a backend that is still
+// struggling. Values below 1 mean 1. Must be called before serving.
+func (cb *CircuitBreaker) SetHalfOpen(successes, maxProbes int) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.needed = max(successes, 1)
+	cb.maxProbes = max(maxProbes, 1)
+}
+
 // SetAnalyzer enables dynamic threshold computation based on learned error baselines.
 // When set, the circuit breaker opens when the error rate exceeds 5× the baseline,
 // instead of using the static failure count threshold.
@@ -52,17 +117,42 @@ func (cb *CircuitBreaker) SetAnalyzer(a *analytics.Analyzer) {
 	cb.analyzer = a
 }
 
-// shouldTrip decides whether the circuit should open.
+// SetProfiles applies per-route protection profiles. The breaker state is
+// shared, but the trip threshold and open timeout are scaled by the profile
+// of the route each request belongs to.
+func (cb *CircuitBreaker) SetProfiles(pm *ProfileManager) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.profiles = pm
+}
+
+// SetRetryBudget makes the breaker consult the retry budget: it trips when
+// a route's budget is exhausted, since retries are then masking a failing
+// backend, and marks half-open probes so they are never retried.
+func (cb *CircuitBreaker) SetRetryBudget(b *RetryBudget) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.budget = b
+}
+
+// shouldTrip decides whether the circuit should open, looking at outcomes
+// within the rolling window.
 // With an analyzer: uses dynamic error-rate threshold (5× baseline, min 5%).
 // Without: uses the static failure count threshold.
-func (cb *CircuitBreaker) shouldTrip(backend string) bool {
-	if cb.analyzer != nil && cb.analyzer.HasSufficientData() && cb.totalCount > 0 {
-		currentErrorRate := float64(cb.failureCount) / float64(cb.totalCount)
-		dynamicThreshold := cb.dynamicThreshold(backend)
+// Both are scaled by the route's protection profile.
+func (cb *CircuitBreaker) shouldTrip(backend string, profile ProtectionProfile) bool {
+	total, failures := cb.outcomes.counts(time.Now())
+	if cb.analyzer != nil && cb.analyzer.HasSufficientData() && total > 0 {
+		currentErrorRate := float64(failures) / float64(total)
+		dynamicThreshold := cb.dynamicThreshold(backend) * profile.BreakerThresholdScale
 		return currentErrorRate > dynamicThreshold
 	}
 	// Fall back to static threshold
-	return cb.failureCount >= cb.threshold
+	threshold := int(math.Ceil(float64(cb.threshold) * profile.BreakerThresholdScale))
+	if threshold < 1 {
+		threshold = 1
+	}
+	return failures >= threshold
 }
 
 // dynamicThreshold computes the error-rate threshold for a backend based on its baseline.
@@ -71,6 +161,11 @@ func (cb *CircuitBreaker) dynamicThreshold(backend string) float64 {
 		return 1.0 // never trip (effectively disabled)
 	}
 
+	if cb.analyzer.BackendIsCold(backend) {
+		// New backend — hold it to the stricter cold-start threshold
+		return cb.analyzer.ColdStart().BreakerErrorRate
+	}
+
 	baseline := cb.analyzer.GetBackendBaseline(backend)
 	if baseline == nil || baseline.SampleSize < 2 {
 		// Not enough data — use a generous default
@@ -84,58 +179,257 @@ func (cb *CircuitBreaker) dynamicThreshold(backend string) float64 {
 	return threshold
 }
 
-// Middleware returns the circuit breaker Middleware.
-func (cb *CircuitBreaker) Middleware() Middleware {
+// Middleware returns the circuit breaker Middleware. routeResolver maps a
+// request path to its route, used to look up the route's protection profile.
+func (cb *CircuitBreaker) Middleware(routeResolver func(path string) string) Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			cb.mu.Lock()
-
-			switch cb.state {
-			case StateOpen:
-				// Check if timeout has passed — if so, move to half-open
-				if time.Since(cb.lastFailure) > cb.timeout {
-					cb.state = StateHalfOpen
-					cb.mu.Unlock()
-					// Fall through to try one request
-				} else {
-					cb.mu.Unlock()
-					http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
-					return
-				}
-
-			case StateClosed, StateHalfOpen:
-				cb.mu.Unlock()
-				// Fall through to handle request
-			}
+			cb.serve(w, r, next, routeResolver(r.URL.Path))
+		})
+	}
+}
+
+// serve passes a request of the given route through the breaker.
+func (cb *CircuitBreaker) serve(w http.ResponseWriter, r *http.Request, next http.Handler, route string) {
+	cb.mu.Lock()
+	profile := cb.profiles.For(route)
+	timeout := time.Duration(float64(cb.timeout) * profile.BreakerTimeoutScale)
 
-			// Wrap response writer to capture status code
-			wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
-			next.ServeHTTP(wrapped, r)
-
-			// Identify backend from response headers (set by proxy)
-			backend := w.Header().Get("X-Proxy-Backend")
-
-			// Check if the request failed (5xx = backend error)
-			cb.mu.Lock()
-			cb.totalCount++
-			if wrapped.statusCode >= 500 {
-				cb.failureCount++
-				cb.lastFailure = time.Now()
-
-				if cb.state == StateHalfOpen {
-					// Half-open test failed → back to open
-					cb.state = StateOpen
-				} else if cb.shouldTrip(backend) {
-					// Too many failures → open the circuit
-					cb.state = StateOpen
-				}
-			} else {
-				// Success — reset everything
-				cb.failureCount = 0
-				cb.totalCount = 0
-				cb.state = StateClosed
+	probe := false
+	switch cb.state {
+	case StateOpen:
+		// Check if timeout has passed — if so, move to half-open
+		if !cb.forced && time.Since(cb.lastFailure) > timeout {
+			cb.setState(StateHalfOpen)
+			cb.successes, cb.probes = 0, 0
+		} else {
+			remaining := timeout - time.Since(cb.lastFailure)
+			if cb.forced {
+				remaining = timeout
 			}
-			cb.mu.Unlock()
-		})
+			name := cb.name
+			cb.unlock()
+			breakerRejected.WithLabelValues(name, route).Inc()
+			setRetryAfter(w, remaining)
+			gatewayError(w, r, "circuit_open", "Service Unavailable", http.StatusServiceUnavailable)
+			return
+		}
+	}
+	if cb.state == StateHalfOpen {
+		// Only a limited number of probes at a time; the rest wait for
+		// their verdict
+		if cb.probes >= cb.maxProbes {
+			name := cb.name
+			cb.unlock()
+			breakerRejected.WithLabelValues(name, route).Inc()
+			setRetryAfter(w, time.Second)
+			gatewayError(w, r, "circuit_open", "Service Unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		cb.probes++
+		probe = true
+	}
+	budget := cb.budget
+	cb.unlock()
+
+	if probe && budget != nil {
+		r = markProbe(r)
+	}
+
+	// Wrap response writer to capture status code
+	wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+	r, info := analytics.WithResponseInfo(r)
+	next.ServeHTTP(wrapped, r)
+
+	// Identify the backend, if the proxy picked one
+	backend := info.Backend()
+
+	// Check if the request failed (5xx = backend error)
+	cb.mu.Lock()
+	if probe && cb.probes > 0 {
+		cb.probes--
+	}
+	if info.GatewayError() != "" {
+		// The gateway refused the request itself (a full bulkhead, no
+		// healthy backends), which says nothing about the backend
+		cb.unlock()
+		return
+	}
+	failed := wrapped.statusCode >= 500
+	cb.outcomes.record(time.Now(), failed)
+	if probe {
+		outcome := "success"
+		if failed {
+			outcome = "failure"
+		}
+		breakerProbes.WithLabelValues(cb.name, outcome).Inc()
+	}
+	if failed {
+		cb.lastFailure = time.Now()
+		breakerFailures.WithLabelValues(cb.name, backend).Inc()
+
+		if cb.state == StateHalfOpen {
+			// Half-open test failed → back to open
+			cb.setState(StateOpen)
+		} else if cb.shouldTrip(backend, profile) {
+			// Too many failures → open the circuit
+			cb.setState(StateOpen)
+		}
+	} else if cb.state == StateHalfOpen {
+		// Close only after enough probes in a row succeed
+		if probe {
+			cb.successes++
+		}
+		if cb.successes >= cb.needed {
+			cb.outcomes.reset()
+			cb.setState(StateClosed)
+		}
+	}
+	if cb.state == StateClosed && budget != nil && budget.Exhausted(route) {
+		// Requests may still succeed, but only because they're being retried
+		cb.lastFailure = time.Now()
+		cb.setState(StateOpen)
+	}
+	cb.unlock()
+}
+
+// setState moves the breaker to state, recording when it changed.
+// Must hold cb.mu; the change is reported by unlock.
+func (cb *CircuitBreaker) setState(state int) {
+	if cb.state != state {
+		from := cb.state
+		cb.state = state
+		cb.lastChange = time.Now()
+		breakerState.WithLabelValues(cb.name).Set(float64(state))
+		breakerTransitions.WithLabelValues(cb.name, StateName(state)).Inc()
+		if cb.onChange != nil {
+			cb.pending = append(cb.pending, BreakerEvent{
+				BreakerStatus: cb.status(cb.name),
+				From:          StateName(from),
+			})
+		}
+	}
+}
+
+// unlock releases cb.mu, then reports any transitions made while it was
+// held, so the hook can't stall requests or deadlock by calling back in.
+func (cb *CircuitBreaker) unlock() {
+	events, fn := cb.pending, cb.onChange
+	cb.pending = nil
+	cb.mu.Unlock()
+	for _, e := range events {
+		fn(e)
+	}
+}
+
+// Trip opens the breaker by hand, e.g. to shed load from a backend during
+// an incident. It stays open, without half-open probes, until Reset.
+func (cb *CircuitBreaker) Trip() {
+	cb.mu.Lock()
+	defer cb.unlock()
+	cb.forced = true
+	cb.lastFailure = time.Now()
+	cb.setState(StateOpen)
+}
+
+// Reset closes the breaker by hand and clears its failure counts.
+func (cb *CircuitBreaker) Reset() {
+	cb.mu.Lock()
+	defer cb.unlock()
+	cb.forced = false
+	cb.outcomes.reset()
+	cb.setState(StateClosed)
+}
+
+// BreakerStatus describes a breaker for the admin API.
+type BreakerStatus struct {
+	Name           string     `json:"name"` // "default" or the route
+	State          string     `json:"state"`
+	FailureCount   int        `json:"failure_count"` // within the rolling window
+	TotalCount     int        `json:"total_count"`
+	LastFailure    *time.Time `json:"last_failure,omitempty"`
+	LastTransition *time.Time `json:"last_transition,omitempty"`
+	Manual         bool       `json:"manual"` // opened by an operator
+}
+
+// BreakerEvent reports a state transition: the breaker's status just
+// after it, and the state it left.
+type BreakerEvent struct {
+	BreakerStatus
+	From string `json:"from"`
+}
+
+// Status returns the breaker's current state under the given name.
+func (cb *CircuitBreaker) Status(name string) BreakerStatus {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.status(name)
+}
+
+// status is Status. Must hold cb.mu.
+func (cb *CircuitBreaker) status(name string) BreakerStatus {
+	total, failures := cb.outcomes.counts(time.Now())
+	s := BreakerStatus{
+		Name:         name,
+		State:        StateName(cb.state),
+		FailureCount: failures,
+		TotalCount:   total,
+		Manual:       cb.forced,
+	}
+	if !cb.lastFailure.IsZero() {
+		t := cb.lastFailure
+		s.LastFailure = &t
+	}
+	if !cb.lastChange.IsZero() {
+		t := cb.lastChange
+		s.LastTransition = &t
+	}
+	return s
+}
+
+// BreakerState is the persisted form of a CircuitBreaker.
+type BreakerState struct {
+	State        int       `json:"state"`
+	FailureCount int       `json:"failure_count"`
+	TotalCount   int       `json:"total_count"`
+	LastFailure  time.Time `json:"last_failure"`
+	LastChange   time.Time `json:"last_change,omitempty"`
+	Forced       bool      `json:"forced,omitempty"`
+}
+
+// Snapshot returns the breaker's current state for persistence.
+func (cb *CircuitBreaker) Snapshot() BreakerState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	total, failures := cb.outcomes.counts(time.Now())
+	return BreakerState{
+		State:        cb.state,
+		FailureCount: failures,
+		TotalCount:   total,
+		LastFailure:  cb.lastFailure,
+		LastChange:   cb.lastChange,
+		Forced:       cb.forced,
+	}
+}
+
+// Restore applies a persisted state. An open breaker keeps its original
+// LastFailure, so only the remaining cool-down is served after a restart
+// instead of immediately sending full traffic to a recovering backend.
+// A half-open breaker is restored as open with the cool-down already elapsed,
+// so the next request becomes the probe. A manually opened breaker stays
+// open until reset.
+func (cb *CircuitBreaker) Restore(s BreakerState) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.state = s.State
+	cb.outcomes.reset()
+	cb.outcomes.add(time.Now(), s.TotalCount, s.FailureCount)
+	cb.lastFailure = s.LastFailure
+	cb.lastChange = s.LastChange
+	cb.forced = s.Forced
+	if cb.state == StateHalfOpen {
+		cb.state = StateOpen
 	}
+	breakerState.WithLabelValues(cb.name).Set(float64(cb.state))
 }
@@ -0,0 +1,221 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/tanmay/gateway/internal/analytics"
+)
+
+// RouteCircuitBreaker picks a CircuitBreaker per route. Routes configured
+// with their own settings get a separate breaker and failure budget, so a
+// flaky batch endpoint can't trip checkout; every other route shares the
+// default breaker. Routes can also opt out of breaking entirely.
+type RouteCircuitBreaker struct {
+	def      *CircuitBreaker
+	routes   map[string]*CircuitBreaker
+	disabled map[string]bool
+	mu       sync.RWMutex
+}
+
+// NewRouteCircuitBreaker creates a per-route breaker that falls back to def.
+func NewRouteCircuitBreaker(def *CircuitBreaker) *RouteCircuitBreaker {
+	def.SetName(DefaultBreaker)
+	return &RouteCircuitBreaker{
+		def:      def,
+		routes:   make(map[string]*CircuitBreaker),
+		disabled: make(map[string]bool),
+	}
+}
+
+// SetRoute gives a route its own breaker. Call before SetAnalyzer and
+// SetProfiles so they reach it too.
+func (rc *RouteCircuitBreaker) SetRoute(route string, cb *CircuitBreaker) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	cb.SetName(route)
+	rc.routes[route] = cb
+}
+
+// Disable turns the breaker off for a route: its failures are not counted
+// and it is never rejected. Must be called before serving.
+func (rc *RouteCircuitBreaker) Disable(route string) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.disabled[route] = true
+}
+
+// For returns the breaker that applies to a route, or nil if disabled.
+func (rc *RouteCircuitBreaker) For(route string) *CircuitBreaker {
+	rc.mu.RLock()
+	defer rc.mu.RUnlock()
+	if rc.disabled[route] {
+		return nil
+	}
+	if cb, ok := rc.routes[route]; ok {
+		return cb
+	}
+	return rc.def
+}
+
+// DefaultBreaker names the breaker shared by routes without their own.
+const DefaultBreaker = "default"
+
+// Statuses lists every breaker: the default first, then route breakers
+// sorted by route.
+func (rc *RouteCircuitBreaker) Statuses() []BreakerStatus {
+	rc.mu.RLock()
+	routes := make([]string, 0, len(rc.routes))
+	for route := range rc.routes {
+		routes = append(routes, route)
+	}
+	rc.mu.RUnlock()
+	sort.Strings(routes)
+
+	out := []BreakerStatus{rc.def.Status(DefaultBreaker)}
+	for _, route := range routes {
+		out = append(out, rc.named(route).Status(route))
+	}
+	return out
+}
+
+// named returns the breaker called name (DefaultBreaker or a route with
+// its own breaker), or nil.
+func (rc *RouteCircuitBreaker) named(name string) *CircuitBreaker {
+	if name == DefaultBreaker {
+		return rc.def
+	}
+	rc.mu.RLock()
+	defer rc.mu.RUnlock()
+	return rc.routes[name]
+}
+
+// AdminHandler serves the breaker admin API, for operators to see why
+// traffic is being rejected and to intervene during incidents:
+//   - GET  list breakers: state, failure counts, last transition
+//   - POST {"breaker": "default" | "<route>", "action": "open" | "close"}
+//
+// A manually opened breaker stays open, without probes, until closed.
+func (rc *RouteCircuitBreaker) AdminHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			var req struct {
+				Breaker string `json:"breaker"`
+				Action  string `json:"action"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			cb := rc.named(req.Breaker)
+			if cb == nil {
+				http.Error(w, fmt.Sprintf("no breaker %q", req.Breaker), http.StatusNotFound)
+				return
+			}
+			switch req.Action {
+			case "open":
+				cb.Trip()
+			case "close":
+				cb.Reset()
+			default:
+				http.Error(w, `"action" must be "open" or "close"`, http.StatusBadRequest)
+				return
+			}
+			Audit(r, AuditEvent{Event: "circuit_breaker_" + req.Action, Outcome: "allowed", Route: req.Breaker})
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"breakers": rc.Statuses(),
+		})
+	})
+}
+
+// breakers returns the default breaker followed by the route breakers.
+func (rc *RouteCircuitBreaker) breakers() []*CircuitBreaker {
+	rc.mu.RLock()
+	defer rc.mu.RUnlock()
+	out := []*CircuitBreaker{rc.def}
+	for _, cb := range rc.routes {
+		out = append(out, cb)
+	}
+	return out
+}
+
+// SetAnalyzer enables dynamic thresholds on every breaker.
+func (rc *RouteCircuitBreaker) SetAnalyzer(a *analytics.Analyzer) {
+	for _, cb := range rc.breakers() {
+		cb.SetAnalyzer(a)
+	}
+}
+
+// SetOnStateChange registers a transition hook on every breaker.
+func (rc *RouteCircuitBreaker) SetOnStateChange(fn func(BreakerEvent)) {
+	for _, cb := range rc.breakers() {
+		cb.SetOnStateChange(fn)
+	}
+}
+
+// SetProfiles applies per-route protection profiles to every breaker.
+func (rc *RouteCircuitBreaker) SetProfiles(pm *ProfileManager) {
+	for _, cb := range rc.breakers() {
+		cb.SetProfiles(pm)
+	}
+}
+
+// SetRetryBudget makes every breaker consult the retry budget.
+func (rc *RouteCircuitBreaker) SetRetryBudget(b *RetryBudget) {
+	for _, cb := range rc.breakers() {
+		cb.SetRetryBudget(b)
+	}
+}
+
+// Middleware returns the circuit breaker Middleware, resolving each
+// request's route to pick its breaker.
+func (rc *RouteCircuitBreaker) Middleware(routeResolver func(path string) string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := routeResolver(r.URL.Path)
+			cb := rc.For(route)
+			if cb == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			cb.serve(w, r, next, route)
+		})
+	}
+}
+
+// Snapshot returns the state of every route-specific breaker, keyed by
+// route. The default breaker is snapshotted separately via its own Snapshot.
+func (rc *RouteCircuitBreaker) Snapshot() map[string]BreakerState {
+	rc.mu.RLock()
+	defer rc.mu.RUnlock()
+
+	out := make(map[string]BreakerState, len(rc.routes))
+	for route, cb := range rc.routes {
+		out[route] = cb.Snapshot()
+	}
+	return out
+}
+
+// Restore loads snapshotted state into route-specific breakers. Routes
+// that no longer have their own breaker are skipped.
+func (rc *RouteCircuitBreaker) Restore(states map[string]BreakerState) {
+	rc.mu.RLock()
+	defer rc.mu.RUnlock()
+
+	for route, s := range states {
+		if cb, ok := rc.routes[route]; ok {
+			cb.Restore(s)
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tanmay/gateway/internal/config"
+	"github.com/tanmay/gateway/internal/proxy"
+)
+
+func TestRouteCircuitBreakerSeparatesRoutes(t *testing.T) {
+	breakers := NewRouteCircuitBreaker(NewCircuitBreaker(2, time.Minute))
+	breakers.SetRoute("/batch", NewCircuitBreaker(1, time.Minute))
+	breakers.Disable("/flaky")
+
+	resolver := NewRouteMatcher([]string{"/batch", "/checkout", "/flaky"}).Resolve
+	handler := breakers.Middleware(resolver)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/fail") {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	send := func(path string) int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code
+	}
+
+	// One failure trips the batch breaker without touching checkout's budget
+	send("/batch/fail")
+	if got := send("/batch/run"); got != http.StatusServiceUnavailable {
+		t.Errorf("Expected batch breaker open, got %d", got)
+	}
+	send("/checkout/fail")
+	if got := send("/checkout/pay"); got != http.StatusOK {
+		t.Errorf("Expected checkout breaker still closed, got %d", got)
+	}
+
+	// A disabled route never trips
+	for i := 0; i < 5; i++ {
+		send("/flaky/fail")
+	}
+	if got := send("/flaky/ok"); got != http.StatusOK {
+		t.Errorf("Expected disabled breaker to let requests through, got %d", got)
+	}
+
+	if s := breakers.Snapshot(); len(s) != 1 || s["/batch"].State != StateOpen {
+		t.Errorf("Expected snapshot of the open batch breaker, got %+v", s)
+	}
+}
+
+func TestRouteCircuitBreakerAdmin(t *testing.T) {
+	breakers := NewRouteCircuitBreaker(NewCircuitBreaker(5, time.Millisecond))
+	breakers.SetRoute("/batch", NewCircuitBreaker(5, time.Millisecond))
+	admin := breakers.AdminHandler()
+	post := func(body string) int {
+		rec := httptest.NewRecorder()
+		admin.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+		return rec.Code
+	}
+
+	if got := post(`{"breaker": "/batch", "action": "open"}`); got != http.StatusOK {
+		t.Fatalf("Expected manual open to succeed, got %d", got)
+	}
+	if got := post(`{"breaker": "/missing", "action": "open"}`); got != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown breaker, got %d", got)
+	}
+
+	// A manual trip outlasts the timeout instead of probing
+	time.Sleep(5 * time.Millisecond)
+	handler := breakers.Middleware(NewRouteMatcher([]string{"/batch"}).Resolve)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/batch/run", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected manually opened breaker to stay open, got %d", rec.Code)
+	}
+
+	statuses := breakers.Statuses()
+	if len(statuses) != 2 || statuses[1].Name != "/batch" || statuses[1].State != "open" || !statuses[1].Manual || statuses[1].LastTransition == nil {
+		t.Errorf("Expected /batch listed as manually open, got %+v", statuses)
+	}
+
+	post(`{"breaker": "/batch", "action": "close"}`)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/batch/run", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected closed breaker to pass requests, got %d", rec.Code)
+	}
+}
+
+func TestCircuitBreakerHalfOpenNeedsSuccesses(t *testing.T) {
+	cb := NewCircuitBreaker(1, time.Millisecond)
+	cb.SetHalfOpen(2, 1)
+
+	release := make(chan struct{})
+	fail := true
+	handler := cb.Middleware(func(string) string { return "/api" })(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			<-release
+		}
+		if fail {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	send := func(path string) int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code
+	}
+
+	send("/trip")
+	time.Sleep(2 * time.Millisecond)
+	fail = false
+
+	// While one probe is in flight, other requests are still turned away
+	done := make(chan int)
+	go func() { done <- send("/slow") }()
+	for cb.Status("").State != "half_open" {
+		time.Sleep(time.Millisecond)
+	}
+	if got := send("/other"); got != http.StatusServiceUnavailable {
+		t.Errorf("Expected extra request rejected during probe, got %d", got)
+	}
+	close(release)
+	if got := <-done; got != http.StatusOK {
+		t.Fatalf("Expected probe to reach the backend, got %d", got)
+	}
+	if s := cb.Status(""); s.State != "half_open" {
+		t.Errorf("Expected one success to leave the breaker half-open, got %s", s.State)
+	}
+
+	send("/probe")
+	if s := cb.Status(""); s.State != "closed" {
+		t.Errorf("Expected two successes to close the breaker, got %s", s.State)
+	}
+}
+
+func TestCircuitBreakerRollingWindow(t *testing.T) {
+	cb := NewCircuitBreaker(4, time.Minute)
+	cb.SetWindow(50 * time.Millisecond)
+	status := http.StatusOK
+	handler := cb.Middleware(func(string) string { return "/api" })(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	send := func(code int) {
+		status = code
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api", nil))
+	}
+
+	// Failures that age out of the window don't count
+	send(http.StatusBadGateway)
+	send(http.StatusBadGateway)
+	time.Sleep(60 * time.Millisecond)
+
+	// A 40% error rate interleaved with successes still adds up:
+	// F F S S S F F trips on the last request
+	for i := 0; i < 7; i++ {
+		if s := cb.Status(""); s.State != "closed" {
+			t.Fatalf("Expected breaker closed before the 4th failure in the window, tripped at request %d", i)
+		}
+		if i%5 < 2 {
+			send(http.StatusBadGateway)
+		} else {
+			send(http.StatusOK)
+		}
+	}
+	if s := cb.Status(""); s.State != "open" || s.FailureCount != 4 {
+		t.Errorf("Expected breaker open with 4 failures in the window, got %+v", s)
+	}
+}
+
+func TestCircuitBreakerRetryBudget(t *testing.T) {
+	budget := NewRetryBudget(time.Minute, 1)
+	cb := NewCircuitBreaker(5, time.Minute)
+	cb.SetRetryBudget(budget)
+
+	// Stands in for the proxy: every request is recorded and, when the
+	// backend fails, retried as far as the budget allows
+	var retried []bool
+	handler := cb.Middleware(func(string) string { return "/api" })(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		budget.Record("/api")
+		retried = append(retried, budget.Retry("/api", r))
+		w.WriteHeader(http.StatusOK)
+	}))
+	send := func() int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api", nil))
+		return rec.Code
+	}
+
+	// The first retry comes from the minimum; the second request needs
+	// one it isn't allowed and the breaker trips
+	if got := send(); got != http.StatusOK || cb.Status("").State != "closed" || !retried[0] {
+		t.Fatalf("Expected first retry allowed and the breaker closed, got %d %v", got, retried)
+	}
+	send()
+	if retried[1] {
+		t.Errorf("Expected the second retry to exceed the budget")
+	}
+	if s := cb.Status(""); s.State != "open" {
+		t.Fatalf("Expected breaker open once the retry budget is exhausted, got %s", s.State)
+	}
+
+	// Half-open probes are never retried
+	cb.Reset()
+	budget = NewRetryBudget(time.Minute, 10)
+	cb.SetRetryBudget(budget)
+	cb.Trip()
+	cb.mu.Lock()
+	cb.forced, cb.lastFailure = false, time.Now().Add(-2*time.Minute)
+	cb.mu.Unlock()
+	send()
+	if retried[len(retried)-1] {
+		t.Errorf("Expected the half-open probe not to be retried")
+	}
+}
+
+func TestCircuitBreakerReportsTransitions(t *testing.T) {
+	breakers := NewRouteCircuitBreaker(NewCircuitBreaker(5, time.Minute))
+	breakers.SetRoute("/batch", NewCircuitBreaker(1, time.Minute))
+	var events []BreakerEvent
+	breakers.SetOnStateChange(func(e BreakerEvent) {
+		// Called outside the lock, so reading the breaker must not deadlock
+		breakers.Statuses()
+		events = append(events, e)
+	})
+
+	resolver := NewRouteMatcher([]string{"/batch"}).Resolve
+	handler := breakers.Middleware(resolver)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/batch/run", nil))
+	breakers.For("/batch").Reset()
+
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 transitions, got %+v", events)
+	}
+	if e := events[0]; e.Name != "/batch" || e.From != "closed" || e.State != "open" || e.FailureCount != 1 {
+		t.Errorf("Expected /batch closed -> open with 1 failure, got %+v", e)
+	}
+	if e := events[1]; e.From != "open" || e.State != "closed" || e.LastTransition == nil {
+		t.Errorf("Expected /batch open -> closed, got %+v", e)
+	}
+}
+
+func TestCircuitBreakerIgnoresFullBulkhead(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/slow" {
+			entered <- struct{}{}
+			<-release
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	p := proxy.NewProxy(&config.Config{
+		Backends: []config.BackendConfig{{URL: backend.URL, MaxConcurrent: 1}},
+		Routes:   []config.Route{{Path: "/api", Backend: backend.URL}},
+	}, nil)
+	breakers := NewRouteCircuitBreaker(NewCircuitBreaker(1, time.Minute))
+	handler := breakers.Middleware(NewRouteMatcher([]string{"/api"}).Resolve)(p)
+	send := func(path string) int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code
+	}
+
+	// Hold the backend's only slot, so other requests find the bulkhead full
+	done := make(chan int)
+	go func() { done <- send("/api/slow") }()
+	<-entered
+	for i := range 3 {
+		if got := send("/api/users"); got != http.StatusServiceUnavailable {
+			t.Fatalf("Request %d: expected 503 from the full bulkhead, got %d", i+1, got)
+		}
+	}
+	close(release)
+	if got := <-done; got != http.StatusOK {
+		t.Fatalf("Expected the slow request to succeed, got %d", got)
+	}
+
+	if got := send("/api/users"); got != http.StatusOK {
+		t.Errorf("Expected the breaker still closed after bulkhead rejections, got %d", got)
+	}
+}
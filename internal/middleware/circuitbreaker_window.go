@@ -0,0 +1,77 @@
+package middleware
+
+import "time"
+
+// DefaultBreakerWindow is how far back the circuit breaker looks at
+// request outcomes unless configured.
+const DefaultBreakerWindow = time.Minute
+
+// breakerWindowBuckets is how many slices the window is split into; the
+// oldest slice expires as a whole.
+const breakerWindowBuckets = 10
+
+// outcomeBucket counts outcomes during one slice of the window.
+type outcomeBucket struct {
+	start    time.Time
+	total    int
+	failures int
+}
+
+// outcomeWindow counts request outcomes over a rolling time window, as a
+// ring of buckets. Successes no longer wipe out earlier failures, so a
+// steady 40% error rate adds up instead of resetting on every success.
+// Not safe for concurrent use; the breaker's mutex guards it.
+type outcomeWindow struct {
+	width   time.Duration // per bucket
+	buckets [breakerWindowBuckets]outcomeBucket
+}
+
+func newOutcomeWindow(window time.Duration) *outcomeWindow {
+	if window <= 0 {
+		window = DefaultBreakerWindow
+	}
+	return &outcomeWindow{width: window / breakerWindowBuckets}
+}
+
+// bucket returns the bucket for now, clearing it if it held an older slice.
+func (ow *outcomeWindow) bucket(now time.Time) *outcomeBucket {
+	start := now.Truncate(ow.width)
+	b := &ow.buckets[int(start.UnixNano()/int64(ow.width))%breakerWindowBuckets]
+	if !b.start.Equal(start) {
+		*b = outcomeBucket{start: start}
+	}
+	return b
+}
+
+// record counts one outcome.
+func (ow *outcomeWindow) record(now time.Time, failed bool) {
+	b := ow.bucket(now)
+	b.total++
+	if failed {
+		b.failures++
+	}
+}
+
+// add credits counts to the current bucket, for restoring persisted state.
+func (ow *outcomeWindow) add(now time.Time, total, failures int) {
+	b := ow.bucket(now)
+	b.total += total
+	b.failures += failures
+}
+
+// counts returns the requests and failures within the window.
+func (ow *outcomeWindow) counts(now time.Time) (total, failures int) {
+	oldest := now.Truncate(ow.width).Add(-ow.width * (breakerWindowBuckets - 1))
+	for _, b := range ow.buckets {
+		if !b.start.Before(oldest) && !b.start.After(now) {
+			total += b.total
+			failures += b.failures
+		}
+	}
+	return total, failures
+}
+
+// reset forgets every outcome.
+func (ow *outcomeWindow) reset() {
+	ow.buckets = [breakerWindowBuckets]outcomeBucket{}
+}
@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+)
+
+// ConcurrencyLimiter caps in-flight requests per route. It protects
+// backends whose limit is parallelism rather than request rate: a slow
+// endpoint can be overwhelmed by a handful of concurrent requests that a
+// rate limiter would happily let through.
+type ConcurrencyLimiter struct {
+	slots map[string]chan struct{} // route → semaphore, capacity = max in flight
+}
+
+// NewConcurrencyLimiter creates a limiter with no capped routes.
+func NewConcurrencyLimiter() *ConcurrencyLimiter {
+	return &ConcurrencyLimiter{slots: make(map[string]chan struct{})}
+}
+
+// SetRoute caps a route at max concurrent requests. Must be called before serving.
+func (c *ConcurrencyLimiter) SetRoute(route string, max int) {
+	c.slots[route] = make(chan struct{}, max)
+}
+
+// Middleware returns the concurrency limiting Middleware. A request that
+// finds its route full is rejected immediately with 503 rather than
+// queued, so a stuck backend can't pile up waiting goroutines.
+func (c *ConcurrencyLimiter) Middleware(routeResolver func(path string) string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := routeResolver(r.URL.Path)
+			sem, ok := c.slots[route]
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			select {
+			case sem <- struct{}{}:
+			default:
+				concurrencyRejected.WithLabelValues(route).Inc()
+				setRetryAfter(w, time.Second)
+				gatewayError(w, r, "concurrency_limited", "Too many concurrent requests", http.StatusServiceUnavailable)
+				return
+			}
+			inFlightRequests.WithLabelValues(route).Inc()
+			defer func() {
+				<-sem
+				inFlightRequests.WithLabelValues(route).Dec()
+			}()
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
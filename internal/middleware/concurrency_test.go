@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestConcurrencyLimiterCapsInFlight(t *testing.T) {
+	limiter := NewConcurrencyLimiter()
+	limiter.SetRoute("/slow", 1)
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	resolver := NewRouteMatcher([]string{"/slow", "/fast"}).Resolve
+	handler := limiter.Middleware(resolver)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow/report" {
+			close(started)
+			<-release
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	send := func(path string) int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code
+	}
+
+	done := make(chan int)
+	go func() { done <- send("/slow/report") }()
+	<-started
+
+	if got := send("/slow/other"); got != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 while the route is full, got %d", got)
+	}
+	if got := send("/fast/ping"); got != http.StatusOK {
+		t.Errorf("Expected uncapped route unaffected, got %d", got)
+	}
+
+	close(release)
+	if got := <-done; got != http.StatusOK {
+		t.Errorf("Expected held request to complete, got %d", got)
+	}
+	if got := send("/slow/other"); got != http.StatusOK {
+		t.Errorf("Expected slot freed after completion, got %d", got)
+	}
+}
@@ -0,0 +1,463 @@
+package middleware
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// dashboardSessionCookie carries a dashboard login.
+const dashboardSessionCookie = "gw_dashboard"
+
+// Dashboard roles. Viewers can see everything admins can but not change
+// it, so a dashboard can be shared widely.
+const (
+	DashboardAdmin  = "admin"
+	DashboardViewer = "viewer"
+)
+
+// DashboardUser is a dashboard login with a password, stored as a bcrypt
+// hash (see NewPasswordHash).
+type DashboardUser struct {
+	Username     string
+	PasswordHash string // "$2a$..." bcrypt hash
+	Role         string // DashboardAdmin (default) or DashboardViewer
+}
+
+// DashboardAuthConfig configures who may use the dashboard API.
+type DashboardAuthConfig struct {
+	Users        []DashboardUser
+	Tokens       []string // salted hashes of bearer tokens, for scripts and peers
+	ViewerTokens []string // same, granting only DashboardViewer
+	OIDC         *OIDC    // optional; its sessions are accepted and "Sign in with SSO" uses it
+	OIDCRole     string   // role of OIDC logins (default DashboardViewer)
+
+	CookieSecret string // signs session cookies; random per process if empty
+	SessionTTL   time.Duration
+}
+
+// dashboardCredential is a parsed password or token hash. Passwords are
+// bcrypt hashes; tokens are random, so a salted SHA-256 is enough.
+type dashboardCredential struct {
+	name   string // username, or the token's position for logs
+	role   string
+	salt   []byte
+	hash   []byte
+	bcrypt []byte
+}
+
+// matches reports whether secret hashes to this credential.
+func (c *dashboardCredential) matches(secret string) bool {
+	if c.bcrypt != nil {
+		return bcrypt.CompareHashAndPassword(c.bcrypt, []byte(secret)) == nil
+	}
+	return subtle.ConstantTimeCompare(saltedHash(c.salt, secret), c.hash) == 1
+}
+
+// NewPasswordHash returns a bcrypt hash of password, the form dashboard
+// users' password_hash takes.
+func NewPasswordHash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+// unknownUser is checked against for usernames that don't exist, so a
+// failed login takes as long either way and doesn't reveal which users do.
+var unknownUser = sync.OnceValue(func() *dashboardCredential {
+	hash, _ := bcrypt.GenerateFromPassword([]byte(randomToken()), bcrypt.DefaultCost)
+	return &dashboardCredential{bcrypt: hash}
+})
+
+// dashboardSession is the payload of the session cookie, and what
+// DashboardAuth records on authenticated requests.
+type dashboardSession struct {
+	Subject string `json:"sub"`
+	Method  string `json:"method"` // "password", "token", or "oidc"
+	Role    string `json:"role"`
+	Expires int64  `json:"exp"`
+}
+
+type dashboardSessionKey struct{}
+
+// DashboardAuth guards the dashboard API and its event stream, which can
+// start and stop processes and change limits. Browsers log in with a
+// password, a token, or the gateway's OIDC provider and get a signed
+// session cookie; scripts and federation peers send a bearer token.
+// Viewer sessions are limited to reads.
+type DashboardAuth struct {
+	users    map[string]*dashboardCredential
+	tokens   []*dashboardCredential
+	oidc     *OIDC
+	oidcRole string
+	secret   []byte
+	ttl      time.Duration
+	throttle *loginThrottle
+}
+
+// NewDashboardAuth validates cfg and creates a DashboardAuth.
+func NewDashboardAuth(cfg DashboardAuthConfig) (*DashboardAuth, error) {
+	if len(cfg.Users) == 0 && len(cfg.Tokens) == 0 && len(cfg.ViewerTokens) == 0 && cfg.OIDC == nil {
+		return nil, errors.New("dashboard auth: configure users, tokens, or oidc")
+	}
+	secret := []byte(cfg.CookieSecret)
+	if len(secret) == 0 {
+		secret = []byte(randomToken() + randomToken())
+	} else if len(secret) < 32 {
+		return nil, errors.New("dashboard auth: cookie_secret must be at least 32 characters")
+	}
+	if cfg.SessionTTL <= 0 {
+		cfg.SessionTTL = DefaultSessionTTL
+	}
+	// Anyone the IdP lets in can sign in, so admin must be asked for
+	if cfg.OIDCRole == "" {
+		cfg.OIDCRole = DashboardViewer
+	}
+	if err := checkDashboardRole(&cfg.OIDCRole); err != nil {
+		return nil, fmt.Errorf("dashboard auth: oidc: %w", err)
+	}
+
+	d := &DashboardAuth{
+		users:    make(map[string]*dashboardCredential, len(cfg.Users)),
+		oidc:     cfg.OIDC,
+		oidcRole: cfg.OIDCRole,
+		secret:   secret,
+		ttl:      cfg.SessionTTL,
+		throttle: newLoginThrottle(loginMaxFailures, loginFailureWindow),
+	}
+	for _, u := range cfg.Users {
+		if u.Username == "" {
+			return nil, errors.New("dashboard auth: user without a username")
+		}
+		if err := checkDashboardRole(&u.Role); err != nil {
+			return nil, fmt.Errorf("dashboard auth: user %q: %w", u.Username, err)
+		}
+		if _, err := bcrypt.Cost([]byte(u.PasswordHash)); err != nil {
+			return nil, fmt.Errorf("dashboard auth: user %q: password_hash must be a bcrypt hash (go run ./cmd/keygen -password '<password>'): %w", u.Username, err)
+		}
+		d.users[u.Username] = &dashboardCredential{name: u.Username, role: u.Role, bcrypt: []byte(u.PasswordHash)}
+	}
+	if err := d.addTokens(cfg.Tokens, "token", DashboardAdmin); err != nil {
+		return nil, err
+	}
+	if err := d.addTokens(cfg.ViewerTokens, "viewer-token", DashboardViewer); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// checkDashboardRole validates a configured role, defaulting it to admin.
+func checkDashboardRole(role *string) error {
+	switch *role {
+	case "":
+		*role = DashboardAdmin
+	case DashboardAdmin, DashboardViewer:
+	default:
+		return fmt.Errorf("unknown role %q", *role)
+	}
+	return nil
+}
+
+// addTokens registers token hashes granting role, named prefix-<n> in logs.
+func (d *DashboardAuth) addTokens(hashes []string, prefix, role string) error {
+	for i, t := range hashes {
+		salt, hash, err := parseKeyHash(t)
+		if err != nil {
+			return fmt.Errorf("dashboard auth: %s %d: %w", prefix, i, err)
+		}
+		d.tokens = append(d.tokens, &dashboardCredential{name: fmt.Sprintf("%s-%d", prefix, i), role: role, salt: salt, hash: hash})
+	}
+	return nil
+}
+
+// Middleware rejects requests without a valid session cookie, bearer
+// token, or OIDC session with 401, and anything but reads from viewers
+// with 403. CORS preflights pass through.
+func (d *DashboardAuth) Middleware() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodOptions {
+				next.ServeHTTP(w, r)
+				return
+			}
+			// Federation fetches this gateway's own views in-process
+			// with the authenticated request's context
+			if _, ok := r.Context().Value(dashboardSessionKey{}).(dashboardSession); ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			s, ok := d.authenticate(r)
+			if !ok {
+				gatewayError(w, r, "unauthorized", "Dashboard login required", http.StatusUnauthorized)
+				return
+			}
+			if s.Role == DashboardViewer && r.Method != http.MethodGet && r.Method != http.MethodHead {
+				Audit(r, AuditEvent{Event: "dashboard_action", Outcome: "denied", Identity: s.Subject, Reason: "viewer role is read-only"})
+				gatewayError(w, r, "forbidden", "Viewers cannot change the gateway", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), dashboardSessionKey{}, s)))
+		})
+	}
+}
+
+// authenticate returns the request's dashboard session, from a bearer
+// token, the session cookie, or an OIDC session, in that order.
+func (d *DashboardAuth) authenticate(r *http.Request) (dashboardSession, bool) {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		if t := d.token(token); t != nil {
+			return dashboardSession{Subject: t.name, Method: "token", Role: t.role}, true
+		}
+		return dashboardSession{}, false
+	}
+	var s dashboardSession
+	if c, err := r.Cookie(dashboardSessionCookie); err == nil && verifySigned(d.secret, c.Value, &s) && time.Now().Unix() < s.Expires {
+		if s.Role == "" {
+			s.Role = DashboardViewer // issued before roles existed; don't assume admin
+		}
+		return s, true
+	}
+	if d.oidc != nil {
+		if o, ok := d.oidc.session(r); ok {
+			return dashboardSession{Subject: o.Subject, Method: "oidc", Role: d.oidcRole, Expires: o.Expires}, true
+		}
+	}
+	return dashboardSession{}, false
+}
+
+// token returns the configured token matching secret, if any.
+func (d *DashboardAuth) token(secret string) *dashboardCredential {
+	for _, t := range d.tokens {
+		if t.matches(secret) {
+			return t
+		}
+	}
+	return nil
+}
+
+// LoginHandler starts a session from a username and password or a token.
+// POST {"username": "...", "password": "..."} or {"token": "..."}
+//
+// After loginMaxFailures failed attempts from a client IP, or for a
+// username, within loginFailureWindow, further attempts get 429 until the
+// window has passed.
+func (d *DashboardAuth) LoginHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var req struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+			Token    string `json:"token"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+			http.Error(w, "Invalid login request", http.StatusBadRequest)
+			return
+		}
+
+		throttled := []string{"ip:" + clientIP(r)}
+		if req.Token == "" {
+			throttled = append(throttled, "user:"+req.Username)
+		}
+		if wait, blocked := d.throttle.blocked(throttled...); blocked {
+			Audit(r, AuditEvent{Event: "dashboard_login", Outcome: "denied", Identity: req.Username, Reason: "too many failed logins"})
+			setRetryAfter(w, wait)
+			gatewayError(w, r, "rate_limited", "Too many failed logins", http.StatusTooManyRequests)
+			return
+		}
+
+		s := dashboardSession{Expires: time.Now().Add(d.ttl).Unix()}
+		switch {
+		case req.Token != "":
+			t := d.token(req.Token)
+			if t == nil {
+				d.throttle.fail(throttled...)
+				d.denied(w, r, "", "unknown token")
+				return
+			}
+			s.Subject, s.Method, s.Role = t.name, "token", t.role
+		default:
+			u, ok := d.users[req.Username]
+			if !ok {
+				u = unknownUser()
+			}
+			if !u.matches(req.Password) || !ok {
+				d.throttle.fail(throttled...)
+				d.denied(w, r, req.Username, "wrong username or password")
+				return
+			}
+			s.Subject, s.Method, s.Role = u.name, "password", u.role
+		}
+		d.throttle.reset(throttled...)
+
+		http.SetCookie(w, d.cookie(r, signValue(d.secret, s), d.ttl))
+		Audit(r, AuditEvent{Event: "dashboard_login", Outcome: "allowed", Identity: s.Subject, Reason: s.Method})
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(sessionInfo(s))
+	}
+}
+
+// denied logs and answers a failed login.
+func (d *DashboardAuth) denied(w http.ResponseWriter, r *http.Request, identity, reason string) {
+	Audit(r, AuditEvent{Event: "dashboard_login", Outcome: "denied", Identity: identity, Reason: reason})
+	gatewayError(w, r, "unauthorized", "Invalid credentials", http.StatusUnauthorized)
+}
+
+// OIDCLoginHandler sends the browser through the OIDC provider and back to
+// the dashboard. 404 if OIDC isn't configured for the dashboard.
+func (d *DashboardAuth) OIDCLoginHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if d.oidc == nil {
+			http.NotFound(w, r)
+			return
+		}
+		if _, ok := d.oidc.session(r); ok {
+			http.Redirect(w, r, "/dashboard/", http.StatusFound)
+			return
+		}
+		d.oidc.login(w, r) // the callback returns here, which then redirects
+	}
+}
+
+// LogoutHandler ends the dashboard session. OIDC sessions are ended at
+// /oauth2/logout.
+func (d *DashboardAuth) LogoutHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		http.SetCookie(w, d.cookie(r, "", -1))
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// SessionHandler describes the caller's session, or answers 401, so the
+// dashboard can tell whether to show its login form.
+// GET /dashboard/api/session
+func (d *DashboardAuth) SessionHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s, ok := d.authenticate(r)
+		if !ok {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"authenticated": false,
+				"oidc":          d.oidc != nil,
+			})
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(sessionInfo(s))
+	}
+}
+
+// sessionInfo is the JSON description of a session.
+func sessionInfo(s dashboardSession) map[string]interface{} {
+	info := map[string]interface{}{
+		"authenticated": true,
+		"user":          s.Subject,
+		"method":        s.Method,
+		"role":          s.Role,
+	}
+	if s.Expires > 0 {
+		info["expires_at"] = time.Unix(s.Expires, 0).UTC()
+	}
+	return info
+}
+
+// cookie builds the session cookie, scoped to the dashboard and Secure
+// when the request came over HTTPS.
+func (d *DashboardAuth) cookie(r *http.Request, value string, ttl time.Duration) *http.Cookie {
+	c := &http.Cookie{
+		Name:     dashboardSessionCookie,
+		Value:    value,
+		Path:     "/dashboard",
+		HttpOnly: true,
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteStrictMode,
+		MaxAge:   int(ttl.Seconds()),
+	}
+	if ttl < 0 {
+		c.MaxAge = -1
+	}
+	return c
+}
+
+// Login throttling: failures allowed per client IP and per username, and
+// how long they are remembered.
+const (
+	loginMaxFailures   = 5
+	loginFailureWindow = 15 * time.Minute
+)
+
+// loginThrottle counts failed logins per key (client IP or username) and
+// blocks a key once it has too many within the window.
+type loginThrottle struct {
+	mu       sync.Mutex
+	max      int
+	window   time.Duration
+	failures map[string]*loginFailures
+}
+
+// loginFailures is one key's failures since the first in the window.
+type loginFailures struct {
+	count int
+	since time.Time
+}
+
+func newLoginThrottle(max int, window time.Duration) *loginThrottle {
+	return &loginThrottle{max: max, window: window, failures: make(map[string]*loginFailures)}
+}
+
+// blocked reports whether any of keys is blocked, and for how long.
+func (t *loginThrottle) blocked(keys ...string) (time.Duration, bool) {
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var wait time.Duration
+	for _, k := range keys {
+		if f, ok := t.failures[k]; ok && f.count >= t.max {
+			wait = max(wait, f.since.Add(t.window).Sub(now))
+		}
+	}
+	return wait, wait > 0
+}
+
+// fail records a failed login against keys.
+func (t *loginThrottle) fail(keys ...string) {
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for k, f := range t.failures {
+		if now.Sub(f.since) >= t.window {
+			delete(t.failures, k)
+		}
+	}
+	for _, k := range keys {
+		f := t.failures[k]
+		if f == nil {
+			f = &loginFailures{since: now}
+			t.failures[k] = f
+		}
+		f.count++
+	}
+}
+
+// reset forgets keys' failures after a successful login.
+func (t *loginThrottle) reset(keys ...string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, k := range keys {
+		delete(t.failures, k)
+	}
+}
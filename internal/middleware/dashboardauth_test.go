@@ -0,0 +1,152 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDashboardAuth(t *testing.T) {
+	passwordHash, _ := NewPasswordHash("hunter2")
+	tokenHash, _ := NewKeyHash("dash-token")
+	auth, err := NewDashboardAuth(DashboardAuthConfig{
+		Users:  []DashboardUser{{Username: "alice", PasswordHash: passwordHash}},
+		Tokens: []string{tokenHash},
+	})
+	if err != nil {
+		t.Fatalf("NewDashboardAuth: %v", err)
+	}
+	protected := auth.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	get := func(setup func(r *http.Request)) int {
+		req := httptest.NewRequest(http.MethodGet, "/dashboard/api/processes", nil)
+		setup(req)
+		rec := httptest.NewRecorder()
+		protected.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := get(func(r *http.Request) {}); code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without credentials, got %d", code)
+	}
+	if code := get(func(r *http.Request) { r.Header.Set("Authorization", "Bearer dash-token") }); code != http.StatusOK {
+		t.Errorf("Expected 200 with a valid token, got %d", code)
+	}
+	if code := get(func(r *http.Request) { r.Header.Set("Authorization", "Bearer wrong") }); code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 with an unknown token, got %d", code)
+	}
+
+	login := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		auth.LoginHandler()(rec, httptest.NewRequest(http.MethodPost, "/dashboard/api/login", strings.NewReader(body)))
+		return rec
+	}
+	if rec := login(`{"username": "alice", "password": "wrong"}`); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for a wrong password, got %d", rec.Code)
+	}
+	rec := login(`{"username": "alice", "password": "hunter2"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 for a valid login, got %d", rec.Code)
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != dashboardSessionCookie || !cookies[0].HttpOnly {
+		t.Fatalf("Expected an HttpOnly session cookie, got %v", cookies)
+	}
+	if code := get(func(r *http.Request) { r.AddCookie(cookies[0]) }); code != http.StatusOK {
+		t.Errorf("Expected 200 with the session cookie, got %d", code)
+	}
+	tampered := *cookies[0]
+	tampered.Value = "x" + tampered.Value
+	if code := get(func(r *http.Request) { r.AddCookie(&tampered) }); code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 with a tampered cookie, got %d", code)
+	}
+}
+
+func TestDashboardAuthViewerIsReadOnly(t *testing.T) {
+	adminHash, _ := NewKeyHash("admin-token")
+	viewerHash, _ := NewKeyHash("viewer-token")
+	auth, err := NewDashboardAuth(DashboardAuthConfig{
+		Tokens:       []string{adminHash},
+		ViewerTokens: []string{viewerHash},
+	})
+	if err != nil {
+		t.Fatalf("NewDashboardAuth: %v", err)
+	}
+	protected := auth.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		token, method string
+		want          int
+	}{
+		{"viewer-token", http.MethodGet, http.StatusOK},
+		{"viewer-token", http.MethodPost, http.StatusForbidden},
+		{"viewer-token", http.MethodDelete, http.StatusForbidden},
+		{"admin-token", http.MethodPost, http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/dashboard/api/processes/backend-1/stop", nil)
+		req.Header.Set("Authorization", "Bearer "+tt.token)
+		rec := httptest.NewRecorder()
+		protected.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s %s: expected %d, got %d", tt.token, tt.method, tt.want, rec.Code)
+		}
+	}
+}
+
+func TestDashboardLoginThrottlesGuessing(t *testing.T) {
+	passwordHash, _ := NewPasswordHash("hunter2")
+	auth, err := NewDashboardAuth(DashboardAuthConfig{
+		Users: []DashboardUser{{Username: "alice", PasswordHash: passwordHash}},
+	})
+	if err != nil {
+		t.Fatalf("NewDashboardAuth: %v", err)
+	}
+	login := func(ip, body string) int {
+		req := httptest.NewRequest(http.MethodPost, "/dashboard/api/login", strings.NewReader(body))
+		req.RemoteAddr = ip + ":5000"
+		rec := httptest.NewRecorder()
+		auth.LoginHandler()(rec, req)
+		return rec.Code
+	}
+
+	for i := range loginMaxFailures {
+		if code := login("203.0.113.9", `{"username": "alice", "password": "guess"}`); code != http.StatusUnauthorized {
+			t.Fatalf("Attempt %d: expected 401, got %d", i+1, code)
+		}
+	}
+	if code := login("203.0.113.9", `{"username": "alice", "password": "hunter2"}`); code != http.StatusTooManyRequests {
+		t.Errorf("Expected 429 once the IP has too many failures, got %d", code)
+	}
+	if code := login("198.51.100.7", `{"username": "alice", "password": "hunter2"}`); code != http.StatusTooManyRequests {
+		t.Errorf("Expected 429 for the guessed-at username from another IP, got %d", code)
+	}
+	if code := login("198.51.100.7", `{"username": "bob", "password": "guess"}`); code != http.StatusUnauthorized {
+		t.Errorf("Expected other users from other IPs unaffected, got %d", code)
+	}
+}
+
+func TestDashboardAuthRejectsWeakPasswordHashes(t *testing.T) {
+	sha, _ := NewKeyHash("hunter2")
+	_, err := NewDashboardAuth(DashboardAuthConfig{
+		Users: []DashboardUser{{Username: "alice", PasswordHash: sha}},
+	})
+	if err == nil {
+		t.Error("Expected a SHA-256 password_hash to be rejected")
+	}
+}
+
+func TestDashboardAuthOIDCDefaultsToViewer(t *testing.T) {
+	tokenHash, _ := NewKeyHash("dash-token")
+	auth, err := NewDashboardAuth(DashboardAuthConfig{Tokens: []string{tokenHash}})
+	if err != nil {
+		t.Fatalf("NewDashboardAuth: %v", err)
+	}
+	if auth.oidcRole != DashboardViewer {
+		t.Errorf("Expected OIDC logins to default to %q, got %q", DashboardViewer, auth.oidcRole)
+	}
+}
@@ -0,0 +1,242 @@
+package middleware
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tanmay/gateway/internal/analytics"
+)
+
+// DedupConfig configures duplicate request tracking.
+type DedupConfig struct {
+	Window           time.Duration // how long a signature is remembered (default 5m)
+	SignatureHeaders []string      // headers carrying a payload signature (default X-Signature, X-Hub-Signature-256)
+	FlagRate         float64       // duplicate rate that flags a client (default 0.2)
+	MinRequests      int           // requests needed before a client can be flagged (default 10)
+	MaxEntries       int           // cap on remembered signatures (default 100000)
+}
+
+// DedupTracker spots repeated requests: the same Idempotency-Key, or the
+// same signed payload (identical signature header), sent to the same method
+// and path within a short window, by whichever client. Duplicates are
+// counted against the client sending them for analytics;
+// on routes with replay protection they're rejected outright, since a
+// signed webhook that arrives twice is either a retry storm or a replay.
+//
+// Requests without an idempotency key or signature aren't tracked — there's
+// no cheap, reliable way to tell a repeat from a legitimate second request.
+// A signature only counts as seen once its request got a non-5xx response,
+// so clients can retry after a backend failure.
+type DedupTracker struct {
+	config    DedupConfig
+	keyFunc   KeyFunc
+	replay    map[string]bool // routes that reject duplicates
+	mu        sync.Mutex
+	seen      map[string]*list.Element // signature → *dedupEntry in order
+	order     *list.List               // oldest first
+	clients   map[string]*dedupCounts
+	lastPrune time.Time
+}
+
+// dedupEntry is a remembered signature.
+type dedupEntry struct {
+	sig  string
+	seen time.Time
+}
+
+// dedupCounts holds one client's counts for the current window.
+type dedupCounts struct {
+	requests   int
+	duplicates int
+	since      time.Time
+}
+
+// NewDedupTracker creates a tracker. keyFunc identifies clients (nil = client IP).
+func NewDedupTracker(cfg DedupConfig, keyFunc KeyFunc) *DedupTracker {
+	if cfg.Window <= 0 {
+		cfg.Window = 5 * time.Minute
+	}
+	if len(cfg.SignatureHeaders) == 0 {
+		cfg.SignatureHeaders = []string{"X-Signature", "X-Hub-Signature-256"}
+	}
+	if cfg.FlagRate <= 0 {
+		cfg.FlagRate = 0.2
+	}
+	if cfg.MinRequests <= 0 {
+		cfg.MinRequests = 10
+	}
+	if cfg.MaxEntries <= 0 {
+		cfg.MaxEntries = 100000
+	}
+	if keyFunc == nil {
+		keyFunc = clientIP
+	}
+	return &DedupTracker{
+		config:    cfg,
+		keyFunc:   keyFunc,
+		replay:    make(map[string]bool),
+		seen:      make(map[string]*list.Element),
+		order:     list.New(),
+		clients:   make(map[string]*dedupCounts),
+		lastPrune: time.Now(),
+	}
+}
+
+// SetReplayProtection makes a route reject duplicate requests with 409.
+// Must be called before serving.
+func (d *DedupTracker) SetReplayProtection(route string) {
+	d.replay[route] = true
+}
+
+// signature returns the request's dedup signature, or "" if it carries
+// neither an idempotency key nor a payload signature.
+func (d *DedupTracker) signature(r *http.Request) string {
+	var id string
+	if key := r.Header.Get("Idempotency-Key"); key != "" {
+		id = "idem:" + key
+	} else {
+		for _, h := range d.config.SignatureHeaders {
+			if sig := r.Header.Get(h); sig != "" {
+				id = "sig:" + sig
+				break
+			}
+		}
+	}
+	if id == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(r.Method + " " + r.URL.Path + "\x00" + id))
+	return hex.EncodeToString(sum[:])
+}
+
+// observe counts a client's request and reports whether its signature was
+// already seen within the window. If not, the signature is remembered
+// until settle decides whether to keep it; a duplicate arriving meanwhile
+// is a duplicate too. When the table is full the oldest signatures make
+// room.
+func (d *DedupTracker) observe(client, sig string) (*list.Element, bool) {
+	now := time.Now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if now.Sub(d.lastPrune) > d.config.Window/2 {
+		d.prune(now)
+	}
+
+	counts := d.clients[client]
+	if counts == nil {
+		counts = &dedupCounts{since: now}
+		d.clients[client] = counts
+	}
+	counts.requests++
+
+	if e, ok := d.seen[sig]; ok {
+		if now.Sub(e.Value.(*dedupEntry).seen) < d.config.Window {
+			counts.duplicates++
+			return nil, true
+		}
+		d.forget(e)
+	}
+	for d.order.Len() >= d.config.MaxEntries {
+		d.forget(d.order.Front())
+	}
+	e := d.order.PushBack(&dedupEntry{sig: sig, seen: now})
+	d.seen[sig] = e
+	return e, false
+}
+
+// settle keeps a signature observe remembered if its request succeeded,
+// and forgets it otherwise so the request can be retried.
+func (d *DedupTracker) settle(e *list.Element, succeeded bool) {
+	if succeeded {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.seen[e.Value.(*dedupEntry).sig] == e {
+		d.forget(e)
+	}
+}
+
+// forget drops a remembered signature. Must hold d.mu.
+func (d *DedupTracker) forget(e *list.Element) {
+	delete(d.seen, e.Value.(*dedupEntry).sig)
+	d.order.Remove(e)
+}
+
+// prune forgets signatures and client counts older than the window.
+// Must hold d.mu.
+func (d *DedupTracker) prune(now time.Time) {
+	for e := d.order.Front(); e != nil && now.Sub(e.Value.(*dedupEntry).seen) >= d.config.Window; e = d.order.Front() {
+		d.forget(e)
+	}
+	for client, c := range d.clients {
+		if now.Sub(c.since) >= d.config.Window {
+			delete(d.clients, client)
+		}
+	}
+	d.lastPrune = now
+}
+
+// Stats returns per-client duplication in the current window, flagged
+// clients first, then by duplicate count.
+func (d *DedupTracker) Stats() []analytics.DuplicateStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	out := make([]analytics.DuplicateStats, 0, len(d.clients))
+	for client, c := range d.clients {
+		rate := float64(c.duplicates) / float64(c.requests)
+		out = append(out, analytics.DuplicateStats{
+			Client:     client,
+			Requests:   c.requests,
+			Duplicates: c.duplicates,
+			Rate:       rate,
+			Flagged:    c.requests >= d.config.MinRequests && rate >= d.config.FlagRate,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Flagged != out[j].Flagged {
+			return out[i].Flagged
+		}
+		return out[i].Duplicates > out[j].Duplicates
+	})
+	return out
+}
+
+// Middleware returns the dedup Middleware.
+func (d *DedupTracker) Middleware(routeResolver func(path string) string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sig := d.signature(r)
+			if sig == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			client := d.keyFunc(r)
+			e, duplicate := d.observe(client, sig)
+			if !duplicate {
+				wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+				next.ServeHTTP(wrapped, r)
+				d.settle(e, wrapped.statusCode < 500)
+				return
+			}
+
+			route := routeResolver(r.URL.Path)
+			duplicateRequests.WithLabelValues(route).Inc()
+			if d.replay[route] {
+				replaysRejected.WithLabelValues(route).Inc()
+				Audit(r, AuditEvent{Event: "replay", Outcome: "denied", Route: route, Identity: client, Reason: "signature seen within dedup window"})
+				gatewayError(w, r, "replay_detected", "Duplicate request", http.StatusConflict)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDedupTrackerRejectsReplays(t *testing.T) {
+	dedup := NewDedupTracker(DedupConfig{MinRequests: 2}, nil)
+	dedup.SetReplayProtection("/webhooks")
+
+	resolver := NewRouteMatcher([]string{"/webhooks", "/api"}).Resolve
+	handler := dedup.Middleware(resolver)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	send := func(path, header, value string) int {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.RemoteAddr = "203.0.113.9:5000"
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if got := send("/webhooks/github", "X-Hub-Signature-256", "sha256=abc"); got != http.StatusOK {
+		t.Fatalf("Expected first signed delivery allowed, got %d", got)
+	}
+	if got := send("/webhooks/github", "X-Hub-Signature-256", "sha256=abc"); got != http.StatusConflict {
+		t.Errorf("Expected replayed signature rejected with 409, got %d", got)
+	}
+	if got := send("/webhooks/github", "X-Hub-Signature-256", "sha256=def"); got != http.StatusOK {
+		t.Errorf("Expected a different signature allowed, got %d", got)
+	}
+
+	// Without replay protection duplicates pass but are counted
+	send("/api/orders", "Idempotency-Key", "order-1")
+	if got := send("/api/orders", "Idempotency-Key", "order-1"); got != http.StatusOK {
+		t.Errorf("Expected duplicate allowed on unprotected route, got %d", got)
+	}
+	// Untracked requests don't count at all
+	send("/api/orders", "", "")
+
+	stats := dedup.Stats()
+	if len(stats) != 1 {
+		t.Fatalf("Expected stats for one client, got %+v", stats)
+	}
+	if stats[0].Requests != 5 || stats[0].Duplicates != 2 || !stats[0].Flagged {
+		t.Errorf("Expected 5 requests, 2 duplicates, flagged; got %+v", stats[0])
+	}
+}
+
+func TestDedupTrackerReplayAcrossClientsAndRetries(t *testing.T) {
+	dedup := NewDedupTracker(DedupConfig{MaxEntries: 2}, nil)
+	dedup.SetReplayProtection("/webhooks")
+
+	status := http.StatusBadGateway
+	resolver := NewRouteMatcher([]string{"/webhooks"}).Resolve
+	handler := dedup.Middleware(resolver)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	send := func(client, sig string) int {
+		req := httptest.NewRequest(http.MethodPost, "/webhooks/github", nil)
+		req.RemoteAddr = client + ":5000"
+		req.Header.Set("X-Signature", sig)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// A failed delivery doesn't burn its signature
+	if got := send("203.0.113.9", "a"); got != http.StatusBadGateway {
+		t.Fatalf("Expected the backend's 502, got %d", got)
+	}
+	status = http.StatusOK
+	if got := send("203.0.113.9", "a"); got != http.StatusOK {
+		t.Errorf("Expected a retry after a 5xx allowed, got %d", got)
+	}
+	if got := send("198.51.100.7", "a"); got != http.StatusConflict {
+		t.Errorf("Expected a signature replayed by another client rejected, got %d", got)
+	}
+
+	// A full table evicts the oldest signatures rather than going blind
+	send("203.0.113.9", "b")
+	send("203.0.113.9", "c")
+	if got := send("198.51.100.7", "c"); got != http.StatusConflict {
+		t.Errorf("Expected the newest signature still remembered, got %d", got)
+	}
+	if got := send("198.51.100.7", "a"); got != http.StatusOK {
+		t.Errorf("Expected the oldest signature evicted, got %d", got)
+	}
+}
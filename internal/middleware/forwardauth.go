@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// DefaultForwardAuthTimeout bounds the sub-request to the auth service
+// unless configured.
+const DefaultForwardAuthTimeout = 5 * time.Second
+
+// forwardAuthBodyLimit caps how much of a denial body is relayed to the client.
+const forwardAuthBodyLimit = 64 << 10
+
+// ForwardAuth delegates the auth decision for a route to an external
+// service, the way Traefik's forwardAuth and nginx's auth_request do: the
+// gateway sends it the request's method and headers (no body), a 2xx lets
+// the request through, and anything else is relayed to the client as-is.
+type ForwardAuth struct {
+	url             string
+	responseHeaders []string // copied from a 2xx auth response onto the upstream request
+	client          *http.Client
+}
+
+// NewForwardAuth creates a forward-auth check against url. responseHeaders
+// (e.g. X-User-Id) are passed upstream on success; clients can't set them
+// themselves.
+func NewForwardAuth(url string, responseHeaders []string, timeout time.Duration) (*ForwardAuth, error) {
+	if url == "" {
+		return nil, errors.New("forward_auth: url is required")
+	}
+	if timeout <= 0 {
+		timeout = DefaultForwardAuthTimeout
+	}
+	return &ForwardAuth{
+		url:             url,
+		responseHeaders: responseHeaders,
+		client: &http.Client{
+			Timeout: timeout,
+			// Redirects (e.g. to a login page) are for the client to follow.
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+	}, nil
+}
+
+// SetForwardAuth makes a route ask an external service whether to let
+// each request through, instead of checking API keys or JWTs. Must be
+// called before serving.
+func (a *Auth) SetForwardAuth(route string, f *ForwardAuth) {
+	a.forward[route] = f
+}
+
+// serve asks the auth service about r and either calls next or relays
+// the service's denial.
+func (f *ForwardAuth) serve(w http.ResponseWriter, r *http.Request, route string, next http.Handler) {
+	sub, err := http.NewRequestWithContext(r.Context(), r.Method, f.url, nil)
+	if err != nil {
+		gatewayError(w, r, "auth_unavailable", "Auth Service Unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	sub.Header = r.Header.Clone()
+	for _, h := range []string{"Connection", "Upgrade", "Content-Length", "Transfer-Encoding", "Te", "Trailer"} {
+		sub.Header.Del(h)
+	}
+	proto := "http"
+	if r.TLS != nil {
+		proto = "https"
+	}
+	sub.Header.Set("X-Forwarded-Method", r.Method)
+	sub.Header.Set("X-Forwarded-Proto", proto)
+	sub.Header.Set("X-Forwarded-Host", r.Host)
+	sub.Header.Set("X-Forwarded-Uri", r.URL.RequestURI())
+	if ip, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		sub.Header.Set("X-Forwarded-For", ip)
+	}
+
+	resp, err := f.client.Do(sub)
+	if err != nil {
+		Audit(r, AuditEvent{Event: "forward_auth", Outcome: "error", Route: route, Reason: err.Error()})
+		gatewayError(w, r, "auth_unavailable", "Auth Service Unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		Audit(r, AuditEvent{Event: "forward_auth", Outcome: "denied", Route: route, Reason: resp.Status})
+		for k, v := range resp.Header {
+			if k != "Content-Length" && k != "Connection" && k != "Transfer-Encoding" {
+				w.Header()[k] = v
+			}
+		}
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, io.LimitReader(resp.Body, forwardAuthBodyLimit))
+		return
+	}
+
+	for _, h := range f.responseHeaders {
+		r.Header.Del(h)
+		for _, v := range resp.Header.Values(h) {
+			r.Header.Add(h, v)
+		}
+	}
+	next.ServeHTTP(w, r)
+}
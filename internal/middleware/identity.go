@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Identity headers set on proxied requests after auth succeeds. Backends
+// can trust them without re-validating credentials, because the gateway
+// strips any copies sent by the client.
+const (
+	HeaderUserID   = "X-User-ID"    // JWT or OIDC subject
+	HeaderAPIKeyID = "X-API-Key-ID" // prefix of the API key used
+	HeaderScopes   = "X-Scopes"     // space-separated granted scopes
+
+	// HeaderAnonymous is "true" on requests admitted without credentials
+	// on an anonymous-mode route, for backends and traffic analytics.
+	HeaderAnonymous = "X-Anonymous"
+)
+
+// stripIdentityHeaders removes client-supplied identity headers.
+func stripIdentityHeaders(r *http.Request) {
+	r.Header.Del(HeaderUserID)
+	r.Header.Del(HeaderAPIKeyID)
+	r.Header.Del(HeaderScopes)
+	r.Header.Del(HeaderAnonymous)
+}
+
+// hasCredentials reports whether a request carries an API key or bearer
+// token. On anonymous-mode routes, requests without either are admitted
+// as anonymous.
+func hasCredentials(r *http.Request) bool {
+	return r.Header.Get("X-API-Key") != "" || r.Header.Get("Authorization") != ""
+}
+
+// markAnonymous tags a request as admitted without credentials.
+func markAnonymous(r *http.Request) {
+	r.Header.Set(HeaderAnonymous, "true")
+}
+
+// setIdentityHeaders records the authenticated caller on r for the backend.
+// Empty values are left unset.
+func setIdentityHeaders(r *http.Request, userID, keyID string, scopes []string) {
+	if userID != "" {
+		r.Header.Set(HeaderUserID, userID)
+	}
+	if keyID != "" {
+		r.Header.Set(HeaderAPIKeyID, keyID)
+	}
+	if len(scopes) > 0 {
+		r.Header.Set(HeaderScopes, strings.Join(scopes, " "))
+	}
+}
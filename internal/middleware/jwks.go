@@ -0,0 +1,225 @@
+package middleware
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// JWKS defaults
+const (
+	DefaultJWKSRefresh = time.Hour
+	// jwksMinRefetch throttles refetches triggered by unknown key IDs, so
+	// tokens with garbage kids can't make the gateway hammer the provider.
+	jwksMinRefetch = 10 * time.Second
+)
+
+// JWKS fetches and caches the public keys of an identity provider (Auth0,
+// Keycloak, Cognito, ...) from its JSON Web Key Set URL. Keys are refreshed
+// periodically, and immediately when a token names a key ID the cache
+// doesn't have yet, so provider key rotation needs no gateway restart.
+// Fetches happen outside the lock, one at a time, so a slow provider only
+// holds up the requests that need a key the cache doesn't have.
+type JWKS struct {
+	url     string
+	refresh time.Duration
+	client  *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]interface{} // kid → *rsa.PublicKey or *ecdsa.PublicKey
+	fetchedAt time.Time
+	fetching  *jwksFetch // the fetch in progress, if any
+}
+
+// jwksFetch is a fetch from the identity provider (a key set or OIDC
+// discovery) that requests can wait on.
+type jwksFetch struct {
+	done chan struct{} // closed when the fetch finishes
+	err  error
+}
+
+// NewJWKS creates a key set fetched from url. refresh <= 0 uses DefaultJWKSRefresh.
+func NewJWKS(url string, refresh time.Duration) *JWKS {
+	if refresh <= 0 {
+		refresh = DefaultJWKSRefresh
+	}
+	return &JWKS{
+		url:     url,
+		refresh: refresh,
+		client:  &http.Client{Timeout: 5 * time.Second},
+		keys:    make(map[string]interface{}),
+	}
+}
+
+// Key returns the public key with the given ID. A stale cache is
+// refreshed in the background while its keys keep validating; an unknown
+// ID waits for a fetch, at most one per jwksMinRefetch.
+func (j *JWKS) Key(kid string) (interface{}, error) {
+	j.mu.Lock()
+	key, ok := j.keys[kid]
+	age := time.Since(j.fetchedAt)
+	switch {
+	case ok:
+		if age >= j.refresh {
+			j.startFetch()
+		}
+		j.mu.Unlock()
+		return key, nil
+	case age < jwksMinRefetch && j.fetching == nil:
+		j.mu.Unlock()
+		return nil, fmt.Errorf("unknown jwt key id %q", kid)
+	}
+	f := j.startFetch()
+	j.mu.Unlock()
+
+	<-f.done
+	if f.err != nil {
+		return nil, f.err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if key, ok = j.keys[kid]; !ok {
+		return nil, fmt.Errorf("unknown jwt key id %q", kid)
+	}
+	return key, nil
+}
+
+// Refresh fetches the key set now, e.g. to warm the cache at startup.
+func (j *JWKS) Refresh() error {
+	j.mu.Lock()
+	f := j.startFetch()
+	j.mu.Unlock()
+	<-f.done
+	return f.err
+}
+
+// startFetch starts fetching the key set, unless a fetch is already in
+// progress, and returns the fetch. Must hold j.mu.
+func (j *JWKS) startFetch() *jwksFetch {
+	if j.fetching != nil {
+		return j.fetching
+	}
+	f := &jwksFetch{done: make(chan struct{})}
+	j.fetching = f
+	j.fetchedAt = time.Now() // also on failure, so misses stay throttled
+	go func() {
+		keys, err := j.fetch()
+		j.mu.Lock()
+		if err == nil {
+			j.keys = keys
+		} else if len(j.keys) > 0 {
+			// Keep validating with the cached keys while the provider is unreachable
+			log.Printf("[auth] JWKS refresh failed, using cached keys: %v", err)
+		}
+		j.fetching = nil
+		j.mu.Unlock()
+		f.err = err
+		close(f.done)
+	}()
+	return f
+}
+
+// fetch returns the provider's current key set.
+func (j *JWKS) fetch() (map[string]interface{}, error) {
+	resp, err := j.client.Get(j.url)
+	if err != nil {
+		return nil, fmt.Errorf("fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch JWKS: %s returned %d", j.url, resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("decode JWKS: %w", err)
+	}
+
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.publicKey()
+		if err != nil {
+			log.Printf("[auth] skipping JWKS key %q: %v", k.Kid, err)
+			continue
+		}
+		keys[k.Kid] = pub
+	}
+	return keys, nil
+}
+
+// jwk is a single JSON Web Key (RFC 7517). Only RSA and EC public keys are supported.
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKey decodes the key material.
+func (k jwk) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeJWKInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeJWKInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeJWKInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeJWKInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// decodeJWKInt decodes a base64url-encoded big-endian integer.
+func decodeJWKInt(s string) (*big.Int, error) {
+	if s == "" {
+		return nil, errors.New("missing key parameter")
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JWTPolicy holds the claims and algorithms a token must satisfy beyond a
+// valid signature. exp and nbf are always checked when present.
+type JWTPolicy struct {
+	Issuer     string        // required iss, "" = any
+	Audience   string        // required aud entry, "" = any
+	Leeway     time.Duration // clock skew tolerated on exp/nbf/iat
+	Algorithms []string      // allowed signing algorithms, see defaultJWTAlgorithms
+	RequireExp bool          // reject tokens without an exp claim
+}
+
+// defaultJWTAlgorithms are accepted when the policy doesn't list any: HMAC
+// with the shared secret, plus RSA and ECDSA when a JWKS is configured.
+func (a *Auth) defaultJWTAlgorithms() []string {
+	var algs []string
+	if len(a.jwtSecret) > 0 {
+		algs = append(algs, "HS256", "HS384", "HS512")
+	}
+	if a.jwks != nil {
+		algs = append(algs, "RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512")
+	}
+	return algs
+}
+
+// SetJWKS verifies asymmetrically signed tokens (RS*, PS*, ES*) against
+// the provider keys in j, selected by the token's kid header. Must be
+// called before serving.
+func (a *Auth) SetJWKS(j *JWKS) {
+	a.jwks = j
+}
+
+// SetJWTPolicy sets the claim and algorithm requirements for Bearer tokens.
+// Must be called before serving.
+func (a *Auth) SetJWTPolicy(p JWTPolicy) error {
+	for _, alg := range p.Algorithms {
+		if alg == "none" {
+			return fmt.Errorf("jwt algorithm %q is never allowed", alg)
+		}
+		if jwt.GetSigningMethod(alg) == nil {
+			return fmt.Errorf("unknown jwt algorithm %q", alg)
+		}
+	}
+	a.jwtPolicy = p
+	return nil
+}
+
+// parseToken verifies a Bearer token's signature, algorithm, and claims.
+func (a *Auth) parseToken(tokenString string) (*jwt.Token, error) {
+	p := a.jwtPolicy
+	algs := p.Algorithms
+	if len(algs) == 0 {
+		algs = a.defaultJWTAlgorithms()
+	}
+	opts := []jwt.ParserOption{jwt.WithValidMethods(algs), jwt.WithLeeway(p.Leeway), jwt.WithIssuedAt()}
+	if p.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(p.Issuer))
+	}
+	if p.Audience != "" {
+		opts = append(opts, jwt.WithAudience(p.Audience))
+	}
+	if p.RequireExp {
+		opts = append(opts, jwt.WithExpirationRequired())
+	}
+
+	return jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		switch token.Method.(type) {
+		case *jwt.SigningMethodHMAC:
+			if len(a.jwtSecret) == 0 {
+				return nil, errors.New("no jwt secret configured")
+			}
+			return a.jwtSecret, nil
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS, *jwt.SigningMethodECDSA:
+			if a.jwks == nil {
+				return nil, errors.New("no JWKS configured")
+			}
+			kid, _ := token.Header["kid"].(string)
+			return a.jwks.Key(kid)
+		}
+		return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+	}, opts...)
+}
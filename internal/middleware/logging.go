@@ -27,6 +27,12 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
+// Unwrap exposes the underlying ResponseWriter so http.ResponseController
+// can reach Flush/Hijack (needed for SSE and upgraded connections).
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 // logEntry is the structured log format for each request.
 // Using JSON makes logs machine-parseable — tools like Datadog, Splunk,
 // and ELK can ingest these directly without custom parsers.
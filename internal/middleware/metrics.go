@@ -29,6 +29,126 @@ var (
 		},
 		[]string{"method", "path"},
 	)
+
+	// rateLimitPressure counts requests allowed above a route's adaptive soft
+	// limit (two-tier mode) — an early signal before clients start seeing 429s.
+	rateLimitPressure = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_ratelimit_pressure_total",
+			Help: "Requests allowed above the adaptive soft limit but under the hard cap",
+		},
+		[]string{"route"},
+	)
+
+	// rateLimitBuckets tracks how many clients each limiter holds a bucket for.
+	rateLimitBuckets = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gateway_ratelimit_buckets",
+			Help: "Client buckets held by each rate limiter",
+		},
+		[]string{"limiter"},
+	)
+
+	// duplicateRequests counts requests repeating an idempotency key or
+	// payload signature seen within the dedup window.
+	duplicateRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_duplicate_requests_total",
+			Help: "Requests repeating a recently seen idempotency key or payload signature",
+		},
+		[]string{"route"},
+	)
+
+	// replaysRejected counts duplicates refused on replay-protected routes.
+	replaysRejected = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_replays_rejected_total",
+			Help: "Duplicate requests rejected on replay-protected routes",
+		},
+		[]string{"route"},
+	)
+
+	// rateLimitShadowRejections counts requests the adaptive limiter would
+	// have rejected in shadow mode.
+	rateLimitShadowRejections = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_ratelimit_shadow_rejections_total",
+			Help: "Requests the adaptive rate limiter would have rejected in shadow mode",
+		},
+		[]string{"route"},
+	)
+
+	// inFlightRequests tracks requests held by the per-route concurrency limit.
+	inFlightRequests = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gateway_inflight_requests",
+			Help: "Requests in flight on routes with a concurrency limit",
+		},
+		[]string{"route"},
+	)
+
+	// concurrencyRejected counts requests refused because their route was full.
+	concurrencyRejected = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_concurrency_rejected_total",
+			Help: "Requests rejected by the per-route concurrency limit",
+		},
+		[]string{"route"},
+	)
+
+	// breakerState tracks each circuit breaker's state (0 closed, 1 open, 2 half-open).
+	breakerState = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gateway_circuit_breaker_state",
+			Help: "Circuit breaker state: 0 closed, 1 open, 2 half-open",
+		},
+		[]string{"breaker"},
+	)
+
+	// breakerTransitions counts state changes by the state entered.
+	breakerTransitions = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_circuit_breaker_transitions_total",
+			Help: "Circuit breaker state transitions, by the state entered",
+		},
+		[]string{"breaker", "state"},
+	)
+
+	// breakerRejected counts requests refused by an open (or probing) breaker.
+	breakerRejected = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_circuit_breaker_rejected_total",
+			Help: "Requests rejected by an open or half-open circuit breaker",
+		},
+		[]string{"breaker", "route"},
+	)
+
+	// breakerFailures counts backend failures (5xx) seen by each breaker.
+	breakerFailures = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_circuit_breaker_failures_total",
+			Help: "Backend failures counted by the circuit breaker",
+		},
+		[]string{"breaker", "backend"},
+	)
+
+	// breakerProbes counts half-open probe outcomes.
+	breakerProbes = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_circuit_breaker_probes_total",
+			Help: "Half-open probe requests by outcome (success or failure)",
+		},
+		[]string{"breaker", "outcome"},
+	)
+
+	// retriesTotal counts retry attempts by whether the retry budget allowed them.
+	retriesTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_retries_total",
+			Help: "Retry attempts by route and result (allowed or denied by the retry budget)",
+		},
+		[]string{"route", "result"},
+	)
 )
 
 // Metrics returns a Middleware that records Prometheus metrics per request.
@@ -0,0 +1,388 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// OIDC cookie names
+const (
+	oidcSessionCookie = "gw_session"
+	oidcStateCookie   = "gw_oidc_state"
+)
+
+// DefaultSessionTTL is how long an OIDC login lasts unless configured.
+const DefaultSessionTTL = 8 * time.Hour
+
+// oidcDiscoveryBackoff is how long a failed discovery is remembered, so an
+// unreachable provider isn't asked again by every login in the meantime.
+const oidcDiscoveryBackoff = 10 * time.Second
+
+// OIDCConfig configures browser login through an OpenID Connect provider.
+type OIDCConfig struct {
+	Issuer       string // e.g. https://accounts.google.com
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string   // this gateway's callback, e.g. https://gw.example.com/oauth2/callback
+	Scopes       []string // default ["openid", "profile", "email"]
+	CookieSecret string   // signs session cookies
+	SessionTTL   time.Duration
+}
+
+// OIDC runs the authorization code flow for browser-facing routes: users
+// without a session are redirected to the provider, the callback exchanges
+// the code for an ID token, and a signed session cookie carries the login
+// from then on. Internal web apps get SSO without implementing it.
+type OIDC struct {
+	cfg    OIDCConfig
+	secret []byte
+	client *http.Client
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	jwks      *JWKS
+	fetching  *jwksFetch // the discovery in progress, if any
+	failedAt  time.Time  // when discovery last failed
+	failure   error
+}
+
+// oidcDiscovery is the subset of the provider metadata the gateway uses.
+type oidcDiscovery struct {
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcSession is the payload of the session cookie.
+type oidcSession struct {
+	Subject string `json:"sub"`
+	Email   string `json:"email,omitempty"`
+	Expires int64  `json:"exp"`
+}
+
+// oidcState is the payload of the short-lived cookie tying a callback to
+// the login that started it.
+type oidcState struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	ReturnTo string `json:"return_to"`
+	Expires  int64  `json:"exp"`
+}
+
+// NewOIDC creates an OIDC login handler. Provider metadata is discovered
+// lazily on first use.
+func NewOIDC(cfg OIDCConfig) (*OIDC, error) {
+	if cfg.Issuer == "" || cfg.ClientID == "" || cfg.RedirectURL == "" {
+		return nil, errors.New("oidc: issuer, client_id, and redirect_url are required")
+	}
+	if len(cfg.CookieSecret) < 32 {
+		return nil, errors.New("oidc: cookie_secret must be at least 32 characters")
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "profile", "email"}
+	}
+	if cfg.SessionTTL <= 0 {
+		cfg.SessionTTL = DefaultSessionTTL
+	}
+	return &OIDC{
+		cfg:    cfg,
+		secret: []byte(cfg.CookieSecret),
+		client: &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// CallbackPath is the path of the redirect URL, to be routed to CallbackHandler.
+func (o *OIDC) CallbackPath() string {
+	u, err := url.Parse(o.cfg.RedirectURL)
+	if err != nil || u.Path == "" {
+		return "/oauth2/callback"
+	}
+	return u.Path
+}
+
+// provider returns the discovered provider metadata, fetching it once.
+// The fetch happens outside the lock, and concurrent logins wait on the
+// same one; after a failure, logins fail fast until oidcDiscoveryBackoff
+// has passed.
+func (o *OIDC) provider() (*oidcDiscovery, *JWKS, error) {
+	o.mu.Lock()
+	if o.discovery != nil {
+		defer o.mu.Unlock()
+		return o.discovery, o.jwks, nil
+	}
+	f := o.fetching
+	if f == nil {
+		if time.Since(o.failedAt) < oidcDiscoveryBackoff {
+			defer o.mu.Unlock()
+			return nil, nil, o.failure
+		}
+		f = &jwksFetch{done: make(chan struct{})}
+		o.fetching = f
+		go func() {
+			d, err := o.discover()
+			o.mu.Lock()
+			if err == nil {
+				o.discovery, o.jwks = d, NewJWKS(d.JWKSURI, 0)
+			} else {
+				o.failedAt, o.failure = time.Now(), err
+			}
+			o.fetching = nil
+			o.mu.Unlock()
+			f.err = err
+			close(f.done)
+		}()
+	}
+	o.mu.Unlock()
+
+	<-f.done
+	if f.err != nil {
+		return nil, nil, f.err
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.discovery, o.jwks, nil
+}
+
+// discover fetches the provider metadata from the issuer's well-known URL.
+func (o *OIDC) discover() (*oidcDiscovery, error) {
+	resp, err := o.client.Get(strings.TrimSuffix(o.cfg.Issuer, "/") + "/.well-known/openid-configuration")
+	if err != nil {
+		return nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oidc discovery: provider returned %d", resp.StatusCode)
+	}
+	var d oidcDiscovery
+	if err := json.NewDecoder(resp.Body).Decode(&d); err != nil {
+		return nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+	return &d, nil
+}
+
+// serve lets requests with a valid session through. Others are sent to the
+// provider to log in if they look like page loads, and refused otherwise.
+func (o *OIDC) serve(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	if s, ok := o.session(r); ok {
+		setIdentityHeaders(r, s.Subject, "", nil)
+		next.ServeHTTP(w, r)
+		return
+	}
+	if r.Method != http.MethodGet || !strings.Contains(r.Header.Get("Accept"), "text/html") {
+		gatewayError(w, r, "unauthorized", "Login required", http.StatusUnauthorized)
+		return
+	}
+	o.login(w, r)
+}
+
+// session returns the request's session, if its cookie is valid and unexpired.
+func (o *OIDC) session(r *http.Request) (oidcSession, bool) {
+	var s oidcSession
+	c, err := r.Cookie(oidcSessionCookie)
+	if err != nil || !o.verify(c.Value, &s) || time.Now().Unix() >= s.Expires {
+		return s, false
+	}
+	return s, true
+}
+
+// login redirects to the provider's authorization endpoint.
+func (o *OIDC) login(w http.ResponseWriter, r *http.Request) {
+	d, _, err := o.provider()
+	if err != nil {
+		gatewayError(w, r, "bad_gateway", "Identity provider unavailable", http.StatusBadGateway)
+		return
+	}
+
+	st := oidcState{
+		State:    randomToken(),
+		Nonce:    randomToken(),
+		ReturnTo: r.URL.RequestURI(), // relative, so the callback can't be turned into an open redirect
+		Expires:  time.Now().Add(10 * time.Minute).Unix(),
+	}
+	o.setCookie(w, oidcStateCookie, o.sign(st), 10*time.Minute)
+
+	q := url.Values{
+		"response_type": {"code"},
+		"client_id":     {o.cfg.ClientID},
+		"redirect_uri":  {o.cfg.RedirectURL},
+		"scope":         {strings.Join(o.cfg.Scopes, " ")},
+		"state":         {st.State},
+		"nonce":         {st.Nonce},
+	}
+	http.Redirect(w, r, d.AuthorizationEndpoint+"?"+q.Encode(), http.StatusFound)
+}
+
+// CallbackHandler completes a login: it checks the state, exchanges the
+// code for an ID token, verifies it, and sets the session cookie.
+func (o *OIDC) CallbackHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var st oidcState
+		c, err := r.Cookie(oidcStateCookie)
+		if err != nil || !o.verify(c.Value, &st) || time.Now().Unix() >= st.Expires ||
+			!hmac.Equal([]byte(st.State), []byte(r.URL.Query().Get("state"))) {
+			gatewayError(w, r, "unauthorized", "Invalid login state", http.StatusUnauthorized)
+			return
+		}
+		o.setCookie(w, oidcStateCookie, "", -1)
+
+		if e := r.URL.Query().Get("error"); e != "" {
+			gatewayError(w, r, "unauthorized", "Login failed: "+e, http.StatusUnauthorized)
+			return
+		}
+
+		claims, err := o.exchange(r.URL.Query().Get("code"), st.Nonce)
+		if err != nil {
+			gatewayError(w, r, "unauthorized", "Login failed", http.StatusUnauthorized)
+			return
+		}
+
+		sub, _ := claims.GetSubject()
+		email, _ := claims["email"].(string)
+		s := oidcSession{Subject: sub, Email: email, Expires: time.Now().Add(o.cfg.SessionTTL).Unix()}
+		o.setCookie(w, oidcSessionCookie, o.sign(s), o.cfg.SessionTTL)
+		Audit(r, AuditEvent{Event: "oidc_login", Outcome: "allowed", Identity: sub})
+
+		returnTo := st.ReturnTo
+		if !strings.HasPrefix(returnTo, "/") || strings.HasPrefix(returnTo, "//") {
+			returnTo = "/"
+		}
+		http.Redirect(w, r, returnTo, http.StatusFound)
+	}
+}
+
+// LogoutHandler clears the session cookie.
+func (o *OIDC) LogoutHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		o.setCookie(w, oidcSessionCookie, "", -1)
+		http.Redirect(w, r, "/", http.StatusFound)
+	}
+}
+
+// exchange trades an authorization code for an ID token and verifies it.
+func (o *OIDC) exchange(code, nonce string) (jwt.MapClaims, error) {
+	d, jwks, err := o.provider()
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {o.cfg.RedirectURL},
+	}
+	req, err := http.NewRequest(http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(o.cfg.ClientID), url.QueryEscape(o.cfg.ClientSecret))
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("oidc token exchange: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oidc token exchange: provider returned %d", resp.StatusCode)
+	}
+	var tok struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil {
+		return nil, fmt.Errorf("oidc token exchange: %w", err)
+	}
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(tok.IDToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return jwks.Key(kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(o.cfg.Issuer),
+		jwt.WithAudience(o.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("oidc id token: %w", err)
+	}
+	if n, _ := claims["nonce"].(string); n != nonce {
+		return nil, errors.New("oidc id token: nonce mismatch")
+	}
+	return claims, nil
+}
+
+// setCookie sets an HttpOnly cookie, Secure when the gateway is reached over HTTPS.
+func (o *OIDC) setCookie(w http.ResponseWriter, name, value string, ttl time.Duration) {
+	c := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(o.cfg.RedirectURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   int(ttl.Seconds()),
+	}
+	if ttl < 0 {
+		c.MaxAge = -1
+	}
+	http.SetCookie(w, c)
+}
+
+// sign encodes v as a signed cookie value.
+func (o *OIDC) sign(v interface{}) string {
+	return signValue(o.secret, v)
+}
+
+// verify checks a signed cookie value and decodes it into v.
+func (o *OIDC) verify(signed string, v interface{}) bool {
+	return verifySigned(o.secret, signed, v)
+}
+
+// signValue encodes v as base64(json).base64(hmac).
+func signValue(secret []byte, v interface{}) string {
+	payload, _ := json.Marshal(v)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verifySigned checks a value from signValue and decodes it into v.
+func verifySigned(secret []byte, signed string, v interface{}) bool {
+	p, s, ok := strings.Cut(signed, ".")
+	if !ok {
+		return false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(p)
+	if err != nil {
+		return false
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return false
+	}
+	return json.Unmarshal(payload, v) == nil
+}
+
+// randomToken returns 128 random bits, base64url-encoded.
+func randomToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
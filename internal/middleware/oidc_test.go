@@ -0,0 +1,205 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestOIDCLoginFlow(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	b64 := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+	var provider *httptest.Server
+	var nonce string
+	provider = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(map[string]string{
+				"authorization_endpoint": provider.URL + "/authorize",
+				"token_endpoint":         provider.URL + "/token",
+				"jwks_uri":               provider.URL + "/jwks",
+			})
+		case "/jwks":
+			json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{
+				{"kid": "k1", "kty": "RSA", "n": b64(key.N.Bytes()), "e": b64(big.NewInt(int64(key.E)).Bytes())},
+			}})
+		case "/token":
+			if id, secret, _ := r.BasicAuth(); id != "gateway" || secret != "s3cret" || r.FormValue("code") != "good-code" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+				"iss": provider.URL, "aud": "gateway", "sub": "alice", "nonce": nonce,
+				"exp": time.Now().Add(time.Hour).Unix(),
+			})
+			token.Header["kid"] = "k1"
+			signed, _ := token.SignedString(key)
+			json.NewEncoder(w).Encode(map[string]string{"id_token": signed})
+		}
+	}))
+	defer provider.Close()
+
+	oidc, err := NewOIDC(OIDCConfig{
+		Issuer:       provider.URL,
+		ClientID:     "gateway",
+		ClientSecret: "s3cret",
+		RedirectURL:  "http://gw.local/oauth2/callback",
+		CookieSecret: "0123456789abcdef0123456789abcdef",
+	})
+	if err != nil {
+		t.Fatalf("NewOIDC: %v", err)
+	}
+	auth := NewAuth(nil, "")
+	auth.SetOIDC("/app", oidc)
+	handler := auth.Middleware(NewRouteMatcher([]string{"/app"}).Resolve)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// An API call without a session is refused outright
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/app/api/items", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected 401 for non-browser request, got %d", rec.Code)
+	}
+
+	// A page load is redirected to the provider
+	req := httptest.NewRequest(http.MethodGet, "/app/reports?id=7", nil)
+	req.Header.Set("Accept", "text/html")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusFound {
+		t.Fatalf("Expected redirect to login, got %d", rec.Code)
+	}
+	loc, _ := url.Parse(rec.Header().Get("Location"))
+	if loc.Path != "/authorize" || loc.Query().Get("client_id") != "gateway" {
+		t.Fatalf("Expected provider authorize redirect, got %s", loc)
+	}
+	nonce = loc.Query().Get("nonce")
+	stateCookie := rec.Result().Cookies()[0]
+
+	// A callback with a forged state is refused
+	cb := httptest.NewRequest(http.MethodGet, "/oauth2/callback?code=good-code&state=forged", nil)
+	cb.AddCookie(stateCookie)
+	rec = httptest.NewRecorder()
+	oidc.CallbackHandler().ServeHTTP(rec, cb)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected forged state refused, got %d", rec.Code)
+	}
+
+	cb = httptest.NewRequest(http.MethodGet, "/oauth2/callback?code=good-code&state="+loc.Query().Get("state"), nil)
+	cb.AddCookie(stateCookie)
+	rec = httptest.NewRecorder()
+	oidc.CallbackHandler().ServeHTTP(rec, cb)
+	if rec.Code != http.StatusFound || rec.Header().Get("Location") != "/app/reports?id=7" {
+		t.Fatalf("Expected redirect back to the original page, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+	var session *http.Cookie
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == oidcSessionCookie {
+			session = c
+		}
+	}
+	if session == nil {
+		t.Fatal("Expected a session cookie")
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/app/reports?id=7", nil)
+	req.AddCookie(session)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected session to grant access, got %d", rec.Code)
+	}
+
+	session.Value += "x"
+	req = httptest.NewRequest(http.MethodGet, "/app/reports", nil)
+	req.AddCookie(session)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected tampered session refused, got %d", rec.Code)
+	}
+}
+
+func TestOIDCDiscoveryFetchesOnceAndBacksOff(t *testing.T) {
+	var hits atomic.Int32
+	var status atomic.Int32
+	status.Store(http.StatusServiceUnavailable)
+	release := make(chan struct{})
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		<-release
+		if code := int(status.Load()); code != http.StatusOK {
+			w.WriteHeader(code)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"authorization_endpoint": "https://idp.example.com/authorize"})
+	}))
+	defer provider.Close()
+
+	oidc, err := NewOIDC(OIDCConfig{
+		Issuer:       provider.URL,
+		ClientID:     "gateway",
+		RedirectURL:  "http://gw.local/oauth2/callback",
+		CookieSecret: "0123456789abcdef0123456789abcdef",
+	})
+	if err != nil {
+		t.Fatalf("NewOIDC: %v", err)
+	}
+
+	// Logins arriving while discovery is slow all wait on the one request
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, err := oidc.provider()
+			errs <- err
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err == nil {
+			t.Error("Expected every waiting login to see the failed discovery")
+		}
+	}
+	if hits.Load() != 1 {
+		t.Fatalf("Expected one discovery request, got %d", hits.Load())
+	}
+
+	// Right after a failure, logins fail fast without asking again
+	status.Store(http.StatusOK)
+	if _, _, err := oidc.provider(); err == nil || hits.Load() != 1 {
+		t.Errorf("Expected the failure remembered during the backoff, got %v after %d requests", err, hits.Load())
+	}
+
+	// Once the backoff has passed, discovery is retried and then cached
+	oidc.mu.Lock()
+	oidc.failedAt = time.Now().Add(-oidcDiscoveryBackoff)
+	oidc.mu.Unlock()
+	for range 2 {
+		d, _, err := oidc.provider()
+		if err != nil || d.AuthorizationEndpoint != "https://idp.example.com/authorize" {
+			t.Fatalf("Expected discovery to succeed after the backoff, got %v", err)
+		}
+	}
+	if hits.Load() != 2 {
+		t.Errorf("Expected discovery cached after success, got %d requests", hits.Load())
+	}
+}
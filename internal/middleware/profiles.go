@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// ProtectionProfile bundles the per-route protection knobs so operators can
+// move a route between a few well-understood presets mid-incident instead of
+// tuning limiter, breaker, and retry numbers one by one. Scales are relative
+// to the globally configured values, so "balanced" changes nothing.
+type ProtectionProfile struct {
+	Name                  string  `json:"name"`
+	LimitScale            float64 `json:"limit_scale"`             // × adaptive rate limit multiplier
+	BreakerThresholdScale float64 `json:"breaker_threshold_scale"` // × breaker failure threshold (lower trips sooner)
+	BreakerTimeoutScale   float64 `json:"breaker_timeout_scale"`   // × breaker open timeout
+	RetryBudget           float64 `json:"retry_budget"`            // max fraction of requests that may be retried
+}
+
+// Built-in profile names.
+const (
+	ProfileConservative = "conservative"
+	ProfileBalanced     = "balanced"
+	ProfileAggressive   = "aggressive"
+)
+
+// Profiles are the built-in protection presets.
+//   - conservative: shields backends — tighter limits, breaker trips sooner
+//     and stays open longer, no retries
+//   - balanced: the configured defaults
+//   - aggressive: favors availability — looser limits, breaker tolerates
+//     more failures and recovers sooner, more retries
+var Profiles = map[string]ProtectionProfile{
+	ProfileConservative: {Name: ProfileConservative, LimitScale: 0.5, BreakerThresholdScale: 0.5, BreakerTimeoutScale: 2.0, RetryBudget: 0},
+	ProfileBalanced:     {Name: ProfileBalanced, LimitScale: 1.0, BreakerThresholdScale: 1.0, BreakerTimeoutScale: 1.0, RetryBudget: 0.1},
+	ProfileAggressive:   {Name: ProfileAggressive, LimitScale: 2.0, BreakerThresholdScale: 2.0, BreakerTimeoutScale: 0.5, RetryBudget: 0.2},
+}
+
+// ProfileManager holds the protection profile assigned to each route and
+// can be changed at runtime (e.g. from the dashboard).
+type ProfileManager struct {
+	mu     sync.RWMutex
+	routes map[string]string // route → profile name
+	def    string
+
+	// version increments on every change so consumers can cheaply notice
+	// they need to recompute derived limits.
+	version atomic.Uint64
+}
+
+// NewProfileManager creates a manager where unassigned routes use
+// defaultProfile (balanced if empty or unknown).
+func NewProfileManager(defaultProfile string) *ProfileManager {
+	if _, ok := Profiles[defaultProfile]; !ok {
+		defaultProfile = ProfileBalanced
+	}
+	return &ProfileManager{
+		routes: make(map[string]string),
+		def:    defaultProfile,
+	}
+}
+
+// Set assigns a profile to a route.
+func (m *ProfileManager) Set(route, profile string) error {
+	if _, ok := Profiles[profile]; !ok {
+		return fmt.Errorf("unknown protection profile %q", profile)
+	}
+	m.mu.Lock()
+	prev := m.routes[route]
+	m.routes[route] = profile
+	m.mu.Unlock()
+	m.version.Add(1)
+
+	if prev != profile {
+		log.Printf("[profiles] route=%s profile=%s", route, profile)
+	}
+	return nil
+}
+
+// For returns the profile in effect for a route. A nil manager yields balanced.
+func (m *ProfileManager) For(route string) ProtectionProfile {
+	if m == nil {
+		return Profiles[ProfileBalanced]
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if name, ok := m.routes[route]; ok {
+		return Profiles[name]
+	}
+	return Profiles[m.def]
+}
+
+// Version returns a counter that changes whenever an assignment changes.
+func (m *ProfileManager) Version() uint64 {
+	if m == nil {
+		return 0
+	}
+	return m.version.Load()
+}
+
+// RouteProfile is one route's profile assignment.
+type RouteProfile struct {
+	Route   string `json:"route"`
+	Profile string `json:"profile"`
+}
+
+// Assignments returns the effective profile for each of the given routes,
+// sorted by route.
+func (m *ProfileManager) Assignments(routes []string) []RouteProfile {
+	out := make([]RouteProfile, 0, len(routes))
+	for _, route := range routes {
+		out = append(out, RouteProfile{Route: route, Profile: m.For(route).Name})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Route < out[j].Route })
+	return out
+}
@@ -0,0 +1,263 @@
+package middleware
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Quota periods
+const (
+	QuotaDaily   = "daily"
+	QuotaMonthly = "monthly"
+)
+
+// QuotaLimits caps requests per API key over long horizons. Zero means
+// unlimited for that period.
+type QuotaLimits struct {
+	Daily   int64
+	Monthly int64
+}
+
+// QuotaUsage is one key's request counts for the current periods. Periods
+// are calendar days and months in UTC; counts reset when a new one starts.
+type QuotaUsage struct {
+	Day         string `json:"day"`   // e.g. "2024-05-17"
+	Month       string `json:"month"` // e.g. "2024-05"
+	DailyUsed   int64  `json:"daily_used"`
+	MonthlyUsed int64  `json:"monthly_used"`
+}
+
+// QuotaManager enforces daily and monthly request quotas per API key, on
+// top of the short-term rate limiter. Usage is kept in memory and persisted
+// via Snapshot/Restore, so a restart doesn't hand everyone a fresh month.
+// Keys are stored hashed, never in plain text.
+type QuotaManager struct {
+	defaults QuotaLimits
+	perKey   map[string]QuotaLimits // hashed key → limits
+	tiers    map[string]QuotaLimits // tier → limits, see SetTier
+	tierOf   func(apiKey string) string
+	mu       sync.Mutex
+	usage    map[string]*QuotaUsage // hashed key → usage
+	now      func() time.Time
+}
+
+// NewQuotaManager creates a quota manager with default limits for every key.
+func NewQuotaManager(defaults QuotaLimits) *QuotaManager {
+	return &QuotaManager{
+		defaults: defaults,
+		perKey:   make(map[string]QuotaLimits),
+		tiers:    make(map[string]QuotaLimits),
+		usage:    make(map[string]*QuotaUsage),
+		now:      time.Now,
+	}
+}
+
+// SetKeyLimits overrides the limits for one API key. Must be called before serving.
+func (q *QuotaManager) SetKeyLimits(apiKey string, limits QuotaLimits) {
+	q.perKey[hashAPIKey(apiKey)] = limits
+}
+
+// SetTier sets the limits for API keys of a tier. Per-key limits still
+// take precedence. Must be called before serving.
+func (q *QuotaManager) SetTier(tier string, limits QuotaLimits) {
+	q.tiers[tier] = limits
+}
+
+// SetTierFunc sets how an API key's tier is found, normally from auth's
+// key configuration. Must be called before serving.
+func (q *QuotaManager) SetTierFunc(fn func(apiKey string) string) {
+	q.tierOf = fn
+}
+
+// limitsFor returns the limits that apply to a hashed key of the given tier.
+func (q *QuotaManager) limitsFor(id, tier string) QuotaLimits {
+	if l, ok := q.perKey[id]; ok {
+		return l
+	}
+	if l, ok := q.tiers[tier]; ok {
+		return l
+	}
+	return q.defaults
+}
+
+// tier returns an API key's tier, or "" without a tier function.
+func (q *QuotaManager) tier(apiKey string) string {
+	if q.tierOf == nil {
+		return ""
+	}
+	return q.tierOf(apiKey)
+}
+
+// QuotaStatus describes one period's quota for a key.
+type QuotaStatus struct {
+	Period    string    `json:"period"`
+	Limit     int64     `json:"limit"`
+	Used      int64     `json:"used"`
+	Remaining int64     `json:"remaining"`
+	ResetsAt  time.Time `json:"resets_at"`
+}
+
+// current returns the key's usage, rolled over to the current periods.
+// Must hold q.mu.
+func (q *QuotaManager) current(id string, now time.Time) *QuotaUsage {
+	day, month := now.Format("2006-01-02"), now.Format("2006-01")
+	u := q.usage[id]
+	if u == nil {
+		u = &QuotaUsage{Day: day, Month: month}
+		q.usage[id] = u
+	}
+	if u.Day != day {
+		u.Day, u.DailyUsed = day, 0
+	}
+	if u.Month != month {
+		u.Month, u.MonthlyUsed = month, 0
+	}
+	return u
+}
+
+// statuses returns the key's limited periods. Must hold q.mu.
+func (q *QuotaManager) statuses(id string, limits QuotaLimits, u *QuotaUsage, now time.Time) []QuotaStatus {
+	y, m, d := now.Date()
+	var out []QuotaStatus
+	if limits.Daily > 0 {
+		out = append(out, QuotaStatus{
+			Period: QuotaDaily, Limit: limits.Daily, Used: u.DailyUsed,
+			Remaining: max(limits.Daily-u.DailyUsed, 0),
+			ResetsAt:  time.Date(y, m, d+1, 0, 0, 0, 0, time.UTC),
+		})
+	}
+	if limits.Monthly > 0 {
+		out = append(out, QuotaStatus{
+			Period: QuotaMonthly, Limit: limits.Monthly, Used: u.MonthlyUsed,
+			Remaining: max(limits.Monthly-u.MonthlyUsed, 0),
+			ResetsAt:  time.Date(y, m+1, 1, 0, 0, 0, 0, time.UTC),
+		})
+	}
+	return out
+}
+
+// consume counts a request against the key's quotas unless one is already
+// exhausted. Returns whether it's allowed and the tightest period's status.
+func (q *QuotaManager) consume(apiKey string) (bool, *QuotaStatus) {
+	id, tier := hashAPIKey(apiKey), q.tier(apiKey)
+	now := q.now().UTC()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	u := q.current(id, now)
+	statuses := q.statuses(id, q.limitsFor(id, tier), u, now)
+	if len(statuses) == 0 {
+		return true, nil
+	}
+
+	tightest := &statuses[0]
+	for i := range statuses {
+		if statuses[i].Remaining == 0 {
+			return false, &statuses[i]
+		}
+		if statuses[i].Remaining < tightest.Remaining {
+			tightest = &statuses[i]
+		}
+	}
+
+	u.DailyUsed++
+	u.MonthlyUsed++
+	tightest.Used++
+	tightest.Remaining--
+	return true, tightest
+}
+
+// Usage returns the current quota status of an API key.
+func (q *QuotaManager) Usage(apiKey string) []QuotaStatus {
+	id, tier := hashAPIKey(apiKey), q.tier(apiKey)
+	now := q.now().UTC()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.statuses(id, q.limitsFor(id, tier), q.current(id, now), now)
+}
+
+// writeQuotaHeaders reports a quota's standing on the response.
+func writeQuotaHeaders(w http.ResponseWriter, s *QuotaStatus, now time.Time) {
+	h := w.Header()
+	h.Set("X-Quota-Limit", strconv.FormatInt(s.Limit, 10))
+	h.Set("X-Quota-Remaining", strconv.FormatInt(s.Remaining, 10))
+	h.Set("X-Quota-Reset", strconv.Itoa(int(math.Ceil(s.ResetsAt.Sub(now).Seconds()))))
+	h.Set("X-Quota-Period", s.Period)
+}
+
+// Middleware returns the quota Middleware. Requests without a valid API
+// key aren't subject to quotas; validKey keeps keys sent to public routes
+// (which skip auth) from being tracked.
+func (q *QuotaManager) Middleware(validKey func(string) bool) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get("X-API-Key")
+			if key == "" || !validKey(key) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ok, status := q.consume(key)
+			now := q.now()
+			if status != nil {
+				writeQuotaHeaders(w, status, now)
+			}
+			if !ok {
+				setRetryAfter(w, status.ResetsAt.Sub(now))
+				gatewayError(w, r, "quota_exceeded", "Quota Exceeded", http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// UsageHandler serves GET /quota: the caller's own quota usage, identified
+// by its X-API-Key. validKey rejects keys auth wouldn't accept.
+func (q *QuotaManager) UsageHandler(validKey func(string) bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		key := r.Header.Get("X-API-Key")
+		if key == "" || !validKey(key) {
+			gatewayError(w, r, "unauthorized", "Invalid API Key", http.StatusUnauthorized)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"quotas": q.Usage(key),
+		})
+	}
+}
+
+// Snapshot returns every key's usage for persistence, keyed by hashed key.
+func (q *QuotaManager) Snapshot() map[string]QuotaUsage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	out := make(map[string]QuotaUsage, len(q.usage))
+	for id, u := range q.usage {
+		out[id] = *u
+	}
+	return out
+}
+
+// Restore loads persisted usage. Stale periods roll over on next use.
+func (q *QuotaManager) Restore(usage map[string]QuotaUsage) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for id, u := range usage {
+		u := u
+		q.usage[id] = &u
+	}
+}
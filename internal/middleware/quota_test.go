@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestQuotaManagerEnforcesAndPersists(t *testing.T) {
+	now := time.Date(2024, 5, 31, 23, 0, 0, 0, time.UTC)
+	q := NewQuotaManager(QuotaLimits{Daily: 2, Monthly: 100})
+	q.SetKeyLimits("vip", QuotaLimits{Monthly: 1000})
+	q.now = func() time.Time { return now }
+
+	handler := q.Middleware(func(string) bool { return true })(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	send := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/users", nil)
+		req.Header.Set("X-API-Key", key)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for i := 0; i < 2; i++ {
+		if rec := send("basic"); rec.Code != http.StatusOK {
+			t.Fatalf("Expected request %d within quota, got %d", i+1, rec.Code)
+		}
+	}
+	rec := send("basic")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429 once the daily quota is used, got %d", rec.Code)
+	}
+	if rec.Header().Get("X-Quota-Period") != QuotaDaily || rec.Header().Get("X-Quota-Remaining") != "0" {
+		t.Errorf("Expected daily quota headers, got %v", rec.Header())
+	}
+	if rec.Header().Get("Retry-After") != "3600" {
+		t.Errorf("Expected Retry-After until midnight UTC, got %q", rec.Header().Get("Retry-After"))
+	}
+	if rec := send("vip"); rec.Code != http.StatusOK || rec.Header().Get("X-Quota-Remaining") != "999" {
+		t.Errorf("Expected per-key override to apply, got %d %v", rec.Code, rec.Header())
+	}
+
+	// Usage survives a restart
+	restored := NewQuotaManager(QuotaLimits{Daily: 2, Monthly: 100})
+	restored.now = q.now
+	restored.Restore(q.Snapshot())
+	usage := restored.Usage("basic")
+	if len(usage) != 2 || usage[0].Used != 2 || usage[1].Used != 2 {
+		t.Fatalf("Expected restored usage of 2 per period, got %+v", usage)
+	}
+
+	// A new day (and month) resets the counters
+	now = now.Add(2 * time.Hour)
+	usage = restored.Usage("basic")
+	if usage[0].Used != 0 || usage[1].Used != 0 {
+		t.Errorf("Expected usage reset in a new month, got %+v", usage)
+	}
+}
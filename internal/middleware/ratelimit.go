@@ -1,8 +1,9 @@
 package middleware
 
 import (
-	"net"
+	"container/list"
 	"net/http"
+	"sort"
 	"sync"
 	"time"
 )
@@ -29,23 +30,30 @@ func (b *bucket) refill() {
 }
 
 // allow checks if a request is permitted.
-// Refills tokens first, then tries to consume one.
-func (b *bucket) allow() bool {
+// Refills tokens first, then tries to consume cost tokens.
+func (b *bucket) allow(cost float64) bool {
 	b.refill()
-	if b.tokens >= 1 {
-		b.tokens--
+	if b.tokens >= cost {
+		b.tokens -= cost
 		return true
 	}
 	return false
 }
 
-// RateLimiter holds a bucket per client IP.
+// RateLimiter holds a bucket per client (IP by default, see SetKeyFunc).
 // The mutex protects the map from concurrent access — multiple
 // goroutines (requests) hit this simultaneously.
 type RateLimiter struct {
-	buckets    map[string]*bucket
+	buckets    map[string]*list.Element // client key → *clientEntry in lru
+	lru        *list.List               // most recently seen first
+	idleTTL    time.Duration            // see SetEviction
+	maxBuckets int
+	name       string // metric label, see SetName
 	maxTokens  float64
 	refillRate float64
+	algorithm  string  // "" = token bucket, see SetAlgorithm
+	headers    string  // RateLimit header mode, "" = off (see SetHeaders)
+	keyFunc    KeyFunc // nil = client IP
 	mu         sync.Mutex
 }
 
@@ -54,45 +62,347 @@ type RateLimiter struct {
 // refillRate = sustained rate (e.g., 1.0 = 1 token/sec)
 func NewRateLimiter(maxTokens, refillRate float64) *RateLimiter {
 	return &RateLimiter{
-		buckets:    make(map[string]*bucket),
+		buckets:    make(map[string]*list.Element),
+		lru:        list.New(),
+		idleTTL:    DefaultIdleTTL,
+		maxBuckets: DefaultMaxBuckets,
+		name:       "default",
 		maxTokens:  maxTokens,
 		refillRate: refillRate,
 	}
 }
 
-// getBucket returns the bucket for a given IP, creating one if needed.
-func (rl *RateLimiter) getBucket(ip string) *bucket {
-	if b, exists := rl.buckets[ip]; exists {
-		return b
+// SetAlgorithm selects the limiting algorithm: AlgorithmTokenBucket
+// (default), AlgorithmSlidingWindow, or AlgorithmGCRA. Must be called
+// before serving. Sliding window and GCRA need refill_rate > 0 and
+// max_tokens >= 1.
+func (rl *RateLimiter) SetAlgorithm(name string) error {
+	if err := validAlgorithm(name, rl.maxTokens, rl.refillRate); err != nil {
+		return err
 	}
-	b := &bucket{
-		tokens:     rl.maxTokens,
-		maxTokens:  rl.maxTokens,
-		refillRate: rl.refillRate,
-		lastRefill: time.Now(),
+	rl.algorithm = name
+	return nil
+}
+
+// derive creates a limiter with different limits that keys clients and
+// limits them with the same algorithm as rl.
+func (rl *RateLimiter) derive(maxTokens, refillRate float64) *RateLimiter {
+	d := NewRateLimiter(maxTokens, refillRate)
+	d.algorithm = rl.algorithm
+	d.headers = rl.headers
+	d.keyFunc = rl.keyFunc
+	d.idleTTL = rl.idleTTL
+	d.maxBuckets = rl.maxBuckets
+	return d
+}
+
+// resize changes the limiter's limits in place. Every client keeps the
+// same fraction of its allowance, scaled to the new limit, so a rebalance
+// neither hands out a fresh burst nor strands clients that were throttled.
+func (rl *RateLimiter) resize(maxTokens, refillRate float64) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	scale := 1.0
+	if rl.maxTokens > 0 {
+		scale = maxTokens / rl.maxTokens
+	}
+	rl.maxTokens, rl.refillRate = maxTokens, refillRate
+	for el := rl.lru.Front(); el != nil; el = el.Next() {
+		e := el.Value.(*clientEntry)
+		s := e.algo.state()
+		s.Tokens *= scale
+		s.Previous *= scale
+		e.algo = newAlgo(rl.algorithm, maxTokens, refillRate, &s)
 	}
-	rl.buckets[ip] = b
-	return b
+}
+
+// limits returns the limiter's current burst size and refill rate.
+func (rl *RateLimiter) limits() (maxTokens, refillRate float64) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	return rl.maxTokens, rl.refillRate
+}
+
+// SetKeyFunc changes what clients are keyed by (default: client IP).
+// Must be called before serving.
+func (rl *RateLimiter) SetKeyFunc(fn KeyFunc) {
+	rl.keyFunc = fn
+}
+
+// key returns the bucket key for a request.
+func (rl *RateLimiter) key(r *http.Request) string {
+	if rl.keyFunc != nil {
+		return rl.keyFunc(r)
+	}
+	return clientIP(r)
+}
+
+// getBucket returns the bucket for a given client key, creating one if needed.
+func (rl *RateLimiter) getBucket(key string) limiterAlgo {
+	return rl.touch(key, time.Now(), func() limiterAlgo {
+		return newAlgo(rl.algorithm, rl.maxTokens, rl.refillRate, nil)
+	}).algo
+}
+
+// allow takes a token from the client's bucket, reporting whether one was available.
+func (rl *RateLimiter) allow(key string) bool {
+	ok, _ := rl.take(key, 1)
+	return ok
+}
+
+// take takes cost tokens from the client's bucket, reporting whether they
+// were available and the client's remaining quota.
+func (rl *RateLimiter) take(key string, cost float64) (bool, quota) {
+	// Lock because multiple goroutines access the buckets map
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	b := rl.getBucket(key)
+	ok := b.allow(cost)
+	remaining, reset := b.quota()
+	return ok, quota{limit: rl.maxTokens, remaining: remaining, reset: reset, window: windowFor(rl.maxTokens, rl.refillRate)}
+}
+
+// limit applies the limiter to a client's request of the given cost,
+// setting RateLimit headers and writing the 429 response if it's over.
+// Reports whether to proceed.
+func (rl *RateLimiter) limit(w http.ResponseWriter, r *http.Request, key string, cost float64) bool {
+	ok, q := rl.take(key, cost)
+	rl.writeHeaders(w, q)
+	if !ok {
+		rl.reject(w, r, cost)
+	}
+	return ok
+}
+
+// reject writes the 429 response for a request of the given cost.
+func (rl *RateLimiter) reject(w http.ResponseWriter, r *http.Request, cost float64) {
+	setRetryAfter(w, rl.retryAfter(cost))
+	gatewayError(w, r, "rate_limited", "Too Many Requests", http.StatusTooManyRequests)
+}
+
+// retryAfter estimates how long until a drained bucket has cost tokens again.
+func (rl *RateLimiter) retryAfter(cost float64) time.Duration {
+	_, refillRate := rl.limits()
+	if refillRate <= 0 {
+		return 0
+	}
+	return time.Duration(cost * float64(time.Second) / refillRate)
 }
 
 // Middleware returns the rate limiting Middleware.
-// Extracts client IP, checks the bucket, returns 429 if over limit.
+// Extracts the client key, checks the bucket, returns 429 if over limit.
 func (rl *RateLimiter) Middleware() Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Lock because multiple goroutines access the buckets map
-			rl.mu.Lock()
-			ip, _, _ := net.SplitHostPort(r.RemoteAddr)
-			b := rl.getBucket(ip)
-			allowed := b.allow()
-			rl.mu.Unlock()
-
-			if !allowed {
-				http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+			rl.serve(w, r, next, 1)
+		})
+	}
+}
+
+// serve applies the limiter to a single request of the given cost.
+func (rl *RateLimiter) serve(w http.ResponseWriter, r *http.Request, next http.Handler, cost float64) {
+	if rl.limit(w, r, rl.key(r), cost) {
+		next.ServeHTTP(w, r)
+	}
+}
+
+// RouteRateLimiter picks a static RateLimiter per route. Routes configured
+// with their own limits get separate buckets; every other route shares the
+// default limiter.
+type RouteRateLimiter struct {
+	def         *RateLimiter
+	routes      map[string]*RateLimiter
+	allowlist   *Allowlist              // exempt callers, nil = none
+	bans        map[string]time.Time    // client key → ban expiry (see Ban)
+	derived     func() []*RateLimiter   // adaptive limiters, for the admin API
+	costs       map[string]RequestCost  // route → token cost, see SetCost
+	defCost     RequestCost             // costs for routes without their own
+	tiers       map[string]*RateLimiter // API key tier → limiter, see SetTier
+	tierOf      func(r *http.Request) string
+	anonLimiter *RateLimiter    // for callers without credentials, see SetAnonymous
+	anonRoutes  map[string]bool // routes anonLimiter applies to
+	rejections  *rejectionLog   // recent 429s per route, for the admin API
+	mu          sync.RWMutex
+}
+
+// NewRouteRateLimiter creates a per-route limiter that falls back to def.
+func NewRouteRateLimiter(def *RateLimiter) *RouteRateLimiter {
+	return &RouteRateLimiter{
+		def:        def,
+		routes:     make(map[string]*RateLimiter),
+		bans:       make(map[string]time.Time),
+		costs:      make(map[string]RequestCost),
+		tiers:      make(map[string]*RateLimiter),
+		anonRoutes: make(map[string]bool),
+		rejections: newRejectionLog(),
+	}
+}
+
+// SetRoute gives a route its own limiter, named after the route in metrics.
+func (rr *RouteRateLimiter) SetRoute(route string, rl *RateLimiter) {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	rl.SetName(route)
+	rr.routes[route] = rl
+}
+
+// RequestCost is how many tokens a request takes from its bucket, so one
+// bucket can budget mixed endpoints (e.g. a search costing 10 next to
+// lookups costing 1). Methods overrides Default per HTTP method; a zero
+// Default means 1.
+type RequestCost struct {
+	Default float64
+	Methods map[string]float64 // e.g. {"POST": 5}
+}
+
+// SetCost sets the token cost of requests to a route. Must be called
+// before serving.
+func (rr *RouteRateLimiter) SetCost(route string, cost RequestCost) {
+	rr.costs[route] = cost
+}
+
+// SetDefaultCost sets per-method costs for routes without their own. Must
+// be called before serving.
+func (rr *RouteRateLimiter) SetDefaultCost(cost RequestCost) {
+	rr.defCost = cost
+}
+
+// cost returns the token cost of a request: the route's cost for its method,
+// then the route's default, then the global cost for its method, then 1.
+func (rr *RouteRateLimiter) cost(route, method string) float64 {
+	if c, ok := rr.costs[route]; ok {
+		if n, ok := c.Methods[method]; ok {
+			return n
+		}
+		if c.Default > 0 {
+			return c.Default
+		}
+	}
+	if n, ok := rr.defCost.Methods[method]; ok {
+		return n
+	}
+	return 1
+}
+
+// SetAllowlist exempts callers from rate limiting on every route, in both
+// the static and the adaptive limiter. Must be called before serving.
+func (rr *RouteRateLimiter) SetAllowlist(a *Allowlist) {
+	rr.allowlist = a
+}
+
+// exempt reports whether a request bypasses rate limiting.
+func (rr *RouteRateLimiter) exempt(r *http.Request) bool {
+	return rr.allowlist.Allows(r)
+}
+
+// For returns the limiter that applies to a route.
+func (rr *RouteRateLimiter) For(route string) *RateLimiter {
+	rr.mu.RLock()
+	defer rr.mu.RUnlock()
+	if rl, ok := rr.routes[route]; ok {
+		return rl
+	}
+	return rr.def
+}
+
+// Middleware returns the rate limiting Middleware, resolving each request's
+// route to pick its limiter.
+func (rr *RouteRateLimiter) Middleware(routeResolver func(path string) string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := routeResolver(r.URL.Path)
+			w, r, done := rr.countRejections(w, r, route)
+			defer done()
+			rl := rr.forRequest(route, r)
+			if rr.rejectBanned(w, r, rl) {
+				return
+			}
+			if rr.exempt(r) {
+				next.ServeHTTP(w, r)
 				return
 			}
+			rl.serve(w, r, next, rr.cost(route, r.Method))
+		})
+	}
+}
+
+// Snapshot returns the buckets of every route-specific limiter, keyed by
+// route. The default limiter is snapshotted separately via its own Snapshot.
+func (rr *RouteRateLimiter) Snapshot() map[string]map[string]BucketState {
+	rr.mu.RLock()
+	defer rr.mu.RUnlock()
+
+	out := make(map[string]map[string]BucketState, len(rr.routes))
+	for route, rl := range rr.routes {
+		out[route] = rl.Snapshot()
+	}
+	return out
+}
+
+// Restore loads snapshotted buckets into route-specific limiters. Routes
+// that no longer have their own limiter are skipped.
+func (rr *RouteRateLimiter) Restore(states map[string]map[string]BucketState) {
+	rr.mu.RLock()
+	defer rr.mu.RUnlock()
+
+	for route, buckets := range states {
+		if rl, ok := rr.routes[route]; ok {
+			rl.Restore(buckets)
+		}
+	}
+}
+
+// BucketState is the persisted form of a single client's limiter. Token
+// bucket and GCRA state are both stored as tokens and a refill time; a
+// sliding window stores its current count in Tokens, the previous window's
+// count in Previous, and the window start in LastRefill.
+type BucketState struct {
+	Algorithm  string    `json:"algorithm,omitempty"` // empty for token bucket
+	Tokens     float64   `json:"tokens"`
+	Previous   float64   `json:"previous,omitempty"`
+	LastRefill time.Time `json:"last_refill"`
+}
+
+// Snapshot returns the current state of every bucket, keyed by client.
+func (rl *RateLimiter) Snapshot() map[string]BucketState {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	out := make(map[string]BucketState, len(rl.buckets))
+	for key, el := range rl.buckets {
+		out[key] = el.Value.(*clientEntry).algo.state()
+	}
+	return out
+}
+
+// Restore loads previously snapshotted buckets. Tokens keep refilling from
+// their saved LastRefill, so downtime is credited exactly as if the gateway
+// had stayed up — but a client that had drained its bucket doesn't get a
+// fresh burst just because the process restarted. State saved under an
+// incompatible algorithm (sliding window vs. the others) starts fresh.
+func (rl *RateLimiter) Restore(states map[string]BucketState) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	// Oldest first, so the most recently active clients end up at the LRU front
+	keys := make([]string, 0, len(states))
+	for key := range states {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return states[keys[i]].LastRefill.Before(states[keys[j]].LastRefill)
+	})
 
-			next.ServeHTTP(w, r)
+	for _, key := range keys {
+		s := states[key]
+		if el, ok := rl.buckets[key]; ok {
+			rl.lru.Remove(el)
+			delete(rl.buckets, key)
+		}
+		rl.touch(key, s.LastRefill, func() limiterAlgo {
+			return newAlgo(rl.algorithm, rl.maxTokens, rl.refillRate, &s)
 		})
 	}
+	rl.evict(time.Now(), rl.maxBuckets)
 }
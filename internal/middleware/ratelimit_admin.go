@@ -0,0 +1,341 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BucketInfo describes one client's bucket in one limiter, for the admin API.
+type BucketInfo struct {
+	Limiter    string    `json:"limiter"`
+	Key        string    `json:"key"`
+	Remaining  float64   `json:"remaining"`
+	Limit      float64   `json:"limit"`
+	RefillRate float64   `json:"refill_rate"` // tokens per second
+	LastSeen   time.Time `json:"last_seen"`
+}
+
+// Ban is a client key cut off from every route until Until.
+type Ban struct {
+	Key   string    `json:"key"`
+	Until time.Time `json:"until"`
+}
+
+// inspect returns up to n buckets, most recently seen first, optionally
+// only those whose key contains match.
+func (rl *RateLimiter) inspect(match string, n int) []BucketInfo {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	var out []BucketInfo
+	for el := rl.lru.Front(); el != nil && len(out) < n; el = el.Next() {
+		e := el.Value.(*clientEntry)
+		if match != "" && !strings.Contains(e.key, match) {
+			continue
+		}
+		remaining, _ := e.algo.quota()
+		out = append(out, BucketInfo{
+			Limiter:    rl.name,
+			Key:        e.key,
+			Remaining:  remaining,
+			Limit:      rl.maxTokens,
+			RefillRate: rl.refillRate,
+			LastSeen:   e.lastSeen,
+		})
+	}
+	return out
+}
+
+// LimiterStatus summarizes one limiter for the admin API: its limits, how
+// many client keys it tracks, and the most recently seen of them.
+type LimiterStatus struct {
+	Name       string       `json:"name"`
+	Limit      float64      `json:"limit"`
+	RefillRate float64      `json:"refill_rate"` // tokens per second
+	ActiveKeys int          `json:"active_keys"`
+	Buckets    []BucketInfo `json:"buckets"`
+}
+
+// status summarizes the limiter with up to n of its buckets.
+func (rl *RateLimiter) status(n int) LimiterStatus {
+	buckets := rl.inspect("", n)
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	return LimiterStatus{
+		Name:       rl.name,
+		Limit:      rl.maxTokens,
+		RefillRate: rl.refillRate,
+		ActiveKeys: len(rl.buckets),
+		Buckets:    buckets,
+	}
+}
+
+// reset drops a client's bucket so its next request starts with a full one.
+func (rl *RateLimiter) reset(key string) bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	el, ok := rl.buckets[key]
+	if !ok {
+		return false
+	}
+	rl.lru.Remove(el)
+	delete(rl.buckets, key)
+	rateLimitBuckets.WithLabelValues(rl.name).Set(float64(len(rl.buckets)))
+	return true
+}
+
+// limiters returns every limiter holding client buckets: the default, the
+// route-specific ones, and any derived by the adaptive limiter.
+func (rr *RouteRateLimiter) limiters() []*RateLimiter {
+	rr.mu.RLock()
+	routes := make([]string, 0, len(rr.routes))
+	for route := range rr.routes {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+	out := []*RateLimiter{rr.def}
+	for _, route := range routes {
+		out = append(out, rr.routes[route])
+	}
+	out = append(out, rr.tierLimiters()...)
+	derived := rr.derived
+	rr.mu.RUnlock()
+
+	if derived != nil {
+		out = append(out, derived()...)
+	}
+	return out
+}
+
+// Inspect lists tracked buckets across all limiters, at most n per limiter.
+// A non-empty match keeps only keys containing it.
+func (rr *RouteRateLimiter) Inspect(match string, n int) []BucketInfo {
+	var out []BucketInfo
+	for _, rl := range rr.limiters() {
+		out = append(out, rl.inspect(match, n)...)
+	}
+	return out
+}
+
+// Status summarizes every limiter, with up to n buckets each.
+func (rr *RouteRateLimiter) Status(n int) []LimiterStatus {
+	var out []LimiterStatus
+	for _, rl := range rr.limiters() {
+		out = append(out, rl.status(n))
+	}
+	return out
+}
+
+// Reset refills a client's buckets in every limiter, returning how many
+// buckets were dropped.
+func (rr *RouteRateLimiter) Reset(key string) int {
+	n := 0
+	for _, rl := range rr.limiters() {
+		if rl.reset(key) {
+			n++
+		}
+	}
+	return n
+}
+
+// Ban rejects every request from a client key for d, allowlisted or not.
+func (rr *RouteRateLimiter) Ban(key string, d time.Duration) Ban {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	until := time.Now().Add(d)
+	rr.bans[key] = until
+	return Ban{Key: key, Until: until}
+}
+
+// Unban lifts a ban early, reporting whether there was one.
+func (rr *RouteRateLimiter) Unban(key string) bool {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	_, ok := rr.bans[key]
+	delete(rr.bans, key)
+	return ok
+}
+
+// Bans returns the active bans, soonest to expire first.
+func (rr *RouteRateLimiter) Bans() []Ban {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+
+	now := time.Now()
+	out := make([]Ban, 0, len(rr.bans))
+	for key, until := range rr.bans {
+		if !now.Before(until) {
+			delete(rr.bans, key)
+			continue
+		}
+		out = append(out, Ban{Key: key, Until: until})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Until.Before(out[j].Until) })
+	return out
+}
+
+// banned returns how long a client key remains banned, if it is.
+func (rr *RouteRateLimiter) banned(key string) (time.Duration, bool) {
+	rr.mu.RLock()
+	until, ok := rr.bans[key]
+	rr.mu.RUnlock()
+	if !ok {
+		return 0, false
+	}
+	left := time.Until(until)
+	return left, left > 0
+}
+
+// rejectBanned writes a 403 if the request's client is banned on this
+// route's limiter key. Reports whether it did.
+func (rr *RouteRateLimiter) rejectBanned(w http.ResponseWriter, r *http.Request, rl *RateLimiter) bool {
+	left, ok := rr.banned(rl.key(r))
+	if !ok {
+		return false
+	}
+	setRetryAfter(w, left)
+	gatewayError(w, r, "forbidden", "Client temporarily banned", http.StatusForbidden)
+	return true
+}
+
+// AdminHandler serves the rate limiter admin API, for support engineers to
+// unblock or cut off a client without redeploying. Keys are limiter keys as
+// listed by GET /buckets (an IP, "key:<hash>", "sub:<subject>", ...) and
+// percent-encoded in paths:
+//   - GET    /status?limit=20           limiters, their active keys, and recent 429s per route
+//   - GET    /buckets?match=&limit=100  tracked buckets per limiter
+//   - POST   /buckets/{key}/reset       refill the client's buckets
+//   - GET    /bans                      active bans
+//   - POST   /bans                      {"key", "duration": "1h"}
+//   - DELETE /bans/{key}                lift a ban
+func (rr *RouteRateLimiter) AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", rr.handleStatus)
+	mux.HandleFunc("/buckets", rr.handleBuckets)
+	mux.HandleFunc("/buckets/", rr.handleBucketReset)
+	mux.HandleFunc("/bans", rr.handleBans)
+	mux.HandleFunc("/bans/", rr.handleUnban)
+	return mux
+}
+
+// queryLimit parses the limit query parameter, def if absent.
+func queryLimit(r *http.Request, def int) (int, bool) {
+	v := r.URL.Query().Get("limit")
+	if v == "" {
+		return def, true
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+func (rr *RouteRateLimiter) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	limit, ok := queryLimit(r, 20)
+	if !ok {
+		http.Error(w, "invalid limit", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"limiters":   rr.Status(limit),
+		"rejections": rr.Rejections(),
+	})
+}
+
+func (rr *RouteRateLimiter) handleBuckets(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	limit, ok := queryLimit(r, 100)
+	if !ok {
+		http.Error(w, "invalid limit", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"buckets": rr.Inspect(r.URL.Query().Get("match"), limit),
+	})
+}
+
+func (rr *RouteRateLimiter) handleBucketReset(w http.ResponseWriter, r *http.Request) {
+	key, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/buckets/"), "/reset")
+	if !ok || key == "" {
+		http.Error(w, "Invalid path", http.StatusBadRequest)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	n := rr.Reset(key)
+	Audit(r, AuditEvent{Event: "ratelimit_reset", Outcome: "allowed", Identity: key})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"key":   key,
+		"reset": n,
+	})
+}
+
+func (rr *RouteRateLimiter) handleBans(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var req struct {
+			Key      string `json:"key"`
+			Duration string `json:"duration"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		d, err := time.ParseDuration(req.Duration)
+		if req.Key == "" || err != nil || d <= 0 {
+			http.Error(w, `"key" and a positive "duration" (e.g. "1h") are required`, http.StatusBadRequest)
+			return
+		}
+		rr.Ban(req.Key, d)
+		Audit(r, AuditEvent{Event: "ratelimit_ban", Outcome: "denied", Identity: req.Key, Reason: fmt.Sprintf("banned for %s", d)})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"bans": rr.Bans(),
+	})
+}
+
+func (rr *RouteRateLimiter) handleUnban(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, "/bans/")
+	if !rr.Unban(key) {
+		http.Error(w, fmt.Sprintf("no ban for %q", key), http.StatusNotFound)
+		return
+	}
+	Audit(r, AuditEvent{Event: "ratelimit_unban", Outcome: "allowed", Identity: key})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"bans": rr.Bans(),
+	})
+}
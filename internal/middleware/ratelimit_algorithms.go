@@ -0,0 +1,172 @@
+package middleware
+
+import (
+	"fmt"
+	"time"
+)
+
+// Rate limiting algorithms
+const (
+	// AlgorithmTokenBucket allows bursts up to max_tokens, refilled at
+	// refill_rate per second (default).
+	AlgorithmTokenBucket = "token_bucket"
+	// AlgorithmSlidingWindow counts requests in a window of
+	// max_tokens/refill_rate seconds, weighting the previous window by how
+	// much of it still overlaps. No burst beyond the window's allowance.
+	AlgorithmSlidingWindow = "sliding_window"
+	// AlgorithmGCRA (generic cell rate algorithm) spaces requests
+	// 1/refill_rate apart, tolerating max_tokens-1 early arrivals. Same
+	// long-run rate as a token bucket, but tracked as a single timestamp
+	// so pacing is exact.
+	AlgorithmGCRA = "gcra"
+)
+
+// limiterAlgo is one client's limiter state under some algorithm. allow
+// admits a request costing cost tokens (1 for a plain request).
+type limiterAlgo interface {
+	allow(cost float64) bool
+	quota() (remaining float64, reset time.Duration)
+	state() BucketState
+}
+
+// validAlgorithm reports whether name is a known algorithm ("" = token
+// bucket) that can enforce the given limits. A token bucket with no refill
+// is a fixed allowance, but sliding windows and GCRA derive their window or
+// emission interval from the rate, so they need a positive rate and room
+// for at least one request.
+func validAlgorithm(name string, maxTokens, refillRate float64) error {
+	switch name {
+	case "", AlgorithmTokenBucket:
+		return nil
+	case AlgorithmSlidingWindow, AlgorithmGCRA:
+		if refillRate <= 0 {
+			return fmt.Errorf("rate limit algorithm %s needs refill_rate > 0, got %v", name, refillRate)
+		}
+		if maxTokens < 1 {
+			return fmt.Errorf("rate limit algorithm %s needs max_tokens >= 1, got %v", name, maxTokens)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown rate limit algorithm %q (want token_bucket, sliding_window, or gcra)", name)
+}
+
+// newAlgo creates a client's limiter state, restored from s if non-nil.
+func newAlgo(algorithm string, maxTokens, refillRate float64, s *BucketState) limiterAlgo {
+	now := time.Now()
+	switch algorithm {
+	case AlgorithmSlidingWindow:
+		w := &slidingWindow{limit: maxTokens, window: windowFor(maxTokens, refillRate), start: now}
+		if s != nil && s.Algorithm == AlgorithmSlidingWindow {
+			w.start, w.curr, w.prev = s.LastRefill, s.Tokens, s.Previous
+		}
+		return w
+
+	case AlgorithmGCRA:
+		g := &gcra{interval: intervalFor(refillRate)}
+		g.tolerance = time.Duration((maxTokens - 1) * float64(g.interval))
+		g.tat = now
+		if s != nil && s.Algorithm != AlgorithmSlidingWindow {
+			// Token bucket and GCRA states are interchangeable: each missing
+			// token is one emission interval the TAT lies ahead
+			g.tat = s.LastRefill.Add(time.Duration((maxTokens - min(s.Tokens, maxTokens)) * float64(g.interval)))
+		}
+		return g
+	}
+
+	b := &bucket{tokens: maxTokens, maxTokens: maxTokens, refillRate: refillRate, lastRefill: now}
+	if s != nil && s.Algorithm != AlgorithmSlidingWindow {
+		b.tokens, b.lastRefill = min(s.Tokens, maxTokens), s.LastRefill
+	}
+	return b
+}
+
+// intervalFor is the emission interval for a rate in requests per second.
+func intervalFor(refillRate float64) time.Duration {
+	if refillRate <= 0 {
+		return time.Duration(1<<63 - 1)
+	}
+	return time.Duration(float64(time.Second) / refillRate)
+}
+
+// windowFor is the sliding window length that allows maxTokens requests at
+// refillRate per second.
+func windowFor(maxTokens, refillRate float64) time.Duration {
+	if refillRate <= 0 {
+		return time.Duration(1<<63 - 1)
+	}
+	return time.Duration(maxTokens / refillRate * float64(time.Second))
+}
+
+func (b *bucket) state() BucketState {
+	return BucketState{Tokens: b.tokens, LastRefill: b.lastRefill}
+}
+
+// slidingWindow is a sliding window counter: the request count of the
+// current fixed window plus the previous window's count weighted by the
+// fraction of it still inside the sliding window.
+type slidingWindow struct {
+	limit  float64
+	window time.Duration
+	start  time.Time // start of the current fixed window
+	prev   float64   // requests counted in the previous window
+	curr   float64   // requests counted in the current window
+}
+
+func (w *slidingWindow) allow(cost float64) bool {
+	now := time.Now()
+	if elapsed := now.Sub(w.start); elapsed >= w.window {
+		w.prev = w.curr
+		if elapsed >= 2*w.window {
+			w.prev = 0 // a whole window passed with no requests
+		}
+		w.curr = 0
+		w.start = now.Add(-(elapsed % w.window))
+	}
+
+	overlap := 1 - float64(now.Sub(w.start))/float64(w.window)
+	if w.prev*overlap+w.curr+cost > w.limit {
+		return false
+	}
+	w.curr += cost
+	return true
+}
+
+func (w *slidingWindow) state() BucketState {
+	return BucketState{Algorithm: AlgorithmSlidingWindow, Tokens: w.curr, Previous: w.prev, LastRefill: w.start}
+}
+
+// gcra tracks the theoretical arrival time (TAT) of the next request.
+// A request is allowed if it isn't earlier than TAT minus the burst tolerance.
+type gcra struct {
+	interval  time.Duration // 1 / rate
+	tolerance time.Duration // (burst - 1) × interval
+	tat       time.Time
+}
+
+func (g *gcra) allow(cost float64) bool {
+	now := time.Now()
+	tat := g.tat
+	if tat.Before(now) {
+		tat = now
+	}
+	// A request costing n is n cells arriving at once: the last of them
+	// must still fall within the tolerance
+	extra := time.Duration((cost - 1) * float64(g.interval))
+	if tat.Add(extra).Sub(now) > g.tolerance {
+		return false
+	}
+	g.tat = tat.Add(extra + g.interval)
+	return true
+}
+
+// state expresses the TAT as the equivalent token bucket, so snapshots stay
+// compatible if the algorithm is switched between gcra and token_bucket.
+func (g *gcra) state() BucketState {
+	now := time.Now()
+	ahead := g.tat.Sub(now)
+	if ahead < 0 {
+		ahead = 0
+	}
+	tokens := float64(g.tolerance+g.interval-ahead) / float64(g.interval)
+	return BucketState{Algorithm: AlgorithmGCRA, Tokens: max(tokens, 0), LastRefill: now}
+}
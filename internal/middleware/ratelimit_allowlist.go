@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// Allowlist exempts callers from rate limiting: internal services and
+// monitoring probes by network, or specific API keys. It's checked before
+// any bucket is touched, so exempt traffic never consumes tokens.
+type Allowlist struct {
+	cidrs []*net.IPNet
+	keys  map[string]bool
+}
+
+// NewAllowlist parses the exempt CIDRs (bare IPs are treated as /32 or
+// /128) and API keys.
+func NewAllowlist(cidrs, apiKeys []string) (*Allowlist, error) {
+	nets, err := parseCIDRs(cidrs)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rate limit allowlist %w", err)
+	}
+	keys := make(map[string]bool, len(apiKeys))
+	for _, k := range apiKeys {
+		keys[k] = true
+	}
+	return &Allowlist{cidrs: nets, keys: keys}, nil
+}
+
+// Allows reports whether the request is exempt. A nil Allowlist exempts nobody.
+func (a *Allowlist) Allows(r *http.Request) bool {
+	if a == nil {
+		return false
+	}
+	if key := r.Header.Get("X-API-Key"); key != "" && a.keys[key] {
+		return true
+	}
+	_, ok := remoteIn(r, a.cidrs)
+	return ok
+}
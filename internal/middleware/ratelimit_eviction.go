@@ -0,0 +1,86 @@
+package middleware
+
+import "time"
+
+// Eviction defaults. Without eviction every client ever seen keeps a bucket
+// forever, which leaks memory under scanning traffic.
+const (
+	DefaultIdleTTL    = 10 * time.Minute
+	DefaultMaxBuckets = 100000
+)
+
+// clientEntry is one client's limiter state in the LRU list.
+type clientEntry struct {
+	key      string
+	algo     limiterAlgo
+	lastSeen time.Time
+}
+
+// SetEviction bounds the number of client buckets. Buckets idle for longer
+// than idleTTL are dropped; if more than maxBuckets clients are active, the
+// least recently seen is dropped. An idle bucket is never dropped before it
+// would have fully refilled, so eviction can't hand a client a fresh burst
+// early. Zero values keep the defaults. Must be called before serving.
+func (rl *RateLimiter) SetEviction(idleTTL time.Duration, maxBuckets int) {
+	if idleTTL > 0 {
+		rl.idleTTL = idleTTL
+	}
+	if maxBuckets > 0 {
+		rl.maxBuckets = maxBuckets
+	}
+}
+
+// SetName labels the limiter in the gateway_ratelimit_buckets metric.
+func (rl *RateLimiter) SetName(name string) {
+	rl.name = name
+}
+
+// effectiveTTL is the idle TTL, extended to at least the time a drained
+// bucket needs to refill.
+func (rl *RateLimiter) effectiveTTL() time.Duration {
+	return max(rl.idleTTL, windowFor(rl.maxTokens, rl.refillRate))
+}
+
+// touch returns a client's entry, creating it if needed, and marks it as
+// most recently seen. Idle and excess entries are evicted from the LRU tail
+// first, so the cost is amortized O(1). Must hold rl.mu.
+func (rl *RateLimiter) touch(key string, now time.Time, create func() limiterAlgo) *clientEntry {
+	if el, ok := rl.buckets[key]; ok {
+		e := el.Value.(*clientEntry)
+		e.lastSeen = now
+		rl.lru.MoveToFront(el)
+		return e
+	}
+
+	rl.evict(now, rl.maxBuckets-1)
+	e := &clientEntry{key: key, algo: create(), lastSeen: now}
+	rl.buckets[key] = rl.lru.PushFront(e)
+	rateLimitBuckets.WithLabelValues(rl.name).Set(float64(len(rl.buckets)))
+	return e
+}
+
+// evict drops idle entries, then the least recently seen until at most
+// limit remain. Must hold rl.mu.
+func (rl *RateLimiter) evict(now time.Time, limit int) {
+	ttl := rl.effectiveTTL()
+	evicted := false
+	for el := rl.lru.Back(); el != nil; el = rl.lru.Back() {
+		e := el.Value.(*clientEntry)
+		if now.Sub(e.lastSeen) < ttl && len(rl.buckets) <= limit {
+			break
+		}
+		rl.lru.Remove(el)
+		delete(rl.buckets, e.key)
+		evicted = true
+	}
+	if evicted {
+		rateLimitBuckets.WithLabelValues(rl.name).Set(float64(len(rl.buckets)))
+	}
+}
+
+// Buckets returns the number of clients currently tracked.
+func (rl *RateLimiter) Buckets() int {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	return len(rl.buckets)
+}
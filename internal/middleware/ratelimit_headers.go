@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RateLimit header modes, following the IETF RateLimit header fields draft
+// (draft-ietf-httpapi-ratelimit-headers) so clients can self-throttle.
+const (
+	// HeadersOff emits no RateLimit fields (default).
+	HeadersOff = "off"
+	// HeadersSeparate emits RateLimit-Limit, RateLimit-Remaining,
+	// RateLimit-Reset, and RateLimit-Policy.
+	HeadersSeparate = "separate"
+	// HeadersCombined emits the single structured RateLimit field plus
+	// RateLimit-Policy, as in later revisions of the draft.
+	HeadersCombined = "combined"
+)
+
+// quota is a client's standing with a limiter after a request.
+type quota struct {
+	limit     float64       // requests allowed per window (burst size)
+	remaining float64       // requests left right now
+	reset     time.Duration // until the allowance is fully restored
+	window    time.Duration // policy window: limit / refill rate
+}
+
+// SetHeaders selects which RateLimit header fields are sent: HeadersOff
+// (default), HeadersSeparate, or HeadersCombined. Must be called before serving.
+func (rl *RateLimiter) SetHeaders(mode string) error {
+	switch mode {
+	case "", HeadersOff:
+		rl.headers = ""
+	case HeadersSeparate, HeadersCombined:
+		rl.headers = mode
+	default:
+		return fmt.Errorf("unknown rate limit headers mode %q (want off, separate, or combined)", mode)
+	}
+	return nil
+}
+
+// writeHeaders sets the configured RateLimit fields for q.
+func (rl *RateLimiter) writeHeaders(w http.ResponseWriter, q quota) {
+	if rl.headers == "" {
+		return
+	}
+
+	limit := int(q.limit)
+	remaining := int(math.Max(math.Floor(q.remaining), 0))
+	reset := int(math.Ceil(q.reset.Seconds()))
+	window := int(math.Ceil(q.window.Seconds()))
+
+	h := w.Header()
+	if rl.headers == HeadersCombined {
+		h.Set("RateLimit", fmt.Sprintf(`"default";r=%d;t=%d`, remaining, reset))
+		h.Set("RateLimit-Policy", fmt.Sprintf(`"default";q=%d;w=%d`, limit, window))
+		return
+	}
+	h.Set("RateLimit-Limit", strconv.Itoa(limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(remaining))
+	h.Set("RateLimit-Reset", strconv.Itoa(reset))
+	h.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", limit, window))
+}
+
+func (b *bucket) quota() (remaining float64, reset time.Duration) {
+	if b.refillRate <= 0 {
+		return b.tokens, 0
+	}
+	return b.tokens, time.Duration((b.maxTokens - b.tokens) / b.refillRate * float64(time.Second))
+}
+
+func (w *slidingWindow) quota() (remaining float64, reset time.Duration) {
+	now := time.Now()
+	overlap := 1 - float64(now.Sub(w.start))/float64(w.window)
+	// Requests in the current window age out once it slides past them
+	return w.limit - (w.prev*overlap + w.curr), w.start.Add(w.window).Sub(now)
+}
+
+func (g *gcra) quota() (remaining float64, reset time.Duration) {
+	ahead := time.Until(g.tat)
+	if ahead < 0 {
+		ahead = 0
+	}
+	return float64(g.tolerance+g.interval-ahead) / float64(g.interval), ahead
+}
@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tanmay/gateway/internal/analytics"
+)
+
+// rejectionWindow is how many minutes of 429s are kept per route.
+const rejectionWindow = 15
+
+// RouteRejections is how many requests to a route were rate limited
+// recently, for the admin API.
+type RouteRejections struct {
+	Route         string `json:"route"`
+	LastMinute    int    `json:"last_minute"`
+	Last15Minutes int    `json:"last_15_minutes"`
+}
+
+// rejectionCounts counts a route's 429s per minute in a ring, each slot
+// tagged with the minute it holds so stale slots read as zero.
+type rejectionCounts struct {
+	minute [rejectionWindow]int64
+	count  [rejectionWindow]int
+}
+
+// rejectionLog counts rate limit rejections per route over the last
+// rejectionWindow minutes.
+type rejectionLog struct {
+	mu     sync.Mutex
+	routes map[string]*rejectionCounts
+}
+
+func newRejectionLog() *rejectionLog {
+	return &rejectionLog{routes: make(map[string]*rejectionCounts)}
+}
+
+// record counts one rejection for route at now.
+func (l *rejectionLog) record(route string, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	c, ok := l.routes[route]
+	if !ok {
+		c = &rejectionCounts{}
+		l.routes[route] = c
+	}
+	m := now.Unix() / 60
+	i := m % rejectionWindow
+	if c.minute[i] != m {
+		c.minute[i], c.count[i] = m, 0
+	}
+	c.count[i]++
+}
+
+// counts returns each route's recent rejections at now, busiest first.
+// Routes with none in the window are dropped.
+func (l *rejectionLog) counts(now time.Time) []RouteRejections {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	m := now.Unix() / 60
+	out := make([]RouteRejections, 0, len(l.routes))
+	for route, c := range l.routes {
+		r := RouteRejections{Route: route}
+		for i, minute := range c.minute {
+			if m-minute >= rejectionWindow {
+				continue
+			}
+			r.Last15Minutes += c.count[i]
+			if minute == m {
+				r.LastMinute = c.count[i]
+			}
+		}
+		if r.Last15Minutes == 0 {
+			delete(l.routes, route)
+			continue
+		}
+		out = append(out, r)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Last15Minutes != out[j].Last15Minutes {
+			return out[i].Last15Minutes > out[j].Last15Minutes
+		}
+		return out[i].Route < out[j].Route
+	})
+	return out
+}
+
+// countRejections wraps w and r so that, once the request is served, a
+// 429 written by a rate limiter is counted against route. Call the
+// returned func when done.
+func (rr *RouteRateLimiter) countRejections(w http.ResponseWriter, r *http.Request, route string) (http.ResponseWriter, *http.Request, func()) {
+	r, info := analytics.WithResponseInfo(r)
+	wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+	return wrapped, r, func() {
+		if wrapped.statusCode == http.StatusTooManyRequests &&
+			info.GatewayError() == "rate_limited" {
+			rr.rejections.record(route, time.Now())
+		}
+	}
+}
+
+// Rejections returns recent 429 counts per route, busiest first.
+func (rr *RouteRateLimiter) Rejections() []RouteRejections {
+	return rr.rejections.counts(time.Now())
+}
@@ -0,0 +1,522 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tanmay/gateway/internal/analytics"
+)
+
+func TestRouteRateLimiterSeparatesRoutes(t *testing.T) {
+	limits := NewRouteRateLimiter(NewRateLimiter(3, 0))
+	limits.SetRoute("/expensive", NewRateLimiter(1, 0))
+
+	resolver := NewRouteMatcher([]string{"/expensive", "/cheap"}).Resolve
+	handler := limits.Middleware(resolver)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	send := func(path string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = "203.0.113.9:5000"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if got := send("/expensive/report"); got != http.StatusOK {
+		t.Fatalf("Expected first expensive request allowed, got %d", got)
+	}
+	if got := send("/expensive/report"); got != http.StatusTooManyRequests {
+		t.Errorf("Expected route burst of 1 to reject second request, got %d", got)
+	}
+
+	// The expensive route's buckets are separate from the default limiter's
+	for i := 0; i < 3; i++ {
+		if got := send("/cheap/items"); got != http.StatusOK {
+			t.Fatalf("Expected cheap request %d allowed under default burst, got %d", i+1, got)
+		}
+	}
+	if got := send("/cheap/items"); got != http.StatusTooManyRequests {
+		t.Errorf("Expected default burst of 3 to reject fourth request, got %d", got)
+	}
+}
+
+func TestRateLimiterKeyByAPIKey(t *testing.T) {
+	keyFunc, err := NewKeyFunc(KeyByAPIKey, "", NewAuth([]string{"key-a", "key-b"}, "secret"))
+	if err != nil {
+		t.Fatalf("NewKeyFunc: %v", err)
+	}
+	rl := NewRateLimiter(1, 0)
+	rl.SetKeyFunc(keyFunc)
+	handler := rl.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// All requests come through the same NAT address
+	send := func(apiKey string) int {
+		req := httptest.NewRequest(http.MethodGet, "/api", nil)
+		req.RemoteAddr = "198.51.100.1:4000"
+		if apiKey != "" {
+			req.Header.Set("X-API-Key", apiKey)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if got := send("key-a"); got != http.StatusOK {
+		t.Fatalf("Expected key-a allowed, got %d", got)
+	}
+	if got := send("key-b"); got != http.StatusOK {
+		t.Errorf("Expected key-b to have its own bucket, got %d", got)
+	}
+	if got := send("key-a"); got != http.StatusTooManyRequests {
+		t.Errorf("Expected key-a limited, got %d", got)
+	}
+
+	// Unknown keys don't get their own bucket; they share the IP's
+	if got := send("made-up"); got != http.StatusOK {
+		t.Fatalf("Expected first unknown-key request allowed via IP bucket, got %d", got)
+	}
+	if got := send("another-made-up"); got != http.StatusTooManyRequests {
+		t.Errorf("Expected unknown keys to share the IP bucket, got %d", got)
+	}
+}
+
+func TestNewKeyFuncRejectsUnknownStrategy(t *testing.T) {
+	if _, err := NewKeyFunc("cookie", "", NewAuth(nil, "")); err == nil {
+		t.Error("Expected error for unknown key strategy")
+	}
+	if _, err := NewKeyFunc(KeyByHeader, "", NewAuth(nil, "")); err == nil {
+		t.Error("Expected error for header strategy without key_header")
+	}
+}
+
+func TestRateLimiterAlgorithms(t *testing.T) {
+	for _, algorithm := range []string{AlgorithmTokenBucket, AlgorithmSlidingWindow, AlgorithmGCRA} {
+		t.Run(algorithm, func(t *testing.T) {
+			rl := NewRateLimiter(3, 0.001)
+			if err := rl.SetAlgorithm(algorithm); err != nil {
+				t.Fatalf("SetAlgorithm: %v", err)
+			}
+
+			for i := 0; i < 3; i++ {
+				if !rl.allow("client") {
+					t.Fatalf("Expected request %d within limit to be allowed", i+1)
+				}
+			}
+			if rl.allow("client") {
+				t.Error("Expected request over the limit to be rejected")
+			}
+			if !rl.allow("other") {
+				t.Error("Expected another client to have its own allowance")
+			}
+
+			// A snapshot restores into a fresh limiter without resetting the client
+			restored := NewRateLimiter(3, 0.001)
+			restored.SetAlgorithm(algorithm)
+			restored.Restore(rl.Snapshot())
+			if restored.allow("client") {
+				t.Error("Expected restored client to stay limited")
+			}
+		})
+	}
+
+	if err := NewRateLimiter(1, 1).SetAlgorithm("leaky"); err == nil {
+		t.Error("Expected error for unknown algorithm")
+	}
+	for _, algorithm := range []string{AlgorithmSlidingWindow, AlgorithmGCRA} {
+		if err := NewRateLimiter(3, 0).SetAlgorithm(algorithm); err == nil {
+			t.Errorf("Expected %s to refuse refill_rate 0", algorithm)
+		}
+		if err := NewRateLimiter(0.5, 1).SetAlgorithm(algorithm); err == nil {
+			t.Errorf("Expected %s to refuse max_tokens below 1", algorithm)
+		}
+	}
+	if err := NewRateLimiter(3, 0).SetAlgorithm(AlgorithmTokenBucket); err != nil {
+		t.Errorf("Expected a token bucket without refill allowed, got %v", err)
+	}
+}
+
+func TestRateLimiterHeaders(t *testing.T) {
+	rl := NewRateLimiter(2, 1)
+	if err := rl.SetHeaders(HeadersSeparate); err != nil {
+		t.Fatalf("SetHeaders: %v", err)
+	}
+	handler := rl.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api", nil)
+		req.RemoteAddr = "198.51.100.1:4000"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := send()
+	if got := rec.Header().Get("RateLimit-Limit"); got != "2" {
+		t.Errorf("Expected RateLimit-Limit 2, got %q", got)
+	}
+	if got := rec.Header().Get("RateLimit-Remaining"); got != "1" {
+		t.Errorf("Expected RateLimit-Remaining 1, got %q", got)
+	}
+	if got := rec.Header().Get("RateLimit-Policy"); got != "2;w=2" {
+		t.Errorf("Expected RateLimit-Policy 2;w=2, got %q", got)
+	}
+
+	send()
+	rec = send()
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("RateLimit-Remaining"); got != "0" {
+		t.Errorf("Expected RateLimit-Remaining 0 on 429, got %q", got)
+	}
+	if got := rec.Header().Get("RateLimit-Reset"); got != "2" {
+		t.Errorf("Expected RateLimit-Reset 2, got %q", got)
+	}
+}
+
+func TestRateLimiterEvictsLeastRecentlySeen(t *testing.T) {
+	rl := NewRateLimiter(1, 1)
+	rl.SetEviction(time.Hour, 2)
+
+	rl.allow("a")
+	rl.allow("b")
+	rl.allow("a") // a is now the most recently seen
+	rl.allow("c") // over the cap: b goes
+
+	if got := rl.Buckets(); got != 2 {
+		t.Fatalf("Expected 2 buckets after eviction, got %d", got)
+	}
+	if rl.allow("a") {
+		t.Error("Expected a's drained bucket to survive eviction")
+	}
+	snap := rl.Snapshot()
+	if _, ok := snap["b"]; ok {
+		t.Error("Expected least recently seen client b to be evicted")
+	}
+}
+
+func TestRouteRateLimiterAllowlist(t *testing.T) {
+	allowlist, err := NewAllowlist([]string{"10.0.0.0/8"}, []string{"key-monitoring"})
+	if err != nil {
+		t.Fatalf("NewAllowlist: %v", err)
+	}
+	limits := NewRouteRateLimiter(NewRateLimiter(1, 0))
+	limits.SetAllowlist(allowlist)
+
+	handler := limits.Middleware(func(string) string { return "/api" })(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	send := func(remoteAddr, apiKey string) int {
+		req := httptest.NewRequest(http.MethodGet, "/api", nil)
+		req.RemoteAddr = remoteAddr
+		if apiKey != "" {
+			req.Header.Set("X-API-Key", apiKey)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	for i := 0; i < 3; i++ {
+		if got := send("10.1.2.3:5000", ""); got != http.StatusOK {
+			t.Fatalf("Expected allowlisted network never limited, got %d", got)
+		}
+		if got := send("203.0.113.9:5000", "key-monitoring"); got != http.StatusOK {
+			t.Fatalf("Expected allowlisted API key never limited, got %d", got)
+		}
+	}
+
+	// The exempt API key's requests didn't consume the caller's bucket
+	send("203.0.113.9:5000", "")
+	if got := send("203.0.113.9:5000", ""); got != http.StatusTooManyRequests {
+		t.Errorf("Expected non-exempt caller limited, got %d", got)
+	}
+}
+
+func TestRouteRateLimiterAdmin(t *testing.T) {
+	limiters := NewRouteRateLimiter(NewRateLimiter(1, 0.001))
+	handler := limiters.Middleware(NewRouteMatcher([]string{"/api"}).Resolve)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	admin := limiters.AdminHandler()
+
+	send := func(ip string) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/users", nil)
+		req.RemoteAddr = ip + ":5000"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	call := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.RemoteAddr = "127.0.0.1:5000"
+		rec := httptest.NewRecorder()
+		admin.ServeHTTP(rec, req)
+		return rec
+	}
+
+	send("203.0.113.9")
+	if got := send("203.0.113.9"); got != http.StatusTooManyRequests {
+		t.Fatalf("Expected drained bucket to reject, got %d", got)
+	}
+	if rec := call(http.MethodGet, "/buckets?match=203.0", ""); !strings.Contains(rec.Body.String(), `"key":"203.0.113.9"`) {
+		t.Errorf("Expected bucket listed, got %s", rec.Body.String())
+	}
+	if rec := call(http.MethodPost, "/buckets/203.0.113.9/reset", ""); rec.Code != http.StatusOK {
+		t.Fatalf("Expected reset to succeed, got %d", rec.Code)
+	}
+	if got := send("203.0.113.9"); got != http.StatusOK {
+		t.Errorf("Expected reset client allowed again, got %d", got)
+	}
+
+	if rec := call(http.MethodPost, "/bans", `{"key":"198.51.100.7","duration":"1h"}`); rec.Code != http.StatusOK {
+		t.Fatalf("Expected ban to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := send("198.51.100.7"); got != http.StatusForbidden {
+		t.Errorf("Expected banned client rejected with 403, got %d", got)
+	}
+	if rec := call(http.MethodDelete, "/bans/198.51.100.7", ""); rec.Code != http.StatusOK {
+		t.Fatalf("Expected unban to succeed, got %d", rec.Code)
+	}
+	if got := send("198.51.100.7"); got != http.StatusOK {
+		t.Errorf("Expected unbanned client allowed, got %d", got)
+	}
+}
+
+func TestRouteRateLimiterStatus(t *testing.T) {
+	limiters := NewRouteRateLimiter(NewRateLimiter(1, 0.001))
+	handler := limiters.Middleware(NewRouteMatcher([]string{"/api", "/web"}).Resolve)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/web") {
+			// A backend's own 429 is not the rate limiter's
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	for range 3 {
+		req := httptest.NewRequest(http.MethodGet, "/api/users", nil)
+		req.RemoteAddr = "203.0.113.9:5000"
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/web/home", nil)
+	req.RemoteAddr = "198.51.100.7:5000"
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	want := []RouteRejections{{Route: "/api", LastMinute: 2, Last15Minutes: 2}}
+	if got := limiters.Rejections(); !slices.Equal(got, want) {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+	status := limiters.Status(10)
+	if len(status) != 1 || status[0].ActiveKeys != 2 || len(status[0].Buckets) != 2 {
+		t.Errorf("Expected the default limiter with 2 active keys, got %+v", status)
+	}
+}
+
+func TestRouteRateLimiterRequestCost(t *testing.T) {
+	for _, algo := range []string{AlgorithmTokenBucket, AlgorithmSlidingWindow, AlgorithmGCRA} {
+		t.Run(algo, func(t *testing.T) {
+			def := NewRateLimiter(10, 0.001)
+			def.SetAlgorithm(algo)
+			limits := NewRouteRateLimiter(def)
+			limits.SetCost("/search", RequestCost{Default: 6, Methods: map[string]float64{"HEAD": 1}})
+			limits.SetDefaultCost(RequestCost{Methods: map[string]float64{"POST": 3}})
+
+			resolver := NewRouteMatcher([]string{"/search", "/items"}).Resolve
+			handler := limits.Middleware(resolver)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+			send := func(method, path string) int {
+				req := httptest.NewRequest(method, path, nil)
+				req.RemoteAddr = "203.0.113.9:5000"
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, req)
+				return rec.Code
+			}
+
+			// Both routes share one bucket of 10: 6 + 3 + 1 spends it exactly
+			if got := send(http.MethodGet, "/search?q=x"); got != http.StatusOK {
+				t.Fatalf("Expected search allowed, got %d", got)
+			}
+			if got := send(http.MethodPost, "/items"); got != http.StatusOK {
+				t.Fatalf("Expected POST allowed, got %d", got)
+			}
+			if got := send(http.MethodHead, "/search"); got != http.StatusOK {
+				t.Fatalf("Expected cheap HEAD allowed, got %d", got)
+			}
+			if got := send(http.MethodGet, "/items"); got != http.StatusTooManyRequests {
+				t.Errorf("Expected bucket spent, got %d", got)
+			}
+		})
+	}
+}
+
+func TestRateLimiterResizeKeepsBucketState(t *testing.T) {
+	for _, algo := range []string{AlgorithmTokenBucket, AlgorithmSlidingWindow, AlgorithmGCRA} {
+		t.Run(algo, func(t *testing.T) {
+			rl := NewRateLimiter(4, 0.001)
+			rl.SetAlgorithm(algo)
+			for i := 0; i < 4; i++ {
+				rl.allow("drained")
+			}
+			rl.allow("half")
+			rl.allow("half")
+
+			// Doubling the limit doubles what's left, but doesn't refill
+			rl.resize(8, 0.002)
+			if rl.allow("drained") {
+				t.Errorf("Expected drained client to stay throttled after resize")
+			}
+			allowed := 0
+			for i := 0; i < 8; i++ {
+				if rl.allow("half") {
+					allowed++
+				}
+			}
+			if allowed != 4 {
+				t.Errorf("Expected half-used client to keep half of the new limit (4), got %d", allowed)
+			}
+		})
+	}
+}
+
+func TestRouteRateLimiterTiers(t *testing.T) {
+	auth := NewAuth(nil, "")
+	auth.AddAPIKey("gw_free-key-0001", Grant{Tier: "free"}, time.Time{})
+	auth.AddAPIKey("gw_ent-key-00001", Grant{Tier: "enterprise"}, time.Time{})
+
+	keyFunc, _ := NewKeyFunc(KeyByAPIKey, "", auth)
+	tierLimiter := func(burst float64) *RateLimiter {
+		rl := NewRateLimiter(burst, 0.001)
+		rl.SetKeyFunc(keyFunc)
+		return rl
+	}
+	limits := NewRouteRateLimiter(tierLimiter(3))
+	limits.SetTier("free", tierLimiter(1))
+	limits.SetTier("enterprise", tierLimiter(5))
+	limits.SetTierFunc(func(r *http.Request) string { return auth.KeyTier(r.Header.Get("X-API-Key")) })
+
+	handler := limits.Middleware(NewRouteMatcher([]string{"/api"}).Resolve)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	allowed := func(key string) int {
+		n := 0
+		for i := 0; i < 10; i++ {
+			req := httptest.NewRequest(http.MethodGet, "/api/items", nil)
+			req.Header.Set("X-API-Key", key)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code == http.StatusOK {
+				n++
+			}
+		}
+		return n
+	}
+
+	for key, want := range map[string]int{"gw_free-key-0001": 1, "gw_ent-key-00001": 5, "gw_bogus-key-001": 3} {
+		if got := allowed(key); got != want {
+			t.Errorf("Key %s: expected %d requests allowed, got %d", key, want, got)
+		}
+	}
+
+	q := NewQuotaManager(QuotaLimits{Daily: 100})
+	q.SetTier("free", QuotaLimits{Daily: 10})
+	q.SetTierFunc(auth.KeyTier)
+	if s := q.Usage("gw_free-key-0001"); len(s) != 1 || s[0].Limit != 10 {
+		t.Errorf("Expected free tier quota of 10, got %+v", s)
+	}
+	if s := q.Usage("gw_ent-key-00001"); len(s) != 1 || s[0].Limit != 100 {
+		t.Errorf("Expected default quota of 100 for a tier without one, got %+v", s)
+	}
+}
+
+func TestRouteRateLimiterAnonymous(t *testing.T) {
+	auth := NewAuth([]string{"key-abc"}, "")
+	auth.SetRouteAuth("/catalog", AuthAnonymous)
+	limits := NewRouteRateLimiter(NewRateLimiter(5, 0.001))
+	limits.SetAnonymous(NewRateLimiter(2, 0.001), []string{"/catalog"})
+
+	resolver := NewRouteMatcher([]string{"/catalog", "/api"}).Resolve
+	var anonymous []bool
+	handler := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		anonymous = append(anonymous, r.Header.Get(HeaderAnonymous) == "true")
+	}), limits.Middleware(resolver), auth.Middleware(resolver))
+	send := func(path, apiKey string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = "203.0.113.9:5000"
+		if apiKey != "" {
+			req.Header.Set("X-API-Key", apiKey)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if got := send("/api/items", ""); got != http.StatusUnauthorized {
+		t.Errorf("Expected credentials required outside anonymous routes, got %d", got)
+	}
+	for i := 0; i < 2; i++ {
+		if got := send("/catalog/items", ""); got != http.StatusOK {
+			t.Fatalf("Expected anonymous request %d allowed, got %d", i, got)
+		}
+	}
+	if got := send("/catalog/items", ""); got != http.StatusTooManyRequests {
+		t.Errorf("Expected the anonymous limit to be spent, got %d", got)
+	}
+	if got := send("/catalog/items", "key-abc"); got != http.StatusOK {
+		t.Errorf("Expected keyed callers to use the regular limit, got %d", got)
+	}
+	if got := send("/catalog/items", "key-wrong"); got != http.StatusUnauthorized {
+		t.Errorf("Expected bad credentials refused on anonymous routes, got %d", got)
+	}
+	if want := []bool{true, true, false}; !slices.Equal(anonymous, want) {
+		t.Errorf("Expected anonymous tags %v, got %v", want, anonymous)
+	}
+}
+
+func TestAdaptiveRateLimiterHardCapBoundsTotal(t *testing.T) {
+	store := analytics.NewMemoryTrafficStore(time.Hour, time.Millisecond)
+	analyzer := analytics.NewAnalyzer(store, analytics.AnalyzerConfig{Window: time.Millisecond})
+	time.Sleep(2 * time.Millisecond) // past the learning window
+
+	static := NewRouteRateLimiter(NewRateLimiter(1000, 0))
+	adaptive := NewAdaptiveRateLimiter(static, analyzer, AdaptiveRateLimitConfig{Enabled: true, HardMultiplier: 2})
+	// Install a soft limit of 10 with a hard cap of 20 as rebalance would
+	adaptive.routeLimiters["/api"] = static.For("/api").derive(10, 0)
+	adaptive.hardLimiters["/api"] = static.For("/api").derive(20, 0)
+	adaptive.lastRebalance = time.Now()
+
+	resolver := NewRouteMatcher([]string{"/api"}).Resolve
+	handler := adaptive.Middleware(resolver)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	var admitted, soft int
+	for range 50 {
+		req := httptest.NewRequest(http.MethodGet, "/api/items", nil)
+		req.RemoteAddr = "203.0.113.9:5000"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code == http.StatusOK {
+			admitted++
+		}
+		if rec.Header().Get(SoftLimitHeader) != "" {
+			soft++
+		}
+	}
+	if admitted != 20 {
+		t.Errorf("Expected the hard cap of 20 to bound the total admitted, got %d", admitted)
+	}
+	if soft != 10 {
+		t.Errorf("Expected the 10 requests between the soft limit and hard cap tagged, got %d", soft)
+	}
+}
@@ -0,0 +1,115 @@
+package middleware
+
+import (
+	"net/http"
+	"sort"
+)
+
+// SetTier gives API keys of a tier (a commercial plan such as "free" or
+// "enterprise") their own limiter in place of the shared default, named
+// "tier:<name>" in metrics. Routes with their own limiter keep applying it
+// to every caller, since it protects the backend rather than a plan.
+// Must be called before serving.
+func (rr *RouteRateLimiter) SetTier(tier string, rl *RateLimiter) {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	rl.SetName("tier:" + tier)
+	rr.tiers[tier] = rl
+}
+
+// SetTierFunc sets how a request's tier is found, normally from its API
+// key via Auth.KeyTier. Must be called before serving.
+func (rr *RouteRateLimiter) SetTierFunc(fn func(r *http.Request) string) {
+	rr.tierOf = fn
+}
+
+// SetAnonymous applies rl, a stricter per-IP limiter, to requests without
+// credentials on the given anonymous-mode routes, in place of the limits
+// that would otherwise apply. Must be called before serving.
+func (rr *RouteRateLimiter) SetAnonymous(rl *RateLimiter, routes []string) {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	rl.SetName("anonymous")
+	rr.anonLimiter = rl
+	for _, route := range routes {
+		rr.anonRoutes[route] = true
+	}
+}
+
+// forRequest returns the limiter for a request: the anonymous limiter for
+// anonymous callers, else the route's own, else its key's tier limiter,
+// else the default. Anonymous requests are tagged so rejections show up
+// as anonymous in analytics too.
+func (rr *RouteRateLimiter) forRequest(route string, r *http.Request) *RateLimiter {
+	rr.mu.RLock()
+	defer rr.mu.RUnlock()
+	if rr.anonRoutes[route] && !hasCredentials(r) {
+		markAnonymous(r)
+		return rr.anonLimiter
+	}
+	if rl, ok := rr.routes[route]; ok {
+		return rl
+	}
+	if rr.tierOf != nil {
+		if rl, ok := rr.tiers[rr.tierOf(r)]; ok {
+			return rl
+		}
+	}
+	return rr.def
+}
+
+// tierLimiters returns the tier limiters sorted by tier, then the anonymous
+// limiter if any. Must hold rr.mu.
+func (rr *RouteRateLimiter) tierLimiters() []*RateLimiter {
+	tiers := make([]string, 0, len(rr.tiers))
+	for tier := range rr.tiers {
+		tiers = append(tiers, tier)
+	}
+	sort.Strings(tiers)
+	out := make([]*RateLimiter, 0, len(tiers)+1)
+	for _, tier := range tiers {
+		out = append(out, rr.tiers[tier])
+	}
+	if rr.anonLimiter != nil {
+		out = append(out, rr.anonLimiter)
+	}
+	return out
+}
+
+// TierSnapshot returns the buckets of every tier limiter, keyed by tier.
+func (rr *RouteRateLimiter) TierSnapshot() map[string]map[string]BucketState {
+	rr.mu.RLock()
+	defer rr.mu.RUnlock()
+
+	out := make(map[string]map[string]BucketState, len(rr.tiers))
+	for tier, rl := range rr.tiers {
+		out[tier] = rl.Snapshot()
+	}
+	return out
+}
+
+// TierRestore loads snapshotted buckets into tier limiters. Tiers that no
+// longer exist are skipped.
+func (rr *RouteRateLimiter) TierRestore(states map[string]map[string]BucketState) {
+	rr.mu.RLock()
+	defer rr.mu.RUnlock()
+
+	for tier, buckets := range states {
+		if rl, ok := rr.tiers[tier]; ok {
+			rl.Restore(buckets)
+		}
+	}
+}
+
+// KeyTier returns the tier of an API key, or "" if the key is invalid or
+// has no tier.
+func (a *Auth) KeyTier(key string) string {
+	if key == "" {
+		return ""
+	}
+	k, _ := a.lookupAPIKey(key)
+	if k == nil {
+		return ""
+	}
+	return k.grant.Tier
+}
@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultRetryWindow is how far back the retry budget counts requests
+// and retries unless configured.
+const DefaultRetryWindow = 10 * time.Second
+
+// RetryBudget caps retries per route at a fraction of the route's recent
+// requests, so a struggling backend sees at most that much extra load
+// instead of every client request turning into several. The fraction comes
+// from the route's protection profile; MinRetries keeps low-traffic routes
+// able to retry at all.
+//
+// The proxy consults it before each retry, and the circuit breaker
+// consults it too: an exhausted budget means failures are being hidden by
+// retries, so the breaker trips; and half-open probes are never retried so
+// their verdict reflects the backend.
+type RetryBudget struct {
+	window     time.Duration
+	minRetries int
+	profiles   *ProfileManager
+	mu         sync.Mutex
+	routes     map[string]*outcomeWindow // total = requests, failures = retries
+	denied     map[string]time.Time      // route → last retry refused
+}
+
+// NewRetryBudget creates a budget counting over window (default 10s) that
+// always allows at least minRetries per window.
+func NewRetryBudget(window time.Duration, minRetries int) *RetryBudget {
+	if window <= 0 {
+		window = DefaultRetryWindow
+	}
+	return &RetryBudget{
+		window:     window,
+		minRetries: max(minRetries, 0),
+		routes:     make(map[string]*outcomeWindow),
+		denied:     make(map[string]time.Time),
+	}
+}
+
+// SetProfiles takes each route's retry fraction from its protection
+// profile. Without profiles every route gets the balanced fraction.
+func (b *RetryBudget) SetProfiles(pm *ProfileManager) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.profiles = pm
+}
+
+// counts returns the route's window, creating it on first use. Must hold b.mu.
+func (b *RetryBudget) counts(route string) *outcomeWindow {
+	w, ok := b.routes[route]
+	if !ok {
+		w = newOutcomeWindow(b.window)
+		b.routes[route] = w
+	}
+	return w
+}
+
+// allowance returns how many retries the route may make given its
+// request count. Must hold b.mu.
+func (b *RetryBudget) allowance(route string, requests int) int {
+	return b.minRetries + int(float64(requests)*b.profiles.For(route).RetryBudget)
+}
+
+// Record counts a request to route towards its budget.
+func (b *RetryBudget) Record(route string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.counts(route).add(time.Now(), 1, 0)
+}
+
+// Retry takes a retry from the route's budget, reporting false if the
+// budget is spent or r is a circuit breaker probe.
+func (b *RetryBudget) Retry(route string, r *http.Request) bool {
+	if isProbe(r) {
+		retriesTotal.WithLabelValues(route, "denied").Inc()
+		return false
+	}
+	b.mu.Lock()
+	now := time.Now()
+	w := b.counts(route)
+	requests, retries := w.counts(now)
+	allowed := b.allowance(route, requests)
+	ok := retries < allowed
+	if ok {
+		w.add(now, 0, 1)
+	} else if allowed > 0 {
+		// Only a spent budget counts, not a profile that allows no retries
+		b.denied[route] = now
+	}
+	b.mu.Unlock()
+
+	result := "allowed"
+	if !ok {
+		result = "denied"
+	}
+	retriesTotal.WithLabelValues(route, result).Inc()
+	return ok
+}
+
+// Exhausted reports whether the route ran out of retry budget within the
+// window, i.e. it needed more retries than it was allowed.
+func (b *RetryBudget) Exhausted(route string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	denied, ok := b.denied[route]
+	return ok && time.Since(denied) < b.window
+}
+
+// probeKey marks a request as a half-open circuit breaker probe.
+type probeKey struct{}
+
+// markProbe returns r marked as a breaker probe.
+func markProbe(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), probeKey{}, true))
+}
+
+// isProbe reports whether r is a breaker probe.
+func isProbe(r *http.Request) bool {
+	probe, _ := r.Context().Value(probeKey{}).(bool)
+	return probe
+}
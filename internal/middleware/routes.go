@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"sort"
+	"strings"
+)
+
+// RouteMatcher resolves request paths to their configured route prefix.
+// Shared by every middleware that applies per-route policy so they all
+// agree on which route a request belongs to.
+type RouteMatcher struct {
+	routes []string // known route prefixes, sorted longest-first for matching
+}
+
+// NewRouteMatcher creates a RouteMatcher for the given route prefixes.
+func NewRouteMatcher(prefixes []string) *RouteMatcher {
+	// Sort prefixes longest-first so we match the most specific route
+	sorted := make([]string, len(prefixes))
+	copy(sorted, prefixes)
+	sort.Slice(sorted, func(i, j int) bool {
+		return len(sorted[i]) > len(sorted[j])
+	})
+	return &RouteMatcher{routes: sorted}
+}
+
+// Match returns the route prefix a path belongs to and true,
+// or the raw path and false if no configured route matches.
+func (m *RouteMatcher) Match(path string) (string, bool) {
+	for _, prefix := range m.routes {
+		if strings.HasPrefix(path, prefix+"/") || path == prefix {
+			return prefix, true
+		}
+	}
+	return path, false
+}
+
+// Resolve is Match without the found flag, usable as a routeResolver.
+func (m *RouteMatcher) Resolve(path string) string {
+	route, _ := m.Match(path)
+	return route
+}
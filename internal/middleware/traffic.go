@@ -1,13 +1,16 @@
 package middleware
 
 import (
+	"math"
 	"net"
 	"net/http"
-	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/tanmay/gateway/internal/analytics"
+	"github.com/tanmay/gateway/internal/geoip"
 )
 
 // TrafficRecorder captures per-request metrics and writes them to a TrafficStore
@@ -15,44 +18,218 @@ import (
 type TrafficRecorder struct {
 	events chan analytics.TrafficEvent
 	store  analytics.TrafficStore
-	routes []string // known route prefixes, sorted longest-first for matching
+	routes *RouteMatcher
+
+	// Cardinality guard for paths that match no configured route
+	grouping  string // one of the Unmatched* modes
+	maxRoutes int    // cap on distinct route series (0 = unlimited)
+	seenMu    sync.Mutex
+	seen      map[string]struct{}
+
+	// Sampling, see SetSampling
+	sampleEvery   uint64        // keep one in this many ordinary requests (0 or 1 keeps all)
+	slowThreshold time.Duration // requests at least this slow are always kept (0 = none)
+	sampleSeq     atomic.Uint64
+
+	// GeoIP tagging, see SetGeoIP
+	geoLookup func(ip string) geoip.Location
+	geoStats  *analytics.GeoStats
+
+	pending    atomic.Int64 // events queued but not yet in the store, see Flush
+	received   atomic.Uint64
+	dropped    atomic.Uint64
+	overflowed atomic.Uint64
+	sampledOut atomic.Uint64
 }
 
+// How paths that match no configured route are grouped into series.
+const (
+	UnmatchedGroup        = "group"         // all unmatched paths share one series (default)
+	UnmatchedFirstSegment = "first_segment" // grouped by first path segment, e.g. "/wp-admin"
+	UnmatchedRaw          = "raw"           // raw path (legacy; only safe with a max_routes cap)
+)
+
+// Synthetic route names used when a path can't be attributed to a configured route.
+const (
+	UnmatchedRoute = "(unmatched)"
+	OverflowRoute  = "(overflow)"
+)
+
+// Recording pipeline sizing. The buffer absorbs bursts; workers drain it
+// in batches of up to recorderBatch events, so the store takes each of
+// its shard locks once per batch rather than once per request.
+const (
+	recorderBuffer  = 16384
+	recorderWorkers = 4
+	recorderBatch   = 512
+)
+
 // NewTrafficRecorder creates a TrafficRecorder with the given store and known route prefixes.
-// It starts a background goroutine to drain events into the store.
+// It starts background workers to drain events into the store.
 func NewTrafficRecorder(store analytics.TrafficStore, routePrefixes []string) *TrafficRecorder {
-	// Sort prefixes longest-first so we match the most specific route
-	sorted := make([]string, len(routePrefixes))
-	copy(sorted, routePrefixes)
-	sort.Slice(sorted, func(i, j int) bool {
-		return len(sorted[i]) > len(sorted[j])
-	})
-
 	tr := &TrafficRecorder{
-		events: make(chan analytics.TrafficEvent, 256),
+		events: make(chan analytics.TrafficEvent, recorderBuffer),
 		store:  store,
-		routes: sorted,
+		routes: NewRouteMatcher(routePrefixes),
+
+		grouping:  UnmatchedGroup,
+		maxRoutes: 1000,
+		seen:      make(map[string]struct{}),
 	}
 
-	// Background worker drains events into the store
-	go func() {
-		for event := range tr.events {
-			tr.store.Record(event)
-		}
-	}()
+	for range recorderWorkers {
+		go tr.drain()
+	}
 
 	return tr
 }
 
+// drain records events in batches: it blocks for one event, then takes
+// whatever else is already queued, up to recorderBatch.
+func (tr *TrafficRecorder) drain() {
+	batch := make([]analytics.TrafficEvent, 0, recorderBatch)
+	for event := range tr.events {
+		batch = append(batch[:0], event)
+	fill:
+		for len(batch) < recorderBatch {
+			select {
+			case event, ok := <-tr.events:
+				if !ok {
+					break fill
+				}
+				batch = append(batch, event)
+			default:
+				break fill
+			}
+		}
+		if tr.geoLookup != nil {
+			for i := range batch {
+				loc := tr.geoLookup(batch[i].ClientIP)
+				batch[i].Country, batch[i].ASN, batch[i].ASOrg = loc.Country, loc.ASN, loc.ASOrg
+			}
+			tr.geoStats.RecordBatch(batch)
+		}
+		tr.store.RecordBatch(batch)
+		tr.pending.Add(-int64(len(batch)))
+	}
+}
+
+// Flush waits until the events queued so far are in the store, up to
+// timeout, so a shutdown can close the store without losing them.
+// Reports whether it got there.
+func (tr *TrafficRecorder) Flush(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for tr.pending.Load() > 0 {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return true
+}
+
+// SetRouteGrouping configures how unmatched paths are grouped and the maximum
+// number of distinct route series. Once the cap is reached, new series are
+// folded into OverflowRoute and counted, so scanners hitting random URLs
+// can't grow the TrafficStore and analyzer without bound.
+func (tr *TrafficRecorder) SetRouteGrouping(grouping string, maxRoutes int) {
+	if grouping == "" {
+		grouping = UnmatchedGroup
+	}
+	tr.grouping = grouping
+	tr.maxRoutes = maxRoutes
+}
+
+// SetSampling records only a fraction rate of requests to bound analytics
+// overhead on very busy gateways. Each request kept is weighted to stand
+// for the ones skipped, so counts, rates, and percentiles stay unbiased.
+// Errors (5xx), gateway-generated responses, and requests taking at least
+// slow are always recorded. rate is rounded to one in N. Must be called
+// before serving.
+func (tr *TrafficRecorder) SetSampling(rate float64, slow time.Duration) {
+	tr.sampleEvery = 1
+	if rate > 0 && rate < 1 {
+		tr.sampleEvery = uint64(math.Round(1 / rate))
+	}
+	tr.slowThreshold = slow
+}
+
+// SetGeoIP tags each event with its client's country and ASN and
+// aggregates them into stats. Lookups run in the recording workers, off
+// the request path. Must be called before serving.
+func (tr *TrafficRecorder) SetGeoIP(lookup func(ip string) geoip.Location, stats *analytics.GeoStats) {
+	tr.geoLookup = lookup
+	tr.geoStats = stats
+}
+
+// sample decides whether to record a request, returning the weight to
+// record it with, or 0 to skip it.
+func (tr *TrafficRecorder) sample(status int, latency time.Duration, gatewayGenerated bool) int {
+	if tr.sampleEvery <= 1 || status >= 500 || gatewayGenerated ||
+		(tr.slowThreshold > 0 && latency >= tr.slowThreshold) {
+		return 1
+	}
+	if tr.sampleSeq.Add(1)%tr.sampleEvery != 0 {
+		tr.sampledOut.Add(1)
+		return 0
+	}
+	return int(tr.sampleEvery)
+}
+
 // NormalizeRoute matches a request path to its configured route prefix.
-// Returns the matched prefix (e.g., "/api/v1") or the raw path if no match.
+// Returns the matched prefix (e.g., "/api/v1"); unmatched paths are grouped
+// according to the configured grouping mode.
 func (tr *TrafficRecorder) NormalizeRoute(path string) string {
-	for _, prefix := range tr.routes {
-		if strings.HasPrefix(path, prefix+"/") || path == prefix {
-			return prefix
-		}
+	route, ok := tr.routes.Match(path)
+	if ok {
+		return route
+	}
+
+	switch tr.grouping {
+	case UnmatchedRaw:
+		return path
+	case UnmatchedFirstSegment:
+		segment := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 2)[0]
+		return "/" + segment
+	default:
+		return UnmatchedRoute
+	}
+}
+
+// admitRoute enforces the route cardinality cap. Configured routes and the
+// synthetic series are always admitted; anything new past the cap is
+// accounted as overflow.
+func (tr *TrafficRecorder) admitRoute(route string) string {
+	if tr.maxRoutes <= 0 || route == UnmatchedRoute {
+		return route
+	}
+	if _, ok := tr.routes.Match(route); ok {
+		return route
+	}
+
+	tr.seenMu.Lock()
+	defer tr.seenMu.Unlock()
+	if _, ok := tr.seen[route]; ok {
+		return route
+	}
+	if len(tr.seen) >= tr.maxRoutes {
+		tr.overflowed.Add(1)
+		return OverflowRoute
+	}
+	tr.seen[route] = struct{}{}
+	return route
+}
+
+// Stats returns the recorder's ingestion counters for pipeline self-monitoring.
+func (tr *TrafficRecorder) Stats() analytics.RecorderStats {
+	return analytics.RecorderStats{
+		EventsReceived:  tr.received.Load(),
+		EventsDropped:   tr.dropped.Load(),
+		RoutesOverflow:  tr.overflowed.Load(),
+		SampledOut:      tr.sampledOut.Load(),
+		Backlog:         len(tr.events),
+		BacklogCapacity: cap(tr.events),
 	}
-	return path
 }
 
 // Middleware returns a Middleware that records traffic events for every request.
@@ -60,10 +237,12 @@ func (tr *TrafficRecorder) Middleware() Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
+			r.Header.Del(HeaderAnonymous) // only the gateway may tag requests anonymous
 
 			// Reuse the responseCapture wrapper from capture.go
 			wrapped := &responseCapture{ResponseWriter: w, statusCode: 0}
 
+			r, info := analytics.WithResponseInfo(r)
 			next.ServeHTTP(wrapped, r)
 
 			if wrapped.statusCode == 0 {
@@ -75,21 +254,35 @@ func (tr *TrafficRecorder) Middleware() Middleware {
 				clientIP = r.RemoteAddr
 			}
 
-			backend := w.Header().Get("X-Proxy-Backend")
+			backend := info.Backend()
+			latency := time.Since(start)
+			gatewayGenerated := info.GatewayError() != ""
 
+			tr.received.Add(1)
+			weight := tr.sample(wrapped.statusCode, latency, gatewayGenerated)
+			if weight == 0 {
+				return
+			}
+			tr.pending.Add(1)
 			select {
 			case tr.events <- analytics.TrafficEvent{
-				Route:     tr.NormalizeRoute(r.URL.Path),
+				Route:     tr.admitRoute(tr.NormalizeRoute(r.URL.Path)),
 				Backend:   backend,
 				Status:    wrapped.statusCode,
-				Latency:   time.Since(start),
+				Latency:   latency,
 				BytesIn:   r.ContentLength,
 				BytesOut:  wrapped.bytesWritten,
 				ClientIP:  clientIP,
 				Timestamp: start.UTC(),
+
+				GatewayGenerated: gatewayGenerated,
+				Anonymous:        r.Header.Get(HeaderAnonymous) != "",
+				Weight:           weight,
 			}:
 			default:
 				// Drop event if channel is full rather than blocking the response
+				tr.pending.Add(-1)
+				tr.dropped.Add(1)
 			}
 		})
 	}
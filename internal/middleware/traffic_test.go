@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/tanmay/gateway/internal/analytics"
+)
+
+func TestTrafficRecorderSampling(t *testing.T) {
+	store := analytics.NewMemoryTrafficStore(time.Hour, time.Minute)
+	recorder := NewTrafficRecorder(store, []string{"/api"})
+	recorder.SetSampling(0.1, 0)
+
+	status := http.StatusOK
+	handler := recorder.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	serve := func(n int) {
+		for range n {
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/x", nil))
+		}
+	}
+	serve(1000)
+	status = http.StatusBadGateway
+	serve(7)
+
+	// Give the workers time to drain the channel
+	time.Sleep(50 * time.Millisecond)
+
+	stats := recorder.Stats()
+	if stats.EventsReceived != 1007 {
+		t.Errorf("Expected 1007 events received, got %d", stats.EventsReceived)
+	}
+	if stats.SampledOut != 900 {
+		t.Errorf("Expected 900 requests sampled out, got %d", stats.SampledOut)
+	}
+
+	now := time.Now()
+	var requests, errors int
+	for _, b := range store.GetBuckets("/api", now.Add(-time.Hour), now.Add(time.Minute)) {
+		requests += b.RequestCount
+		errors += b.ErrorCount
+	}
+	if requests != 1007 {
+		t.Errorf("Expected sampled requests to be weighted back to 1007, got %d", requests)
+	}
+	if errors != 7 {
+		t.Errorf("Expected every error to be recorded once, got %d", errors)
+	}
+}
+
+func TestTrafficRecorderTagsGatewayErrorsOutOfBand(t *testing.T) {
+	store := analytics.NewMemoryTrafficStore(time.Hour, time.Minute)
+	recorder := NewTrafficRecorder(store, []string{"/api"})
+
+	handler := recorder.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/limited" {
+			gatewayError(w, r, "rate_limited", "Too Many Requests", http.StatusTooManyRequests)
+			return
+		}
+		// A backend claiming its own error came from the gateway
+		w.Header().Set(analytics.GatewayResponseHeader, "circuit_open")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/limited", nil))
+	if got := rec.Header().Get(analytics.GatewayResponseHeader); got != "" {
+		t.Errorf("Expected no %s header on the client response, got %q", analytics.GatewayResponseHeader, got)
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/forged", nil))
+
+	time.Sleep(50 * time.Millisecond)
+
+	now := time.Now()
+	var requests, errors, rejected int
+	for _, b := range store.GetBuckets("/api", now.Add(-time.Hour), now.Add(time.Minute)) {
+		requests += b.RequestCount
+		errors += b.ErrorCount
+		rejected += b.Rejected
+	}
+	if rejected != 1 {
+		t.Errorf("Expected the gateway's 429 to be counted as rejected, got %d", rejected)
+	}
+	if requests != 1 || errors != 1 {
+		t.Errorf("Expected the backend's 503 in the baselines despite its header, got %d requests, %d errors", requests, errors)
+	}
+}
@@ -0,0 +1,23 @@
+// Package openapi serves the OpenAPI description of the gateway's own
+// endpoints and of the JSON error format used for gateway-generated errors.
+package openapi
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+//go:embed openapi.json
+var spec []byte
+
+// Handler serves the OpenAPI document at GET /openapi.json.
+func Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(spec)
+	}
+}
@@ -0,0 +1,71 @@
+package proxy
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Bulkhead caps concurrent proxied requests per backend, so one slow
+// backend can only tie up its own share of gateway goroutines and
+// connections instead of starving every other route. A request that finds
+// its backend full waits up to the backend's queue timeout for a slot,
+// then is rejected.
+type Bulkhead struct {
+	mu    sync.RWMutex
+	slots map[string]chan struct{} // backend URL → semaphore, capacity = max in flight
+	wait  map[string]time.Duration // backend URL → queue timeout
+}
+
+// NewBulkhead creates a bulkhead with no capped backends.
+func NewBulkhead() *Bulkhead {
+	return &Bulkhead{
+		slots: make(map[string]chan struct{}),
+		wait:  make(map[string]time.Duration),
+	}
+}
+
+// SetBackend caps a backend at max concurrent requests, queueing excess
+// requests for up to wait (0 = reject immediately).
+func (b *Bulkhead) SetBackend(backend string, max int, wait time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.slots[backend] = make(chan struct{}, max)
+	b.wait[backend] = wait
+}
+
+// acquire takes a slot for backend, waiting up to its queue timeout.
+// It returns the function that frees the slot, or false if none came free
+// in time. Uncapped backends always succeed.
+func (b *Bulkhead) acquire(ctx context.Context, backend string) (release func(), ok bool) {
+	b.mu.RLock()
+	sem, capped := b.slots[backend]
+	wait := b.wait[backend]
+	b.mu.RUnlock()
+	if !capped {
+		return func() {}, true
+	}
+
+	select {
+	case sem <- struct{}{}:
+	default:
+		if wait <= 0 {
+			return nil, false
+		}
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case sem <- struct{}{}:
+		case <-timer.C:
+			return nil, false
+		case <-ctx.Done():
+			return nil, false
+		}
+	}
+
+	backendInFlight.WithLabelValues(backend).Inc()
+	return func() {
+		<-sem
+		backendInFlight.WithLabelValues(backend).Dec()
+	}, true
+}
@@ -38,6 +38,20 @@ func (lb *LoadBalancer) AddBackend(url string) {
 	lb.backends = append(lb.backends, url)
 }
 
+// RemoveBackend unregisters a backend URL from this load balancer.
+// Returns false if the backend wasn't registered.
+func (lb *LoadBalancer) RemoveBackend(url string) bool {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	for i, b := range lb.backends {
+		if b == url {
+			lb.backends = append(lb.backends[:i:i], lb.backends[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
 // Next returns the next backend URL based on the load balancing strategy.
 // Skips unhealthy backends if a health checker is configured.
 // Returns empty string if no healthy backends are available.
@@ -56,6 +70,23 @@ func (lb *LoadBalancer) Next() string {
 	}
 }
 
+// GetWeights returns each backend's share of traffic: an equal split
+// among the backends Next currently picks from, 0 for the rest.
+func (lb *LoadBalancer) GetWeights() map[string]float64 {
+	lb.mu.RLock()
+	result := make(map[string]float64, len(lb.backends))
+	for _, b := range lb.backends {
+		result[b] = 0
+	}
+	lb.mu.RUnlock()
+
+	healthy := lb.healthyBackends()
+	for _, b := range healthy {
+		result[b] = 1.0 / float64(len(healthy))
+	}
+	return result
+}
+
 // healthyBackends returns only backends that are currently healthy.
 // If no health checker is configured, returns all backends.
 func (lb *LoadBalancer) healthyBackends() []string {
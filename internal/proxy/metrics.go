@@ -0,0 +1,57 @@
+package proxy
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Prometheus metrics for the proxy layer — registered once at package init via promauto.
+var (
+	// upgradeAttemptsTotal counts protocol upgrade attempts by route, protocol, and outcome.
+	upgradeAttemptsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_upgrade_attempts_total",
+			Help: "Total number of protocol upgrade attempts",
+		},
+		[]string{"route", "protocol", "result"}, // result: allowed, denied
+	)
+
+	// upgradedConnectionsActive tracks currently open upgraded connections.
+	upgradedConnectionsActive = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gateway_upgraded_connections_active",
+			Help: "Number of currently open upgraded (e.g. WebSocket) connections",
+		},
+		[]string{"route", "protocol"},
+	)
+
+	// upgradedConnectionDuration tracks how long upgraded connections stay open.
+	// Kept separate from the request duration histogram so hour-long
+	// WebSockets don't skew regular request latency.
+	upgradedConnectionDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "gateway_upgraded_connection_duration_seconds",
+			Help:    "Lifetime of upgraded connections in seconds",
+			Buckets: []float64{1, 10, 60, 300, 900, 3600, 4 * 3600, 24 * 3600},
+		},
+		[]string{"route", "protocol"},
+	)
+
+	// backendInFlight tracks proxied requests in flight to each bulkheaded backend.
+	backendInFlight = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gateway_backend_inflight_requests",
+			Help: "Proxied requests in flight to backends with max_concurrent",
+		},
+		[]string{"backend"},
+	)
+
+	// bulkheadRejected counts requests rejected because their backend stayed full.
+	bulkheadRejected = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_bulkhead_rejected_total",
+			Help: "Requests rejected because the backend's max_concurrent was reached",
+		},
+		[]string{"backend"},
+	)
+)
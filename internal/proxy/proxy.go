@@ -1,6 +1,7 @@
 package proxy
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
@@ -8,7 +9,11 @@ import (
 	"net/url"
 	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/tanmay/gateway/internal/analytics"
+	"github.com/tanmay/gateway/internal/apierror"
 	"github.com/tanmay/gateway/internal/config"
 	"github.com/tanmay/gateway/internal/health"
 )
@@ -17,9 +22,13 @@ import (
 // Each route gets a backend selector (LoadBalancer or WeightedLoadBalancer).
 // Backends can be added at runtime.
 type Proxy struct {
-	mux    *http.ServeMux
-	routes map[string]BackendSelector // path → backend selector
-	mu     sync.RWMutex              // protects routes map
+	mux      *http.ServeMux
+	routes   map[string]BackendSelector // path → backend selector
+	mu       sync.RWMutex               // protects routes map
+	bulkhead *Bulkhead                  // per-backend concurrency caps
+	inFlight sync.Map                   // backend URL → *atomic.Int64, requests being proxied
+
+	retryBudget RetryBudget // nil disables retries
 }
 
 // NewProxy creates a Proxy that routes requests to backends
@@ -29,40 +38,75 @@ func NewProxy(cfg *config.Config, hc *health.HealthChecker) *Proxy {
 	routes := make(map[string]BackendSelector)
 
 	p := &Proxy{
-		mux:    mux,
-		routes: routes,
+		mux:      mux,
+		routes:   routes,
+		bulkhead: NewBulkhead(),
+	}
+
+	for _, b := range cfg.Backends {
+		if b.MaxConcurrent > 0 {
+			wait, _ := time.ParseDuration(b.QueueTimeout)
+			p.bulkhead.SetBackend(b.URL, b.MaxConcurrent, wait)
+			log.Printf("[init] Bulkhead: %s max_concurrent=%d queue_timeout=%s", b.URL, b.MaxConcurrent, wait)
+		}
 	}
 
 	for _, route := range cfg.Routes {
 		backends := route.GetBackends()
-		lb := NewLoadBalancer(backends, route.Strategy, hc)
-		routes[route.Path] = lb
+		routes[route.Path] = NewLoadBalancer(backends, route.Strategy, hc)
+
+		retries := route.Retries
+		timeout, _ := time.ParseDuration(route.Timeout)
+		idleTimeout, _ := time.ParseDuration(route.IdleTimeout)
+		upgrades := newUpgradePolicy(route.Upgrades)
+		routePath := route.Path
 
-		// Create a handler that picks a backend per-request via the load balancer
+		// Create a handler that picks a backend per-request via the route's
+		// selector, looked up each time since SetRouteSelector may replace it
 		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			backend := lb.Next()
-			if backend == "" {
-				http.Error(w, "No healthy backends available", http.StatusServiceUnavailable)
-				return
+			// Audit and restrict protocol upgrades before picking a backend
+			protocol := requestedUpgrade(r)
+			if protocol != "" {
+				if !upgrades.Allows(protocol) {
+					upgradeAttemptsTotal.WithLabelValues(routePath, protocol, "denied").Inc()
+					log.Printf("[proxy] upgrade denied: route=%s protocol=%s client=%s", routePath, protocol, r.RemoteAddr)
+					gatewayError(w, r, "upgrade_denied", "Upgrade not allowed", http.StatusForbidden)
+					return
+				}
+				upgradeAttemptsTotal.WithLabelValues(routePath, protocol, "allowed").Inc()
+				log.Printf("[proxy] upgrade allowed: route=%s protocol=%s client=%s", routePath, protocol, r.RemoteAddr)
 			}
 
-			targetURL, err := url.Parse(backend)
-			if err != nil {
-				http.Error(w, "Bad backend URL", http.StatusInternalServerError)
-				return
-			}
+			// Enforce the route's request timeout across all attempts,
+			// switching to the idle timeout if the response turns out to be a stream
+			ctx, cancel := context.WithCancel(r.Context())
+			defer cancel()
+			deadline := newRouteDeadline(timeout, idleTimeout, cancel)
+			defer deadline.stop()
 
-			// Create a reverse proxy for the selected backend
-			rp := httputil.NewSingleHostReverseProxy(targetURL)
-			originalDirector := rp.Director
-			rp.Director = func(req *http.Request) {
-				originalDirector(req)
-				req.Header.Set("X-Forwarded-Host", req.Host)
-				req.Header.Set("X-Gateway", "tanmay-gateway")
-				log.Printf("[proxy] %s %s → %s", req.Method, req.URL.Path, backend)
+			// Idempotent requests may be retried on another backend, as
+			// far as the route's retry budget allows
+			budget := p.retryBudget
+			retriesLeft := 0
+			if budget != nil {
+				budget.Record(routePath)
+				if protocol == "" && canRetry(r) {
+					retriesLeft = retries
+				}
+			}
+			retry := func(backend string, err error) bool {
+				if retriesLeft == 0 || deadline.Expired() || ctx.Err() != nil || !budget.Retry(routePath, r) {
+					return false
+				}
+				retriesLeft--
+				log.Printf("[proxy] %s %s → %s failed (%v), retrying", r.Method, r.URL.Path, backend, err)
+				return true
 			}
 
-			rp.ServeHTTP(w, r)
+			lb := p.selector(routePath)
+			dw := &deadlineWriter{ResponseWriter: w, d: deadline}
+			for p.forward(dw, r.WithContext(ctx), lb, routePath, protocol, deadline, retry) {
+			}
 		})
 
 		mux.Handle(route.Path+"/", handler)
@@ -72,8 +116,112 @@ func NewProxy(cfg *config.Config, hc *health.HealthChecker) *Proxy {
 	return p
 }
 
+// forward sends one attempt of a request to the next backend of lb and
+// relays the response, reporting true instead if the attempt failed and
+// retry allowed another one. Nothing has been written to w in that case.
+func (p *Proxy) forward(w *deadlineWriter, r *http.Request, lb BackendSelector, routePath, protocol string, deadline *routeDeadline, retry func(backend string, err error) bool) (retried bool) {
+	backend := lb.Next()
+	if backend == "" {
+		gatewayError(w, r, "no_backends", "No healthy backends available", http.StatusServiceUnavailable)
+		return false
+	}
+
+	// Let the middleware around the proxy (capture, traffic recorder,
+	// circuit breaker) attribute this response to the chosen backend
+	analytics.ResponseInfoFrom(r.Context()).SetBackend(backend)
+
+	// Wait briefly for a slot if the backend is at its concurrency cap
+	release, ok := p.bulkhead.acquire(r.Context(), backend)
+	if !ok {
+		bulkheadRejected.WithLabelValues(backend).Inc()
+		w.Header().Set("Retry-After", "1")
+		gatewayError(w, r, "bulkhead_full", "Backend is at its concurrency limit", http.StatusServiceUnavailable)
+		return false
+	}
+	defer release()
+	n := p.inFlightCounter(backend)
+	n.Add(1)
+	defer n.Add(-1)
+
+	targetURL, err := url.Parse(backend)
+	if err != nil {
+		gatewayError(w, r, "bad_backend", "Bad backend URL", http.StatusInternalServerError)
+		return false
+	}
+
+	// Create a reverse proxy for the selected backend
+	rp := httputil.NewSingleHostReverseProxy(targetURL)
+	originalDirector := rp.Director
+	rp.Director = func(req *http.Request) {
+		originalDirector(req)
+		req.Header.Set("X-Forwarded-Host", req.Host)
+		req.Header.Set("X-Gateway", "tanmay-gateway")
+		log.Printf("[proxy] %s %s → %s", req.Method, req.URL.Path, backend)
+	}
+
+	// Overloaded or unreachable backends are worth another try elsewhere;
+	// the failed response is discarded before anything reaches the client
+	rp.ModifyResponse = func(resp *http.Response) error {
+		resp.Header.Del(analytics.GatewayResponseHeader)
+		if retryableStatus(resp.StatusCode) && retry(backend, fmt.Errorf("status %d", resp.StatusCode)) {
+			retried = true
+			return errRetryableStatus
+		}
+		return nil
+	}
+
+	rp.ErrorHandler = func(w http.ResponseWriter, req *http.Request, err error) {
+		if retried {
+			return
+		}
+		// Not tagged as gateway-generated: these reflect backend
+		// health and belong in error baselines
+		if deadline.Expired() {
+			log.Printf("[proxy] %s %s → %s timed out", req.Method, req.URL.Path, backend)
+			apierror.Write(w, http.StatusGatewayTimeout, apierror.CodeGatewayTimeout, "Gateway Timeout")
+			return
+		}
+		if retry(backend, err) {
+			retried = true
+			return
+		}
+		log.Printf("[proxy] %s %s → %s error: %v", req.Method, req.URL.Path, backend, err)
+		apierror.Write(w, http.StatusBadGateway, apierror.CodeBadGateway, "Bad Gateway")
+	}
+
+	if protocol == "" {
+		rp.ServeHTTP(w, r)
+		return retried
+	}
+
+	// Upgraded connections are tracked separately: ServeHTTP blocks
+	// until the hijacked connection is closed, so it spans the lifetime
+	start := time.Now()
+	upgradedConnectionsActive.WithLabelValues(routePath, protocol).Inc()
+	rp.ServeHTTP(w, r)
+	upgradedConnectionsActive.WithLabelValues(routePath, protocol).Dec()
+	if w.hijacked {
+		lifetime := time.Since(start)
+		upgradedConnectionDuration.WithLabelValues(routePath, protocol).Observe(lifetime.Seconds())
+		log.Printf("[proxy] upgraded connection closed: route=%s protocol=%s lifetime=%s", routePath, protocol, lifetime.Round(time.Millisecond))
+	}
+	return false
+}
+
+// gatewayError writes a JSON error response generated by the gateway itself,
+// tagging the request so traffic analytics can tell it apart from backend errors.
+func gatewayError(w http.ResponseWriter, r *http.Request, reason, message string, code int) {
+	analytics.ResponseInfoFrom(r.Context()).SetGatewayError(reason)
+	apierror.Write(w, code, apierror.CodeFor(reason), message)
+}
+
 // ServeHTTP implements http.Handler by delegating to the internal mux.
+// Paths that match no route get a ROUTE_NOT_FOUND error body.
 func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if _, pattern := p.mux.Handler(r); pattern == "" {
+		gatewayError(w, r, "route_not_found", "No route matches this path", http.StatusNotFound)
+		return
+	}
 	p.mux.ServeHTTP(w, r)
 }
 
@@ -92,14 +240,87 @@ func (p *Proxy) AddBackend(routePath, backendURL string) error {
 	return nil
 }
 
+// RemoveBackend unregisters a backend URL from every route that uses it.
+// Returns the routes it was removed from.
+func (p *Proxy) RemoveBackend(backendURL string) []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	var removed []string
+	for route, selector := range p.routes {
+		if selector.RemoveBackend(backendURL) {
+			removed = append(removed, route)
+		}
+	}
+	sort.Strings(removed)
+	if len(removed) > 0 {
+		log.Printf("[proxy] Backend removed dynamically: %s from %v", backendURL, removed)
+	}
+	return removed
+}
+
+// SetRetryBudget enables retries on routes with retries configured,
+// drawing on b. Must be called before serving.
+func (p *Proxy) SetRetryBudget(b RetryBudget) {
+	p.retryBudget = b
+}
+
 // SetRouteSelector replaces the backend selector for a specific route.
-// Used during startup to swap in a WeightedLoadBalancer when enabled.
+// Used during startup to swap in a WeightedLoadBalancer when enabled;
+// requests already in flight finish on the old one.
 func (p *Proxy) SetRouteSelector(routePath string, selector BackendSelector) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 	p.routes[routePath] = selector
 }
 
+// selector returns the backend selector currently serving a route.
+func (p *Proxy) selector(routePath string) BackendSelector {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.routes[routePath]
+}
+
+// inFlightCounter returns the in-flight request count for backend.
+func (p *Proxy) inFlightCounter(backend string) *atomic.Int64 {
+	if n, ok := p.inFlight.Load(backend); ok {
+		return n.(*atomic.Int64)
+	}
+	n, _ := p.inFlight.LoadOrStore(backend, new(atomic.Int64))
+	return n.(*atomic.Int64)
+}
+
+// RouteBackend is one of a route's backends, with its share of the
+// route's traffic and the requests currently proxied to it.
+type RouteBackend struct {
+	URL      string  `json:"url"`
+	Weight   float64 `json:"weight"`
+	InFlight int64   `json:"in_flight"` // across every route using the backend
+}
+
+// RouteBackends returns a route's backends sorted by URL, or false if
+// there is no such route.
+func (p *Proxy) RouteBackends(routePath string) ([]RouteBackend, bool) {
+	p.mu.RLock()
+	selector, ok := p.routes[routePath]
+	p.mu.RUnlock()
+	if !ok {
+		return nil, false
+	}
+
+	weights := selector.GetWeights()
+	out := make([]RouteBackend, 0, len(weights))
+	for url, w := range weights {
+		out = append(out, RouteBackend{
+			URL:      url,
+			Weight:   w,
+			InFlight: p.inFlightCounter(url).Load(),
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].URL < out[j].URL })
+	return out, true
+}
+
 // RouteNames returns a sorted list of all configured route paths.
 func (p *Proxy) RouteNames() []string {
 	p.mu.RLock()
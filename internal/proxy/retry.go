@@ -0,0 +1,34 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+)
+
+// RetryBudget limits how many failed attempts may be retried, so retries
+// can't multiply the load on a backend that is already failing.
+type RetryBudget interface {
+	// Record counts a request to route.
+	Record(route string)
+	// Retry reports whether r may be retried, taking from the route's budget.
+	Retry(route string, r *http.Request) bool
+}
+
+// errRetryableStatus aborts relaying a response that is being retried.
+var errRetryableStatus = errors.New("retrying backend response")
+
+// retryableStatus reports whether a backend response means "try elsewhere".
+func retryableStatus(code int) bool {
+	return code == http.StatusBadGateway || code == http.StatusServiceUnavailable || code == http.StatusGatewayTimeout
+}
+
+// canRetry reports whether r is safe to send again: an idempotent method
+// with no body to replay.
+func canRetry(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+	default:
+		return false
+	}
+	return r.Body == nil || r.Body == http.NoBody || r.ContentLength == 0
+}
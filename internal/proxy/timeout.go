@@ -0,0 +1,151 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// routeDeadline enforces a route's request timeout and, once the response
+// turns out to be a stream (SSE or an upgraded connection), swaps it for an
+// idle timeout that is pushed back on every read or write.
+// Either duration may be zero to disable that limit.
+type routeDeadline struct {
+	mu        sync.Mutex
+	timer     *time.Timer
+	cancel    context.CancelFunc
+	idle      time.Duration
+	streaming bool
+	expired   bool
+}
+
+// newRouteDeadline starts the request timer. cancel is invoked when either limit is hit.
+func newRouteDeadline(timeout, idle time.Duration, cancel context.CancelFunc) *routeDeadline {
+	d := &routeDeadline{cancel: cancel, idle: idle}
+	if timeout > 0 {
+		d.timer = time.AfterFunc(timeout, d.fire)
+	}
+	return d
+}
+
+// fire marks the deadline as expired and cancels the request context.
+func (d *routeDeadline) fire() {
+	d.mu.Lock()
+	d.expired = true
+	d.mu.Unlock()
+	d.cancel()
+}
+
+// startStreaming drops the request timeout in favor of the idle timeout.
+func (d *routeDeadline) startStreaming() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.streaming {
+		return
+	}
+	d.streaming = true
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+	if d.idle > 0 {
+		d.timer = time.AfterFunc(d.idle, d.fire)
+	}
+}
+
+// touch records stream activity, resetting the idle timer.
+func (d *routeDeadline) touch() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.streaming && d.timer != nil {
+		d.timer.Reset(d.idle)
+	}
+}
+
+// Expired reports whether the request was cut off by one of the limits.
+func (d *routeDeadline) Expired() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.expired
+}
+
+// stop releases the timer once the request has finished.
+func (d *routeDeadline) stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+}
+
+// isStreamingResponse reports whether response headers describe a long-lived stream.
+func isStreamingResponse(h http.Header) bool {
+	return strings.HasPrefix(h.Get("Content-Type"), "text/event-stream")
+}
+
+// deadlineWriter wraps the client ResponseWriter so the routeDeadline can
+// detect streaming responses and observe activity on them.
+type deadlineWriter struct {
+	http.ResponseWriter
+	d        *routeDeadline
+	hijacked bool
+}
+
+// WriteHeader switches to idle-timeout mode for streaming responses.
+func (w *deadlineWriter) WriteHeader(code int) {
+	if isStreamingResponse(w.Header()) {
+		w.d.startStreaming()
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Write counts as stream activity.
+func (w *deadlineWriter) Write(b []byte) (int, error) {
+	w.d.touch()
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher
+func (w *deadlineWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker. An upgraded connection is always a
+// stream, and its reads and writes keep the idle timer alive.
+func (w *deadlineWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	w.hijacked = true
+	w.d.startStreaming()
+	return &idleConn{Conn: conn, d: w.d}, rw, nil
+}
+
+// idleConn resets the idle timer on every read and write of an upgraded connection.
+type idleConn struct {
+	net.Conn
+	d *routeDeadline
+}
+
+func (c *idleConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.d.touch()
+	}
+	return n, err
+}
+
+func (c *idleConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if n > 0 {
+		c.d.touch()
+	}
+	return n, err
+}
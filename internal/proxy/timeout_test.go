@@ -0,0 +1,84 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tanmay/gateway/internal/config"
+)
+
+// newTestGateway fronts backend with a proxy serving route.
+func newTestGateway(t *testing.T, backend http.Handler, route config.Route) string {
+	t.Helper()
+	srv := httptest.NewServer(backend)
+	t.Cleanup(srv.Close)
+	route.Backend = srv.URL
+	gw := httptest.NewServer(NewProxy(&config.Config{Routes: []config.Route{route}}, nil))
+	t.Cleanup(gw.Close)
+	return gw.URL
+}
+
+// stream writes n server-sent events, every interval.
+func stream(n int, interval time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := range n {
+			fmt.Fprintf(w, "data: %d\n\n", i)
+			w.(http.Flusher).Flush()
+			select {
+			case <-time.After(interval):
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}
+}
+
+func TestRouteTimeout(t *testing.T) {
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(2 * time.Second):
+			w.Write([]byte("too late"))
+		case <-r.Context().Done():
+		}
+	})
+
+	tests := []struct {
+		name    string
+		backend http.Handler
+		route   config.Route
+		status  int
+		events  int // server-sent events the client should see
+	}{
+		{"slow response", slow, config.Route{Path: "/api", Timeout: "100ms"}, http.StatusGatewayTimeout, 0},
+		{"no timeout", stream(1, 0), config.Route{Path: "/api"}, http.StatusOK, 1},
+		// 500ms of events outlives the timeout but never idles past 200ms
+		{"active stream", stream(10, 50*time.Millisecond), config.Route{Path: "/api", Timeout: "100ms", IdleTimeout: "200ms"}, http.StatusOK, 10},
+		// Two events, then silence: cut off once idle
+		{"stalled stream", stream(2, 2*time.Second), config.Route{Path: "/api", Timeout: "100ms", IdleTimeout: "200ms"}, http.StatusOK, 1},
+	}
+	for _, tt := range tests {
+		url := newTestGateway(t, tt.backend, tt.route)
+		start := time.Now()
+		resp, err := http.Get(url + "/api/events")
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.status, resp.StatusCode)
+		}
+		if got := strings.Count(string(body), "data: "); got < tt.events {
+			t.Errorf("%s: expected at least %d events, got %d", tt.name, tt.events, got)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("%s: expected the request to end before the backend gave up, took %s", tt.name, elapsed)
+		}
+	}
+}
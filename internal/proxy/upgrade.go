@@ -0,0 +1,49 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+)
+
+// upgradePolicy decides which Upgrade protocols a route lets through.
+type upgradePolicy struct {
+	allowed map[string]bool
+}
+
+// newUpgradePolicy builds a policy from a route's configured protocol list.
+// A nil list allows only WebSocket; ["none"] refuses every upgrade.
+func newUpgradePolicy(protocols []string) upgradePolicy {
+	if protocols == nil {
+		protocols = []string{"websocket"}
+	}
+	allowed := make(map[string]bool, len(protocols))
+	for _, p := range protocols {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if p == "none" {
+			return upgradePolicy{allowed: map[string]bool{}}
+		}
+		allowed[p] = true
+	}
+	return upgradePolicy{allowed: allowed}
+}
+
+// Allows reports whether the given protocol may be upgraded to.
+func (p upgradePolicy) Allows(protocol string) bool {
+	return p.allowed[strings.ToLower(protocol)]
+}
+
+// requestedUpgrade returns the protocol a request is asking to switch to,
+// or "" if it isn't an upgrade request.
+func requestedUpgrade(r *http.Request) string {
+	upgrade := r.Header.Get("Upgrade")
+	if upgrade == "" {
+		return ""
+	}
+	for _, token := range strings.Split(r.Header.Get("Connection"), ",") {
+		if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+			// Only the first offered protocol matters for policy purposes
+			return strings.TrimSpace(strings.Split(upgrade, ",")[0])
+		}
+	}
+	return ""
+}
@@ -0,0 +1,79 @@
+package proxy
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/tanmay/gateway/internal/config"
+)
+
+// echoUpgrade switches to whatever protocol is asked for and echoes the
+// upgraded connection back.
+var echoUpgrade = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: %s\r\nConnection: Upgrade\r\n\r\n", r.Header.Get("Upgrade"))
+	rw.Flush()
+	io.Copy(conn, rw)
+})
+
+func TestUpgradePolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		upgrades []string
+		protocol string
+		allowed  bool
+	}{
+		{"websocket by default", nil, "websocket", true},
+		{"case-insensitive", nil, "WebSocket", true},
+		{"others denied by default", nil, "h2c", false},
+		{"listed protocol", []string{"websocket", "h2c"}, "h2c", true},
+		{"unlisted protocol", []string{"h2c"}, "websocket", false},
+		{"none", []string{"none"}, "websocket", false},
+	}
+	for _, tt := range tests {
+		gw := newTestGateway(t, echoUpgrade, config.Route{Path: "/ws", Upgrades: tt.upgrades})
+		u, _ := url.Parse(gw)
+		conn, err := net.Dial("tcp", u.Host)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+		fmt.Fprintf(conn, "GET /ws/chat HTTP/1.1\r\nHost: %s\r\nUpgrade: %s\r\nConnection: Upgrade\r\n\r\n", u.Host, tt.protocol)
+		br := bufio.NewReader(conn)
+		resp, err := http.ReadResponse(br, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		if !tt.allowed {
+			if resp.StatusCode != http.StatusForbidden {
+				t.Errorf("%s: expected a denied upgrade to get 403, got %d", tt.name, resp.StatusCode)
+			}
+			conn.Close()
+			continue
+		}
+		if resp.StatusCode != http.StatusSwitchingProtocols {
+			t.Errorf("%s: expected 101 Switching Protocols, got %d", tt.name, resp.StatusCode)
+			conn.Close()
+			continue
+		}
+		// The upgraded connection is relayed both ways
+		conn.Write([]byte("ping"))
+		buf := make([]byte, 4)
+		if _, err := io.ReadFull(br, buf); err != nil || string(buf) != "ping" {
+			t.Errorf("%s: expected the backend to echo ping, got %q, %v", tt.name, buf, err)
+		}
+		conn.Close()
+	}
+}
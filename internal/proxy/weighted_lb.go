@@ -15,6 +15,8 @@ import (
 type BackendSelector interface {
 	Next() string
 	AddBackend(url string)
+	RemoveBackend(url string) bool
+	GetWeights() map[string]float64 // every backend's share of traffic
 }
 
 // backendWeight holds the computed weight for a single backend.
@@ -23,15 +25,34 @@ type backendWeight struct {
 	weight float64
 }
 
+// BackendHint carries static, operator-supplied facts about a backend
+// that the analyzer can't learn from traffic alone.
+type BackendHint struct {
+	MaxRate  float64 // requests per minute the backend can comfortably serve (0 = unknown)
+	Capacity float64 // relative instance size multiplier, e.g. 2.0 for a 2× instance (0 = 1.0)
+}
+
+// capacity returns the hint's weight multiplier, defaulting to 1.0.
+func (h BackendHint) capacity() float64 {
+	if h.Capacity <= 0 {
+		return 1.0
+	}
+	return h.Capacity
+}
+
 // WeightedLoadBalancer distributes traffic to backends proportional to their
 // performance: lower latency and lower error rate = more traffic.
 type WeightedLoadBalancer struct {
-	backends      []string
-	mu            sync.RWMutex
-	weights       []backendWeight // sorted by backend URL for stability
-	analyzer      *analytics.Analyzer
-	healthChecker *health.HealthChecker
+	backends          []string
+	mu                sync.RWMutex
+	weights           []backendWeight // sorted by backend URL for stability
+	analyzer          *analytics.Analyzer
+	healthChecker     *health.HealthChecker
 	rebalanceInterval time.Duration
+	hints             map[string]BackendHint // per-backend capacity hints
+
+	stop chan struct{} // closed by Stop
+	done chan struct{} // closed when the rebalancing loop exits
 }
 
 // NewWeightedLoadBalancer creates a performance-weighted load balancer.
@@ -58,6 +79,13 @@ func NewWeightedLoadBalancer(
 	return wlb
 }
 
+// SetBackendHints provides per-backend capacity hints used when computing weights.
+func (wlb *WeightedLoadBalancer) SetBackendHints(hints map[string]BackendHint) {
+	wlb.mu.Lock()
+	defer wlb.mu.Unlock()
+	wlb.hints = hints
+}
+
 // initEqualWeights sets all backends to equal weight.
 func (wlb *WeightedLoadBalancer) initEqualWeights() {
 	wlb.mu.Lock()
@@ -75,19 +103,38 @@ func (wlb *WeightedLoadBalancer) StartRebalancing() {
 	// Initial rebalance
 	wlb.Rebalance()
 
+	wlb.stop = make(chan struct{})
+	wlb.done = make(chan struct{})
 	ticker := time.NewTicker(wlb.rebalanceInterval)
 	go func() {
-		for range ticker.C {
-			wlb.Rebalance()
+		defer close(wlb.done)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				wlb.Rebalance()
+			case <-wlb.stop:
+				return
+			}
 		}
 	}()
 }
 
+// Stop ends periodic rebalancing; the current weights stay in effect.
+func (wlb *WeightedLoadBalancer) Stop() {
+	if wlb.stop != nil {
+		close(wlb.stop)
+		<-wlb.done
+		wlb.stop = nil
+	}
+}
+
 // Rebalance recomputes backend weights based on analyzer data.
 func (wlb *WeightedLoadBalancer) Rebalance() {
 	wlb.mu.RLock()
 	backends := make([]string, len(wlb.backends))
 	copy(backends, wlb.backends)
+	hints := wlb.hints
 	wlb.mu.RUnlock()
 
 	newWeights := make([]backendWeight, 0, len(backends))
@@ -100,7 +147,10 @@ func (wlb *WeightedLoadBalancer) Rebalance() {
 			w = 1.0 // equal weight if no data
 		} else {
 			w = computeWeight(baseline.MeanLatencyMs, baseline.MeanErrorRate)
+			w *= headroomFactor(baseline.CurrentRate, hints[backend].MaxRate)
 		}
+		// A bigger instance with the same latency deserves proportionally more traffic
+		w *= hints[backend].capacity()
 		newWeights = append(newWeights, backendWeight{url: backend, weight: w})
 		totalWeight += w
 	}
@@ -116,6 +166,13 @@ func (wlb *WeightedLoadBalancer) Rebalance() {
 	wlb.weights = newWeights
 	wlb.mu.Unlock()
 
+	// Keep a history so weight changes can be lined up with performance
+	recorded := make(map[string]float64, len(newWeights))
+	for _, w := range newWeights {
+		recorded[w.url] = w.weight
+	}
+	wlb.analyzer.RecordWeights(recorded)
+
 	// Log the new weights
 	for _, w := range newWeights {
 		log.Printf("[weighted-lb] %s → weight=%.3f", w.url, w.weight)
@@ -139,6 +196,21 @@ func computeWeight(avgLatencyMs float64, errorRate float64) float64 {
 	return latencyScore * reliabilityScore
 }
 
+// headroomFactor scales a backend's weight down as its recent request rate
+// approaches its configured capacity. Without this, a small backend that is
+// fast only because it is idle keeps winning traffic until it saturates.
+// Returns 1.0 when no capacity hint is configured.
+func headroomFactor(currentRate, maxRate float64) float64 {
+	if maxRate <= 0 {
+		return 1.0
+	}
+	headroom := 1.0 - currentRate/maxRate
+	if headroom < 0.05 {
+		headroom = 0.05 // keep a trickle flowing so we notice when it recovers
+	}
+	return headroom
+}
+
 // Next selects a backend using weighted random selection.
 // Skips unhealthy backends if a health checker is configured.
 func (wlb *WeightedLoadBalancer) Next() string {
@@ -195,6 +267,41 @@ func (wlb *WeightedLoadBalancer) AddBackend(url string) {
 	wlb.weights = append(wlb.weights, backendWeight{url: url, weight: avgWeight})
 }
 
+// RemoveBackend unregisters a backend URL at runtime and renormalizes the
+// remaining weights. Returns false if the backend wasn't registered.
+func (wlb *WeightedLoadBalancer) RemoveBackend(url string) bool {
+	wlb.mu.Lock()
+	defer wlb.mu.Unlock()
+
+	found := false
+	for i, b := range wlb.backends {
+		if b == url {
+			wlb.backends = append(wlb.backends[:i:i], wlb.backends[i+1:]...)
+			found = true
+			break
+		}
+	}
+	if !found {
+		return false
+	}
+
+	var total float64
+	kept := make([]backendWeight, 0, len(wlb.weights))
+	for _, w := range wlb.weights {
+		if w.url != url {
+			kept = append(kept, w)
+			total += w.weight
+		}
+	}
+	if total > 0 {
+		for i := range kept {
+			kept[i].weight /= total
+		}
+	}
+	wlb.weights = kept
+	return true
+}
+
 // GetWeights returns a snapshot of current backend weights (for API/debugging).
 func (wlb *WeightedLoadBalancer) GetWeights() map[string]float64 {
 	wlb.mu.RLock()
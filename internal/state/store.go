@@ -0,0 +1,81 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Store persists small named snapshots of runtime state (rate limiter
+// buckets, circuit breaker state, ...) so they survive a gateway restart.
+type Store interface {
+	// Save serializes v under the given key, replacing any previous snapshot.
+	Save(key string, v interface{}) error
+	// Load deserializes the snapshot stored under key into v.
+	// Returns false if no snapshot exists yet.
+	Load(key string, v interface{}) (bool, error)
+}
+
+// FileStore is a Store that keeps one JSON file per key inside a directory.
+// Writes go to a temp file first and are renamed into place, so a crash
+// mid-write never leaves a truncated snapshot behind.
+type FileStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewFileStore creates a FileStore rooted at dir, creating the directory if needed.
+func NewFileStore(dir string) (*FileStore, error) {
+	if dir == "" {
+		dir = "data/state"
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create state dir: %w", err)
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+// path returns the snapshot file path for a key.
+func (s *FileStore) path(key string) string {
+	return filepath.Join(s.dir, key+".json")
+}
+
+// Save writes the JSON encoding of v to <dir>/<key>.json atomically.
+func (s *FileStore) Save(key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode state %q: %w", key, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tmp := s.path(key) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write state %q: %w", key, err)
+	}
+	if err := os.Rename(tmp, s.path(key)); err != nil {
+		return fmt.Errorf("failed to commit state %q: %w", key, err)
+	}
+	return nil
+}
+
+// Load reads <dir>/<key>.json into v.
+func (s *FileStore) Load(key string, v interface{}) (bool, error) {
+	s.mu.Lock()
+	data, err := os.ReadFile(s.path(key))
+	s.mu.Unlock()
+
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read state %q: %w", key, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return false, fmt.Errorf("failed to decode state %q: %w", key, err)
+	}
+	return true, nil
+}
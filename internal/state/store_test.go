@@ -0,0 +1,115 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type snapshot struct {
+	Tokens map[string]float64 `json:"tokens"`
+	State  string             `json:"state"`
+}
+
+func newTestStore(t *testing.T) *FileStore {
+	t.Helper()
+	s, err := NewFileStore(filepath.Join(t.TempDir(), "nested", "state"))
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	return s
+}
+
+func TestFileStoreRoundTrip(t *testing.T) {
+	s := newTestStore(t)
+	want := snapshot{Tokens: map[string]float64{"10.0.0.1": 4.5}, State: "open"}
+	if err := s.Save("ratelimit", want); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	var got snapshot
+	ok, err := s.Load("ratelimit", &got)
+	if !ok || err != nil {
+		t.Fatalf("Expected the snapshot loaded, got %v, %v", ok, err)
+	}
+	if got.State != want.State || got.Tokens["10.0.0.1"] != 4.5 {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+
+	// Saving again replaces the snapshot
+	if err := s.Save("ratelimit", snapshot{State: "closed"}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	got = snapshot{}
+	if _, err := s.Load("ratelimit", &got); err != nil || got.State != "closed" || got.Tokens != nil {
+		t.Errorf("Expected the newer snapshot, got %+v, %v", got, err)
+	}
+}
+
+func TestFileStoreMissingAndCorrupt(t *testing.T) {
+	s := newTestStore(t)
+	var got snapshot
+	if ok, err := s.Load("breakers", &got); ok || err != nil {
+		t.Errorf("Expected a missing snapshot reported as not found, got %v, %v", ok, err)
+	}
+
+	os.WriteFile(s.path("breakers"), []byte(`{"state": "op`), 0o644)
+	if ok, err := s.Load("breakers", &got); ok || err == nil {
+		t.Errorf("Expected a corrupt snapshot to be an error, got %v, %v", ok, err)
+	}
+}
+
+func TestFileStoreWritesAtomically(t *testing.T) {
+	s := newTestStore(t)
+	if err := s.Save("breakers", snapshot{State: "open"}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	load := func() snapshot {
+		t.Helper()
+		var got snapshot
+		if ok, err := s.Load("breakers", &got); !ok || err != nil {
+			t.Fatalf("Expected the earlier snapshot intact, got %v, %v", ok, err)
+		}
+		return got
+	}
+
+	// A crash mid-write leaves at most a partial temp file, which is ignored
+	os.WriteFile(s.path("breakers")+".tmp", []byte(`{"state": "cl`), 0o644)
+	if got := load(); got.State != "open" {
+		t.Errorf("Expected the partial write ignored, got %+v", got)
+	}
+
+	// A write that fails leaves the existing snapshot alone
+	tmp := s.path("breakers") + ".tmp"
+	os.Remove(tmp)
+	if err := os.Mkdir(tmp, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save("breakers", snapshot{State: "closed"}); err == nil {
+		t.Error("Expected the failed write reported")
+	}
+	if got := load(); got.State != "open" {
+		t.Errorf("Expected the failed write not to touch the snapshot, got %+v", got)
+	}
+
+	// So does a value that can't be encoded
+	if err := s.Save("breakers", make(chan int)); err == nil {
+		t.Error("Expected an unencodable value refused")
+	}
+	if got := load(); got.State != "open" {
+		t.Errorf("Expected the snapshot intact, got %+v", got)
+	}
+
+	// Once writes work again, nothing is left behind but the snapshot
+	os.Remove(tmp)
+	if err := s.Save("breakers", snapshot{State: "closed"}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if got := load(); got.State != "closed" {
+		t.Errorf("Expected the new snapshot, got %+v", got)
+	}
+	entries, _ := os.ReadDir(s.dir)
+	if len(entries) != 1 || entries[0].Name() != "breakers.json" {
+		t.Errorf("Expected only breakers.json in the state dir, got %v", entries)
+	}
+}
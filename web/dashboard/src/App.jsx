@@ -1,8 +1,9 @@
 import { useState } from 'react';
 import useEventStream from './hooks/useEventStream';
-import { startProcess, stopProcess, addProcess, fetchProcessLogs } from './services/api';
+import { startProcess, stopProcess, addProcess, fetchProcessLogs, setBackendDrain } from './services/api';
 import ServicePanel from './components/ServicePanel';
 import MetricsPanel from './components/MetricsPanel';
+import ProfilePanel from './components/ProfilePanel';
 import RequestTable from './components/RequestTable';
 import RequestDetail from './components/RequestDetail';
 import ProcessLogs from './components/ProcessLogs';
@@ -10,6 +11,8 @@ import ProcessLogs from './components/ProcessLogs';
 const emptyMetrics = {
     requests_per_minute: 0,
     avg_latency_ms: 0,
+    p95_latency_ms: 0,
+    p99_latency_ms: 0,
     error_rate: 0,
     healthy_backends: 0,
     total_backends: 0,
@@ -17,8 +20,9 @@ const emptyMetrics = {
     sparklines: { requests: [], latency: [], errors: [] },
 };
 
-export default function App() {
+export default function App({ user, role, onLogout }) {
     const { services, logs, metrics, isConnected, error } = useEventStream();
+    const readOnly = role === 'viewer';
     const [selectedRequest, setSelectedRequest] = useState(null);
     const [showProcessLogs, setShowProcessLogs] = useState(false);
     const [processLogs, setProcessLogs] = useState([]);
@@ -54,6 +58,18 @@ export default function App() {
         }
     };
 
+    const handleDrain = async (svc) => {
+        const action = svc.drained ? 'undrain' : 'drain';
+        const reason = action === 'drain' ? prompt('Reason for draining (optional):') : '';
+        if (reason === null) return; // cancelled
+        try {
+            await setBackendDrain(action, `http://localhost:${svc.port}`, reason);
+        } catch (err) {
+            console.error(`Failed to ${action}:`, err);
+            alert(err.message);
+        }
+    };
+
     const handleToggleProcessLogs = async () => {
         if (showProcessLogs) {
             setShowProcessLogs(false);
@@ -100,15 +116,21 @@ export default function App() {
                     >
                         {showProcessLogs ? 'Hide Logs' : 'Process Logs'}
                     </button>
+                    {onLogout && (
+                        <button className="btn btn-sm" onClick={onLogout} title={`Signed in as ${user} (${role})`}>
+                            Sign out
+                        </button>
+                    )}
                 </div>
             </header>
 
             <main className="app-main">
                 <ServicePanel
                     services={services}
-                    onStart={handleStart}
-                    onStop={handleStop}
-                    onAdd={handleAddBackend}
+                    onStart={readOnly ? null : handleStart}
+                    onStop={readOnly ? null : handleStop}
+                    onAdd={readOnly ? null : handleAddBackend}
+                    onDrain={readOnly ? null : handleDrain}
                 />
 
                 <MetricsPanel
@@ -116,6 +138,8 @@ export default function App() {
                     sparklines={sparklines}
                 />
 
+                <ProfilePanel readOnly={readOnly} />
+
                 {showProcessLogs && (
                     <ProcessLogs
                         logs={processLogs}
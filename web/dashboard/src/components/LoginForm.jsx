@@ -0,0 +1,48 @@
+import { useState } from 'react';
+import { login } from '../services/api';
+
+export default function LoginForm({ oidc, onLogin }) {
+    const [useToken, setUseToken] = useState(false);
+    const [username, setUsername] = useState('');
+    const [password, setPassword] = useState('');
+    const [token, setToken] = useState('');
+    const [error, setError] = useState(null);
+
+    const handleSubmit = async (e) => {
+        e.preventDefault();
+        try {
+            onLogin(await login(useToken ? { token } : { username, password }));
+        } catch (err) {
+            setError(err.message);
+        }
+    };
+
+    return (
+        <div className="app">
+            <main className="app-main login">
+                <form className="card" onSubmit={handleSubmit}>
+                    <div className="card-header">
+                        <span className="card-title">⚡ MicroGate Dashboard</span>
+                    </div>
+                    {useToken ? (
+                        <input className="filter-input" type="password" placeholder="Access token"
+                            value={token} onChange={e => setToken(e.target.value)} autoFocus />
+                    ) : (
+                        <>
+                            <input className="filter-input" placeholder="Username" autoComplete="username"
+                                value={username} onChange={e => setUsername(e.target.value)} autoFocus />
+                            <input className="filter-input" type="password" placeholder="Password" autoComplete="current-password"
+                                value={password} onChange={e => setPassword(e.target.value)} />
+                        </>
+                    )}
+                    {error && <span className="error-text">{error}</span>}
+                    <button className="btn btn-primary" type="submit">Sign in</button>
+                    <button className="btn btn-sm" type="button" onClick={() => setUseToken(!useToken)}>
+                        {useToken ? 'Use a password' : 'Use an access token'}
+                    </button>
+                    {oidc && <a className="btn btn-sm" href="/dashboard/api/login/oidc">Sign in with SSO</a>}
+                </form>
+            </main>
+        </div>
+    );
+}
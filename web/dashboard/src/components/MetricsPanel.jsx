@@ -1,4 +1,5 @@
 export default function MetricsPanel({ metrics, sparklines }) {
+    const span = sparkWindowLabel(sparklines);
     return (
         <div className="card">
             <div className="card-header">
@@ -13,6 +14,7 @@ export default function MetricsPanel({ metrics, sparklines }) {
                     colorClass="good"
                     data={sparklines.requests}
                     color="var(--status-healthy)"
+                    span={span}
                 />
                 <MetricCard
                     label="Avg Latency"
@@ -20,6 +22,12 @@ export default function MetricsPanel({ metrics, sparklines }) {
                     colorClass={metrics.avg_latency_ms < 100 ? 'good' : metrics.avg_latency_ms < 500 ? 'warn' : 'bad'}
                     data={sparklines.latency}
                     color="var(--accent-secondary)"
+                    span={span}
+                />
+                <MetricCard
+                    label="p95 / p99 Latency"
+                    value={`${metrics.p95_latency_ms}ms / ${metrics.p99_latency_ms}ms`}
+                    colorClass={metrics.p99_latency_ms < 500 ? 'good' : metrics.p99_latency_ms < 2000 ? 'warn' : 'bad'}
                 />
                 <MetricCard
                     label="Error Rate"
@@ -27,6 +35,7 @@ export default function MetricsPanel({ metrics, sparklines }) {
                     colorClass={metrics.error_rate < 0.01 ? 'good' : metrics.error_rate < 0.05 ? 'warn' : 'bad'}
                     data={sparklines.errors}
                     color="var(--status-warning)"
+                    span={span}
                 />
                 <MetricCard
                     label="Backends"
@@ -38,9 +47,18 @@ export default function MetricsPanel({ metrics, sparklines }) {
     );
 }
 
-function MetricCard({ label, value, colorClass, data, color }) {
+// sparkWindowLabel describes the span covered by the sparklines, e.g. "last 30m",
+// using the bucket width reported by the gateway.
+function sparkWindowLabel(sparklines) {
+    const seconds = (sparklines.bucket_seconds || 60) * (sparklines.requests.length || 30);
+    if (seconds >= 3600) return `last ${+(seconds / 3600).toFixed(1)}h`;
+    if (seconds >= 60) return `last ${+(seconds / 60).toFixed(1)}m`;
+    return `last ${seconds}s`;
+}
+
+function MetricCard({ label, value, colorClass, data, color, span }) {
     return (
-        <div className="metric-item">
+        <div className="metric-item" title={span}>
             <div className="metric-label">{label}</div>
             <div className={`metric-value ${colorClass}`}>{value}</div>
             {data && <Sparkline data={data} color={color} />}
@@ -0,0 +1,58 @@
+import { useState, useEffect } from 'react';
+import { fetchProfiles, setRouteProfile } from '../services/api';
+
+const PROFILE_ORDER = ['conservative', 'balanced', 'aggressive'];
+
+export default function ProfilePanel({ readOnly }) {
+    const [data, setData] = useState(null);
+
+    useEffect(() => {
+        fetchProfiles().then(setData).catch(() => {});
+    }, []);
+
+    if (!data || !data.routes || data.routes.length === 0) return null;
+
+    const handleChange = async (route, profile) => {
+        try {
+            setData(await setRouteProfile(route, profile));
+        } catch (err) {
+            console.error("Failed to set profile:", err);
+            alert(err.message);
+        }
+    };
+
+    const describe = (name) => {
+        const p = data.profiles[name];
+        if (!p) return '';
+        return `limit ×${p.limit_scale}, breaker threshold ×${p.breaker_threshold_scale}, ` +
+            `open timeout ×${p.breaker_timeout_scale}, retry budget ${(p.retry_budget * 100).toFixed(0)}%`;
+    };
+
+    return (
+        <div className="card">
+            <div className="card-header">
+                <span className="card-title">Protection Profiles</span>
+            </div>
+
+            <div className="service-list">
+                {data.routes.map(({ route, profile }) => (
+                    <div key={route} className="service-item" title={describe(profile)}>
+                        <div className="service-info">
+                            <span className="service-name">{route}</span>
+                            <div className="service-meta">
+                                <span>{describe(profile)}</span>
+                            </div>
+                        </div>
+                        <div className="service-actions">
+                            <select value={profile} disabled={readOnly} onChange={(e) => handleChange(route, e.target.value)}>
+                                {PROFILE_ORDER.map((name) => (
+                                    <option key={name} value={name}>{name}</option>
+                                ))}
+                            </select>
+                        </div>
+                    </div>
+                ))}
+            </div>
+        </div>
+    );
+}
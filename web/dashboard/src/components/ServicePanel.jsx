@@ -1,19 +1,23 @@
 import { useState, useEffect } from 'react';
 import { fetchRoutes } from '../services/api';
 
-export default function ServicePanel({ services, onStart, onStop, onAdd }) {
+export default function ServicePanel({ services, onStart, onStop, onAdd, onDrain }) {
     const [showModal, setShowModal] = useState(false);
     const [selectedLogs, setSelectedLogs] = useState(null);
 
     const getStatusClass = (svc) => {
         if (svc.status === 'crashed') return 'crashed';
         if (svc.status === 'stopped') return 'stopped';
+        if (svc.status === 'starting') return 'starting';
+        if (svc.drained) return 'stopped';
         return svc.healthy ? 'healthy' : 'unhealthy';
     };
 
     const getStatusLabel = (svc) => {
         if (svc.status === 'crashed') return 'crashed';
         if (svc.status === 'stopped') return 'stopped';
+        if (svc.status === 'starting') return 'starting…';
+        if (svc.drained) return 'drained (manual)';
         return svc.healthy ? 'healthy' : 'unhealthy';
     };
 
@@ -33,9 +37,11 @@ export default function ServicePanel({ services, onStart, onStop, onAdd }) {
         <div className="card">
             <div className="card-header">
                 <span className="card-title">Services</span>
-                <button className="btn btn-sm btn-primary" onClick={() => setShowModal(true)}>
-                    + Add Backend
-                </button>
+                {onAdd && (
+                    <button className="btn btn-sm btn-primary" onClick={() => setShowModal(true)}>
+                        + Add Backend
+                    </button>
+                )}
             </div>
 
             <div className="service-list">
@@ -54,16 +60,34 @@ export default function ServicePanel({ services, onStart, onStop, onAdd }) {
                                 {svc.error_rate != null && (
                                     <span>{(svc.error_rate * 100).toFixed(1)}% err</span>
                                 )}
+                                {svc.probe_duration_ms > 0 && (
+                                    <span title="Last health probe duration">
+                                        probe {svc.probe_duration_ms.toFixed(0)}ms
+                                    </span>
+                                )}
                             </div>
+                            {!svc.healthy && svc.status === 'running' && svc.last_error && (
+                                <div className="service-meta" title={svc.last_error}>
+                                    <span>
+                                        {svc.consecutive_failures > 0 && `${svc.consecutive_failures}× failed: `}
+                                        {svc.last_error}
+                                    </span>
+                                </div>
+                            )}
                         </div>
 
                         <div className="service-actions">
-                            {svc.status === 'running' && (
+                            {svc.status === 'running' && onDrain && (
+                                <button className="btn btn-sm" onClick={() => onDrain(svc)}>
+                                    {svc.drained ? 'Undrain' : 'Drain'}
+                                </button>
+                            )}
+                            {(svc.status === 'running' || svc.status === 'starting') && onStop && (
                                 <button className="btn btn-sm btn-danger" onClick={() => onStop(svc.id)}>
                                     Stop
                                 </button>
                             )}
-                            {(svc.status === 'stopped' || svc.status === 'crashed') && (
+                            {(svc.status === 'stopped' || svc.status === 'crashed') && onStart && (
                                 <button className="btn btn-sm btn-success" onClick={() => onStart(svc.id)}>
                                     {svc.status === 'crashed' ? 'Restart' : 'Start'}
                                 </button>
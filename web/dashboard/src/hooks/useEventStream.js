@@ -3,7 +3,7 @@ import { fetchLogs, fetchProcesses, fetchMetrics } from '../services/api';
 
 /**
  * Custom hook to connect to the Server-Sent Events stream
- * and manage real-time state for logs and processes/services.
+ * and manage real-time state for logs, processes/services, and anomalies.
  * 
  * @param {string} url - The URL to the SSE endpoint
  */
@@ -11,6 +11,7 @@ export default function useEventStream(url = '/dashboard/api/stream') {
     const [logs, setLogs] = useState([]);
     const [services, setServices] = useState([]);
     const [metrics, setMetrics] = useState(null);
+    const [anomalies, setAnomalies] = useState([]);
     const [isConnected, setIsConnected] = useState(false);
     const [lastError, setLastError] = useState(null);
 
@@ -95,7 +96,7 @@ export default function useEventStream(url = '/dashboard/api/stream') {
         source.addEventListener('service', (e) => {
             try {
                 const serviceEvent = JSON.parse(e.data);
-                // serviceEvent looks like: { url: "http://localhost:9001", healthy: true }
+                // serviceEvent looks like: { url: "http://localhost:9001", healthy: true, drained: false }
 
                 setServices(prev => {
                     // Find the process this belongs to based on port/URL
@@ -107,7 +108,11 @@ export default function useEventStream(url = '/dashboard/api/stream') {
                     if (idx === -1) return prev; // Not found
 
                     const updated = [...prev];
-                    updated[idx] = { ...updated[idx], healthy: serviceEvent.healthy };
+                    updated[idx] = {
+                        ...updated[idx],
+                        healthy: serviceEvent.healthy,
+                        drained: !!serviceEvent.drained,
+                    };
                     return updated;
                 });
             } catch (err) {
@@ -125,6 +130,26 @@ export default function useEventStream(url = '/dashboard/api/stream') {
             }
         });
 
+        // Listen for anomalies as the analyzer detects them
+        source.addEventListener('anomaly', (e) => {
+            try {
+                const anomaly = JSON.parse(e.data);
+                setAnomalies(prev => [anomaly, ...prev].slice(0, 50));
+            } catch (err) {
+                console.error("Error parsing anomaly event:", err);
+            }
+        });
+
+        // Acknowledgments update the anomaly in place
+        source.addEventListener('anomaly_ack', (e) => {
+            try {
+                const acked = JSON.parse(e.data);
+                setAnomalies(prev => prev.map(a => (a.id === acked.id ? acked : a)));
+            } catch (err) {
+                console.error("Error parsing anomaly_ack event:", err);
+            }
+        });
+
         return () => {
             console.log("Closing SSE connection");
             source.close();
@@ -136,6 +161,7 @@ export default function useEventStream(url = '/dashboard/api/stream') {
         logs,
         services,
         metrics,
+        anomalies,
         isConnected,
         error: lastError
     };
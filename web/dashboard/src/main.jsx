@@ -1,10 +1,38 @@
-import React from 'react';
+import React, { useEffect, useState } from 'react';
 import ReactDOM from 'react-dom/client';
 import App from './App';
+import LoginForm from './components/LoginForm';
+import { fetchSession, logout } from './services/api';
 import './index.css';
 
+// Root shows the login form until the dashboard API accepts us. Gateways
+// without dashboard auth have no session endpoint and go straight in.
+function Root() {
+    const [session, setSession] = useState(undefined);
+
+    useEffect(() => {
+        fetchSession()
+            .then(s => setSession(s || { authenticated: true }))
+            .catch(() => setSession({ authenticated: true }));
+    }, []);
+
+    if (session === undefined) return null;
+    if (!session.authenticated) {
+        return <LoginForm oidc={session.oidc} onLogin={setSession} />;
+    }
+    const handleLogout = async () => {
+        if (session.method === 'oidc') {
+            window.location.href = '/oauth2/logout';
+            return;
+        }
+        await logout();
+        setSession({ authenticated: false, oidc: session.oidc });
+    };
+    return <App user={session.user} role={session.role} onLogout={session.user ? handleLogout : null} />;
+}
+
 ReactDOM.createRoot(document.getElementById('root')).render(
     <React.StrictMode>
-        <App />
+        <Root />
     </React.StrictMode>
 );
@@ -7,15 +7,23 @@ const API_BASE = '/dashboard/api';
  * Fetches recent request logs
  * @param {Object} filters - Optional filters
  * @param {number} filters.limit - Max number of logs to return (default 50)
- * @param {number} filters.status - Filter by HTTP status code
+ * @param {number|string} filters.status - Filter by HTTP status code, or a class like "5xx"
  * @param {string} filters.path - Filter by request path (substring match)
+ * @param {string} filters.method - Filter by HTTP method
+ * @param {string} filters.clientIp - Filter by client IP
+ * @param {string} filters.backend - Filter by backend (substring match)
+ * @param {string} filters.from - Only logs at or after this RFC 3339 time
+ * @param {string} filters.to - Only logs before this RFC 3339 time
+ * @param {string} filters.minLatency - Only logs at least this slow, e.g. "250ms"
+ * @param {string} filters.before - Cursor: only logs older than this log ID or time
+ * @param {string} filters.after - Cursor: only logs newer than this log ID or time
  * @returns {Promise<Array>} Array of RequestLog objects
  */
 export async function fetchLogs(filters = {}) {
-    const params = new URLSearchParams();
+    const params = logFilterParams(filters);
     if (filters.limit) params.append('limit', filters.limit);
-    if (filters.status) params.append('status', filters.status);
-    if (filters.path) params.append('path', filters.path);
+    if (filters.before) params.append('before', filters.before);
+    if (filters.after) params.append('after', filters.after);
 
     const query = params.toString();
     const url = query ? `${API_BASE}/logs?${query}` : `${API_BASE}/logs`;
@@ -28,6 +36,32 @@ export async function fetchLogs(filters = {}) {
     return data.logs || [];
 }
 
+/**
+ * Builds a download link for the buffered logs matching the filters
+ * @param {Object} filters - The same filters as fetchLogs, without limit or cursors
+ * @param {string} format - "ndjson" (default) or "csv"
+ * @returns {string} URL of the export endpoint
+ */
+export function logExportUrl(filters = {}, format = 'ndjson') {
+    const params = logFilterParams(filters);
+    params.append('format', format);
+    return `${API_BASE}/logs/export?${params.toString()}`;
+}
+
+// logFilterParams turns log filters into query parameters
+function logFilterParams(filters) {
+    const params = new URLSearchParams();
+    if (filters.status) params.append('status', filters.status);
+    if (filters.path) params.append('path', filters.path);
+    if (filters.method) params.append('method', filters.method);
+    if (filters.clientIp) params.append('client_ip', filters.clientIp);
+    if (filters.backend) params.append('backend', filters.backend);
+    if (filters.from) params.append('from', filters.from);
+    if (filters.to) params.append('to', filters.to);
+    if (filters.minLatency) params.append('min_latency', filters.minLatency);
+    return params;
+}
+
 /**
  * Fetches a single request log by ID
  * @param {string} id 
@@ -82,6 +116,20 @@ export async function stopProcess(id) {
     }
 }
 
+/**
+ * Removes a managed process and retires its backend from routing and health checks
+ * @param {string} id - The process ID
+ */
+export async function removeProcess(id) {
+    const res = await fetch(`${API_BASE}/processes/${id}`, {
+        method: 'DELETE'
+    });
+    if (!res.ok) {
+        const errText = await res.text();
+        throw new Error(errText || `Failed to remove process: ${res.statusText}`);
+    }
+}
+
 /**
  * Fetches real-time gateway metrics and sparklines
  * @returns {Promise<Object>} Metrics object with sparklines
@@ -94,6 +142,140 @@ export async function fetchMetrics() {
     return res.json();
 }
 
+/**
+ * Fetches a backend's health transitions and uptime over a window
+ * @param {string} backendUrl - Backend URL, e.g. http://localhost:9001
+ * @param {string} window - Go duration, e.g. "1h", "24h", "168h"
+ * @returns {Promise<Object>} { url, window, uptime_percent, transitions }
+ */
+export async function fetchBackendTimeline(backendUrl, window = '24h') {
+    const res = await fetch(`${API_BASE}/backends/${encodeURIComponent(backendUrl)}/timeline?window=${window}`);
+    if (!res.ok) {
+        throw new Error(`Failed to fetch backend timeline: ${res.statusText}`);
+    }
+    return res.json();
+}
+
+/**
+ * Fetches a resource aggregated across federated gateways
+ * @param {string} resource - "metrics", "processes", "health", or "anomalies"
+ * @returns {Promise<Object>} { resource, combined, instances }
+ */
+export async function fetchFederated(resource) {
+    const res = await fetch(`${API_BASE}/federation/${resource}`);
+    if (!res.ok) {
+        throw new Error(`Failed to fetch federated ${resource}: ${res.statusText}`);
+    }
+    return res.json();
+}
+
+/**
+ * Fetches every rate limiter's active keys and recent 429s per route
+ * @returns {Promise<Object>} { limiters: [{ name, limit, refill_rate, active_keys, buckets }], rejections: [{ route, last_minute, last_15_minutes }] }
+ */
+export async function fetchRateLimitStatus() {
+    const res = await fetch(`${API_BASE}/ratelimit/status`);
+    if (!res.ok) {
+        throw new Error(`Failed to fetch rate limit status: ${res.statusText}`);
+    }
+    return res.json();
+}
+
+/**
+ * Fetches tracked rate limit buckets
+ * @param {string} match - Only keys containing this (optional)
+ * @returns {Promise<Object>} { buckets: [{ limiter, key, remaining, limit, refill_rate, last_seen }] }
+ */
+export async function fetchRateLimitBuckets(match = '') {
+    const res = await fetch(`${API_BASE}/ratelimit/buckets?match=${encodeURIComponent(match)}`);
+    if (!res.ok) {
+        throw new Error(`Failed to fetch rate limit buckets: ${res.statusText}`);
+    }
+    return res.json();
+}
+
+/**
+ * Refills a client's rate limit buckets
+ * @param {string} key - The limiter key, as listed by fetchRateLimitBuckets
+ */
+export async function resetRateLimitKey(key) {
+    const res = await fetch(`${API_BASE}/ratelimit/buckets/${encodeURIComponent(key)}/reset`, {
+        method: 'POST'
+    });
+    if (!res.ok) {
+        const errText = await res.text();
+        throw new Error(errText || `Failed to reset rate limit: ${res.statusText}`);
+    }
+}
+
+/**
+ * Temporarily bans a client key from every route
+ * @param {string} key - The limiter key
+ * @param {string} duration - Ban length, e.g. "1h"
+ * @returns {Promise<Object>} { bans }
+ */
+export async function banRateLimitKey(key, duration) {
+    const res = await fetch(`${API_BASE}/ratelimit/bans`, {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json'
+        },
+        body: JSON.stringify({ key, duration })
+    });
+    if (!res.ok) {
+        const errText = await res.text();
+        throw new Error(errText || `Failed to ban key: ${res.statusText}`);
+    }
+    return res.json();
+}
+
+/**
+ * Lifts a ban early
+ * @param {string} key - The banned limiter key
+ */
+export async function unbanRateLimitKey(key) {
+    const res = await fetch(`${API_BASE}/ratelimit/bans/${encodeURIComponent(key)}`, {
+        method: 'DELETE'
+    });
+    if (!res.ok) {
+        const errText = await res.text();
+        throw new Error(errText || `Failed to lift ban: ${res.statusText}`);
+    }
+}
+
+/**
+ * Fetches every circuit breaker's state
+ * @returns {Promise<Object>} { breakers: [{ name, state, failure_count, total_count, last_failure, last_transition, manual }] }
+ */
+export async function fetchCircuitBreakers() {
+    const res = await fetch(`${API_BASE}/circuit-breakers`);
+    if (!res.ok) {
+        throw new Error(`Failed to fetch circuit breakers: ${res.statusText}`);
+    }
+    return res.json();
+}
+
+/**
+ * Manually opens or closes a circuit breaker
+ * @param {string} breaker - "default" or a route with its own breaker
+ * @param {string} action - "open" (stays open until closed) or "close"
+ * @returns {Promise<Object>} { breakers }
+ */
+export async function setCircuitBreaker(breaker, action) {
+    const res = await fetch(`${API_BASE}/circuit-breakers`, {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json'
+        },
+        body: JSON.stringify({ breaker, action })
+    });
+    if (!res.ok) {
+        const errText = await res.text();
+        throw new Error(errText || `Failed to ${action} circuit breaker: ${res.statusText}`);
+    }
+    return res.json();
+}
+
 /**
  * Fetches recent output lines from a managed process
  * @param {string} id - The process ID
@@ -122,6 +304,34 @@ export async function fetchRoutes() {
     return data.routes || [];
 }
 
+/**
+ * Fetches a route's backends with their health, weight, in-flight requests, and recent error rate
+ * @param {string} route - The route path, e.g. /api/v1
+ * @returns {Promise<Object>} { route, backends: [{ url, weight, in_flight, healthy, drained, requests, error_rate }], error_rate_window }
+ */
+export async function fetchRouteBackends(route) {
+    const res = await fetch(`${API_BASE}/routes/${route.replace(/^\//, '')}/backends`);
+    if (!res.ok) {
+        throw new Error(`Failed to fetch route backends: ${res.statusText}`);
+    }
+    return res.json();
+}
+
+/**
+ * Fetches the busiest, slowest (by p95), and most error-prone routes
+ * @param {string} window - Duration to rank over, e.g. '1h'
+ * @param {number} limit - Routes per list
+ * @returns {Promise<Object>} { window, busiest, slowest, most_errors: [{ route, requests, error_rate, p95_latency_ms }] }
+ */
+export async function fetchTopRoutes(window = '1h', limit = 10) {
+    const params = new URLSearchParams({ window, limit });
+    const res = await fetch(`${API_BASE}/top?${params}`);
+    if (!res.ok) {
+        throw new Error(`Failed to fetch top routes: ${res.statusText}`);
+    }
+    return res.json();
+}
+
 /**
  * Adds a new process to be managed by the gateway
  * @param {Object} data
@@ -144,3 +354,111 @@ export async function addProcess(data) {
         throw new Error(errText || `Failed to add process: ${res.statusText}`);
     }
 }
+
+/**
+ * Pauses or resumes active health probing during planned maintenance
+ * @param {'pause'|'resume'} action
+ * @param {string} [backendUrl] - Backend URL; omit to pause/resume all backends
+ * @returns {Promise<Object>} Updated backend statuses and global paused flag
+ */
+export async function setHealthChecking(action, backendUrl) {
+    const url = backendUrl
+        ? `${API_BASE}/backends/${encodeURIComponent(backendUrl)}/${action}`
+        : `${API_BASE}/health/${action}`;
+    const res = await fetch(url, { method: 'POST' });
+    if (!res.ok) {
+        const errText = await res.text();
+        throw new Error(errText || `Failed to ${action} health checks: ${res.statusText}`);
+    }
+    return res.json();
+}
+
+/**
+ * Forces a backend down regardless of probe results (drain), or lifts that (undrain)
+ * @param {'drain'|'undrain'} action
+ * @param {string} backendUrl - Backend URL, e.g. http://localhost:9001
+ * @param {string} [reason] - Optional note shown in /health, e.g. "deploying v2"
+ */
+export async function setBackendDrain(action, backendUrl, reason) {
+    const res = await fetch(`${API_BASE}/backends/${encodeURIComponent(backendUrl)}/${action}`, {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json'
+        },
+        body: action === 'drain' ? JSON.stringify({ reason: reason || '' }) : undefined
+    });
+    if (!res.ok) {
+        const errText = await res.text();
+        throw new Error(errText || `Failed to ${action} backend: ${res.statusText}`);
+    }
+    return res.json();
+}
+
+/**
+ * Fetches protection profiles and each route's current assignment
+ * @returns {Promise<Object>} { profiles: {name: ProtectionProfile}, routes: [{route, profile}] }
+ */
+export async function fetchProfiles() {
+    const res = await fetch(`${API_BASE}/profiles`);
+    if (!res.ok) {
+        throw new Error(`Failed to fetch profiles: ${res.statusText}`);
+    }
+    return res.json();
+}
+
+/**
+ * Switches a route's protection profile (breaker, limiter, and retries together)
+ * @param {string} route - Route path, e.g. /api/v1
+ * @param {string} profile - "conservative", "balanced", or "aggressive"
+ * @returns {Promise<Object>} Updated profiles and assignments
+ */
+export async function setRouteProfile(route, profile) {
+    const res = await fetch(`${API_BASE}/profiles`, {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json'
+        },
+        body: JSON.stringify({ route, profile })
+    });
+    if (!res.ok) {
+        const errText = await res.text();
+        throw new Error(errText || `Failed to set profile: ${res.statusText}`);
+    }
+    return res.json();
+}
+
+/**
+ * Fetches the current dashboard session
+ * @returns {Promise<Object|null>} { authenticated, user, method, oidc }, or null if the gateway has no dashboard auth
+ */
+export async function fetchSession() {
+    const res = await fetch(`${API_BASE}/session`);
+    if (res.status === 404) return null;
+    return res.json();
+}
+
+/**
+ * Logs in to the dashboard with a username and password, or a token
+ * @param {Object} credentials - { username, password } or { token }
+ * @returns {Promise<Object>} The new session
+ */
+export async function login(credentials) {
+    const res = await fetch(`${API_BASE}/login`, {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json'
+        },
+        body: JSON.stringify(credentials)
+    });
+    if (!res.ok) {
+        throw new Error(res.status === 401 ? 'Invalid credentials' : `Login failed: ${res.statusText}`);
+    }
+    return res.json();
+}
+
+/**
+ * Ends the dashboard session
+ */
+export async function logout() {
+    await fetch(`${API_BASE}/logout`, { method: 'POST' });
+}
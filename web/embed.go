@@ -0,0 +1,20 @@
+// Package web embeds the built dashboard frontend, so the gateway binary
+// serves it without web/dashboard/dist on disk.
+package web
+
+import (
+	"embed"
+	"io/fs"
+)
+
+// Build web/dashboard (npm run build) before the gateway so dist has the
+// assets; otherwise only the placeholder is embedded.
+//
+//go:embed all:dashboard/dist
+var dist embed.FS
+
+// Dashboard returns the built frontend, rooted at its index.html.
+func Dashboard() fs.FS {
+	sub, _ := fs.Sub(dist, "dashboard/dist")
+	return sub
+}